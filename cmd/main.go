@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 
 	"github.com/jbctechsolutions/sr-router/config"
 	mcpserver "github.com/jbctechsolutions/sr-router/mcp"
@@ -35,20 +43,7 @@ func main() {
 
 	// resolveConfig returns configDir if set, otherwise searches well-known paths.
 	resolveConfig := func() string {
-		if configDir != "" {
-			return configDir
-		}
-		if _, err := os.Stat("config"); err == nil {
-			return "config"
-		}
-		home, err := os.UserHomeDir()
-		if err == nil {
-			candidate := filepath.Join(home, ".config", "sr-router", "config")
-			if _, err := os.Stat(candidate); err == nil {
-				return candidate
-			}
-		}
-		return "config" // fall through to default; Load will surface a useful error
+		return resolveConfigDir(configDir)
 	}
 
 	// -------------------------------------------------------------------------
@@ -59,8 +54,27 @@ func main() {
 		Short: "Route a prompt to the best model",
 		Args:  cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
 			useStdin, _ := cmd.Flags().GetBool("stdin")
 			useJSON, _ := cmd.Flags().GetBool("json")
+			pretty, _ := cmd.Flags().GetBool("pretty")
+
+			if costTable, _ := cmd.Flags().GetBool("model-cost-table"); costTable {
+				cfg, err := config.Load(resolveConfig())
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				if cmd.Flags().Changed("seed") {
+					seed, _ := cmd.Flags().GetInt64("seed")
+					router.Seed(seed)
+				}
+				routeClass := ""
+				if bg, _ := cmd.Flags().GetBool("background"); bg {
+					routeClass = "background"
+				}
+				renderModelCostTable(w, cfg, router.NewClassifier(cfg), router.NewRouter(cfg), routeClass)
+				return nil
+			}
 
 			var prompt string
 			if useStdin {
@@ -86,14 +100,35 @@ func main() {
 				return fmt.Errorf("empty prompt")
 			}
 
+			prof := newPhaseTimer()
 			cfg, err := config.Load(resolveConfig())
 			if err != nil {
 				return fmt.Errorf("loading config: %w", err)
 			}
+			prof.mark("config load")
 
-			classifier := router.NewClassifier(cfg)
+			classifier, err := router.NewClassifierFromConfig(cfg)
+			if err != nil {
+				return err
+			}
+			prof.mark("classifier build")
+			classifier.SetEnv(os.LookupEnv)
+			// With --stdin the pipe carries the prompt itself, which says
+			// nothing about whether the caller is a batch job.
+			classifier.SetStdinPiped(!useStdin && stdinPiped())
 			rtr := router.NewRouter(cfg)
 
+			if cmd.Flags().Changed("seed") {
+				seed, _ := cmd.Flags().GetInt64("seed")
+				router.Seed(seed)
+			}
+
+			var flags []string
+			cmd.Flags().Visit(func(f *pflag.Flag) {
+				flags = append(flags, "--"+f.Name)
+			})
+			classifier.SetFlags(flags)
+
 			headers := make(map[string]string)
 			if bg, _ := cmd.Flags().GetBool("background"); bg {
 				headers["x-request-type"] = "background"
@@ -102,48 +137,138 @@ func main() {
 				headers["x-request-type"] = "chat"
 			}
 
+			prof.restart()
 			classification := classifier.Classify(prompt, headers)
-			decision := rtr.Route(classification)
+			prof.mark("classification")
+			var decision router.RoutingDecision
+			if noFallback, _ := cmd.Flags().GetBool("no-fallback"); noFallback {
+				decision, err = rtr.RouteStrict(classification)
+				if err != nil {
+					return err
+				}
+			} else {
+				decision = rtr.Route(classification)
+			}
+			prof.mark("routing")
+
+			// The profile goes to stderr so it never mixes with JSON or
+			// --output results.
+			if profile, _ := cmd.Flags().GetBool("profile"); profile {
+				prof.print(cmd.ErrOrStderr())
+			}
 
-			if useJSON {
+			// --measure sends the prompt through the failover engine to the
+			// real providers; without it nothing leaves the machine.
+			var m *measurement
+			if measure, _ := cmd.Flags().GetBool("measure"); measure {
+				maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+				m, err = measureRoute(cmd.Context(), cfg, rtr, decision, prompt, maxTokens)
+				if err != nil {
+					return err
+				}
+			}
+
+			if useJSON || pretty {
+				type jsonAlternative struct {
+					Model          string  `json:"model"`
+					Score          float64 `json:"score"`
+					EstCost        float64 `json:"est_cost"`
+					EstRequestCost float64 `json:"est_request_cost"`
+				}
+				type jsonAlternativeDetail struct {
+					Model        string  `json:"model"`
+					CostScore    float64 `json:"cost_score"`
+					QualityScore float64 `json:"quality_score"`
+					LostBecause  string  `json:"lost_because"`
+				}
+				type jsonReasoningDetail struct {
+					MinQuality        float64                 `json:"min_quality"`
+					RequiredStrengths []string                `json:"required_strengths"`
+					StrengthMatch     string                  `json:"strength_match,omitempty"`
+					Tiers             []string                `json:"tiers,omitempty"`
+					Excluded          map[string]string       `json:"excluded"`
+					Selection         string                  `json:"selection"`
+					CostWeight        float64                 `json:"cost_weight"`
+					QualityWeight     float64                 `json:"quality_weight"`
+					CostScore         float64                 `json:"cost_score"`
+					QualityScore      float64                 `json:"quality_score"`
+					Alternatives      []jsonAlternativeDetail `json:"alternatives"`
+				}
 				type jsonOutput struct {
-					Model      string  `json:"model"`
-					Tier       string  `json:"tier"`
-					Task       string  `json:"task"`
-					RouteClass string  `json:"route_class"`
-					Score      float64 `json:"score"`
+					Model           string              `json:"model"`
+					Tier            string              `json:"tier"`
+					Task            string              `json:"task"`
+					RouteClass      string              `json:"route_class"`
+					Score           float64             `json:"score"`
+					EstCost         float64             `json:"est_cost"`
+					EstRequestCost  float64             `json:"est_request_cost"`
+					Reasoning       string              `json:"reasoning"`
+					ReasoningDetail jsonReasoningDetail `json:"reasoning_detail"`
+					Alternatives    []jsonAlternative   `json:"alternatives"`
+					Measured        *measurement        `json:"measured,omitempty"`
 				}
+				detail := decision.Detail
 				out := jsonOutput{
-					Model:      decision.Model,
-					Tier:       decision.Tier,
-					Task:       classification.TaskType,
-					RouteClass: classification.RouteClass,
-					Score:      decision.Score,
+					Model:          decision.Model,
+					Tier:           decision.Tier,
+					Task:           classification.TaskType,
+					RouteClass:     classification.RouteClass,
+					Score:          decision.Score,
+					EstCost:        decision.EstCost,
+					EstRequestCost: rtr.EstCostForPrompt(decision.Model, classification.TaskType, prompt),
+					Reasoning:      decision.Reasoning,
+					ReasoningDetail: jsonReasoningDetail{
+						MinQuality:        detail.MinQuality,
+						RequiredStrengths: append([]string{}, detail.RequiredStrengths...),
+						StrengthMatch:     detail.StrengthMatch,
+						Tiers:             detail.Tiers,
+						Excluded:          detail.Excluded,
+						Selection:         detail.Selection,
+						CostWeight:        detail.CostWeight,
+						QualityWeight:     detail.QualityWeight,
+						CostScore:         detail.CostScore,
+						QualityScore:      detail.QualityScore,
+						Alternatives:      []jsonAlternativeDetail{},
+					},
+					Alternatives: []jsonAlternative{},
+					Measured:     m,
 				}
-				b, err := json.Marshal(out)
-				if err != nil {
-					return fmt.Errorf("marshaling JSON: %w", err)
+				for _, alt := range detail.Alternatives {
+					out.ReasoningDetail.Alternatives = append(out.ReasoningDetail.Alternatives,
+						jsonAlternativeDetail{alt.Model, alt.CostScore, alt.QualityScore, alt.LostBecause})
 				}
-				fmt.Println(string(b))
-				return nil
+				for _, alt := range decision.Alternatives {
+					out.Alternatives = append(out.Alternatives, jsonAlternative{alt.Model, alt.Score, alt.EstCost,
+						rtr.EstCostForPrompt(alt.Model, classification.TaskType, prompt)})
+				}
+				return printJSON(w, out, pretty)
 			}
 
-			fmt.Printf("Route Class:  %s\n", classification.RouteClass)
-			fmt.Printf("Task Type:    %s\n", classification.TaskType)
-			fmt.Printf("Tier:         %s\n", decision.Tier)
-			fmt.Printf("Model:        %s\n", decision.Model)
-			fmt.Printf("Score:        %.2f\n", decision.Score)
-			fmt.Printf("Est. Cost:    $%.4f/1k tokens\n", decision.EstCost)
-			fmt.Printf("Reasoning:    %s\n", decision.Reasoning)
+			fmt.Fprintf(w, "Route Class:  %s\n", classification.RouteClass)
+			fmt.Fprintf(w, "Task Type:    %s\n", classification.TaskType)
+			fmt.Fprintf(w, "Tier:         %s\n", decision.Tier)
+			fmt.Fprintf(w, "Model:        %s\n", decision.Model)
+			fmt.Fprintf(w, "Score:        %.2f\n", decision.Score)
+			fmt.Fprintf(w, "Est. Cost:    $%.4f/1k tokens\n", decision.EstCost)
+			fmt.Fprintf(w, "Est. Request: $%.6f (prompt + %d output tokens)\n",
+				rtr.EstCostForPrompt(decision.Model, classification.TaskType, prompt),
+				cfg.GetExpectedOutputTokens(classification.TaskType))
+			fmt.Fprintf(w, "Reasoning:    %s\n", decision.Reasoning)
 			if len(decision.Alternatives) > 0 {
-				fmt.Printf("Alternatives: ")
+				fmt.Fprintf(w, "Alternatives: ")
 				for i, alt := range decision.Alternatives {
 					if i > 0 {
-						fmt.Print(", ")
+						fmt.Fprint(w, ", ")
 					}
-					fmt.Printf("%s (%.2f)", alt.Model, alt.Score)
+					fmt.Fprintf(w, "%s (%.2f)", alt.Model, alt.Score)
 				}
-				fmt.Println()
+				fmt.Fprintln(w)
+			}
+			if m != nil {
+				fmt.Fprintf(w, "Served By:    %s\n", m.ServedBy)
+				fmt.Fprintf(w, "Latency:      %dms\n", m.LatencyMs)
+				fmt.Fprintf(w, "Tokens:       %d in / %d out\n", m.InputTokens, m.OutputTokens)
+				fmt.Fprintf(w, "Cost:         $%.6f\n", m.CostUSD)
 			}
 			return nil
 		},
@@ -151,7 +276,15 @@ func main() {
 	routeCmd.Flags().Bool("background", false, "Force background route class")
 	routeCmd.Flags().Bool("interactive", false, "Force interactive route class")
 	routeCmd.Flags().Bool("json", false, "Output as JSON")
+	routeCmd.Flags().Bool("pretty", false, "Output as indented JSON (implies --json)")
 	routeCmd.Flags().Bool("stdin", false, "Read prompt from stdin JSON")
+	routeCmd.Flags().Bool("no-fallback", false, "Fail when no model qualifies instead of using the fallback model")
+	routeCmd.Flags().Int64("seed", 0, "Seed the routing RNG for reproducible runs (default: seeded from the clock)")
+	routeCmd.Flags().Bool("measure", false, "Send the prompt to the routed model and report actual latency, tokens, and cost")
+	routeCmd.Flags().Int("max-tokens", 256, "Maximum output tokens for --measure")
+	routeCmd.Flags().Bool("model-cost-table", false, "Print the model selected for every configured task and its estimated cost, instead of routing a prompt")
+	routeCmd.Flags().Bool("profile", false, "Print the time spent loading config, building the classifier, classifying, and routing to stderr")
+	addOutputFlag(routeCmd)
 
 	// -------------------------------------------------------------------------
 	// classify — classify only, no routing
@@ -161,6 +294,7 @@ func main() {
 		Short: "Classify a prompt without routing",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
 			prompt := strings.Join(args, " ")
 
 			cfg, err := config.Load(resolveConfig())
@@ -168,22 +302,102 @@ func main() {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
-			classifier := router.NewClassifier(cfg)
+			classifier, err := router.NewClassifierFromConfig(cfg)
+			if err != nil {
+				return err
+			}
+			classifier.SetEnv(os.LookupEnv)
+			classifier.SetStdinPiped(stdinPiped())
 			classification := classifier.Classify(prompt, nil)
 
-			fmt.Printf("Route Class:       %s\n", classification.RouteClass)
-			fmt.Printf("Task Type:         %s\n", classification.TaskType)
-			fmt.Printf("Tier:              %s\n", classification.Tier)
-			fmt.Printf("Min Quality:       %.2f\n", classification.MinQuality)
-			fmt.Printf("Latency Budget:    %dms\n", classification.LatencyBudgetMs)
-			fmt.Printf("Confidence:        %.2f\n", classification.Confidence)
+			// Below the threshold the task type is reported as unknown
+			// rather than the classifier's best guess.
+			threshold, _ := cmd.Flags().GetFloat64("threshold")
+			belowThreshold := threshold > 0 && classification.Confidence < threshold
+			if belowThreshold {
+				classification.TaskType = "unknown"
+				classification.RequiredStrengths = nil
+			}
+
+			var eligible []string
+			showEligible, _ := cmd.Flags().GetBool("eligible")
+			if showEligible {
+				eligible = router.NewRouter(cfg).EligibleModels(classification)
+			}
+			var tiers map[string][]string
+			showTiers, _ := cmd.Flags().GetBool("show-tiers")
+			if showTiers {
+				tiers = router.NewRouter(cfg).EligibleTiers(classification)
+			}
+
+			useJSON, _ := cmd.Flags().GetBool("json")
+			pretty, _ := cmd.Flags().GetBool("pretty")
+			if useJSON || pretty {
+				type jsonOutput struct {
+					RouteClass        string              `json:"route_class"`
+					TaskType          string              `json:"task_type"`
+					Tier              string              `json:"tier"`
+					MinQuality        float64             `json:"min_quality"`
+					LatencyBudgetMs   int                 `json:"latency_budget_ms"`
+					Confidence        float64             `json:"confidence"`
+					RequiredStrengths []string            `json:"required_strengths"`
+					Threshold         float64             `json:"threshold,omitempty"`
+					BelowThreshold    bool                `json:"below_threshold"`
+					EligibleModels    []string            `json:"eligible_models,omitempty"`
+					Tiers             map[string][]string `json:"tiers,omitempty"`
+				}
+				return printJSON(w, jsonOutput{
+					RouteClass:        classification.RouteClass,
+					TaskType:          classification.TaskType,
+					Tier:              classification.Tier,
+					MinQuality:        classification.MinQuality,
+					LatencyBudgetMs:   classification.LatencyBudgetMs,
+					Confidence:        classification.Confidence,
+					RequiredStrengths: classification.RequiredStrengths,
+					Threshold:         threshold,
+					BelowThreshold:    belowThreshold,
+					EligibleModels:    eligible,
+					Tiers:             tiers,
+				}, pretty)
+			}
+
+			fmt.Fprintf(w, "Route Class:       %s\n", classification.RouteClass)
+			fmt.Fprintf(w, "Task Type:         %s\n", classification.TaskType)
+			fmt.Fprintf(w, "Tier:              %s\n", classification.Tier)
+			fmt.Fprintf(w, "Min Quality:       %.2f\n", classification.MinQuality)
+			fmt.Fprintf(w, "Latency Budget:    %dms\n", classification.LatencyBudgetMs)
+			fmt.Fprintf(w, "Confidence:        %.2f\n", classification.Confidence)
+			if threshold > 0 {
+				verdict := "passed"
+				if belowThreshold {
+					verdict = "below, task reported as unknown"
+				}
+				fmt.Fprintf(w, "Threshold:         %.2f (%s)\n", threshold, verdict)
+			}
 			if len(classification.RequiredStrengths) > 0 {
-				fmt.Printf("Required Strengths: %s\n", strings.Join(classification.RequiredStrengths, ", "))
+				fmt.Fprintf(w, "Required Strengths: %s\n", strings.Join(classification.RequiredStrengths, ", "))
+			}
+			if showEligible {
+				if len(eligible) == 0 {
+					fmt.Fprintln(w, "Eligible Models:   none")
+				} else {
+					fmt.Fprintf(w, "Eligible Models:   %s\n", strings.Join(eligible, ", "))
+				}
+			}
+			if showTiers {
+				renderTierEligibility(w, tiers, classification.Tier)
 			}
 			return nil
 		},
 	}
 
+	classifyCmd.Flags().Bool("eligible", false, "List the models that pass the quality and strength filters, unranked")
+	classifyCmd.Flags().Bool("show-tiers", false, "List every tier with the models in it that pass the quality and strength filters")
+	classifyCmd.Flags().Float64("threshold", 0, "Report the task type as unknown when confidence is below this value (0 disables)")
+	classifyCmd.Flags().Bool("json", false, "Output as JSON")
+	classifyCmd.Flags().Bool("pretty", false, "Output as indented JSON (implies --json)")
+	addOutputFlag(classifyCmd)
+
 	// -------------------------------------------------------------------------
 	// models — list configured models
 	// -------------------------------------------------------------------------
@@ -191,7 +405,10 @@ func main() {
 		Use:   "models",
 		Short: "List configured models",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
 			tierFilter, _ := cmd.Flags().GetString("tier")
+			providerFilter, _ := cmd.Flags().GetString("provider")
+			tagFilter, _ := cmd.Flags().GetStringArray("tag")
 
 			cfg, err := config.Load(resolveConfig())
 			if err != nil {
@@ -201,25 +418,67 @@ func main() {
 			// Determine the set of model names to display.
 			var names []string
 			if tierFilter != "" {
-				names = cfg.GetTierModels(tierFilter)
-				if len(names) == 0 {
-					return fmt.Errorf("unknown tier: %q", tierFilter)
+				// A comma-separated list shows the union of the tiers, each
+				// model once, in the order the tiers list them.
+				seen := map[string]bool{}
+				for _, tier := range strings.Split(tierFilter, ",") {
+					tier = strings.TrimSpace(tier)
+					models := cfg.GetTierModels(tier)
+					if len(models) == 0 {
+						return fmt.Errorf("unknown tier: %q", tier)
+					}
+					for _, name := range models {
+						if !seen[name] {
+							seen[name] = true
+							names = append(names, name)
+						}
+					}
 				}
 			} else {
-				for name := range cfg.Models {
-					names = append(names, name)
-				}
-				sort.Strings(names)
+				names = cfg.GetModelsByTag(tagFilter...)
 			}
 
-			fmt.Printf("%-30s %-14s %-10s %-8s %s\n", "NAME", "PROVIDER", "COST/1K", "QUALITY", "STRENGTHS")
-			fmt.Println(strings.Repeat("-", 90))
+			// Keep only configured models matching the provider and tag
+			// filters.
+			var shown []string
 			for _, name := range names {
 				m, ok := cfg.Models[name]
-				if !ok {
+				if !ok || (providerFilter != "" && m.Provider != providerFilter) || !m.HasTags(tagFilter) {
 					continue
 				}
-				fmt.Printf("%-30s %-14s $%-9.4f %-8.2f %s\n",
+				shown = append(shown, name)
+			}
+			names = shown
+
+			if count, _ := cmd.Flags().GetBool("count"); count {
+				fmt.Fprintln(w, len(names))
+				return nil
+			}
+
+			useJSON, _ := cmd.Flags().GetBool("json")
+			pretty, _ := cmd.Flags().GetBool("pretty")
+			if useJSON || pretty {
+				type jsonModel struct {
+					Name           string   `json:"name"`
+					Provider       string   `json:"provider"`
+					CostPer1kTok   float64  `json:"cost_per_1k_tokens"`
+					QualityCeiling float64  `json:"quality_ceiling"`
+					Strengths      []string `json:"strengths"`
+					Tags           []string `json:"tags,omitempty"`
+				}
+				out := []jsonModel{}
+				for _, name := range names {
+					m := cfg.Models[name]
+					out = append(out, jsonModel{name, m.Provider, m.CostPer1kTok, m.QualityCeiling, m.Strengths, m.Tags})
+				}
+				return printJSON(w, out, pretty)
+			}
+
+			fmt.Fprintf(w, "%-30s %-14s %-10s %-8s %s\n", "NAME", "PROVIDER", "COST/1K", "QUALITY", "STRENGTHS")
+			fmt.Fprintln(w, strings.Repeat("-", 90))
+			for _, name := range names {
+				m := cfg.Models[name]
+				fmt.Fprintf(w, "%-30s %-14s $%-9.4f %-8.2f %s\n",
 					name,
 					m.Provider,
 					m.CostPer1kTok,
@@ -230,7 +489,13 @@ func main() {
 			return nil
 		},
 	}
-	modelsCmd.Flags().String("tier", "", "Filter by tier name (e.g. premium, budget, speed)")
+	modelsCmd.Flags().String("tier", "", "Filter by tier name, or a comma-separated list of tiers (e.g. premium, budget,speed)")
+	modelsCmd.Flags().String("provider", "", "Filter by provider (anthropic, openai_compat, ollama)")
+	modelsCmd.Flags().StringArray("tag", nil, "Only list models with this tag; repeat to require several")
+	modelsCmd.Flags().Bool("json", false, "Output as JSON")
+	modelsCmd.Flags().Bool("pretty", false, "Output as indented JSON (implies --json)")
+	modelsCmd.Flags().Bool("count", false, "Print only the number of matching models")
+	addOutputFlag(modelsCmd)
 
 	// -------------------------------------------------------------------------
 	// proxy — start transparent HTTP proxy
@@ -241,8 +506,10 @@ func main() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			port, _ := cmd.Flags().GetString("port")
 			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			verbose, _ := cmd.Flags().GetBool("verbose")
 
-			cfg, err := config.Load(resolveConfig())
+			dir := resolveConfig()
+			cfg, err := config.Load(dir)
 			if err != nil {
 				return fmt.Errorf("loading config: %w", err)
 			}
@@ -251,12 +518,83 @@ func main() {
 			if err != nil {
 				return fmt.Errorf("creating proxy server: %w", err)
 			}
+			srv.SetVerbose(verbose)
+
+			if watch, _ := cmd.Flags().GetBool("config-watch"); watch {
+				stop, err := srv.WatchConfig(dir, proxy.DefaultConfigWatchDebounce)
+				if err != nil {
+					return fmt.Errorf("watching config: %w", err)
+				}
+				defer stop()
+			}
+
+			if endpoint, _ := cmd.Flags().GetString("otel-endpoint"); endpoint != "" {
+				shutdown, err := telemetry.InitTracing(context.Background(), endpoint)
+				if err != nil {
+					return fmt.Errorf("initialising tracing: %w", err)
+				}
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := shutdown(ctx); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: flushing traces: %v\n", err)
+					}
+				}()
+			}
 			return srv.Start()
 		},
 	}
 	proxyCmd.Flags().String("port", "8889", "Port to listen on")
 	proxyCmd.Flags().Bool("dry-run", false, "Return mock responses with routing decisions instead of calling providers")
 	proxyCmd.Flags().Bool("dashboard", false, "Open dashboard in browser on startup")
+	proxyCmd.Flags().Bool("verbose", false, "Log classification reasoning and candidate scores for every request")
+	proxyCmd.Flags().Bool("config-watch", false, "Reload the config when a YAML file in the config directory changes")
+	proxyCmd.Flags().String("otel-endpoint", "", "Export OpenTelemetry traces over OTLP/HTTP to this URL (e.g. http://localhost:4318)")
+
+	// -------------------------------------------------------------------------
+	// warmup — verify every configured provider is reachable
+	// -------------------------------------------------------------------------
+	warmupCmd := &cobra.Command{
+		Use:   "warmup",
+		Short: "Ping each configured provider to validate reachability and API keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+
+			cfg, err := config.Load(resolveConfig())
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			results := router.ProbeProviders(ctx, cfg)
+
+			fmt.Printf("%-14s %-34s %-20s %s\n", "PROVIDER", "BASE URL", "KEY", "STATUS")
+			fmt.Println(strings.Repeat("-", 90))
+			failed := 0
+			for _, r := range results {
+				key := "-"
+				if r.EnvVar != "" {
+					key = r.EnvVar
+					if !r.KeyPresent {
+						key += " (unset)"
+					}
+				}
+				status := "ok"
+				if !r.OK {
+					status = "FAIL: " + r.Err
+					failed++
+				}
+				fmt.Printf("%-14s %-34s %-20s %s\n", r.Provider, r.BaseURL, key, status)
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d providers failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	warmupCmd.Flags().Duration("timeout", 15*time.Second, "Overall timeout for all provider checks")
 
 	// -------------------------------------------------------------------------
 	// mcp — start MCP server (stdio transport)
@@ -270,7 +608,10 @@ func main() {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
-			classifier := router.NewClassifier(cfg)
+			classifier, err := router.NewClassifierFromConfig(cfg)
+			if err != nil {
+				return err
+			}
 			rtr := router.NewRouter(cfg)
 
 			// Telemetry is optional; if it fails the MCP server continues without it.
@@ -288,7 +629,15 @@ func main() {
 		Use:   "stats",
 		Short: "Show routing statistics",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
 			modelFilter, _ := cmd.Flags().GetString("model")
+			by, _ := cmd.Flags().GetString("by")
+
+			switch by {
+			case "", "model", "tier", "route_class":
+			default:
+				return fmt.Errorf("--by must be one of: model, tier, route_class")
+			}
 
 			dbPath := filepath.Join(os.TempDir(), "sr-router-telemetry.db")
 			col, err := telemetry.NewCollector(dbPath)
@@ -297,42 +646,85 @@ func main() {
 			}
 			defer col.Close()
 
-			stats, err := col.GetStats(modelFilter)
-			if err != nil {
-				return fmt.Errorf("retrieving stats: %w", err)
+			// Savings are measured against always using the fallback model.
+			// Config is optional here; without it the savings line is omitted.
+			var baselineModel string
+			var baselineCost float64
+			if cfg, err := config.Load(resolveConfig()); err == nil {
+				if m, ok := cfg.Models[cfg.Defaults.FallbackModel]; ok {
+					baselineModel, baselineCost = cfg.Defaults.FallbackModel, m.CostPer1kTok
+				}
 			}
 
-			fmt.Printf("Total Requests: %d\n", stats.TotalRequests)
-			fmt.Printf("Total Cost:     $%.6f\n", stats.TotalCost)
-			fmt.Printf("Failovers:      %d\n", stats.FailoverCount)
-
-			if len(stats.ByModel) > 0 {
-				fmt.Println("\nBy Model:")
-				modelNames := make([]string, 0, len(stats.ByModel))
-				for name := range stats.ByModel {
-					modelNames = append(modelNames, name)
+			useJSON, _ := cmd.Flags().GetBool("json")
+			pretty, _ := cmd.Flags().GetBool("pretty")
+			compact, _ := cmd.Flags().GetBool("compact")
+			if compact && (useJSON || pretty) {
+				return fmt.Errorf("--compact cannot be combined with --json or --pretty")
+			}
+			show := func() error {
+				stats, err := col.GetStats(modelFilter)
+				if err != nil {
+					return fmt.Errorf("retrieving stats: %w", err)
+				}
+				if baselineModel != "" {
+					stats.ApplyBaseline(baselineModel, baselineCost)
 				}
-				sort.Strings(modelNames)
-				for _, name := range modelNames {
-					fmt.Printf("  %-30s %d\n", name, stats.ByModel[name])
+				// JSON output carries every breakdown; --by only trims the table.
+				if useJSON || pretty {
+					return printJSON(w, stats, pretty)
 				}
+				if compact {
+					renderCompactStats(w, stats)
+					return nil
+				}
+				renderStats(w, stats, by)
+				return nil
 			}
 
-			if len(stats.ByTier) > 0 {
-				fmt.Println("\nBy Tier:")
-				tierNames := make([]string, 0, len(stats.ByTier))
-				for name := range stats.ByTier {
-					tierNames = append(tierNames, name)
+			watch, _ := cmd.Flags().GetBool("watch")
+			if !watch {
+				return show()
+			}
+
+			// --watch redraws the table in place every interval until
+			// interrupted; JSON and --compact output print one document or
+			// line per refresh.
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if interval <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				table := !useJSON && !pretty && !compact
+				if table {
+					fmt.Fprint(w, clearScreen)
+				}
+				if err := show(); err != nil {
+					return err
 				}
-				sort.Strings(tierNames)
-				for _, name := range tierNames {
-					fmt.Printf("  %-20s %d\n", name, stats.ByTier[name])
+				if table {
+					fmt.Fprintf(w, "\nRefreshing every %s; press Ctrl-C to stop.\n", interval)
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
 				}
 			}
-			return nil
 		},
 	}
 	statsCmd.Flags().String("model", "", "Filter stats by model name")
+	statsCmd.Flags().String("by", "", "Only show one breakdown: model, tier, or route_class")
+	statsCmd.Flags().Bool("json", false, "Output as JSON")
+	statsCmd.Flags().Bool("pretty", false, "Output as indented JSON (implies --json)")
+	statsCmd.Flags().Bool("compact", false, "Print only the total request count and total cost on one line")
+	statsCmd.Flags().Bool("watch", false, "Refresh the stats in place until interrupted")
+	statsCmd.Flags().Duration("interval", 2*time.Second, "Refresh interval for --watch")
+	addOutputFlag(statsCmd)
 
 	// -------------------------------------------------------------------------
 	// feedback — record user feedback for a routing event
@@ -373,6 +765,90 @@ func main() {
 	feedbackCmd.Flags().String("override", "", "Model the user would have preferred")
 	_ = feedbackCmd.MarkFlagRequired("rating")
 
+	// -------------------------------------------------------------------------
+	// telemetry — telemetry database subcommand group
+	// -------------------------------------------------------------------------
+	telemetryCmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Telemetry database management",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export routing events as CSV or JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			sinceFlag, _ := cmd.Flags().GetString("since")
+			output, _ := cmd.Flags().GetString("output")
+
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("--format must be csv or json")
+			}
+			var since time.Time
+			if sinceFlag != "" {
+				var err error
+				if since, err = parseSince(sinceFlag, time.Now()); err != nil {
+					return err
+				}
+			}
+
+			dbPath := filepath.Join(os.TempDir(), "sr-router-telemetry.db")
+			col, err := telemetry.NewCollector(dbPath)
+			if err != nil {
+				return fmt.Errorf("opening telemetry database: %w", err)
+			}
+			defer col.Close()
+
+			var w io.Writer = os.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("creating output file: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if err := col.ExportEvents(w, format, since); err != nil {
+				return fmt.Errorf("exporting events: %w", err)
+			}
+			return nil
+		},
+	}
+	exportCmd.Flags().String("format", "csv", "Output format: csv or json")
+	exportCmd.Flags().String("since", "", "Only export events since a duration ago (e.g. 24h) or a date (2006-01-02 or RFC 3339)")
+	exportCmd.Flags().String("output", "", "Write to this file instead of stdout")
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete routing events older than a given age",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			olderThan, _ := cmd.Flags().GetString("older-than")
+			age, err := parseAge(olderThan)
+			if err != nil {
+				return fmt.Errorf("--older-than: %w", err)
+			}
+
+			dbPath := filepath.Join(os.TempDir(), "sr-router-telemetry.db")
+			col, err := telemetry.NewCollector(dbPath)
+			if err != nil {
+				return fmt.Errorf("opening telemetry database: %w", err)
+			}
+			defer col.Close()
+
+			removed, err := col.Prune(time.Now().Add(-age))
+			if err != nil {
+				return fmt.Errorf("pruning events: %w", err)
+			}
+			fmt.Printf("Removed %d events older than %s\n", removed, olderThan)
+			return nil
+		},
+	}
+	pruneCmd.Flags().String("older-than", "", "Age cutoff, e.g. 30d, 2w, or 36h")
+	_ = pruneCmd.MarkFlagRequired("older-than")
+
+	telemetryCmd.AddCommand(exportCmd, pruneCmd)
+
 	// -------------------------------------------------------------------------
 	// config — configuration management subcommand group
 	// -------------------------------------------------------------------------
@@ -413,7 +889,122 @@ func main() {
 		},
 	}
 
-	configCmd.AddCommand(validateCmd, initCmd)
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the merged effective config",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+
+			cfg, err := config.Load(resolveConfig())
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			// The Config struct only holds what the YAML files declare; API
+			// keys are resolved from the environment at call time and so
+			// never appear here.
+			out, err := yaml.Marshal(cfg)
+			if err != nil {
+				return fmt.Errorf("marshaling YAML: %w", err)
+			}
+
+			switch format {
+			case "yaml":
+				fmt.Print(string(out))
+			case "json":
+				// Round-trip through a generic value so JSON keys match the
+				// snake_case YAML keys rather than Go field names.
+				var generic interface{}
+				if err := yaml.Unmarshal(out, &generic); err != nil {
+					return fmt.Errorf("converting to JSON: %w", err)
+				}
+				b, err := json.MarshalIndent(generic, "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshaling JSON: %w", err)
+				}
+				fmt.Println(string(b))
+			default:
+				return fmt.Errorf("--format must be yaml or json")
+			}
+			return nil
+		},
+	}
+	showCmd.Flags().String("format", "yaml", "Output format: yaml or json")
+
+	probeCmd := &cobra.Command{
+		Use:   "probe",
+		Short: "Ask providers for each model's context window and suggest max_context updates",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+
+			cfg, err := config.Load(resolveConfig())
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			renderContextWindows(cmd.OutOrStdout(), router.ProbeContextWindows(ctx, cfg))
+			return nil
+		},
+	}
+	probeCmd.Flags().Duration("timeout", 15*time.Second, "Overall timeout for all provider requests")
+
+	configCmd.AddCommand(validateCmd, initCmd, showCmd, probeCmd)
+
+	// -------------------------------------------------------------------------
+	// bench — route a file of prompts offline and summarise the decisions
+	// -------------------------------------------------------------------------
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Classify and route a file of prompts and summarise the decisions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
+			file, _ := cmd.Flags().GetString("file")
+			if file == "" {
+				return fmt.Errorf("--file is required")
+			}
+			prompts, err := readPrompts(file)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := config.Load(resolveConfig())
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			// Env and stdin detection are left off: the prompts, not the
+			// shell running the benchmark, decide each route class.
+			classifier, err := router.NewClassifierFromConfig(cfg)
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("seed") {
+				seed, _ := cmd.Flags().GetInt64("seed")
+				router.Seed(seed)
+			}
+
+			summary := runBench(cfg, classifier, router.NewRouter(cfg), prompts)
+
+			useJSON, _ := cmd.Flags().GetBool("json")
+			pretty, _ := cmd.Flags().GetBool("pretty")
+			if useJSON || pretty {
+				return printJSON(w, summary, pretty)
+			}
+
+			fmt.Fprintf(w, "Prompts:        %d\n", summary.Prompts)
+			fmt.Fprintf(w, "Avg Est. Cost:  $%.4f/1k tokens\n", summary.AvgCostPer1k)
+			fmt.Fprintf(w, "Fallbacks:      %d\n", summary.Fallbacks)
+			printBreakdown(w, "By Model", summary.ByModel, 30)
+			printBreakdown(w, "By Tier", summary.ByTier, 20)
+			printBreakdown(w, "By Task Type", summary.ByTaskType, 20)
+			return nil
+		},
+	}
+	benchCmd.Flags().String("file", "", "File of prompts, one per line (blank lines and lines starting with # are skipped)")
+	benchCmd.Flags().Int64("seed", 0, "Seed the routing RNG for reproducible runs (default: seeded from the clock)")
+	benchCmd.Flags().Bool("json", false, "Output as JSON")
+	benchCmd.Flags().Bool("pretty", false, "Output as indented JSON (implies --json)")
 
 	// -------------------------------------------------------------------------
 	// Wire all top-level subcommands into root.
@@ -423,14 +1014,474 @@ func main() {
 		classifyCmd,
 		modelsCmd,
 		proxyCmd,
+		warmupCmd,
 		mcpCmd,
 		statsCmd,
 		feedbackCmd,
+		telemetryCmd,
 		configCmd,
+		benchCmd,
 	)
 
+	// Route class flags come from the config, so it is only loaded when the
+	// route command is the one being run.
+	if cmd, args, err := rootCmd.Find(os.Args[1:]); err == nil && cmd == routeCmd {
+		registerRouteClassFlags(routeCmd, args)
+	}
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// measurement is the outcome of executing a routed prompt with --measure.
+type measurement struct {
+	ServedBy     string  `json:"served_by"`
+	LatencyMs    int64   `json:"latency_ms"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// measureRoute executes prompt against decision through the failover engine
+// and reports the model that served it, the wall-clock latency, the token
+// usage the provider reported, and the resulting cost.
+func measureRoute(ctx context.Context, cfg *config.Config, rtr *router.Router, decision router.RoutingDecision, prompt string, maxTokens int) (*measurement, error) {
+	engine := router.NewFailoverEngine(cfg, rtr, nil)
+	req := router.ProviderRequest{
+		Messages:  []router.ProviderMessage{{Role: "user", Content: prompt}},
+		MaxTokens: maxTokens,
+	}
+
+	start := time.Now()
+	resp, served, err := engine.ExecuteWithFailover(ctx, decision, req)
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned %d: %s", served, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	pr, err := router.DecodeProviderResponse(cfg.Models[served].Provider, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	return &measurement{
+		ServedBy:     served,
+		LatencyMs:    latency.Milliseconds(),
+		InputTokens:  pr.InputTokens,
+		OutputTokens: pr.OutputTokens,
+		CostUSD:      rtr.EstimateCost(served, pr.InputTokens+pr.OutputTokens),
+	}, nil
+}
+
+// benchSummary aggregates the routing decisions for a prompt set.
+// AvgCostPer1k is the mean cost_per_1k_tokens of the selected models, and
+// Fallbacks counts prompts no model qualified for.
+type benchSummary struct {
+	Prompts      int            `json:"prompts"`
+	AvgCostPer1k float64        `json:"avg_cost_per_1k_tokens"`
+	Fallbacks    int            `json:"fallbacks"`
+	ByModel      map[string]int `json:"by_model"`
+	ByTier       map[string]int `json:"by_tier"`
+	ByTaskType   map[string]int `json:"by_task_type"`
+}
+
+// runBench classifies and routes every prompt, tallying the decisions.
+func runBench(cfg *config.Config, classifier *router.Classifier, rtr *router.Router, prompts []string) benchSummary {
+	summary := benchSummary{
+		Prompts:    len(prompts),
+		ByModel:    make(map[string]int),
+		ByTier:     make(map[string]int),
+		ByTaskType: make(map[string]int),
+	}
+	var totalCost float64
+	for _, prompt := range prompts {
+		classification := classifier.Classify(prompt, nil)
+		decision, err := rtr.RouteStrict(classification)
+		if err != nil {
+			summary.Fallbacks++
+			decision = rtr.Route(classification)
+		}
+		summary.ByModel[decision.Model]++
+		summary.ByTier[decision.Tier]++
+		summary.ByTaskType[classification.TaskType]++
+		totalCost += cfg.Models[decision.Model].CostPer1kTok
+	}
+	if len(prompts) > 0 {
+		summary.AvgCostPer1k = totalCost / float64(len(prompts))
+	}
+	return summary
+}
+
+// readPrompts returns the prompts in path, one per line, skipping blank lines
+// and # comments.
+func readPrompts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening prompt file: %w", err)
+	}
+	defer f.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading prompt file: %w", err)
+	}
+	return prompts, nil
+}
+
+// resolveConfigDir returns dir if set, otherwise searches well-known paths.
+func resolveConfigDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if _, err := os.Stat("config"); err == nil {
+		return "config"
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		candidate := filepath.Join(home, ".config", "sr-router", "config")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return "config" // fall through to default; Load will surface a useful error
+}
+
+// outputFile is a command's --output destination. It records the first
+// write error so it can be reported once the command finishes.
+type outputFile struct {
+	f   *os.File
+	err error
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	n, err := o.f.Write(p)
+	if err != nil && o.err == nil {
+		o.err = err
+	}
+	return n, err
+}
+
+// addOutputFlag adds --output to cmd, which must print through
+// cmd.OutOrStdout(). When set, the output goes to that file instead of
+// stdout, creating its parent directories as needed; failures to create or
+// write the file fail the command.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().String("output", "", "Write the result to this file instead of stdout")
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString("output")
+		if path == "" {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		cmd.SetOut(&outputFile{f: f})
+		return nil
+	}
+	cmd.PostRunE = func(cmd *cobra.Command, args []string) error {
+		out, ok := cmd.OutOrStdout().(*outputFile)
+		if !ok {
+			return nil
+		}
+		err := out.f.Close()
+		if out.err != nil {
+			err = out.err
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", out.f.Name(), err)
+		}
+		return nil
+	}
+}
+
+// registerRouteClassFlags adds a boolean flag to cmd for every flag listed
+// under a route class's detection rules, so a class added in YAML can be
+// selected from the command line. args are the command's arguments, from
+// which --config is read with the flags cmd already defines; those flags are
+// left alone. When the config cannot be loaded nothing is registered, and an
+// unknown flag error then reports the load error as its likely cause.
+func registerRouteClassFlags(cmd *cobra.Command, args []string) {
+	cmd.InitDefaultHelpFlag()
+	cmd.Flags().ParseErrorsWhitelist.UnknownFlags = true
+	err := cmd.ParseFlags(args)
+	cmd.Flags().ParseErrorsWhitelist.UnknownFlags = false
+	if err != nil {
+		return
+	}
+	dir, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(resolveConfigDir(dir))
+	if err != nil {
+		cmd.SetFlagErrorFunc(func(_ *cobra.Command, flagErr error) error {
+			return fmt.Errorf("%w (route class flags unavailable: loading config: %v)", flagErr, err)
+		})
+		return
+	}
+	names := make([]string, 0, len(cfg.RouteClasses))
+	for name := range cfg.RouteClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, flag := range cfg.RouteClasses[name].Detection.Flags {
+			flag = strings.TrimLeft(flag, "-")
+			if flag == "" || flag == "help" || strings.ContainsAny(flag, " =") || cmd.Flags().Lookup(flag) != nil {
+				continue
+			}
+			cmd.Flags().Bool(flag, false, fmt.Sprintf("Use the %s route class", name))
+		}
+	}
+}
+
+// stdinPiped reports whether stdin is a pipe or redirected file rather than
+// a terminal, as when sr-router runs from cron or a shell pipeline.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeNamedPipe != 0 || fi.Mode().IsRegular()
+}
+
+// printJSON writes v to w as JSON, indented when pretty is set.
+func printJSON(w io.Writer, v interface{}, pretty bool) error {
+	var b []byte
+	var err error
+	if pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	fmt.Fprintln(w, string(b))
+	return nil
+}
+
+// parseSince interprets a --since value as either an age before now (see
+// parseAge) or an absolute date ("2006-01-02" or RFC 3339).
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := parseAge(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("--since must be a duration (e.g. 24h or 7d) or a date (2006-01-02 or RFC 3339), got %q", s)
+}
+
+// parseAge parses a non-negative age. Besides Go durations ("36h", "90m") it
+// accepts whole days and weeks ("30d", "2w").
+func parseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else if n, ok := strings.CutSuffix(s, "w"); ok {
+		weeks, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		d = time.Duration(weeks) * 7 * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid age %q (use e.g. 30d, 2w, or 36h)", s)
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("age %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// phaseTimer records the wall time of consecutive phases for route
+// --profile. Each mark ends the current phase and starts the next.
+type phaseTimer struct {
+	start  time.Time
+	phases []timedPhase
+}
+
+type timedPhase struct {
+	name string
+	d    time.Duration
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{start: time.Now()}
+}
+
+// mark records the time since the previous mark (or restart) as phase name.
+func (t *phaseTimer) mark(name string) {
+	now := time.Now()
+	t.phases = append(t.phases, timedPhase{name, now.Sub(t.start)})
+	t.start = now
+}
+
+// restart begins a new phase without recording the time since the last
+// mark, for setup work that should not be counted.
+func (t *phaseTimer) restart() {
+	t.start = time.Now()
+}
+
+// print writes each recorded phase and their total to w.
+func (t *phaseTimer) print(w io.Writer) {
+	var total time.Duration
+	fmt.Fprintln(w, "Profile:")
+	for _, p := range t.phases {
+		fmt.Fprintf(w, "  %-18s %s\n", p.name, p.d)
+		total += p.d
+	}
+	fmt.Fprintf(w, "  %-18s %s\n", "total", total)
+}
+
+// clearScreen moves the cursor home and clears the terminal, so each
+// stats --watch refresh replaces the last.
+const clearScreen = "\033[H\033[2J"
+
+// renderContextWindows prints each model's configured and probed context
+// window, followed by a models.yaml snippet for every model whose probed
+// window differs from its max_context.
+func renderContextWindows(w io.Writer, results []router.ContextWindow) {
+	fmt.Fprintf(w, "%-24s %-12s %-12s %s\n", "MODEL", "CONFIGURED", "PROBED", "STATUS")
+	fmt.Fprintln(w, strings.Repeat("-", 70))
+	var updates []router.ContextWindow
+	for _, r := range results {
+		probed, status := "-", "not reported"
+		switch {
+		case r.Err != "":
+			status = "FAIL: " + r.Err
+		case r.Probed == 0:
+		case r.Probed == r.Configured:
+			probed, status = strconv.Itoa(r.Probed), "ok"
+		default:
+			probed, status = strconv.Itoa(r.Probed), "differs"
+			updates = append(updates, r)
+		}
+		fmt.Fprintf(w, "%-24s %-12d %-12s %s\n", r.Model, r.Configured, probed, status)
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nSuggested models.yaml updates:")
+	fmt.Fprintln(w, "models:")
+	for _, r := range updates {
+		fmt.Fprintf(w, "  %s:\n    max_context: %d\n", r.Model, r.Probed)
+	}
+}
+
+// renderModelCostTable prints, for every configured task in name order, the
+// model a prompt of that task is routed to and what it costs: the model's
+// price per 1k tokens and the cost of the output the task is expected to
+// produce. routeClass is passed to Classifier.ClassifyTask.
+func renderModelCostTable(w io.Writer, cfg *config.Config, classifier *router.Classifier, rtr *router.Router, routeClass string) {
+	tasks := make([]string, 0, len(cfg.Tasks))
+	for name := range cfg.Tasks {
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+
+	fmt.Fprintf(w, "%-20s %-24s %-10s %-12s %s\n", "TASK", "MODEL", "TIER", "COST/1K", "EST. REQUEST")
+	fmt.Fprintln(w, strings.Repeat("-", 86))
+	for _, task := range tasks {
+		decision := rtr.Route(classifier.ClassifyTask(task, routeClass))
+		outputTokens := cfg.GetExpectedOutputTokens(task)
+		fmt.Fprintf(w, "%-20s %-24s %-10s $%-11.4f $%.6f (%d output tokens)\n", task, decision.Model, decision.Tier,
+			decision.EstCost, rtr.EstimateCost(decision.Model, outputTokens), outputTokens)
+	}
+}
+
+// renderTierEligibility prints every tier in name order with the models in
+// it that could serve the classification, marking defaultTier, the tier the
+// classification routes from.
+func renderTierEligibility(w io.Writer, tiers map[string][]string, defaultTier string) {
+	names := make([]string, 0, len(tiers))
+	for name := range tiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Tiers (* = classified tier):")
+	for _, name := range names {
+		models := "none eligible"
+		if len(tiers[name]) > 0 {
+			models = strings.Join(tiers[name], ", ")
+		}
+		marker := " "
+		if name == defaultTier {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "  %s %-12s %s\n", marker, name, models)
+	}
+}
+
+// renderCompactStats prints the total request count and total cost on a
+// single line, for status bars and scripts.
+func renderCompactStats(w io.Writer, stats *telemetry.Stats) {
+	fmt.Fprintf(w, "%d %.6f\n", stats.TotalRequests, stats.TotalCost)
+}
+
+// renderStats prints the stats table to w. by limits the breakdowns to one
+// of "model", "tier", or "route_class"; empty prints all three.
+func renderStats(w io.Writer, stats *telemetry.Stats, by string) {
+	fmt.Fprintf(w, "Total Requests: %d\n", stats.TotalRequests)
+	fmt.Fprintf(w, "Total Cost:     $%.6f\n", stats.TotalCost)
+	fmt.Fprintf(w, "Failovers:      %d\n", stats.FailoverCount)
+	if stats.BaselineModel != "" {
+		fmt.Fprintf(w, "Savings:        $%.6f versus always using %s\n", stats.EstimatedSavings, stats.BaselineModel)
+	}
+
+	if by == "" || by == "model" {
+		printBreakdown(w, "By Model", stats.ByModel, 30)
+	}
+	if by == "" || by == "tier" {
+		printBreakdown(w, "By Tier", stats.ByTier, 20)
+	}
+	if by == "" || by == "route_class" {
+		printBreakdown(w, "By Route Class", stats.ByRouteClass, 20)
+	}
+}
+
+// printBreakdown prints a titled, name-sorted count breakdown to w. Nothing
+// is printed when counts is empty.
+func printBreakdown(w io.Writer, title string, counts map[string]int, width int) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-*s %d\n", width, name, counts[name])
+	}
+}
@@ -3,11 +3,20 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
+	"github.com/jbctechsolutions/sr-router/telemetry"
 )
 
 // binary holds the path to the compiled sr-router binary used by every test.
@@ -159,6 +168,140 @@ func TestRouteJSONOutput(t *testing.T) {
 	}
 }
 
+func TestRouteJSONAlternativesEstCost(t *testing.T) {
+	stdout, stderr, err := run(t, "route", "--json", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+
+	var out struct {
+		EstCost        *float64 `json:"est_cost"`
+		EstRequestCost float64  `json:"est_request_cost"`
+		Alternatives   []struct {
+			Model   string   `json:"model"`
+			EstCost *float64 `json:"est_cost"`
+		} `json:"alternatives"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v\nstdout: %s", err, stdout)
+	}
+	if out.EstCost == nil || *out.EstCost < 0 {
+		t.Errorf("est_cost = %v, want a non-negative number", out.EstCost)
+	}
+	// summarization reserves 300 output tokens on top of the prompt.
+	if out.EstCost != nil && out.EstRequestCost <= *out.EstCost*300/1000 {
+		t.Errorf("est_request_cost = %f, want it to include the output reservation", out.EstRequestCost)
+	}
+	if len(out.Alternatives) == 0 {
+		t.Fatalf("expected alternatives in the JSON output\ngot: %s", stdout)
+	}
+	for _, alt := range out.Alternatives {
+		if alt.EstCost == nil || *alt.EstCost < 0 {
+			t.Errorf("alternative %s: est_cost = %v, want a non-negative number", alt.Model, alt.EstCost)
+		}
+	}
+}
+
+func TestRouteJSONReasoningDetail(t *testing.T) {
+	stdout, stderr, err := run(t, "route", "--json", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+
+	var out struct {
+		Score        float64 `json:"score"`
+		Reasoning    string  `json:"reasoning"`
+		Alternatives []struct {
+			Model string `json:"model"`
+		} `json:"alternatives"`
+		Detail struct {
+			Selection     string  `json:"selection"`
+			CostWeight    float64 `json:"cost_weight"`
+			QualityWeight float64 `json:"quality_weight"`
+			CostScore     float64 `json:"cost_score"`
+			QualityScore  float64 `json:"quality_score"`
+			Alternatives  []struct {
+				Model       string `json:"model"`
+				LostBecause string `json:"lost_because"`
+			} `json:"alternatives"`
+		} `json:"reasoning_detail"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v\nstdout: %s", err, stdout)
+	}
+	d := out.Detail
+	if out.Reasoning == "" || d.Selection != "best_score" {
+		t.Errorf("reasoning = %q, selection = %q", out.Reasoning, d.Selection)
+	}
+	if got := d.CostWeight*d.CostScore + d.QualityWeight*d.QualityScore; math.Abs(got-out.Score) > 1e-9 {
+		t.Errorf("score components give %f, want the score %f", got, out.Score)
+	}
+	if len(d.Alternatives) != len(out.Alternatives) {
+		t.Fatalf("got %d alternative details for %d alternatives", len(d.Alternatives), len(out.Alternatives))
+	}
+	for i, alt := range d.Alternatives {
+		if alt.Model != out.Alternatives[i].Model || alt.LostBecause == "" {
+			t.Errorf("alternative detail %d = %+v, want %s with a reason", i, alt, out.Alternatives[i].Model)
+		}
+	}
+}
+
+func TestRouteProfile(t *testing.T) {
+	stdout, stderr, err := run(t, "route", "--profile", "--json", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	if !json.Valid([]byte(stdout)) {
+		t.Errorf("the profile must not mix into stdout JSON:\n%s", stdout)
+	}
+
+	for _, phase := range []string{"config load", "classifier build", "classification", "routing", "total"} {
+		var found bool
+		for _, line := range strings.Split(stderr, "\n") {
+			rest, ok := strings.CutPrefix(strings.TrimSpace(line), phase+" ")
+			if !ok {
+				continue
+			}
+			found = true
+			d, err := time.ParseDuration(strings.TrimSpace(rest))
+			if err != nil || d < 0 {
+				t.Errorf("phase %q: duration %q is not a non-negative duration", phase, rest)
+			}
+		}
+		if !found {
+			t.Errorf("profile missing phase %q\nstderr: %s", phase, stderr)
+		}
+	}
+}
+
+func TestRouteModelCostTable(t *testing.T) {
+	stdout, stderr, err := run(t, "route", "--model-cost-table")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	cfg, err := config.Load("../config")
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+
+	rows := make(map[string][]string)
+	for _, line := range strings.Split(stdout, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			rows[fields[0]] = fields
+		}
+	}
+	for task := range cfg.Tasks {
+		fields, ok := rows[task]
+		if !ok {
+			t.Errorf("task %q missing from the table\n%s", task, stdout)
+			continue
+		}
+		if _, ok := cfg.Models[fields[1]]; !ok {
+			t.Errorf("task %q: selected model %q is not a configured model", task, fields[1])
+		}
+	}
+}
+
 func TestRouteJSONOutputForDifferentPrompts(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -292,6 +435,116 @@ func TestClassifyOutputFields(t *testing.T) {
 	}
 }
 
+func TestClassifyThreshold(t *testing.T) {
+	type result struct {
+		TaskType       string  `json:"task_type"`
+		Confidence     float64 `json:"confidence"`
+		Threshold      float64 `json:"threshold"`
+		BelowThreshold bool    `json:"below_threshold"`
+	}
+	tests := []struct {
+		name      string
+		prompt    string
+		wantTask  string
+		wantBelow bool
+	}{
+		{"low confidence becomes unknown", "hello there", "unknown", true},
+		{"high confidence passes", "Design a microservice architecture for payments", "architecture", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, err := run(t, "classify", "--threshold", "0.7", "--json", tt.prompt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			var got result
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+			}
+			if got.TaskType != tt.wantTask || got.BelowThreshold != tt.wantBelow || got.Threshold != 0.7 {
+				t.Errorf("got %+v, want task %s below_threshold=%v", got, tt.wantTask, tt.wantBelow)
+			}
+		})
+	}
+
+	stdout, stderr, err := run(t, "classify", "--threshold", "0.7", "hello there")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Task Type:         unknown") || !strings.Contains(stdout, "Threshold:         0.70 (below") {
+		t.Errorf("human output does not report the threshold decision:\n%s", stdout)
+	}
+
+	// Without --threshold the classifier's guess is kept.
+	stdout, _, _ = run(t, "classify", "hello there")
+	if !strings.Contains(stdout, "Task Type:         chat") || strings.Contains(stdout, "Threshold:") {
+		t.Errorf("unexpected output without --threshold:\n%s", stdout)
+	}
+}
+
+func TestClassifyShowTiers(t *testing.T) {
+	stdout, stderr, err := run(t, "classify", "--show-tiers", "--json", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	var got struct {
+		Tiers map[string][]string `json:"tiers"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	want := map[string]string{
+		"premium": "",
+		"budget":  "minimax-m2,ollama/llama3.2",
+		"speed":   "cerebras-glm,ollama/llama3.2",
+		"free":    "ollama/llama3.2",
+	}
+	if len(got.Tiers) != len(want) {
+		t.Errorf("tiers = %v, want one entry per configured tier", got.Tiers)
+	}
+	for tier, models := range want {
+		if strings.Join(got.Tiers[tier], ",") != models {
+			t.Errorf("tier %s = %v, want [%s]", tier, got.Tiers[tier], models)
+		}
+	}
+
+	stdout, _, _ = run(t, "classify", "--show-tiers", "Write a Go function for sorting")
+	if !strings.Contains(stdout, "* premium      claude-sonnet") || !strings.Contains(stdout, "budget       none eligible") {
+		t.Errorf("human output missing tier eligibility:\n%s", stdout)
+	}
+
+	stdout, _, _ = run(t, "classify", "Write a Go function for sorting")
+	if strings.Contains(stdout, "Tiers (") {
+		t.Errorf("tiers shown without --show-tiers:\n%s", stdout)
+	}
+}
+
+func TestClassifyEligible(t *testing.T) {
+	stdout, stderr, err := run(t, "classify", "--eligible", "--json", "Design a microservice architecture for payments")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	var got struct {
+		EligibleModels []string `json:"eligible_models"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(got.EligibleModels) != 1 || got.EligibleModels[0] != "claude-opus" {
+		t.Errorf("eligible_models = %v, want [claude-opus]", got.EligibleModels)
+	}
+
+	stdout, _, _ = run(t, "classify", "--eligible", "What is a goroutine?")
+	if !strings.Contains(stdout, "Eligible Models:") || !strings.Contains(stdout, "claude-sonnet") {
+		t.Errorf("human output missing eligible models:\n%s", stdout)
+	}
+
+	stdout, _, _ = run(t, "classify", "What is a goroutine?")
+	if strings.Contains(stdout, "Eligible Models:") {
+		t.Errorf("eligible models shown without --eligible:\n%s", stdout)
+	}
+}
+
 // --------------------------------------------------------------------------
 // models command
 // --------------------------------------------------------------------------
@@ -402,6 +655,137 @@ func TestModelsTierFilter(t *testing.T) {
 	}
 }
 
+func TestModelsMultipleTiers(t *testing.T) {
+	stdout, stderr, err := run(t, "models", "--tier", "budget,speed", "--json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+
+	var models []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &models); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	var names []string
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	want := []string{"minimax-m2", "ollama/llama3.2", "cerebras-glm"}
+	if !slices.Equal(names, want) {
+		t.Errorf("models = %v, want %v", names, want)
+	}
+}
+
+func TestModelsMultipleTiersUnknown(t *testing.T) {
+	_, stderr, err := run(t, "models", "--tier", "budget,nope")
+	if err == nil {
+		t.Fatal("expected an error for an unknown tier in the list")
+	}
+	if !strings.Contains(stderr, `"nope"`) {
+		t.Errorf("stderr should name the unknown tier, got: %s", stderr)
+	}
+}
+
+func TestModelsTagFilter(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--tag", "on-prem"}, []string{"ollama/codellama", "ollama/llama3.2"}},
+		// Repeated --tag flags must all match.
+		{[]string{"--tag", "on-prem", "--tag", "fast"}, []string{"ollama/llama3.2"}},
+		{[]string{"--tag", "hosted", "--tag", "on-prem"}, nil},
+		// Combined with --tier, both filters apply.
+		{[]string{"--tag", "fast", "--tier", "speed"}, []string{"cerebras-glm", "ollama/llama3.2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr, err := run(t, append([]string{"models", "--json"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			var models []struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &models); err != nil {
+				t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+			}
+			var names []string
+			for _, m := range models {
+				names = append(names, m.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("models = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelsProviderFilter(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--provider", "anthropic"}, []string{"claude-opus", "claude-sonnet"}},
+		{[]string{"--provider", "openai_compat"}, []string{"cerebras-glm", "minimax-m2"}},
+		{[]string{"--provider", "ollama"}, []string{"ollama/codellama", "ollama/llama3.2"}},
+		// Combined with --tier, both filters must match.
+		{[]string{"--provider", "ollama", "--tier", "premium"}, nil},
+		{[]string{"--provider", "openai_compat", "--tier", "speed"}, []string{"cerebras-glm"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr, err := run(t, append([]string{"models"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+
+			// Rows follow the header and separator lines.
+			var got []string
+			lines := strings.Split(strings.TrimSpace(stdout), "\n")
+			for _, line := range lines[2:] {
+				got = append(got, strings.Fields(line)[0])
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got models %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelsCount(t *testing.T) {
+	cfg, err := config.Load("../config")
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, len(cfg.Models)},
+		{[]string{"--tier", "premium"}, len(cfg.GetTierModels("premium"))},
+		{[]string{"--tier", "free"}, len(cfg.GetTierModels("free"))},
+		{[]string{"--provider", "ollama", "--tier", "premium"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			args := append([]string{"models", "--count"}, tt.args...)
+			stdout, stderr, err := run(t, args...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			if got := strings.TrimSpace(stdout); got != fmt.Sprint(tt.want) {
+				t.Errorf("count = %q, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestModelsTierFilterUnknownTier(t *testing.T) {
 	_, _, err := run(t, "models", "--tier", "nonexistent")
 	if err == nil {
@@ -433,6 +817,52 @@ func TestConfigInit(t *testing.T) {
 	}
 }
 
+func TestConfigShow(t *testing.T) {
+	const secret = "sk-test-should-never-be-printed"
+	t.Setenv("ANTHROPIC_API_KEY", secret)
+	t.Setenv("MINIMAX_API_KEY", secret)
+
+	for _, format := range []string{"yaml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			stdout, stderr, err := run(t, "config", "show", "--format", format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			for _, want := range []string{"models", "tiers", "route_classes", "claude-sonnet", "interactive"} {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output missing %q", want)
+				}
+			}
+			if strings.Contains(stdout, secret) {
+				t.Error("output contains an API key value")
+			}
+		})
+	}
+}
+
+func TestConfigShowJSONIsValid(t *testing.T) {
+	stdout, stderr, err := run(t, "config", "show", "--format", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"defaults", "models", "tiers", "tasks", "route_classes"} {
+		if _, ok := out[key]; !ok {
+			t.Errorf("JSON output missing key %q", key)
+		}
+	}
+}
+
+func TestConfigShowInvalidFormat(t *testing.T) {
+	_, _, err := run(t, "config", "show", "--format", "toml")
+	if err == nil {
+		t.Fatal("expected error for unsupported format, got nil")
+	}
+}
+
 // --------------------------------------------------------------------------
 // Error cases
 // --------------------------------------------------------------------------
@@ -519,6 +949,117 @@ func TestRouteInteractiveFlag(t *testing.T) {
 	}
 }
 
+func TestRouteStdinPromptIsNotBackground(t *testing.T) {
+	cmd := exec.Command(binary, "--config", configDir(t), "route", "--json", "--stdin")
+	cmd.Stdin = strings.NewReader(`{"prompt":"Write a Go function"}`)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got struct {
+		RouteClass string `json:"route_class"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v\nstdout: %s", err, out)
+	}
+	if got.RouteClass != "interactive" {
+		t.Errorf("route --stdin: route class = %q, want interactive", got.RouteClass)
+	}
+}
+
+func TestRouteCustomRouteClassFlag(t *testing.T) {
+	dir := writeMockConfig(t, "http://127.0.0.1:0")
+	classes := `route_classes:
+  interactive:
+    default_tier: budget
+  nightly:
+    detection:
+      flags: ["--nightly"]
+    default_tier: budget
+`
+	if err := os.WriteFile(filepath.Join(dir, "route_classes.yaml"), []byte(classes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(binary, "--config", dir, "route", "--json", "--nightly", "hello").Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got struct {
+		RouteClass string `json:"route_class"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v\nstdout: %s", err, out)
+	}
+	if got.RouteClass != "nightly" {
+		t.Errorf("route class = %q, want nightly", got.RouteClass)
+	}
+
+	// --config is also found after the subcommand, and --help lists the flag.
+	help, err := exec.Command(binary, "route", "--config="+dir, "--help").Output()
+	if err != nil {
+		t.Fatalf("route --help: unexpected error: %v", err)
+	}
+	if !strings.Contains(string(help), "--nightly") {
+		t.Errorf("route --help does not list --nightly:\n%s", help)
+	}
+
+	// The flag only exists for configs that declare it.
+	if _, _, err := run(t, "route", "--nightly", "hello"); err == nil {
+		t.Error("expected unknown flag error with the default config")
+	}
+
+	// When the config cannot be loaded, the unknown flag error says why.
+	missing := filepath.Join(t.TempDir(), "missing")
+	out, err = exec.Command(binary, "route", "--config", missing, "--nightly", "hello").CombinedOutput()
+	if err == nil {
+		t.Fatal("expected unknown flag error with an unloadable config")
+	}
+	if !strings.Contains(string(out), "loading config") {
+		t.Errorf("error does not report the config load failure: %s", out)
+	}
+}
+
+func TestRouteNoFallback(t *testing.T) {
+	dir := writeMockConfig(t, "http://127.0.0.1:0")
+	classes := "route_classes:\n  interactive:\n    default_tier: budget\n    quality_floor: 0.95\n"
+	if err := os.WriteFile(filepath.Join(dir, "route_classes.yaml"), []byte(classes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := exec.Command(binary, "--config", dir, "route", "hello").Output(); err != nil {
+		t.Fatalf("without --no-fallback: unexpected error: %v", err)
+	}
+
+	cmd := exec.Command(binary, "--config", dir, "route", "--no-fallback", "hello")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected an error with --no-fallback")
+	}
+	if !strings.Contains(stderr.String(), "mock: quality 0.90 below floor 0.95") {
+		t.Errorf("stderr does not explain the exclusion: %s", stderr.String())
+	}
+}
+
+// --------------------------------------------------------------------------
+// route --seed
+// --------------------------------------------------------------------------
+
+func TestRouteSeedReproducible(t *testing.T) {
+	first, stderr, err := run(t, "route", "--json", "--seed", "42", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	second, _, err := run(t, "route", "--json", "--seed", "42", "Summarize this document")
+	if err != nil {
+		t.Fatalf("unexpected error on second run: %v", err)
+	}
+	if first != second {
+		t.Errorf("same seed produced different output:\n%s\n%s", first, second)
+	}
+}
+
 // --------------------------------------------------------------------------
 // route --json structure with --background flag
 // --------------------------------------------------------------------------
@@ -544,3 +1085,437 @@ func TestRouteJSONWithBackgroundFlag(t *testing.T) {
 		t.Errorf("expected route_class %q, got %q", "background", out.RouteClass)
 	}
 }
+
+// --------------------------------------------------------------------------
+// stats --by flag
+// --------------------------------------------------------------------------
+
+func TestStatsByInvalidValue(t *testing.T) {
+	_, _, err := run(t, "stats", "--by", "provider")
+	if err == nil {
+		t.Fatal("expected error for unsupported --by value, got nil")
+	}
+}
+
+// --------------------------------------------------------------------------
+// stats --watch
+// --------------------------------------------------------------------------
+
+func TestRenderStats(t *testing.T) {
+	stats := &telemetry.Stats{
+		TotalRequests: 3,
+		TotalCost:     0.0125,
+		FailoverCount: 1,
+		ByModel:       map[string]int{"claude-sonnet": 2, "minimax-m2": 1},
+		ByTier:        map[string]int{"premium": 2, "budget": 1},
+	}
+
+	var buf strings.Builder
+	renderStats(&buf, stats, "")
+	out := buf.String()
+	for _, want := range []string{"Total Requests: 3", "Total Cost:     $0.012500", "Failovers:      1", "By Model:", "claude-sonnet", "By Tier:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\ngot: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "Savings") {
+		t.Errorf("no baseline was applied, so no savings line is expected\ngot: %s", out)
+	}
+
+	buf.Reset()
+	renderStats(&buf, stats, "tier")
+	if strings.Contains(buf.String(), "By Model:") {
+		t.Errorf("--by tier should omit the model breakdown\ngot: %s", buf.String())
+	}
+}
+
+func TestRenderContextWindows(t *testing.T) {
+	var buf strings.Builder
+	renderContextWindows(&buf, []router.ContextWindow{
+		{Model: "claude-opus", Configured: 200000, Probed: 200000},
+		{Model: "cerebras-glm", Configured: 128000, Probed: 131072},
+		{Model: "minimax-m2", Configured: 1000000},
+		{Model: "ollama/llama3.2", Configured: 128000, Err: "connection refused"},
+	})
+	out := buf.String()
+
+	for _, want := range []string{"ok", "differs", "not reported", "FAIL: connection refused",
+		"Suggested models.yaml updates:\nmodels:\n  cerebras-glm:\n    max_context: 131072\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\ngot: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "claude-opus:") || strings.Contains(out, "minimax-m2:") {
+		t.Errorf("only models whose window differs should be suggested\ngot: %s", out)
+	}
+}
+
+func TestStatsCompact(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	col, err := telemetry.NewCollector(filepath.Join(tmp, "sr-router-telemetry.db"))
+	if err != nil {
+		t.Fatalf("opening telemetry database: %v", err)
+	}
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := col.RecordRouting(telemetry.RoutingEvent{ID: id, SelectedModel: "claude-sonnet", EstimatedCost: 0.0125}); err != nil {
+			t.Fatalf("recording event: %v", err)
+		}
+	}
+	col.Close()
+
+	stdout, stderr, err := run(t, "stats", "--compact")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	if stdout != "2 0.025000\n" {
+		t.Errorf("stats --compact = %q, want %q", stdout, "2 0.025000\n")
+	}
+
+	if _, _, err := run(t, "stats", "--compact", "--json"); err == nil {
+		t.Error("expected error combining --compact with --json")
+	}
+}
+
+func TestStatsWatchRejectsNonPositiveInterval(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	_, stderr, err := run(t, "stats", "--watch", "--interval", "0s")
+	if err == nil || !strings.Contains(stderr, "--interval") {
+		t.Fatalf("expected an --interval error, got err=%v stderr=%s", err, stderr)
+	}
+}
+
+// --------------------------------------------------------------------------
+// telemetry export command
+// --------------------------------------------------------------------------
+
+func TestTelemetryExport(t *testing.T) {
+	// The telemetry database lives in the temp dir; isolate it per test.
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	col, err := telemetry.NewCollector(filepath.Join(tmp, "sr-router-telemetry.db"))
+	if err != nil {
+		t.Fatalf("opening telemetry database: %v", err)
+	}
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := col.RecordRouting(telemetry.RoutingEvent{ID: id, RouteClass: "interactive", SelectedModel: "claude-sonnet"}); err != nil {
+			t.Fatalf("recording event: %v", err)
+		}
+	}
+	col.Close()
+
+	out := filepath.Join(tmp, "events.json")
+	if _, stderr, err := run(t, "telemetry", "export", "--format", "json", "--since", "1h", "--output", out); err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	var events []map[string]any
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatalf("export is not a JSON array: %v\n%s", err, data)
+	}
+	if len(events) != 2 || events[0]["id"] != "evt-1" {
+		t.Errorf("unexpected export: %s", data)
+	}
+
+	stdout, stderr, err := run(t, "telemetry", "export")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "id,timestamp,") {
+		t.Errorf("unexpected CSV export:\n%s", stdout)
+	}
+}
+
+func TestTelemetryExportInvalidFlags(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	if _, _, err := run(t, "telemetry", "export", "--format", "xml"); err == nil {
+		t.Error("expected error for unsupported --format")
+	}
+	if _, _, err := run(t, "telemetry", "export", "--since", "last tuesday"); err == nil {
+		t.Error("expected error for unparseable --since")
+	}
+}
+
+func TestTelemetryPrune(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	col, err := telemetry.NewCollector(filepath.Join(tmp, "sr-router-telemetry.db"))
+	if err != nil {
+		t.Fatalf("opening telemetry database: %v", err)
+	}
+	if err := col.RecordRouting(telemetry.RoutingEvent{ID: "evt-1", SelectedModel: "claude-sonnet"}); err != nil {
+		t.Fatalf("recording event: %v", err)
+	}
+	col.Close()
+
+	// A fresh event survives a 30-day cutoff.
+	stdout, stderr, err := run(t, "telemetry", "prune", "--older-than", "30d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Removed 0 events") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+
+	if _, _, err := run(t, "telemetry", "prune", "--older-than", "a while"); err == nil {
+		t.Error("expected error for unparseable --older-than")
+	}
+}
+
+// --------------------------------------------------------------------------
+// route --measure
+// --------------------------------------------------------------------------
+
+// writeMockConfig writes a minimal config directory whose only model is an
+// openai_compat model served at baseURL.
+func writeMockConfig(t *testing.T, baseURL string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"models.yaml": `defaults:
+  cost_weight: 0.4
+  quality_weight: 0.6
+  fallback_model: mock
+tiers:
+  budget:
+    models: [mock]
+models:
+  mock:
+    provider: openai_compat
+    api_model: mock-model
+    base_url: ` + baseURL + `
+    cost_per_1k_tokens: 0.002
+    quality_ceiling: 0.9
+    prompt_suffix: ""
+`,
+		"tasks.yaml":         "tasks: {}\n",
+		"route_classes.yaml": "route_classes:\n  interactive:\n    default_tier: budget\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestRouteMeasure(t *testing.T) {
+	var gotMaxTokens int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		gotMaxTokens = req.MaxTokens
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":400,"completion_tokens":100}}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cmd := exec.Command(binary, "--config", writeMockConfig(t, srv.URL),
+		"route", "--measure", "--max-tokens", "64", "--json", "hello")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr.String())
+	}
+
+	var out struct {
+		Model    string `json:"model"`
+		Measured struct {
+			ServedBy     string  `json:"served_by"`
+			LatencyMs    int64   `json:"latency_ms"`
+			InputTokens  int     `json:"input_tokens"`
+			OutputTokens int     `json:"output_tokens"`
+			CostUSD      float64 `json:"cost_usd"`
+		} `json:"measured"`
+	}
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	m := out.Measured
+	if m.ServedBy != "mock" {
+		t.Errorf("served_by = %q, want mock", m.ServedBy)
+	}
+	if m.LatencyMs < 50 {
+		t.Errorf("latency_ms = %d, want at least the provider's 50ms", m.LatencyMs)
+	}
+	if m.InputTokens != 400 || m.OutputTokens != 100 {
+		t.Errorf("tokens = %d in / %d out, want 400 / 100", m.InputTokens, m.OutputTokens)
+	}
+	if want := 0.001; m.CostUSD < want-1e-9 || m.CostUSD > want+1e-9 {
+		t.Errorf("cost_usd = %f, want %f", m.CostUSD, want)
+	}
+	if gotMaxTokens != 64 {
+		t.Errorf("provider received max_tokens %d, want 64", gotMaxTokens)
+	}
+}
+
+func TestRouteWithoutMeasureMakesNoCalls(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	cmd := exec.Command(binary, "--config", writeMockConfig(t, srv.URL), "route", "hello")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out)
+	}
+	if called {
+		t.Error("route without --measure called the provider")
+	}
+}
+
+// --------------------------------------------------------------------------
+// --json / --pretty
+// --------------------------------------------------------------------------
+
+func TestJSONAndPrettyOutput(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	commands := [][]string{
+		{"route", "Write a Go function"},
+		{"classify", "Write a Go function"},
+		{"models"},
+		{"stats"},
+	}
+	for _, args := range commands {
+		t.Run(args[0], func(t *testing.T) {
+			compact, stderr, err := run(t, append(append([]string{}, args...), "--json")...)
+			if err != nil {
+				t.Fatalf("--json: unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			if !json.Valid([]byte(compact)) {
+				t.Fatalf("--json output is not valid JSON: %s", compact)
+			}
+			if n := strings.Count(strings.TrimSpace(compact), "\n"); n != 0 {
+				t.Errorf("--json output spans %d lines, want a single line", n+1)
+			}
+
+			pretty, stderr, err := run(t, append(append([]string{}, args...), "--pretty")...)
+			if err != nil {
+				t.Fatalf("--pretty: unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			if !json.Valid([]byte(pretty)) {
+				t.Fatalf("--pretty output is not valid JSON: %s", pretty)
+			}
+			if !strings.Contains(pretty, "\n  \"") && !strings.Contains(pretty, "\n  {") {
+				t.Errorf("--pretty output is not indented:\n%s", pretty)
+			}
+		})
+	}
+}
+
+// --------------------------------------------------------------------------
+// bench
+// --------------------------------------------------------------------------
+
+func TestBench(t *testing.T) {
+	dir := writeMockConfig(t, "http://127.0.0.1:0")
+	tasks := "tasks:\n  architecture:\n    patterns: [\"architect\"]\n    required_strengths: [architecture]\n    min_quality: 0.5\n"
+	if err := os.WriteFile(filepath.Join(dir, "tasks.yaml"), []byte(tasks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts := filepath.Join(t.TempDir(), "prompts.txt")
+	content := "# sample prompts\nhello there\n\nsay hi\nArchitect a payments system\n"
+	if err := os.WriteFile(prompts, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(binary, "--config", dir, "bench", "--json", "--file", prompts).Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got struct {
+		Prompts      int            `json:"prompts"`
+		AvgCostPer1k float64        `json:"avg_cost_per_1k_tokens"`
+		Fallbacks    int            `json:"fallbacks"`
+		ByModel      map[string]int `json:"by_model"`
+		ByTaskType   map[string]int `json:"by_task_type"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v\nstdout: %s", err, out)
+	}
+	if got.Prompts != 3 {
+		t.Errorf("prompts = %d, want 3 (blank and comment lines skipped)", got.Prompts)
+	}
+	if got.Fallbacks != 1 {
+		t.Errorf("fallbacks = %d, want 1 for the architecture prompt", got.Fallbacks)
+	}
+	if got.ByModel["mock"] != 3 {
+		t.Errorf("by_model = %v, want mock: 3", got.ByModel)
+	}
+	if got.ByTaskType["architecture"] != 1 {
+		t.Errorf("by_task_type = %v, want architecture: 1", got.ByTaskType)
+	}
+	if got.AvgCostPer1k != 0.002 {
+		t.Errorf("avg cost = %v, want 0.002", got.AvgCostPer1k)
+	}
+}
+
+func TestBenchRequiresFile(t *testing.T) {
+	if _, _, err := run(t, "bench"); err == nil {
+		t.Fatal("expected an error without --file")
+	}
+}
+
+// --------------------------------------------------------------------------
+// --output flag
+// --------------------------------------------------------------------------
+
+func TestOutputFlagWritesFile(t *testing.T) {
+	tests := [][]string{
+		{"route", "--json", "Write a Go function for sorting"},
+		{"classify", "Summarize this document"},
+		{"models", "--tier", "budget"},
+	}
+
+	for _, args := range tests {
+		t.Run(args[0], func(t *testing.T) {
+			want, stderr, err := run(t, args...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+
+			path := filepath.Join(t.TempDir(), "nested", "dir", "result.out")
+			stdout, stderr, err := run(t, append(args, "--output", path)...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\nstderr: %s", err, stderr)
+			}
+			if stdout != "" {
+				t.Errorf("expected nothing on stdout, got %q", stdout)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading output file: %v", err)
+			}
+			if string(got) != want {
+				t.Errorf("file contents = %q, want stdout output %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOutputFlagReportsCreateError(t *testing.T) {
+	// A regular file cannot serve as the parent directory.
+	parent := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(parent, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := run(t, "models", "--output", filepath.Join(parent, "out.txt"))
+	if err == nil {
+		t.Fatal("expected an error when the output file cannot be created")
+	}
+	if !strings.Contains(stderr, "creating output directory") {
+		t.Errorf("stderr = %q, want it to explain the failure", stderr)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,24 +18,195 @@ type Config struct {
 	Models       map[string]Model        `yaml:"models"`
 	Tasks        map[string]TaskSpec     `yaml:"tasks"`
 	RouteClasses map[string]RouteClass   `yaml:"route_classes"`
+	Providers    map[string]ProviderSpec `yaml:"providers"`
+	Proxy        ProxyConfig             `yaml:"proxy"`
 }
 
+// ProxyConfig holds settings for the HTTP proxy. MaxBodyBytes caps the size
+// of an incoming request body; zero uses DefaultMaxBodyBytes.
+//
+// MaxConcurrentRequests limits how many /v1/messages requests are handled at
+// once (zero means no limit). A request arriving when every slot is taken
+// waits up to QueueTimeoutMs for one to free up, then is rejected with 429;
+// a zero timeout rejects it immediately.
+//
+// BackgroundModels lists substrings matched, case-insensitively, against the
+// model a client asks for. A match marks the request as background work
+// whatever its content, as Claude Code does when it sends titles and other
+// housekeeping to a haiku-class model. Unset means DefaultBackgroundModels;
+// an empty list turns the check off.
+//
+// ResponseCacheTTLMs, when positive, turns on caching of non-streaming
+// responses to requests sent with temperature 0, which are deterministic.
+// Identical requests within the TTL are answered from the cache without a
+// provider call. ResponseCacheSize caps the number of cached responses
+// (default 256).
+//
+// CoalesceRequests lets identical temperature-0 non-streaming requests from
+// the same caller that are in flight at the same time share one provider
+// call.
+//
+// MaxStreamLineBytes is the longest single line accepted from a provider's
+// streaming response; zero uses DefaultMaxStreamLineBytes. A longer line
+// ends the stream with an error event.
+//
+// StreamFlushMs, when positive, lets the streaming translators hold text
+// deltas for up to that many milliseconds and send those that arrive in the
+// meantime as one event and one flush, cutting per-token writes under load.
+// Zero sends every delta as soon as it arrives.
+//
+// Transforms lists built-in rewrites applied, in order, to each request's
+// system prompt and messages before it is classified and sent on:
+// "strip_system_reminders" removes <system-reminder> blocks,
+// "redact_emails" replaces email addresses, and "truncate_to_context" drops
+// the oldest messages until the request fits the largest max_context among
+// the enabled models at startup. That bound is the largest configured
+// context, not the routed model's: transforms run before routing, so a
+// request sent to a model with a smaller window can still exceed it.
+type ProxyConfig struct {
+	MaxBodyBytes          int64    `yaml:"max_body_bytes,omitempty"`
+	MaxConcurrentRequests int      `yaml:"max_concurrent_requests,omitempty"`
+	QueueTimeoutMs        int      `yaml:"queue_timeout_ms,omitempty"`
+	BackgroundModels      []string `yaml:"background_models,omitempty"`
+	ResponseCacheTTLMs    int      `yaml:"response_cache_ttl_ms,omitempty"`
+	ResponseCacheSize     int      `yaml:"response_cache_size,omitempty"`
+	CoalesceRequests      bool     `yaml:"coalesce_requests,omitempty"`
+	MaxStreamLineBytes    int      `yaml:"max_stream_line_bytes,omitempty"`
+	StreamFlushMs         int      `yaml:"stream_flush_ms,omitempty"`
+	Transforms            []string `yaml:"transforms,omitempty"`
+}
+
+// DefaultMaxBodyBytes is the request body limit used when
+// proxy.max_body_bytes is unset.
+const DefaultMaxBodyBytes = 10 << 20
+
+// DefaultMaxStreamLineBytes is the streaming line limit used when
+// proxy.max_stream_line_bytes is unset.
+const DefaultMaxStreamLineBytes = 16 << 20
+
+// DefaultExpectedOutputTokens is the output reservation used in cost
+// estimates when neither the task nor defaults.expected_output_tokens sets
+// one.
+const DefaultExpectedOutputTokens = 500
+
+// DefaultBackgroundModels is used when proxy.background_models is unset.
+var DefaultBackgroundModels = []string{"haiku"}
+
 type Defaults struct {
 	QualityThreshold float64 `yaml:"quality_threshold"`
 	CostWeight       float64 `yaml:"cost_weight"`
 	QualityWeight    float64 `yaml:"quality_weight"`
 	FallbackModel    string  `yaml:"fallback_model"`
+
+	// FallbackChain lists last-resort models, tried in order after the
+	// tier's failover chain and before FallbackModel. Models already in the
+	// chain are not tried twice.
+	FallbackChain []string `yaml:"fallback_chain,omitempty"`
+
+	// MaxFailoverAttempts caps how many provider calls a single request may
+	// make across its failover chain. Zero means no cap.
+	MaxFailoverAttempts int `yaml:"max_failover_attempts,omitempty"`
+
+	// MaxTokensCap clamps the max_tokens sent to providers, guarding against
+	// clients that omit it or ask for very long generations. Zero disables
+	// the cap.
+	MaxTokensCap int `yaml:"max_tokens_cap,omitempty"`
+
+	// TierEscalation, when set, confines routing to the classified tier and
+	// lists the tiers to try, in order, when that tier has no qualifying
+	// model (e.g. [budget, speed, premium]). When empty, every configured
+	// model is a candidate regardless of tier.
+	TierEscalation []string `yaml:"tier_escalation,omitempty"`
+
+	// Selection picks among scored candidates: "argmax" (the default when
+	// empty) always takes the highest score, "weighted_random" samples from
+	// the top SelectionTopK candidates (default 3) with probability
+	// proportional to a softmax of their scores at SelectionTemperature
+	// (default 0.1). Lower temperatures favour the best score more strongly.
+	Selection            string  `yaml:"selection,omitempty"`
+	SelectionTopK        int     `yaml:"selection_top_k,omitempty"`
+	SelectionTemperature float64 `yaml:"selection_temperature,omitempty"`
+
+	// LogSampleRate is the fraction (0.0-1.0) of proxy requests whose full
+	// routing details, including a truncated prompt preview, are logged.
+	LogSampleRate float64 `yaml:"log_sample_rate,omitempty"`
+
+	// ShadowModel, when set, is sent a copy of each sampled proxy request
+	// after the real response has been served, and its latency and cost are
+	// recorded in telemetry as a shadow event. The client never sees its
+	// answer. ShadowSampleRate is the fraction (0.0-1.0) of requests
+	// shadowed; zero shadows every request.
+	ShadowModel      string  `yaml:"shadow_model,omitempty"`
+	ShadowSampleRate float64 `yaml:"shadow_sample_rate,omitempty"`
+
+	// LongConversation raises the quality bar for conversations long enough
+	// to benefit from larger-context, higher-quality models.
+	LongConversation LongConversationConfig `yaml:"long_conversation,omitempty"`
+
+	// ClassificationCacheSize is the number of classification results kept
+	// in an LRU cache keyed by prompt and headers. Zero disables caching.
+	ClassificationCacheSize int `yaml:"classification_cache_size,omitempty"`
+
+	// Classifier selects the task-detection backend: "regex" (the default
+	// when empty) or "embedding".
+	Classifier string          `yaml:"classifier,omitempty"`
+	Embedding  EmbeddingConfig `yaml:"embedding,omitempty"`
+
+	// ExpectedOutputTokens is the number of output tokens cost estimates
+	// reserve for a prompt whose task sets no expected_output_tokens. Zero
+	// uses DefaultExpectedOutputTokens.
+	ExpectedOutputTokens int `yaml:"expected_output_tokens,omitempty"`
+}
+
+// LongConversationConfig marks a conversation as long once it reaches Turns
+// messages or Chars characters of message text (zero disables either check).
+// A long conversation's quality floor is raised to at least MinQuality and,
+// when Tier is set, it is routed from that tier instead of the route class
+// default.
+type LongConversationConfig struct {
+	Turns      int     `yaml:"turns,omitempty"`
+	Chars      int     `yaml:"chars,omitempty"`
+	MinQuality float64 `yaml:"min_quality,omitempty"`
+	Tier       string  `yaml:"tier,omitempty"`
+}
+
+// EmbeddingConfig points the embedding classifier at an Ollama-compatible
+// /api/embeddings endpoint. TimeoutMs bounds each prompt embedding before
+// classification falls back to regex (default 2000).
+type EmbeddingConfig struct {
+	BaseURL   string `yaml:"base_url"`
+	Model     string `yaml:"model"`
+	TimeoutMs int    `yaml:"timeout_ms,omitempty"`
 }
 
+// Tier is a named group of models. PreferredModel, when set, wins ties
+// between equally scored candidates routed within the tier, instead of the
+// alphabetically first.
 type Tier struct {
-	Description string   `yaml:"description"`
-	Models      []string `yaml:"models"`
+	Description    string   `yaml:"description"`
+	Models         []string `yaml:"models"`
+	PreferredModel string   `yaml:"preferred_model,omitempty"`
 }
 
 type FailoverSpec struct {
 	Chain      []string `yaml:"chain"`
 	RetryOn    []string `yaml:"retry_on"`
 	MaxRetries int      `yaml:"max_retries"`
+
+	// RetryOnBodyPatterns are regexes matched against successful
+	// non-streaming response bodies. A match (e.g. a provider reporting a
+	// content-filter block with a 200) is treated as a failure and the
+	// request fails over to the next model.
+	RetryOnBodyPatterns []string `yaml:"retry_on_body_patterns,omitempty"`
+}
+
+// ProviderSpec holds per-provider settings, keyed in Config.Providers by a
+// provider kind or by a base_url host. RequestsPerMinute of zero disables
+// rate limiting; Burst is the number of requests that may be sent
+// back-to-back (default 1).
+type ProviderSpec struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst,omitempty"`
 }
 
 type Model struct {
@@ -45,13 +219,56 @@ type Model struct {
 	AvgLatencyMs   int      `yaml:"avg_latency_ms"`
 	QualityCeiling float64  `yaml:"quality_ceiling"`
 	MaxContext     int      `yaml:"max_context"`
+	PromptPrefix   *string  `yaml:"prompt_prefix,omitempty"`
 	PromptSuffix   *string  `yaml:"prompt_suffix"`
+
+	// MaxOutputTokens is the model's output limit. It replaces the global
+	// 4096 default when a request omits max_tokens, and larger requests are
+	// clamped to it. Zero means no model-specific limit.
+	MaxOutputTokens int `yaml:"max_output_tokens,omitempty"`
+
+	// AuthStyle selects how an openai_compat model is addressed: "bearer"
+	// (the default when empty) posts to {base_url}/chat/completions with an
+	// Authorization: Bearer key, while "azure" follows Azure OpenAI's
+	// conventions, treating api_model as the deployment name and sending an
+	// api-key header. APIVersion is Azure's api-version query parameter.
+	AuthStyle  string `yaml:"auth_style,omitempty"`
+	APIVersion string `yaml:"api_version,omitempty"`
+
+	// Tags are free-form labels such as "on-prem" or "region:us" for
+	// grouping models independently of tiers. They do not affect routing.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Disabled takes the model out of rotation: it is never selected by the
+	// router or tried during failover. Models can also be disabled without
+	// editing YAML by listing them in SR_ROUTER_DISABLED_MODELS.
+	Disabled bool `yaml:"disabled,omitempty"`
 }
 
 type TaskSpec struct {
 	Patterns          []string `yaml:"patterns"`
+	Examples          []string `yaml:"examples,omitempty"`
 	RequiredStrengths []string `yaml:"required_strengths"`
 	MinQuality        float64  `yaml:"min_quality"`
+
+	// Weight scales how much each matching pattern counts when choosing
+	// between tasks; zero means 1. Give a specialised task such as
+	// code_review a weight above 1 so it wins over a broader task (code)
+	// that matches the same prompt as often.
+	Weight float64 `yaml:"weight,omitempty"`
+
+	// StrengthMatch is "all" (the default) to require a model to have every
+	// required strength, or "any" to accept a model with at least one.
+	StrengthMatch string `yaml:"strength_match,omitempty"`
+
+	// ExpectedOutputTokens overrides defaults.expected_output_tokens for
+	// prompts of this task in cost estimates.
+	ExpectedOutputTokens int `yaml:"expected_output_tokens,omitempty"`
+
+	// MaxTokens and Temperature, when set, are applied to requests of this
+	// task that omit them, overriding the route class's settings.
+	MaxTokens   int      `yaml:"max_tokens,omitempty"`
+	Temperature *float64 `yaml:"temperature,omitempty"`
 }
 
 type RouteClass struct {
@@ -60,10 +277,22 @@ type RouteClass struct {
 	DefaultTier     string          `yaml:"default_tier"`
 	LatencyBudgetMs int             `yaml:"latency_budget_ms"`
 	QualityFloor    float64         `yaml:"quality_floor"`
+
+	// MaxTokens and Temperature, when set, are applied to requests in this
+	// class that omit them.
+	MaxTokens   int      `yaml:"max_tokens,omitempty"`
+	Temperature *float64 `yaml:"temperature,omitempty"`
+
+	// ServiceTier, when set, is the Anthropic service_tier ("auto" or
+	// "standard_only") sent with requests in this class that omit one.
+	ServiceTier string `yaml:"service_tier,omitempty"`
 }
 
+// DetectionConfig lists the signals that select a route class. Stdin, when
+// set, matches CLI invocations whose stdin is (true) or is not (false) an
+// interactive terminal; nil means stdin is not considered.
 type DetectionConfig struct {
-	Stdin                bool     `yaml:"stdin,omitempty"`
+	Stdin                *bool    `yaml:"stdin,omitempty"`
 	Flags                []string `yaml:"flags,omitempty"`
 	Headers              []string `yaml:"headers,omitempty"`
 	Env                  []string `yaml:"env,omitempty"`
@@ -103,9 +332,27 @@ func Load(configDir string) (*Config, error) {
 	}
 	cfg.RouteClasses = rcWrapper.RouteClasses
 
+	cfg.disableModels(os.Getenv(DisabledModelsEnv))
+
 	return cfg, nil
 }
 
+// DisabledModelsEnv names the environment variable holding a comma-separated
+// list of models to disable in addition to those marked disabled in YAML.
+const DisabledModelsEnv = "SR_ROUTER_DISABLED_MODELS"
+
+// disableModels marks every model in the comma-separated list as disabled.
+// Names that are not configured models are ignored.
+func (c *Config) disableModels(list string) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if m, ok := c.Models[name]; ok {
+			m.Disabled = true
+			c.Models[name] = m
+		}
+	}
+}
+
 func loadYAML(path string, target interface{}) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -131,3 +378,93 @@ func (c *Config) GetTierModels(tier string) []string {
 	}
 	return nil
 }
+
+// HasTags reports whether the model carries every one of tags. An empty
+// list matches any model.
+func (m Model) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(m.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetModelsByTag returns the sorted names of the models carrying every one
+// of tags.
+func (c *Config) GetModelsByTag(tags ...string) []string {
+	var names []string
+	for name, m := range c.Models {
+		if m.HasTags(tags) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsBackgroundModel reports whether a client's requested model name matches
+// proxy.background_models (or DefaultBackgroundModels when unset).
+func (c *Config) IsBackgroundModel(requested string) bool {
+	patterns := c.Proxy.BackgroundModels
+	if patterns == nil {
+		patterns = DefaultBackgroundModels
+	}
+	requested = strings.ToLower(requested)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(requested, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaxBodyBytes returns the configured proxy request body limit, or
+// DefaultMaxBodyBytes when unset.
+func (c *Config) GetMaxBodyBytes() int64 {
+	if c.Proxy.MaxBodyBytes > 0 {
+		return c.Proxy.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// GetExpectedOutputTokens returns the output tokens to reserve when
+// estimating the cost of a prompt classified as task: the task's
+// expected_output_tokens, else defaults.expected_output_tokens, else
+// DefaultExpectedOutputTokens.
+func (c *Config) GetExpectedOutputTokens(task string) int {
+	if t, ok := c.Tasks[task]; ok && t.ExpectedOutputTokens > 0 {
+		return t.ExpectedOutputTokens
+	}
+	if c.Defaults.ExpectedOutputTokens > 0 {
+		return c.Defaults.ExpectedOutputTokens
+	}
+	return DefaultExpectedOutputTokens
+}
+
+// GetRequestDefaults returns the max_tokens and temperature to apply to a
+// request in routeClass classified as task when the request omits them:
+// each comes from the task when it sets one, else from the route class. A
+// zero max_tokens or nil temperature means no default.
+func (c *Config) GetRequestDefaults(routeClass, task string) (maxTokens int, temperature *float64) {
+	rc := c.RouteClasses[routeClass]
+	maxTokens, temperature = rc.MaxTokens, rc.Temperature
+	if t, ok := c.Tasks[task]; ok {
+		if t.MaxTokens > 0 {
+			maxTokens = t.MaxTokens
+		}
+		if t.Temperature != nil {
+			temperature = t.Temperature
+		}
+	}
+	return maxTokens, temperature
+}
+
+// GetMaxStreamLineBytes returns the configured limit on a single line of a
+// provider's streaming response, or DefaultMaxStreamLineBytes when unset.
+func (c *Config) GetMaxStreamLineBytes() int {
+	if c.Proxy.MaxStreamLineBytes > 0 {
+		return c.Proxy.MaxStreamLineBytes
+	}
+	return DefaultMaxStreamLineBytes
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -69,3 +70,109 @@ func TestTiersExist(t *testing.T) {
 		}
 	}
 }
+
+func TestGetMaxBodyBytes(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.GetMaxBodyBytes(); got != DefaultMaxBodyBytes {
+		t.Errorf("unset limit: got %d, want default %d", got, DefaultMaxBodyBytes)
+	}
+	cfg.Proxy.MaxBodyBytes = 4096
+	if got := cfg.GetMaxBodyBytes(); got != 4096 {
+		t.Errorf("configured limit: got %d, want 4096", got)
+	}
+}
+
+func TestGetRequestDefaults(t *testing.T) {
+	low, lower := 0.2, 0.0
+	cfg := &Config{
+		RouteClasses: map[string]RouteClass{
+			"compaction":  {MaxTokens: 2000, Temperature: &low},
+			"interactive": {},
+		},
+		Tasks: map[string]TaskSpec{
+			"summarization":   {MaxTokens: 500, Temperature: &lower},
+			"data_extraction": {MaxTokens: 800},
+			"code":            {},
+		},
+	}
+
+	tests := []struct {
+		routeClass, task string
+		maxTokens        int
+		temperature      *float64
+	}{
+		{"compaction", "code", 2000, &low},
+		{"compaction", "summarization", 500, &lower},
+		{"compaction", "data_extraction", 800, &low},
+		{"interactive", "summarization", 500, &lower},
+		{"interactive", "code", 0, nil},
+		{"unknown", "unknown", 0, nil},
+	}
+	for _, tt := range tests {
+		maxTokens, temperature := cfg.GetRequestDefaults(tt.routeClass, tt.task)
+		if maxTokens != tt.maxTokens || temperature != tt.temperature {
+			t.Errorf("GetRequestDefaults(%s, %s) = %d, %v; want %d, %v",
+				tt.routeClass, tt.task, maxTokens, temperature, tt.maxTokens, tt.temperature)
+		}
+	}
+}
+
+func TestDisabledModelsEnv(t *testing.T) {
+	t.Setenv(DisabledModelsEnv, " claude-opus, no-such-model ,")
+	cfg, err := Load(".")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	for name, m := range cfg.Models {
+		if want := name == "claude-opus"; m.Disabled != want {
+			t.Errorf("model %s disabled = %v, want %v", name, m.Disabled, want)
+		}
+	}
+	if _, ok := cfg.Models["no-such-model"]; ok {
+		t.Error("unknown name in the env override should not add a model")
+	}
+}
+
+func TestIsBackgroundModel(t *testing.T) {
+	cfg := &Config{}
+	if !cfg.IsBackgroundModel("claude-3-5-Haiku-20241022") {
+		t.Error("default list should match a haiku model case-insensitively")
+	}
+	if cfg.IsBackgroundModel("claude-sonnet-4-5") {
+		t.Error("default list should not match sonnet")
+	}
+
+	cfg.Proxy.BackgroundModels = []string{"mini"}
+	if cfg.IsBackgroundModel("claude-haiku-4-5") || !cfg.IsBackgroundModel("gpt-4o-mini") {
+		t.Error("a configured list should replace the default")
+	}
+
+	cfg.Proxy.BackgroundModels = []string{}
+	if cfg.IsBackgroundModel("claude-haiku-4-5") {
+		t.Error("an empty list should disable the check")
+	}
+}
+
+func TestGetModelsByTag(t *testing.T) {
+	cfg := &Config{Models: map[string]Model{
+		"a": {Tags: []string{"on-prem", "fast"}},
+		"b": {Tags: []string{"on-prem"}},
+		"c": {Tags: []string{"hosted", "fast"}},
+		"d": {},
+	}}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"on-prem"}, []string{"a", "b"}},
+		{[]string{"on-prem", "fast"}, []string{"a"}},
+		{[]string{"hosted", "on-prem"}, nil},
+		{nil, []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		if got := cfg.GetModelsByTag(tt.tags...); !slices.Equal(got, tt.want) {
+			t.Errorf("GetModelsByTag(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
@@ -6,7 +6,7 @@ PROMPT=$(echo "$INPUT" | jq -r '.prompt // empty')
 SR="${CLAUDE_PLUGIN_ROOT}/bin/sr-router"
 [ ! -x "$SR" ] && exit 0
 
-RESULT=$("$SR" route --json --config "${CLAUDE_PLUGIN_ROOT}/config" "$PROMPT" 2>/dev/null)
+RESULT=$(echo "$INPUT" | "$SR" route --json --stdin --config "${CLAUDE_PLUGIN_ROOT}/config" 2>/dev/null)
 [ -z "$RESULT" ] && exit 0
 
 MODEL=$(echo "$RESULT" | jq -r '.model')
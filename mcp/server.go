@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/jbctechsolutions/sr-router/config"
 	"github.com/jbctechsolutions/sr-router/router"
@@ -14,7 +15,9 @@ import (
 
 // MCPServer exposes sr-router capabilities over the Model Context Protocol
 // using stdio transport. It wraps the classifier, router, and telemetry
-// collector and registers four tools: route, classify, models, and stats.
+// collector and registers six tools: route, route_and_estimate, classify,
+// models, stats, and feedback, plus the config resource (see
+// configResourceURI).
 type MCPServer struct {
 	cfg        *config.Config
 	classifier *router.Classifier
@@ -39,13 +42,20 @@ func NewMCPServer(
 	}
 }
 
-// Start registers all tools with a new MCP server and begins serving requests
-// over stdio. It blocks until stdin is closed or an error occurs.
+// Start registers all tools and resources with a new MCP server and begins
+// serving requests over stdio. It blocks until stdin is closed or an error
+// occurs.
 func (m *MCPServer) Start() error {
+	return server.ServeStdio(m.newServer())
+}
+
+// newServer builds the MCP server with every tool and resource registered.
+func (m *MCPServer) newServer() *server.MCPServer {
 	s := server.NewMCPServer(
 		"sr-router",
 		"0.1.0",
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, false),
 	)
 
 	s.AddTool(mcpgo.NewTool("route",
@@ -59,6 +69,22 @@ func (m *MCPServer) Start() error {
 		),
 	), m.handleRoute)
 
+	s.AddTool(mcpgo.NewTool("route_and_estimate",
+		mcpgo.WithDescription("Route a prompt and estimate the total cost of the prompt plus the expected output"),
+		mcpgo.WithString("prompt",
+			mcpgo.Required(),
+			mcpgo.Description("The prompt to classify and route"),
+		),
+		mcpgo.WithNumber("expected_output_tokens",
+			mcpgo.Required(),
+			mcpgo.Description("Number of output tokens the caller expects the model to generate"),
+			mcpgo.Min(0),
+		),
+		mcpgo.WithString("mode",
+			mcpgo.Description("Override route class: interactive, background, or compaction"),
+		),
+	), m.handleRouteAndEstimate)
+
 	s.AddTool(mcpgo.NewTool("classify",
 		mcpgo.WithDescription("Classify a prompt without routing — returns task type and route class"),
 		mcpgo.WithString("prompt",
@@ -72,6 +98,13 @@ func (m *MCPServer) Start() error {
 		mcpgo.WithString("tier",
 			mcpgo.Description("Filter by tier: premium, budget, speed, free"),
 		),
+		mcpgo.WithString("provider",
+			mcpgo.Description("Filter by provider: anthropic, openai_compat, ollama"),
+		),
+		mcpgo.WithArray("tags",
+			mcpgo.WithStringItems(),
+			mcpgo.Description("Only list models carrying every one of these tags"),
+		),
 	), m.handleModels)
 
 	s.AddTool(mcpgo.NewTool("stats",
@@ -81,7 +114,29 @@ func (m *MCPServer) Start() error {
 		),
 	), m.handleStats)
 
-	return server.ServeStdio(s)
+	s.AddTool(mcpgo.NewTool("feedback",
+		mcpgo.WithDescription("Record a rating for a routing event"),
+		mcpgo.WithString("event_id",
+			mcpgo.Required(),
+			mcpgo.Description("ID of the routing event to rate"),
+		),
+		mcpgo.WithNumber("rating",
+			mcpgo.Required(),
+			mcpgo.Description("Rating from 1 (poor) to 5 (excellent)"),
+			mcpgo.Min(1),
+			mcpgo.Max(5),
+		),
+		mcpgo.WithString("override",
+			mcpgo.Description("Model the user would have preferred"),
+		),
+	), m.handleFeedback)
+
+	s.AddResource(mcpgo.NewResource(configResourceURI, "Model catalogue",
+		mcpgo.WithResourceDescription("Configured models with capabilities and costs, and the models in each tier"),
+		mcpgo.WithMIMEType("application/json"),
+	), m.handleConfigResource)
+
+	return s
 }
 
 // routeResult is the JSON shape returned by the route tool.
@@ -103,17 +158,27 @@ func (m *MCPServer) handleRoute(ctx context.Context, req mcpgo.CallToolRequest)
 		return mcpgo.NewToolResultError(err.Error()), nil
 	}
 
+	b, err := json.Marshal(m.route(prompt, req.GetString("mode", "")))
+	if err != nil {
+		return mcpgo.NewToolResultError(fmt.Sprintf("marshal result: %v", err)), nil
+	}
+	return mcpgo.NewToolResultText(string(b)), nil
+}
+
+// route classifies and routes prompt. A non-empty mode overrides the route
+// class detected from content.
+func (m *MCPServer) route(prompt, mode string) routeResult {
 	// Build headers for the classifier. If the caller supplied a mode override,
 	// translate it into the x-request-type header so detectRouteClass picks it up.
 	headers := make(map[string]string)
-	if mode := req.GetString("mode", ""); mode != "" {
+	if mode != "" {
 		headers["x-request-type"] = mode
 	}
 
 	classification := m.classifier.Classify(prompt, headers)
 	decision := m.router.Route(classification)
 
-	result := routeResult{
+	return routeResult{
 		Model:        decision.Model,
 		Score:        decision.Score,
 		Tier:         decision.Tier,
@@ -122,6 +187,42 @@ func (m *MCPServer) handleRoute(ctx context.Context, req mcpgo.CallToolRequest)
 		TaskType:     classification.TaskType,
 		Alternatives: decision.Alternatives,
 	}
+}
+
+// routeAndEstimateResult is the JSON shape returned by the route_and_estimate
+// tool: the routing decision plus token and cost estimates.
+type routeAndEstimateResult struct {
+	routeResult
+	EstInputTokens  int     `json:"est_input_tokens"`
+	EstOutputTokens int     `json:"est_output_tokens"`
+	EstTotalCostUSD float64 `json:"est_total_cost_usd"`
+}
+
+// handleRouteAndEstimate routes the prompt like handleRoute and estimates the
+// cost of sending it to the selected model and receiving
+// expected_output_tokens in return, so an agent can decide whether to proceed.
+func (m *MCPServer) handleRouteAndEstimate(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+	prompt, err := req.RequireString("prompt")
+	if err != nil {
+		return mcpgo.NewToolResultError(err.Error()), nil
+	}
+	outputTokens, err := req.RequireInt("expected_output_tokens")
+	if err != nil {
+		return mcpgo.NewToolResultError(err.Error()), nil
+	}
+	if outputTokens < 0 {
+		return mcpgo.NewToolResultError(fmt.Sprintf("expected_output_tokens must not be negative, got %d", outputTokens)), nil
+	}
+
+	rr := m.route(prompt, req.GetString("mode", ""))
+	inputTokens := router.EstimateTokens(prompt)
+
+	result := routeAndEstimateResult{
+		routeResult:     rr,
+		EstInputTokens:  inputTokens,
+		EstOutputTokens: outputTokens,
+		EstTotalCostUSD: m.router.EstimateCost(rr.Model, inputTokens+outputTokens),
+	}
 
 	b, err := json.Marshal(result)
 	if err != nil {
@@ -175,12 +276,16 @@ type modelEntry struct {
 	CostPer1kTok   float64  `json:"cost_per_1k_tokens"`
 	QualityCeiling float64  `json:"quality_ceiling"`
 	Strengths      []string `json:"strengths"`
+	Tags           []string `json:"tags,omitempty"`
 }
 
 // handleModels returns the list of configured models, optionally filtered by
-// tier. When no tier is specified every model in the catalogue is returned.
+// tier, provider, and tags (a model must carry all of them). When none is
+// specified every model in the catalogue is returned.
 func (m *MCPServer) handleModels(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
 	tierFilter := req.GetString("tier", "")
+	providerFilter := req.GetString("provider", "")
+	tagFilter := req.GetStringSlice("tags", nil)
 
 	// Collect the model names we want to expose.
 	var names []string
@@ -198,7 +303,7 @@ func (m *MCPServer) handleModels(ctx context.Context, req mcpgo.CallToolRequest)
 	entries := make([]modelEntry, 0, len(names))
 	for _, name := range names {
 		model, ok := m.cfg.Models[name]
-		if !ok {
+		if !ok || (providerFilter != "" && model.Provider != providerFilter) || !model.HasTags(tagFilter) {
 			continue
 		}
 		entries = append(entries, modelEntry{
@@ -207,6 +312,7 @@ func (m *MCPServer) handleModels(ctx context.Context, req mcpgo.CallToolRequest)
 			CostPer1kTok:   model.CostPer1kTok,
 			QualityCeiling: model.QualityCeiling,
 			Strengths:      model.Strengths,
+			Tags:           model.Tags,
 		})
 	}
 
@@ -217,9 +323,71 @@ func (m *MCPServer) handleModels(ctx context.Context, req mcpgo.CallToolRequest)
 	return mcpgo.NewToolResultText(string(b)), nil
 }
 
+// configResourceURI identifies the resource describing the configured models
+// and tiers.
+const configResourceURI = "sr-router://config/models"
+
+// configResource is the JSON shape of the config resource.
+type configResource struct {
+	Models []modelEntry         `json:"models"`
+	Tiers  map[string]tierEntry `json:"tiers"`
+}
+
+// tierEntry is the JSON shape for a single tier in the config resource.
+type tierEntry struct {
+	Description    string   `json:"description"`
+	Models         []string `json:"models"`
+	PreferredModel string   `json:"preferred_model,omitempty"`
+}
+
+// handleConfigResource returns the model catalogue, sorted by name, and the
+// tier definitions, so a client can reason about the available models
+// without calling the models tool.
+func (m *MCPServer) handleConfigResource(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents, error) {
+	names := make([]string, 0, len(m.cfg.Models))
+	for name := range m.cfg.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := configResource{
+		Models: make([]modelEntry, 0, len(names)),
+		Tiers:  make(map[string]tierEntry, len(m.cfg.Tiers)),
+	}
+	for _, name := range names {
+		model := m.cfg.Models[name]
+		res.Models = append(res.Models, modelEntry{
+			Name:           name,
+			Provider:       model.Provider,
+			CostPer1kTok:   model.CostPer1kTok,
+			QualityCeiling: model.QualityCeiling,
+			Strengths:      model.Strengths,
+			Tags:           model.Tags,
+		})
+	}
+	for name, tier := range m.cfg.Tiers {
+		res.Tiers[name] = tierEntry{
+			Description:    tier.Description,
+			Models:         tier.Models,
+			PreferredModel: tier.PreferredModel,
+		}
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config resource: %w", err)
+	}
+	return []mcpgo.ResourceContents{mcpgo.TextResourceContents{
+		URI:      configResourceURI,
+		MIMEType: "application/json",
+		Text:     string(b),
+	}}, nil
+}
+
 // handleStats returns aggregate routing statistics from the telemetry
-// collector. An optional "model" argument scopes TotalRequests and TotalCost
-// to that model only.
+// collector, including estimated savings versus always using the fallback
+// model. An optional "model" argument scopes TotalRequests and TotalCost to
+// that model only.
 func (m *MCPServer) handleStats(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
 	if m.telemetry == nil {
 		return mcpgo.NewToolResultError("telemetry collector not available"), nil
@@ -231,6 +399,9 @@ func (m *MCPServer) handleStats(ctx context.Context, req mcpgo.CallToolRequest)
 	if err != nil {
 		return mcpgo.NewToolResultError(fmt.Sprintf("get stats: %v", err)), nil
 	}
+	if baseline, ok := m.cfg.Models[m.cfg.Defaults.FallbackModel]; ok {
+		stats.ApplyBaseline(m.cfg.Defaults.FallbackModel, baseline.CostPer1kTok)
+	}
 
 	b, err := json.Marshal(stats)
 	if err != nil {
@@ -238,3 +409,34 @@ func (m *MCPServer) handleStats(ctx context.Context, req mcpgo.CallToolRequest)
 	}
 	return mcpgo.NewToolResultText(string(b)), nil
 }
+
+// handleFeedback records a user rating (and optional preferred model) against
+// a previously routed event.
+func (m *MCPServer) handleFeedback(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+	if m.telemetry == nil {
+		return mcpgo.NewToolResultError("telemetry collector not available"), nil
+	}
+
+	eventID, err := req.RequireString("event_id")
+	if err != nil {
+		return mcpgo.NewToolResultError(err.Error()), nil
+	}
+	rating, err := req.RequireInt("rating")
+	if err != nil {
+		return mcpgo.NewToolResultError(err.Error()), nil
+	}
+	if rating < 1 || rating > 5 {
+		return mcpgo.NewToolResultError(fmt.Sprintf("rating must be between 1 and 5, got %d", rating)), nil
+	}
+	override := req.GetString("override", "")
+
+	if err := m.telemetry.RecordFeedback(eventID, rating, override); err != nil {
+		return mcpgo.NewToolResultError(fmt.Sprintf("record feedback: %v", err)), nil
+	}
+
+	msg := fmt.Sprintf("Feedback recorded for event %s (rating: %d", eventID, rating)
+	if override != "" {
+		msg += ", override: " + override
+	}
+	return mcpgo.NewToolResultText(msg + ")"), nil
+}
@@ -3,6 +3,10 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/jbctechsolutions/sr-router/config"
@@ -156,6 +160,72 @@ func TestHandleRouteMissingPrompt(t *testing.T) {
 	}
 }
 
+// --- route_and_estimate tool tests ---
+
+func routeAndEstimate(t *testing.T, srv *MCPServer, args map[string]any) routeAndEstimateResult {
+	t.Helper()
+	result, err := srv.handleRouteAndEstimate(context.Background(), makeRequest(args))
+	if err != nil {
+		t.Fatalf("handleRouteAndEstimate returned error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("handleRouteAndEstimate returned tool error: %+v", result.Content)
+	}
+
+	var rr routeAndEstimateResult
+	text := result.Content[0].(mcpgo.TextContent).Text
+	if err := json.Unmarshal([]byte(text), &rr); err != nil {
+		t.Fatalf("failed to unmarshal route_and_estimate result: %v", err)
+	}
+	return rr
+}
+
+func TestHandleRouteAndEstimateScalesWithOutputTokens(t *testing.T) {
+	srv := newTestServer(t, nil)
+	prompt := "Write a Go function for rate limiting"
+
+	small := routeAndEstimate(t, srv, map[string]any{"prompt": prompt, "expected_output_tokens": float64(1000)})
+	large := routeAndEstimate(t, srv, map[string]any{"prompt": prompt, "expected_output_tokens": float64(5000)})
+
+	if small.Model == "" || small.Model != large.Model {
+		t.Fatalf("expected the same non-empty model for both calls, got %q and %q", small.Model, large.Model)
+	}
+	if small.EstInputTokens != router.EstimateTokens(prompt) {
+		t.Errorf("est_input_tokens = %d, want %d", small.EstInputTokens, router.EstimateTokens(prompt))
+	}
+	if small.EstOutputTokens != 1000 || large.EstOutputTokens != 5000 {
+		t.Errorf("est_output_tokens = %d/%d, want 1000/5000", small.EstOutputTokens, large.EstOutputTokens)
+	}
+
+	costPerToken := srv.cfg.Models[small.Model].CostPer1kTok / 1000
+	if costPerToken == 0 {
+		t.Skipf("selected model %q is free; cost cannot scale", small.Model)
+	}
+	if large.EstTotalCostUSD <= small.EstTotalCostUSD {
+		t.Errorf("cost for 5000 output tokens ($%f) should exceed cost for 1000 ($%f)", large.EstTotalCostUSD, small.EstTotalCostUSD)
+	}
+	if diff := large.EstTotalCostUSD - small.EstTotalCostUSD; math.Abs(diff-4000*costPerToken) > 1e-9 {
+		t.Errorf("cost difference = %f, want %f for 4000 extra tokens", diff, 4000*costPerToken)
+	}
+}
+
+func TestHandleRouteAndEstimateInvalidOutputTokens(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	for _, args := range []map[string]any{
+		{"prompt": "hello"},
+		{"prompt": "hello", "expected_output_tokens": float64(-5)},
+	} {
+		result, err := srv.handleRouteAndEstimate(context.Background(), makeRequest(args))
+		if err != nil {
+			t.Fatalf("handleRouteAndEstimate returned Go error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("expected tool error for args %v", args)
+		}
+	}
+}
+
 // --- classify tool tests ---
 
 func TestHandleClassifyCodePrompt(t *testing.T) {
@@ -353,6 +423,98 @@ func TestHandleModelsFilterByTier(t *testing.T) {
 	}
 }
 
+func TestHandleModelsFilterByTags(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	tests := []struct {
+		tags []any
+		want []string
+	}{
+		{[]any{"on-prem"}, []string{"ollama/codellama", "ollama/llama3.2"}},
+		{[]any{"on-prem", "fast"}, []string{"ollama/llama3.2"}},
+	}
+	for _, tt := range tests {
+		result, err := srv.handleModels(context.Background(), makeRequest(map[string]any{
+			"tags": tt.tags,
+		}))
+		if err != nil || result.IsError {
+			t.Fatalf("handleModels(%v) failed: %v %+v", tt.tags, err, result)
+		}
+
+		var entries []modelEntry
+		text := result.Content[0].(mcpgo.TextContent).Text
+		if err := json.Unmarshal([]byte(text), &entries); err != nil {
+			t.Fatalf("failed to unmarshal models result: %v", err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		sort.Strings(names)
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("tags %v: got models %v, want %v", tt.tags, names, tt.want)
+		}
+	}
+}
+
+func TestHandleModelsFilterByProvider(t *testing.T) {
+	srv := newTestServer(t, nil)
+	cfg := loadTestConfig(t)
+
+	for _, provider := range []string{"anthropic", "openai_compat", "ollama"} {
+		t.Run(provider, func(t *testing.T) {
+			result, err := srv.handleModels(context.Background(), makeRequest(map[string]any{
+				"provider": provider,
+			}))
+			if err != nil {
+				t.Fatalf("handleModels returned error: %v", err)
+			}
+			if result.IsError {
+				t.Fatalf("handleModels returned tool error: %+v", result.Content)
+			}
+
+			var entries []modelEntry
+			text := result.Content[0].(mcpgo.TextContent).Text
+			if err := json.Unmarshal([]byte(text), &entries); err != nil {
+				t.Fatalf("failed to unmarshal models result: %v", err)
+			}
+
+			want := 0
+			for _, m := range cfg.Models {
+				if m.Provider == provider {
+					want++
+				}
+			}
+			if want == 0 || len(entries) != want {
+				t.Errorf("expected %d %s models, got %d", want, provider, len(entries))
+			}
+			for _, e := range entries {
+				if e.Provider != provider {
+					t.Errorf("model %q has provider %q, want %q", e.Name, e.Provider, provider)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleModelsFilterByTierAndProvider(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	result, err := srv.handleModels(context.Background(), makeRequest(map[string]any{
+		"tier":     "premium",
+		"provider": "ollama",
+	}))
+	if err != nil {
+		t.Fatalf("handleModels returned error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("handleModels returned tool error: %+v", result.Content)
+	}
+	if text := result.Content[0].(mcpgo.TextContent).Text; text != "[]" {
+		t.Errorf("expected no ollama models in the premium tier, got %s", text)
+	}
+}
+
 func TestHandleModelsUnknownTier(t *testing.T) {
 	srv := newTestServer(t, nil)
 
@@ -367,6 +529,52 @@ func TestHandleModelsUnknownTier(t *testing.T) {
 	}
 }
 
+// --- config resource tests ---
+
+func TestConfigResourceListsConfiguredModels(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"` + configResourceURI + `"}}`
+	reply := srv.newServer().HandleMessage(context.Background(), json.RawMessage(msg))
+	resp, ok := reply.(mcpgo.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("resources/read returned %T, want a response: %+v", reply, reply)
+	}
+	result, ok := resp.Result.(mcpgo.ReadResourceResult)
+	if !ok || len(result.Contents) != 1 {
+		t.Fatalf("unexpected resources/read result: %+v", resp.Result)
+	}
+	contents, ok := result.Contents[0].(mcpgo.TextResourceContents)
+	if !ok {
+		t.Fatalf("expected text contents, got %T", result.Contents[0])
+	}
+	if contents.MIMEType != "application/json" {
+		t.Errorf("MIME type = %q, want application/json", contents.MIMEType)
+	}
+
+	var res configResource
+	if err := json.Unmarshal([]byte(contents.Text), &res); err != nil {
+		t.Fatalf("failed to unmarshal config resource: %v", err)
+	}
+	var names []string
+	for _, e := range res.Models {
+		names = append(names, e.Name)
+	}
+	var want []string
+	for name := range srv.cfg.Models {
+		want = append(want, name)
+	}
+	sort.Strings(want)
+	if !slices.Equal(names, want) {
+		t.Errorf("resource models = %v, want %v", names, want)
+	}
+	for name, tier := range srv.cfg.Tiers {
+		if !slices.Equal(res.Tiers[name].Models, tier.Models) {
+			t.Errorf("tier %q models = %v, want %v", name, res.Tiers[name].Models, tier.Models)
+		}
+	}
+}
+
 // --- stats tool tests ---
 
 func TestHandleStatsWithTelemetry(t *testing.T) {
@@ -448,6 +656,9 @@ func TestHandleStatsWithRecordedEvents(t *testing.T) {
 	if stats.TotalRequests != 2 {
 		t.Errorf("expected 2 total requests, got %d", stats.TotalRequests)
 	}
+	if stats.ByRouteClass["interactive"] != 1 || stats.ByRouteClass["background"] != 1 {
+		t.Errorf("expected one interactive and one background event, got %v", stats.ByRouteClass)
+	}
 
 	// Filtered by model.
 	result, toolErr = srv.handleStats(context.Background(), makeRequest(map[string]any{
@@ -478,3 +689,110 @@ func TestHandleStatsNilTelemetry(t *testing.T) {
 		t.Error("expected tool error when telemetry collector is nil")
 	}
 }
+
+// --- feedback tool tests ---
+
+func TestHandleFeedbackRecordsRating(t *testing.T) {
+	tel, err := telemetry.NewCollector(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create telemetry collector: %v", err)
+	}
+	defer tel.Close()
+
+	if err := tel.RecordRouting(telemetry.RoutingEvent{
+		ID:            "evt-1",
+		RouteClass:    "interactive",
+		TaskType:      "code",
+		Tier:          "premium",
+		SelectedModel: "claude-sonnet",
+	}); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+
+	srv := newTestServer(t, tel)
+
+	result, toolErr := srv.handleFeedback(context.Background(), makeRequest(map[string]any{
+		"event_id": "evt-1",
+		"rating":   float64(4), // JSON numbers arrive as float64
+		"override": "claude-opus",
+	}))
+	if toolErr != nil {
+		t.Fatalf("handleFeedback returned error: %v", toolErr)
+	}
+	if result.IsError {
+		t.Fatalf("handleFeedback returned tool error: %+v", result.Content)
+	}
+
+	text := result.Content[0].(mcpgo.TextContent).Text
+	if text != "Feedback recorded for event evt-1 (rating: 4, override: claude-opus)" {
+		t.Errorf("unexpected confirmation: %q", text)
+	}
+}
+
+func TestHandleFeedbackUnknownEvent(t *testing.T) {
+	tel, err := telemetry.NewCollector(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create telemetry collector: %v", err)
+	}
+	defer tel.Close()
+
+	srv := newTestServer(t, tel)
+
+	result, err := srv.handleFeedback(context.Background(), makeRequest(map[string]any{
+		"event_id": "no-such-event",
+		"rating":   float64(3),
+	}))
+	if err != nil {
+		t.Fatalf("handleFeedback returned Go error: %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("expected tool error for an unknown event ID")
+	}
+	text := result.Content[0].(mcpgo.TextContent).Text
+	if !strings.Contains(text, "event not found") {
+		t.Errorf("error %q should say the event was not found", text)
+	}
+}
+
+func TestHandleFeedbackNilTelemetry(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	result, err := srv.handleFeedback(context.Background(), makeRequest(map[string]any{
+		"event_id": "evt-1",
+		"rating":   float64(3),
+	}))
+	if err != nil {
+		t.Fatalf("handleFeedback returned Go error: %v", err)
+	}
+	if !result.IsError {
+		t.Error("expected tool error when telemetry collector is nil")
+	}
+}
+
+func TestHandleFeedbackRatingOutOfRange(t *testing.T) {
+	tel, err := telemetry.NewCollector(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create telemetry collector: %v", err)
+	}
+	defer tel.Close()
+
+	srv := newTestServer(t, tel)
+
+	for _, rating := range []float64{0, 6, -1} {
+		result, err := srv.handleFeedback(context.Background(), makeRequest(map[string]any{
+			"event_id": "evt-1",
+			"rating":   rating,
+		}))
+		if err != nil {
+			t.Fatalf("rating %v: handleFeedback returned Go error: %v", rating, err)
+		}
+		if !result.IsError {
+			t.Errorf("rating %v: expected tool error for out-of-range rating", rating)
+			continue
+		}
+		text := result.Content[0].(mcpgo.TextContent).Text
+		if !strings.Contains(text, "between 1 and 5") {
+			t.Errorf("rating %v: error %q should describe the valid range", rating, text)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jbctechsolutions/sr-router/router"
+)
+
+// sharedResponse is a provider response read in full, so that every request
+// coalesced onto one upstream call can replay it.
+type sharedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	readErr error
+	model   string
+}
+
+// executeShared runs the failover chain for a deterministic non-streaming
+// request, sharing one upstream call between identical requests in flight
+// at the same time. key identifies the request and its caller (see
+// responseCacheKey); the routed model and the trace context headers are
+// added to it, so only requests whose upstream calls would be the same
+// share one. Each caller gets its own copy of the response, already
+// decompressed.
+//
+// The shared call is detached from the context of the request that started
+// it, so one client going away does not fail the others waiting on it.
+func (p *ProxyServer) executeShared(ctx context.Context, failover *router.FailoverEngine, key string, decision router.RoutingDecision, req router.ProviderRequest) (*http.Response, string, error) {
+	key = strings.Join([]string{key, decision.Model,
+		req.TraceHeaders.Get("traceparent"), req.TraceHeaders.Get("tracestate")}, "\x00")
+	v, err, shared := p.inflight.Do(key, func() (any, error) {
+		resp, usedModel, err := failover.ExecuteWithFailover(context.WithoutCancel(ctx), decision, req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, readErr := readProviderBody(resp)
+		return sharedResponse{status: resp.StatusCode, header: resp.Header, body: body, readErr: readErr, model: usedModel}, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if shared {
+		log.Printf("Coalesced identical in-flight requests onto one %s call", decision.Model)
+	}
+
+	res := v.(sharedResponse)
+	var body io.ReadCloser = io.NopCloser(bytes.NewReader(res.body))
+	if res.readErr != nil {
+		body = errorBody{res.readErr}
+	}
+	return &http.Response{StatusCode: res.status, Header: res.header.Clone(), Body: body}, res.model, nil
+}
+
+// errorBody is a response body whose reads fail with err.
+type errorBody struct{ err error }
+
+func (b errorBody) Read([]byte) (int, error) { return 0, b.err }
+func (errorBody) Close() error               { return nil }
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coalescingStubProxy returns a proxy with proxy.coalesce_requests set whose
+// provider counts calls and holds each one until release is closed.
+func coalescingStubProxy(t *testing.T, calls *int32, release <-chan struct{}) *ProxyServer {
+	t.Helper()
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"shared"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+	p.coalesce = true
+	return p
+}
+
+// afterFirstCall returns a ready function for postConcurrently that reports
+// true once the provider has been called and the other requests have had a
+// moment to join that call.
+func afterFirstCall(calls *int32) func() bool {
+	var reached time.Time
+	return func() bool {
+		if atomic.LoadInt32(calls) == 0 {
+			return false
+		}
+		if reached.IsZero() {
+			reached = time.Now()
+		}
+		return time.Since(reached) >= 100*time.Millisecond
+	}
+}
+
+// postConcurrently sends n copies of body at once, request i with headers(i)
+// when headers is non-nil, and returns the responses. The provider is
+// released only once ready reports that the requests have got as far as the
+// test needs.
+func postConcurrently(t *testing.T, p *ProxyServer, body string, n int, headers func(i int) map[string]string, release chan struct{}, ready func() bool) []*httptest.ResponseRecorder {
+	t.Helper()
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var h map[string]string
+			if headers != nil {
+				h = headers(i)
+			}
+			responses[i] = postMessages(t, p, body, h)
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !ready() {
+		if time.Now().After(deadline) {
+			close(release)
+			wg.Wait()
+			t.Fatal("requests did not reach the expected point in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	return responses
+}
+
+func TestHandleMessages_CoalescesIdenticalRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := coalescingStubProxy(t, &calls, release)
+
+	const n = 20
+	for i, w := range postConcurrently(t, p, deterministicBody("hello"), n, nil, release, afterFirstCall(&calls)) {
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200: %s", i, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"text":"shared"`) {
+			t.Errorf("request %d: body %s, want the shared response", i, w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("provider calls = %d, want 1 for %d identical requests", calls, n)
+	}
+}
+
+func TestHandleMessages_DoesNotCoalesceNonDeterministicRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := coalescingStubProxy(t, &calls, release)
+
+	const n = 5
+	ready := func() bool { return atomic.LoadInt32(&calls) == n }
+	postConcurrently(t, p, simpleRequestBody, n, nil, release, ready)
+	if calls != n {
+		t.Errorf("provider calls = %d, want %d when temperature is not 0", calls, n)
+	}
+}
+
+func TestHandleMessages_DoesNotCoalesceUnlessEnabled(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := coalescingStubProxy(t, &calls, release)
+	p.coalesce = false
+
+	const n = 5
+	ready := func() bool { return atomic.LoadInt32(&calls) == n }
+	postConcurrently(t, p, deterministicBody("hello"), n, nil, release, ready)
+	if calls != n {
+		t.Errorf("provider calls = %d, want %d with coalesce_requests off", calls, n)
+	}
+}
+
+func TestHandleMessages_DoesNotCoalesceAcrossCallers(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := coalescingStubProxy(t, &calls, release)
+
+	const n = 3
+	keys := func(i int) map[string]string {
+		return map[string]string{"X-Api-Key": fmt.Sprintf("key-%d", i)}
+	}
+	ready := func() bool { return atomic.LoadInt32(&calls) == n }
+	postConcurrently(t, p, deterministicBody("hello"), n, keys, release, ready)
+	if calls != n {
+		t.Errorf("provider calls = %d, want %d for requests with different API keys", calls, n)
+	}
+}
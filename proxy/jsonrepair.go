@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// repairJSON returns s compacted when it is valid JSON. Otherwise it treats
+// s as a document cut off part way through and tries to complete it: an
+// unterminated string is closed, a trailing comma dropped, a key left
+// without a value given null, and unclosed arrays and objects closed in
+// order. ok is false when s is still not valid JSON after that, such as
+// when it ends inside a number or literal.
+func repairJSON(s string) (json.RawMessage, bool) {
+	if out, ok := compactJSON(s); ok {
+		return out, true
+	}
+
+	var closers []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			closers = append(closers, '}')
+		case c == '[':
+			closers = append(closers, ']')
+		case c == '}' || c == ']':
+			if len(closers) == 0 || closers[len(closers)-1] != c {
+				return nil, false
+			}
+			closers = closers[:len(closers)-1]
+		}
+	}
+
+	base := s
+	if inString {
+		if escaped {
+			base = base[:len(base)-1]
+		}
+		base += `"`
+	}
+	base = strings.TrimRight(base, " \t\r\n")
+	base = strings.TrimSuffix(base, ",")
+
+	var tail strings.Builder
+	for i := len(closers) - 1; i >= 0; i-- {
+		tail.WriteByte(closers[i])
+	}
+	for _, fill := range []string{"", "null", ":null"} {
+		if out, ok := compactJSON(base + fill + tail.String()); ok {
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+// compactJSON returns s with insignificant whitespace removed, and whether s
+// is valid JSON.
+func compactJSON(s string) (json.RawMessage, bool) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// toolInput converts an OpenAI tool call's arguments, a JSON-encoded string
+// that may have been cut short, into an Anthropic tool_use input object.
+// Arguments that are empty, cannot be repaired, or are not an object become
+// {}.
+func toolInput(name, arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" {
+		return json.RawMessage(`{}`)
+	}
+	input, ok := repairJSON(arguments)
+	if !ok || input[0] != '{' {
+		log.Printf("Warning: tool call %s has unusable arguments %q, sending {}", name, previewText(arguments, samplePreviewChars))
+		return json.RawMessage(`{}`)
+	}
+	return input
+}
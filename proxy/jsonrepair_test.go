@@ -0,0 +1,30 @@
+package proxy
+
+import "testing"
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{`{"a": 1, "b": [true, null]}`, `{"a":1,"b":[true,null]}`, true},
+		{`{"city":"Par`, `{"city":"Par"}`, true},
+		{`{"path":"C:\\`, `{"path":"C:\\"}`, true},
+		{`{"path":"C:\`, `{"path":"C:"}`, true},
+		{`{"a":1,`, `{"a":1}`, true},
+		{`{"a":`, `{"a":null}`, true},
+		{`{"a":1,"b"`, `{"a":1,"b":null}`, true},
+		{`{"a":[1,2`, `{"a":[1,2]}`, true},
+		{`{"a":{"b":[{"c":"}]"`, `{"a":{"b":[{"c":"}]"}]}}`, true},
+		{`{"a":tr`, "", false},
+		{`{"a":1]`, "", false},
+		{`{"a":1}}`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := repairJSON(tt.in)
+		if ok != tt.ok || string(got) != tt.want {
+			t.Errorf("repairJSON(%q) = %s, %v; want %s, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"time"
+)
+
+// concurrencyLimiter is a counting semaphore bounding how many requests the
+// proxy handles at once. A nil limiter admits every request.
+type concurrencyLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newConcurrencyLimiter returns a limiter admitting max concurrent requests,
+// each waiting up to timeout for a slot. It returns nil when max is not
+// positive.
+func newConcurrencyLimiter(max int, timeout time.Duration) *concurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &concurrencyLimiter{slots: make(chan struct{}, max), timeout: timeout}
+}
+
+// acquire takes a slot, waiting up to the queue timeout or until ctx is
+// done. It reports whether a slot was taken; the caller must release it.
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l *concurrencyLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterRejectsWhenFull(t *testing.T) {
+	l := newConcurrencyLimiter(2, 0)
+	ctx := context.Background()
+	if !l.acquire(ctx) || !l.acquire(ctx) {
+		t.Fatal("expected two slots to be available")
+	}
+	if l.acquire(ctx) {
+		t.Fatal("third acquire succeeded with two slots taken")
+	}
+	l.release()
+	if !l.acquire(ctx) {
+		t.Error("acquire failed after a slot was released")
+	}
+}
+
+func TestConcurrencyLimiterQueues(t *testing.T) {
+	l := newConcurrencyLimiter(1, time.Second)
+	ctx := context.Background()
+	l.acquire(ctx)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.release()
+	}()
+	if !l.acquire(ctx) {
+		t.Error("queued acquire should succeed once the slot is released")
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := newConcurrencyLimiter(1, 20*time.Millisecond)
+	ctx := context.Background()
+	l.acquire(ctx)
+
+	start := time.Now()
+	if l.acquire(ctx) {
+		t.Fatal("acquire succeeded while the only slot was held")
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("gave up after %v, want at least the 20ms queue timeout", waited)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if !newConcurrencyLimiter(1, time.Hour).acquire(cancelled) {
+		t.Error("an empty limiter should admit even a cancelled request")
+	}
+	if l.acquire(cancelled) {
+		t.Error("acquire succeeded for a cancelled request while full")
+	}
+}
+
+func TestNilConcurrencyLimiterAdmitsAll(t *testing.T) {
+	l := newConcurrencyLimiter(0, 0)
+	if l != nil {
+		t.Fatal("expected nil limiter for max 0")
+	}
+	for i := 0; i < 100; i++ {
+		if !l.acquire(context.Background()) {
+			t.Fatal("nil limiter rejected a request")
+		}
+		l.release()
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
+)
+
+// DefaultConfigWatchDebounce is how long WatchConfig waits after the last
+// change to a config file before reloading, so an editor's burst of writes
+// triggers a single reload.
+const DefaultConfigWatchDebounce = 500 * time.Millisecond
+
+// current returns the config, router, and failover engine in use. Callers
+// keep the returned values for the rest of a request so that a concurrent
+// Reload cannot mix two configs within it.
+func (p *ProxyServer) current() (*config.Config, *router.Router, *router.FailoverEngine) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg, p.router, p.failover
+}
+
+// Reload switches the proxy to cfg: the classifier's patterns are replaced
+// in place and a new router and failover engine are built. Provider rate
+// limits that did not change keep their current budgets. If cfg's patterns
+// do not compile, the error is returned and the current config stays in
+// use. Settings under proxy: are fixed at startup: cfg's proxy: block is
+// replaced with the one in use, so none of them change.
+func (p *ProxyServer) Reload(cfg *config.Config) error {
+	p.mu.RLock()
+	reloaded := *cfg
+	reloaded.Proxy = p.cfg.Proxy
+	p.mu.RUnlock()
+	cfg = &reloaded
+
+	if err := p.classifier.Reload(cfg); err != nil {
+		return err
+	}
+	rtr := router.NewRouter(cfg)
+	failover := router.NewFailoverEngine(cfg, rtr, p.telemetry)
+
+	p.mu.Lock()
+	failover.KeepRateLimits(p.failover)
+	p.cfg, p.router, p.failover = cfg, rtr, failover
+	p.mu.Unlock()
+	return nil
+}
+
+// WatchConfig reloads the config from dir whenever one of its YAML files
+// changes, once debounce has passed without further changes. A config that
+// fails to load or compile is logged and the current one is kept. The
+// returned function stops watching.
+func (p *ProxyServer) WatchConfig(dir string, debounce time.Duration) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory rather than the files, so editors that save by
+	// renaming a new file over the old one are still noticed.
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigFile(ev.Name) || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) {
+					continue
+				}
+				if timer == nil {
+					timer = time.NewTimer(debounce)
+				} else {
+					timer.Reset(debounce)
+				}
+				fire = timer.C
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Warning: config watch: %v", err)
+			case <-fire:
+				fire = nil
+				p.reloadFrom(dir)
+			case <-done:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+		}
+	}()
+
+	log.Printf("Watching %s for config changes", dir)
+	return func() {
+		close(done)
+		watcher.Close() //nolint:errcheck
+	}, nil
+}
+
+// reloadFrom loads the config in dir and applies it, logging the outcome.
+func (p *ProxyServer) reloadFrom(dir string) {
+	cfg, err := config.Load(dir)
+	if err == nil {
+		err = p.Reload(cfg)
+	}
+	if err != nil {
+		log.Printf("Warning: config reload failed, keeping current config: %v", err)
+		return
+	}
+	log.Printf("Config reloaded from %s", dir)
+}
+
+// isConfigFile reports whether name is a YAML file.
+func isConfigFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
+)
+
+// copyConfigDir copies the real YAML config into a temporary directory.
+func copyConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"models.yaml", "tasks.yaml", "route_classes.yaml"} {
+		data, err := os.ReadFile(filepath.Join("../config", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// editConfig rewrites the file in dir, replacing old with new.
+func editConfig(t *testing.T, dir, file, old, new string) {
+	t.Helper()
+	path := filepath.Join(dir, file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), old) {
+		t.Fatalf("%s does not contain %q", file, old)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchConfigReloadsOnChange(t *testing.T) {
+	dir := copyConfigDir(t)
+	cfg, err := config.Load(dir)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	rtr := router.NewRouter(cfg)
+	p := &ProxyServer{
+		classifier: router.NewClassifier(cfg),
+		router:     rtr,
+		failover:   router.NewFailoverEngine(cfg, rtr, nil),
+		cfg:        cfg,
+		dryRun:     true,
+	}
+
+	const debounce = 50 * time.Millisecond
+	stop, err := p.WatchConfig(dir, debounce)
+	if err != nil {
+		t.Fatalf("WatchConfig: %v", err)
+	}
+	defer stop()
+
+	editConfig(t, dir, "models.yaml", "max_tokens_cap: 0", "max_tokens_cap: 1234")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if cfg, _, _ := p.current(); cfg.Defaults.MaxTokensCap == 1234 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("config change was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A config that fails to load leaves the last good one in use.
+	editConfig(t, dir, "models.yaml", "max_tokens_cap: 1234", "max_tokens_cap: [")
+	time.Sleep(10 * debounce)
+	if cfg, _, _ := p.current(); cfg.Defaults.MaxTokensCap != 1234 {
+		t.Errorf("max_tokens_cap = %d after an invalid edit, want 1234 kept", cfg.Defaults.MaxTokensCap)
+	}
+}
+
+// TestReloadKeepsProxySettings verifies that a reload leaves every proxy:
+// setting as it was at startup, including those read per request.
+func TestReloadKeepsProxySettings(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+	})
+	p.cfg.Proxy.MaxBodyBytes = 64
+
+	reloaded := *p.cfg
+	reloaded.Proxy.MaxBodyBytes = 1 << 20
+	if err := p.Reload(&reloaded); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if w := postMessages(t, p, simpleRequestBody, nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d, want 413 under the startup max_body_bytes", w.Code)
+	}
+	if got := p.cfg.Proxy.MaxBodyBytes; got != 64 {
+		t.Errorf("max_body_bytes after reload = %d, want 64", got)
+	}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultResponseCacheSize is the entry limit used when
+// proxy.response_cache_size is unset.
+const defaultResponseCacheSize = 256
+
+// cachedResponse is a complete Anthropic-format response body together with
+// the routing outcome reported in its headers.
+type cachedResponse struct {
+	body       []byte
+	model      string
+	tier       string
+	routeClass string
+	expires    time.Time
+}
+
+// responseCache is a mutex-guarded LRU cache of non-streaming responses to
+// deterministic (temperature 0) requests, each kept until its TTL expires. A
+// nil cache stores nothing.
+type responseCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+type responseCacheEntry struct {
+	key   string
+	value cachedResponse
+}
+
+// newResponseCache returns a cache holding up to size responses (default
+// defaultResponseCacheSize) for ttl each. It returns nil when ttl is not
+// positive, leaving caching off.
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = defaultResponseCacheSize
+	}
+	return &responseCache{
+		capacity: size,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// responseCacheKey returns the cache key for req, or false when req must not
+// be cached: it streams, or its temperature is not explicitly 0 (Anthropic
+// defaults to 1, so an omitted temperature is not deterministic). The key
+// hashes the requested model, max_tokens, and everything that shapes the
+// output: system prompt, messages, tools, response_format, thinking, the
+// top_p, top_k, and stop_sequences sampling settings, service_tier, and
+// metadata. The cache is consulted before routing, so the key also covers
+// the x-request-type header, which can change the routed model, and a hash
+// of the caller's credentials from header, so a response is only replayed to
+// the same API key.
+func responseCacheKey(req AnthropicRequest, body []byte, header http.Header) (string, bool) {
+	if req.Stream {
+		return "", false
+	}
+	var t struct {
+		Temperature *float64        `json:"temperature"`
+		Thinking    json.RawMessage `json:"thinking"`
+	}
+	if err := json.Unmarshal(body, &t); err != nil || t.Temperature == nil || *t.Temperature != 0 {
+		return "", false
+	}
+
+	keyed, err := json.Marshal(struct {
+		Model          string            `json:"model"`
+		MaxTokens      int               `json:"max_tokens"`
+		System         json.RawMessage   `json:"system,omitempty"`
+		Messages       []Message         `json:"messages"`
+		Tools          []Tool            `json:"tools,omitempty"`
+		ToolChoice     *ToolChoice       `json:"tool_choice,omitempty"`
+		ResponseFormat json.RawMessage   `json:"response_format,omitempty"`
+		Thinking       json.RawMessage   `json:"thinking,omitempty"`
+		TopP           *float64          `json:"top_p,omitempty"`
+		TopK           *int              `json:"top_k,omitempty"`
+		StopSequences  []string          `json:"stop_sequences,omitempty"`
+		ServiceTier    string            `json:"service_tier,omitempty"`
+		Metadata       map[string]string `json:"metadata,omitempty"`
+		RequestType    string            `json:"request_type,omitempty"`
+		Auth           string            `json:"auth,omitempty"`
+	}{req.Model, req.MaxTokens, req.System, req.Messages, req.Tools, req.ToolChoice, req.ResponseFormat,
+		t.Thinking, req.TopP, req.TopK, req.StopSequences, req.ServiceTier, req.Metadata,
+		header.Get("x-request-type"), authIdentity(header)})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(keyed)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// authIdentity returns a hash of the credentials in header (Authorization
+// and X-Api-Key), or "" when it carries none, so keys can be scoped to a
+// caller without holding its secrets.
+func authIdentity(header http.Header) string {
+	auth, key := header.Get("Authorization"), header.Get("X-Api-Key")
+	if auth == "" && key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(auth + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the unexpired response stored under key, marking it most
+// recently used.
+func (c *responseCache) get(key string) (cachedResponse, bool) {
+	if c == nil {
+		return cachedResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	entry := el.Value.(*responseCacheEntry)
+	if !c.now().Before(entry.value.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return cachedResponse{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// put stores value under key for the cache's TTL, evicting the least
+// recently used entry when the cache is full.
+func (c *responseCache) put(key string, value cachedResponse) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value.expires = c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*responseCacheEntry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&responseCacheEntry{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// bodyRecorder passes a response through to the client while keeping a
+// copy of the status and body, so a successful response can be cached.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCachingStubProxy(t *testing.T, calls *int32) *ProxyServer {
+	t.Helper()
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+	p.responses = newResponseCache(0, time.Minute)
+	return p
+}
+
+func deterministicBody(prompt string) string {
+	return `{"model":"claude-sonnet","max_tokens":100,"temperature":0,"messages":[{"role":"user","content":"` + prompt + `"}]}`
+}
+
+func TestHandleMessages_ResponseCacheHit(t *testing.T) {
+	var calls int32
+	p := newCachingStubProxy(t, &calls)
+
+	first := postMessages(t, p, deterministicBody("hello"), nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", first.Code, first.Body.String())
+	}
+	second := postMessages(t, p, deterministicBody("hello"), nil)
+	if second.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", second.Code, second.Body.String())
+	}
+
+	if calls != 1 {
+		t.Errorf("provider calls = %d, want 1", calls)
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("cached body = %s, want %s", second.Body.String(), first.Body.String())
+	}
+	if got := second.Header().Get("X-SR-Cache"); got != "hit" {
+		t.Errorf("X-SR-Cache = %q, want hit", got)
+	}
+	assertRoutingHeaders(t, second.Header(), "stub", "budget", "interactive")
+}
+
+func TestHandleMessages_ResponseCacheMissOnDifferentMessages(t *testing.T) {
+	var calls int32
+	p := newCachingStubProxy(t, &calls)
+
+	postMessages(t, p, deterministicBody("hello"), nil)
+	w := postMessages(t, p, deterministicBody("goodbye"), nil)
+
+	if calls != 2 {
+		t.Errorf("provider calls = %d, want 2", calls)
+	}
+	if got := w.Header().Get("X-SR-Cache"); got != "" {
+		t.Errorf("X-SR-Cache = %q, want empty", got)
+	}
+}
+
+func TestHandleMessages_ResponseCacheScopedToCallerAndRouting(t *testing.T) {
+	var calls int32
+	p := newCachingStubProxy(t, &calls)
+
+	alice := map[string]string{"X-Api-Key": "key-alice"}
+	postMessages(t, p, deterministicBody("hello"), alice)
+
+	for name, headers := range map[string]map[string]string{
+		"another API key": {"X-Api-Key": "key-bob"},
+		"no credentials":  nil,
+		"a bearer token":  {"Authorization": "Bearer key-alice"},
+		"a request type":  {"X-Api-Key": "key-alice", "x-request-type": "background"},
+	} {
+		if w := postMessages(t, p, deterministicBody("hello"), headers); w.Header().Get("X-SR-Cache") != "" {
+			t.Errorf("%s: served from the cache", name)
+		}
+	}
+	metadata := `{"model":"claude-sonnet","max_tokens":100,"temperature":0,"metadata":{"user_id":"u2"},"messages":[{"role":"user","content":"hello"}]}`
+	if w := postMessages(t, p, metadata, alice); w.Header().Get("X-SR-Cache") != "" {
+		t.Error("different metadata: served from the cache")
+	}
+
+	if w := postMessages(t, p, deterministicBody("hello"), alice); w.Header().Get("X-SR-Cache") != "hit" {
+		t.Error("same caller and request: want a cache hit")
+	}
+}
+
+func TestHandleMessages_ResponseCacheSkipsNonZeroTemperature(t *testing.T) {
+	var calls int32
+	p := newCachingStubProxy(t, &calls)
+
+	postMessages(t, p, simpleRequestBody, nil)
+	postMessages(t, p, simpleRequestBody, nil)
+
+	if calls != 2 {
+		t.Errorf("provider calls = %d, want 2 when temperature is not 0", calls)
+	}
+}
+
+func TestHandleMessages_StopSequencesSeparateCacheAndCoalescing(t *testing.T) {
+	var calls int32
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+	p.responses = newResponseCache(0, time.Minute)
+	p.coalesce = true
+	withStop := func(stop string) string {
+		return `{"model":"claude-sonnet","max_tokens":100,"temperature":0,"stop_sequences":["` + stop +
+			`"],"messages":[{"role":"user","content":"hello"}]}`
+	}
+
+	// Sent together, the two requests must each reach the provider rather
+	// than share one call.
+	var wg sync.WaitGroup
+	for _, stop := range []string{"END", "STOP"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := postMessages(t, p, withStop(stop), nil); w.Code != http.StatusOK {
+				t.Errorf("stop %s: got status %d, want 200: %s", stop, w.Code, w.Body.String())
+			}
+		}()
+	}
+	for range 2 {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			close(release)
+			wg.Wait()
+			t.Fatalf("provider calls = %d, want 2: requests with different stop_sequences were coalesced", atomic.LoadInt32(&calls))
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	// A third stop sequence is not served from either cached response.
+	if w := postMessages(t, p, withStop("DONE"), nil); w.Header().Get("X-SR-Cache") != "" {
+		t.Errorf("X-SR-Cache = %q, want a miss for a new stop sequence", w.Header().Get("X-SR-Cache"))
+	}
+	if w := postMessages(t, p, withStop("END"), nil); w.Header().Get("X-SR-Cache") != "hit" {
+		t.Errorf("X-SR-Cache = %q, want a hit for a repeated stop sequence", w.Header().Get("X-SR-Cache"))
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("provider calls = %d, want 3", got)
+	}
+}
+
+func TestResponseCacheExpires(t *testing.T) {
+	c := newResponseCache(0, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.put("k", cachedResponse{body: []byte("{}")})
+	if _, ok := c.get("k"); !ok {
+		t.Fatal("expected a hit before the TTL elapses")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.get("k"); ok {
+		t.Error("expected a miss once the TTL has elapsed")
+	}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResponseCache(2, time.Minute)
+	c.put("a", cachedResponse{})
+	c.put("b", cachedResponse{})
+	c.get("a")
+	c.put("c", cachedResponse{})
+
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("expected a to be kept")
+	}
+}
@@ -1,43 +1,78 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jbctechsolutions/sr-router/config"
 	"github.com/jbctechsolutions/sr-router/router"
 	"github.com/jbctechsolutions/sr-router/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
+// tracerName identifies spans created by this package.
+const tracerName = "github.com/jbctechsolutions/sr-router/proxy"
+
 // ProxyServer is an HTTP server that accepts Anthropic Messages API requests,
 // classifies them, routes them to the best-fit model, and streams or returns
 // responses in the Anthropic format.
 type ProxyServer struct {
 	classifier *router.Classifier
-	router     *router.Router
-	failover   *router.FailoverEngine
 	telemetry  *telemetry.Collector
-	cfg        *config.Config
+	recorder   *telemetry.AsyncRecorder
+	limiter    *concurrencyLimiter
+	responses  *responseCache
+	transforms []requestTransform
+	stream     streamOptions
+	coalesce   bool
+	inflight   singleflight.Group
+	shadows    sync.WaitGroup
 	port       string
 	dryRun     bool
+	verbose    bool
+
+	// mu guards cfg, router, and failover, which Reload replaces.
+	mu       sync.RWMutex
+	cfg      *config.Config
+	router   *router.Router
+	failover *router.FailoverEngine
 }
 
 // NewProxyServer constructs a ProxyServer wired to the provided config. It
-// initialises the classifier, router, and failover engine. Telemetry uses a
-// SQLite database in the OS temp directory; if that fails, telemetry is
-// disabled with a warning rather than preventing startup. When dryRun is true,
+// initialises the classifier (using the backend selected by
+// defaults.classifier), router, and failover engine. Telemetry uses a
+// SQLite database in the OS temp directory, written asynchronously in
+// batches; if that fails, telemetry is disabled with a warning rather than
+// preventing startup. When dryRun is true,
 // the proxy returns mock responses containing the routing decision instead of
 // forwarding to real providers.
 func NewProxyServer(cfg *config.Config, port string, dryRun bool) (*ProxyServer, error) {
-	classifier := router.NewClassifier(cfg)
+	classifier, err := router.NewClassifierFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	rtr := router.NewRouter(cfg)
 
 	dbPath := filepath.Join(os.TempDir(), "sr-router-telemetry.db")
@@ -49,19 +84,52 @@ func NewProxyServer(cfg *config.Config, port string, dryRun bool) (*ProxyServer,
 
 	failover := router.NewFailoverEngine(cfg, rtr, tel)
 
+	var recorder *telemetry.AsyncRecorder
+	if tel != nil {
+		recorder = telemetry.NewAsyncRecorder(tel, telemetry.DefaultBatchSize, telemetry.DefaultFlushInterval)
+	}
+
+	transforms, err := newTransforms(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := newConcurrencyLimiter(cfg.Proxy.MaxConcurrentRequests,
+		time.Duration(cfg.Proxy.QueueTimeoutMs)*time.Millisecond)
+	responses := newResponseCache(cfg.Proxy.ResponseCacheSize,
+		time.Duration(cfg.Proxy.ResponseCacheTTLMs)*time.Millisecond)
+	stream := streamOptions{
+		maxLineBytes:  cfg.GetMaxStreamLineBytes(),
+		flushInterval: time.Duration(cfg.Proxy.StreamFlushMs) * time.Millisecond,
+	}
+
 	return &ProxyServer{
 		classifier: classifier,
 		router:     rtr,
 		failover:   failover,
 		telemetry:  tel,
+		recorder:   recorder,
 		cfg:        cfg,
+		limiter:    limiter,
+		responses:  responses,
+		coalesce:   cfg.Proxy.CoalesceRequests,
+		transforms: transforms,
+		stream:     stream,
 		port:       port,
 		dryRun:     dryRun,
 	}, nil
 }
 
+// SetVerbose enables logging of the full classification reasoning and
+// candidate scoring for every request.
+func (p *ProxyServer) SetVerbose(verbose bool) {
+	p.verbose = verbose
+}
+
 // Start registers all route handlers, wraps the mux in the logging middleware,
-// and begins listening. It blocks until the server returns an error.
+// and begins listening. It blocks until the server returns an error or the
+// process receives SIGINT/SIGTERM, in which case in-flight requests are given
+// shutdownTimeout to finish and pending telemetry is flushed before returning.
 func (p *ProxyServer) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/messages", p.handleMessages)
@@ -83,7 +151,63 @@ func (p *ProxyServer) Start() error {
 		log.Printf("DRY-RUN MODE: no provider calls will be made")
 	}
 	log.Printf("Endpoint: http://localhost:%s/v1/messages", p.port)
-	return http.ListenAndServe(":"+p.port, handler)
+
+	srv := &http.Server{Addr: ":" + p.port, Handler: handler}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		p.closeTelemetry()
+		return err
+	case <-ctx.Done():
+		log.Printf("sr-router proxy shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		p.closeTelemetry()
+		return err
+	}
+}
+
+// shutdownTimeout bounds how long Start waits for in-flight requests on
+// shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// closeTelemetry waits for shadow calls in flight, flushes queued routing
+// events, and closes the database.
+func (p *ProxyServer) closeTelemetry() {
+	p.shadows.Wait()
+	if p.recorder != nil {
+		p.recorder.Close() //nolint:errcheck
+	}
+	if p.telemetry != nil {
+		p.telemetry.Close() //nolint:errcheck
+	}
+}
+
+// providerTools converts the request's tool definitions for the provider
+// request.
+func providerTools(tools []Tool) []router.ProviderTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	out := make([]router.ProviderTool, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, router.ProviderTool{Name: t.Name, Description: t.Description, InputSchema: t.InputSchema})
+	}
+	return out
+}
+
+// providerToolChoice converts the request's tool_choice, if any.
+func providerToolChoice(c *ToolChoice) *router.ProviderToolChoice {
+	if c == nil {
+		return nil
+	}
+	return &router.ProviderToolChoice{Type: c.Type, Name: c.Name}
 }
 
 // handleMessages is the primary handler for /v1/messages. It:
@@ -98,9 +222,40 @@ func (p *ProxyServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Read and parse request body.
+	// A client-supplied X-Request-Id becomes the telemetry event ID so retries
+	// can be correlated; the effective ID is always echoed back.
+	eventID := resolveRequestID(r)
+	w.Header().Set("X-Request-Id", eventID)
+
+	// Bound concurrent requests so load spikes queue here instead of
+	// fanning out to providers.
+	if !p.limiter.acquire(r.Context()) {
+		sendError(w, "rate_limit_error", "Too many concurrent requests; try again shortly", http.StatusTooManyRequests)
+		return
+	}
+	defer p.limiter.release()
+
+	// One span covers classification, routing, and failover; provider
+	// attempts become child spans. A no-op unless tracing is configured.
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "sr-router.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("sr.request_id", eventID)))
+	defer span.End()
+
+	// Use one config for the whole request, even if it is reloaded meanwhile.
+	cfg, rtr, failover := p.current()
+
+	// 1. Read and parse request body, capped at proxy.max_body_bytes.
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.GetMaxBodyBytes())
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, "request_too_large",
+				fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
 		sendError(w, "invalid_request_error", "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -117,6 +272,39 @@ func (p *ProxyServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.N > 1 {
+		sendError(w, "invalid_request_error",
+			fmt.Sprintf("n=%d is not supported: sr-router returns a single completion per request; send %d separate requests instead", req.N, req.N),
+			http.StatusBadRequest)
+		return
+	}
+
+	// Apply the configured transforms before anything looks at the prompt.
+	req, body, err = applyTransforms(p.transforms, req, body)
+	if err != nil {
+		sendError(w, "api_error", "Failed to apply request transforms: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Deterministic requests seen recently are answered from the response
+	// cache without classifying, routing, or calling a provider. The key
+	// also lets identical requests in flight share one provider call, when
+	// proxy.coalesce_requests is set.
+	var cacheKey string
+	if !p.dryRun && (p.responses != nil || p.coalesce) {
+		if key, ok := responseCacheKey(req, body, r.Header); ok {
+			if cached, hit := p.responses.get(key); hit {
+				log.Printf("Response cache hit: model=%s", cached.model)
+				setRoutingHeaders(w, cached.model, cached.tier, cached.routeClass)
+				w.Header().Set("X-SR-Cache", "hit")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(cached.body) //nolint:errcheck
+				return
+			}
+			cacheKey = key
+		}
+	}
+
 	// 2. Extract text for classification from the last user message only
 	// (earlier messages are conversation history and add noise). Strip
 	// infrastructure tags like <system-reminder> injected by Claude Code.
@@ -151,36 +339,75 @@ func (p *ProxyServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 		headers["x-request-type"] = rt
 	}
 
-	// 4. Classify.
-	classification := p.classifier.Classify(promptText, headers)
+	// 4. Classify. Conversation length lets long sessions be biased toward
+	// context-preserving models.
+	var conversationChars int
+	for _, msg := range req.Messages {
+		conversationChars += len(ExtractText(msg.Content))
+	}
+	classification := p.classifier.ClassifyConversation(ctx, promptText, headers, len(req.Messages), conversationChars)
+	// Claude Code sends titles and other housekeeping to a haiku-class
+	// model; treat such requests as background work whatever their content,
+	// unless the client named a request type explicitly.
+	if headers["x-request-type"] == "" && cfg.IsBackgroundModel(req.Model) {
+		classification = p.classifier.AsRouteClass(classification, "background")
+	}
+	// Agent requests need a model that can call tools.
+	if UsesTools(req) {
+		classification = router.RequireToolUse(classification)
+	}
 
 	// 5. Route.
-	decision := p.router.Route(classification)
+	decision := rtr.Route(classification)
+
+	span.SetAttributes(
+		attribute.String("sr.route_class", classification.RouteClass),
+		attribute.String("sr.task_type", classification.TaskType),
+		attribute.String("sr.tier", decision.Tier),
+		attribute.String("sr.selected_model", decision.Model),
+	)
 
-	eventID := uuid.New().String()
 	start := time.Now()
 
 	log.Printf("Routing: class=%s task=%s tier=%s model=%s",
 		classification.RouteClass, classification.TaskType, classification.Tier, decision.Model)
+	if classification.LongConversation {
+		log.Printf("Routing: long conversation (%d messages), quality floor %.2f",
+			len(req.Messages), classification.MinQuality)
+	}
+
+	if p.verbose {
+		p.logReasoning(promptText, headers, classification)
+	}
+
+	sampled := shouldSample(eventID, cfg.Defaults.LogSampleRate)
+	if sampled {
+		log.Printf("Sample %s: class=%s task=%s confidence=%.2f tier=%s model=%s score=%.3f est_cost=%.4f alternatives=%d messages=%d stream=%v prompt=%q",
+			eventID, classification.RouteClass, classification.TaskType, classification.Confidence,
+			decision.Tier, decision.Model, decision.Score, decision.EstCost, len(decision.Alternatives),
+			len(req.Messages), req.Stream, previewText(promptText, samplePreviewChars))
+	}
 
 	// 6a. Dry-run: return a mock response with the routing decision.
 	if p.dryRun {
+		setRoutingHeaders(w, decision.Model, decision.Tier, classification.RouteClass)
 		p.serveDryRun(w, req, eventID, classification, decision)
 		return
 	}
 
-	// 6. Build the normalised provider request.
+	// 6. Build the normalised provider request, filling in the task's or
+	// route class's max_tokens and temperature, and the route class's
+	// service_tier, where the client left them out.
+	body = applyRequestDefaults(&req, body, classification)
 	var messages []router.ProviderMessage
 	for _, msg := range req.Messages {
 		messages = append(messages, router.ProviderMessage{
 			Role:    msg.Role,
 			Content: ExtractText(msg.Content),
+			Images:  ExtractImages(msg.Content),
 		})
 	}
 
-	// Inject the model-specific prompt suffix into the system prompt.
-	modifiedSystem := p.router.InjectSuffix(decision.Model, systemPrompt)
-
 	// Capture incoming auth headers to forward to Anthropic.
 	authHeader := make(http.Header)
 	if auth := r.Header.Get("Authorization"); auth != "" {
@@ -190,76 +417,279 @@ func (p *ProxyServer) handleMessages(w http.ResponseWriter, r *http.Request) {
 		authHeader.Set("X-Api-Key", key)
 	}
 
+	// Propagate tracing headers; the effective request ID replaces any
+	// invalid one the client sent.
+	traceHeader := r.Header.Clone()
+	traceHeader.Set("X-Request-Id", eventID)
+
 	provReq := router.ProviderRequest{
-		SystemPrompt:        modifiedSystem,
+		// The failover engine applies each model's prompt prefix and
+		// suffix to the undecorated system prompt per attempt.
+		SystemPrompt:        systemPrompt,
 		Messages:            messages,
 		MaxTokens:           req.MaxTokens,
 		Temperature:         req.Temperature,
+		TopP:                req.TopP,
+		TopK:                req.TopK,
+		Stop:                req.StopSequences,
 		Stream:              req.Stream,
+		ServiceTier:         req.ServiceTier,
+		Metadata:            req.Metadata,
+		Tools:               providerTools(req.Tools),
+		ToolChoice:          providerToolChoice(req.ToolChoice),
+		ResponseFormat:      req.ResponseFormat,
 		RawAnthropicBody:    body,
 		AnthropicAuthHeader: authHeader,
+		TraceHeaders:        traceHeader,
 	}
 
-	// 7. Execute with failover.
-	resp, usedModel, err := p.failover.ExecuteWithFailover(r.Context(), decision, provReq)
+	// 7. Execute with failover. Identical deterministic requests in flight
+	// may share one provider call.
+	var resp *http.Response
+	var usedModel string
+	if p.coalesce && cacheKey != "" {
+		resp, usedModel, err = p.executeShared(ctx, failover, cacheKey, decision, provReq)
+	} else {
+		resp, usedModel, err = failover.ExecuteWithFailover(ctx, decision, provReq)
+	}
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		sendError(w, "api_error", "All providers failed: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.String("sr.model", usedModel))
+
+	// Once the client has its response, ask the shadow model, if any, too.
+	defer p.startShadow(ctx, cfg, failover, eventID, classification, decision, usedModel, provReq)
+
+	// Expose the model that actually served the request. These must be set
+	// before the stream translators write headers and flush.
+	setRoutingHeaders(w, usedModel, decision.Tier, classification.RouteClass)
 
 	latencyMs := int(time.Since(start).Milliseconds())
 
-	// 8. Record telemetry (non-fatal if it fails).
-	if p.telemetry != nil {
-		if telErr := p.telemetry.RecordRouting(telemetry.RoutingEvent{
-			ID:            eventID,
-			RouteClass:    classification.RouteClass,
-			TaskType:      classification.TaskType,
-			Tier:          decision.Tier,
-			SelectedModel: usedModel,
-			LatencyMs:     latencyMs,
-			EstimatedCost: decision.EstCost,
-		}); telErr != nil {
-			log.Printf("telemetry: failed to record routing event: %v", telErr)
-		}
+	if sampled {
+		log.Printf("Sample %s: served by %s with status %d in %dms", eventID, usedModel, resp.StatusCode, latencyMs)
+	}
+
+	// 8. Record telemetry (non-fatal if it fails). A non-streaming event is
+	// recorded once the body is read, so it can carry the cache usage.
+	event := telemetry.RoutingEvent{
+		ID:            eventID,
+		RouteClass:    classification.RouteClass,
+		TaskType:      classification.TaskType,
+		Tier:          decision.Tier,
+		SelectedModel: usedModel,
+		LatencyMs:     latencyMs,
 	}
 
 	// 9. Determine provider type and write response.
-	model := p.cfg.Models[usedModel]
+	model := cfg.Models[usedModel]
 
 	if req.Stream {
+		// The event is recorded before the stream is read, so only the
+		// estimated input is counted.
+		setEventTokens(&event, model, estimateInputTokens(req), 0)
+		p.recordRouting(event)
+		// Some providers and gateways ignore stream: true and answer with a
+		// single JSON document; replay it to the client as an SSE stream.
+		if isJSONResponse(resp) {
+			streamJSONToAnthropic(w, resp, model.Provider, eventID, usedModel, p.stream)
+			return
+		}
 		switch model.Provider {
 		case "anthropic":
-			StreamAnthropicPassthrough(w, resp, eventID)
+			streamAnthropicPassthrough(w, resp, p.stream)
 		case "openai_compat":
-			StreamOpenAIToAnthropic(w, resp, eventID, usedModel)
+			streamOpenAIToAnthropic(w, resp, eventID, usedModel, estimateInputTokens(req), p.stream)
 		case "ollama":
-			StreamOllamaToAnthropic(w, resp, eventID, usedModel)
+			streamOllamaToAnthropic(w, resp, eventID, usedModel, estimateInputTokens(req), p.stream)
 		default:
-			StreamAnthropicPassthrough(w, resp, eventID)
+			streamAnthropicPassthrough(w, resp, p.stream)
 		}
 		return
 	}
 
 	// Non-streaming: read full response body, translate to Anthropic format.
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := readProviderBody(resp)
+	var usage Usage
+	if err == nil {
+		usage = providerUsage(model.Provider, respBody)
+		event.CacheCreationTokens = usage.CacheCreationInputTokens
+		event.CacheReadTokens = usage.CacheReadInputTokens
+	}
+	if usage.InputTokens == 0 {
+		usage.InputTokens = estimateInputTokens(req)
+	}
+	setEventTokens(&event, model, usage.InputTokens, usage.OutputTokens)
+	p.recordRouting(event)
 	if err != nil {
-		sendError(w, "api_error", "Failed to read provider response", http.StatusBadGateway)
+		sendError(w, "api_error", "Failed to read provider response: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 
+	// Keep a copy of a cacheable response as it is written.
+	out := w
+	var rec *bodyRecorder
+	if p.responses != nil && cacheKey != "" && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		rec = &bodyRecorder{ResponseWriter: w}
+		out = rec
+	}
+
 	switch model.Provider {
 	case "anthropic":
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody) //nolint:errcheck
+		out.Header().Set("Content-Type", "application/json")
+		out.Write(respBody) //nolint:errcheck
 	case "openai_compat":
-		translateOpenAIResponseToAnthropic(w, respBody, eventID, usedModel)
+		translateOpenAIResponseToAnthropic(out, respBody, eventID, usedModel)
 	case "ollama":
-		translateOllamaResponseToAnthropic(w, respBody, eventID, usedModel)
+		translateOllamaResponseToAnthropic(out, respBody, eventID, usedModel)
 	default:
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody) //nolint:errcheck
+		out.Header().Set("Content-Type", "application/json")
+		out.Write(respBody) //nolint:errcheck
+	}
+
+	if rec != nil && rec.status == http.StatusOK {
+		p.responses.put(cacheKey, cachedResponse{
+			body:       rec.body.Bytes(),
+			model:      usedModel,
+			tier:       decision.Tier,
+			routeClass: classification.RouteClass,
+		})
+	}
+}
+
+// applyRequestDefaults sets req's max_tokens, temperature, and service_tier
+// from the classification's defaults when the client omitted them, and
+// returns body with the same fields added for Anthropic passthrough. Values
+// the client sent are never changed.
+func applyRequestDefaults(req *AnthropicRequest, body []byte, cl router.Classification) []byte {
+	fields := make(map[string]any)
+	if req.MaxTokens == 0 && cl.MaxTokens > 0 {
+		req.MaxTokens = cl.MaxTokens
+		fields["max_tokens"] = cl.MaxTokens
+	}
+	if req.Temperature == nil && cl.Temperature != nil {
+		req.Temperature = cl.Temperature
+		fields["temperature"] = *cl.Temperature
+	}
+	if req.ServiceTier == "" && cl.ServiceTier != "" {
+		req.ServiceTier = cl.ServiceTier
+		fields["service_tier"] = cl.ServiceTier
+	}
+	if len(fields) == 0 {
+		return body
+	}
+	patched, err := setBodyFields(body, fields)
+	if err != nil {
+		return body
+	}
+	return patched
+}
+
+// setBodyFields returns the JSON object body with each of fields set,
+// leaving its other fields as they were.
+func setBodyFields(body []byte, fields map[string]any) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		raw[k] = b
+	}
+	return json.Marshal(raw)
+}
+
+// readProviderBody reads a complete non-streaming provider response,
+// decompressing it first when it is gzip-encoded.
+func readProviderBody(resp *http.Response) ([]byte, error) {
+	if err := router.DecodeResponseBody(resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// providerUsage returns the token usage reported in a non-streaming response
+// body from provider, or zero usage when the body reports none.
+func providerUsage(provider string, body []byte) Usage {
+	switch provider {
+	case "openai_compat":
+		resp, _ := openAIResponseToAnthropic(body, "", "")
+		return resp.Usage
+	case "ollama":
+		resp, _ := ollamaResponseToAnthropic(body, "", "")
+		return resp.Usage
+	default:
+		return responseUsage(body)
+	}
+}
+
+// setEventTokens records in and out tokens on e, and their cost on model as
+// its estimated cost.
+func setEventTokens(e *telemetry.RoutingEvent, model config.Model, in, out int) {
+	e.InputTokens = in
+	e.OutputTokens = out
+	e.EstimatedCost = float64(in+out) / 1000 * model.CostPer1kTok
+}
+
+// responseUsage returns the usage block of a provider response body. Only
+// Anthropic-format bodies carry the prompt-cache fields; for other shapes
+// they are left zero.
+func responseUsage(body []byte) Usage {
+	var resp struct {
+		Usage Usage `json:"usage"`
+	}
+	json.Unmarshal(body, &resp) //nolint:errcheck
+	return resp.Usage
+}
+
+// logReasoning logs why the prompt was classified as it was and how every
+// configured model scored against the classification.
+func (p *ProxyServer) logReasoning(prompt string, headers map[string]string, c router.Classification) {
+	explanation := p.classifier.Explain(prompt, headers)
+	log.Printf("Classification: route_class=%s (%s) task=%s confidence=%.2f min_quality=%.2f strengths=%v latency_budget_ms=%d",
+		c.RouteClass, explanation.RouteClassReason, c.TaskType, c.Confidence, c.MinQuality, c.RequiredStrengths, c.LatencyBudgetMs)
+
+	tasks := make([]string, 0, len(explanation.TaskMatches))
+	for task := range explanation.TaskMatches {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	for _, task := range tasks {
+		log.Printf("  task %s matched %q", task, explanation.TaskMatches[task])
+	}
+
+	_, rtr, _ := p.current()
+	for _, cand := range rtr.ScoreCandidates(c) {
+		if cand.Excluded != "" {
+			log.Printf("  candidate %s excluded: %s", cand.Model, cand.Excluded)
+			continue
+		}
+		log.Printf("  candidate %s score=%.3f (cost=%.3f quality=%.3f)",
+			cand.Model, cand.Score, cand.CostScore, cand.QualityScore)
+	}
+}
+
+// recordRouting hands e to the async recorder when one is running, falling
+// back to a synchronous insert. Failures are logged, never surfaced.
+func (p *ProxyServer) recordRouting(e telemetry.RoutingEvent) {
+	var err error
+	switch {
+	case p.recorder != nil:
+		err = p.recorder.Record(e)
+	case p.telemetry != nil:
+		err = p.telemetry.RecordRouting(e)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("telemetry: failed to record routing event: %v", err)
 	}
 }
 
@@ -295,14 +725,14 @@ func (p *ProxyServer) serveDryRun(w http.ResponseWriter, req AnthropicRequest, e
 			http.Error(w, "streaming not supported", http.StatusInternalServerError)
 			return
 		}
-		emitPreamble(w, flusher, "msg_"+eventID[:8], d.Model)
-		writeSSEEvent(w, flusher, "content_block_delta", buildContentBlockDelta(text))
-		emitEpilogue(w, flusher, 0)
+		emitPreamble(w, flusher, messageID(eventID), d.Model, 0)
+		writeSSEEvent(w, flusher, "content_block_delta", buildContentBlockDelta(0, text))
+		emitEpilogue(w, flusher, "end_turn", Usage{})
 		return
 	}
 
 	resp := AnthropicResponse{
-		ID:   "msg_" + eventID[:8],
+		ID:   messageID(eventID),
 		Type: "message",
 		Role: "assistant",
 		Content: []ContentBlock{
@@ -319,10 +749,29 @@ func (p *ProxyServer) serveDryRun(w http.ResponseWriter, req AnthropicRequest, e
 // translateOpenAIResponseToAnthropic converts a non-streaming OpenAI chat
 // completions response into the Anthropic Messages API response format.
 func translateOpenAIResponseToAnthropic(w http.ResponseWriter, body []byte, eventID string, model string) {
+	anthropicResp, err := openAIResponseToAnthropic(body, eventID, model)
+	if err != nil {
+		sendError(w, "api_error", err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anthropicResp) //nolint:errcheck
+}
+
+// openAIResponseToAnthropic decodes a non-streaming OpenAI chat completions
+// response into an AnthropicResponse.
+func openAIResponseToAnthropic(body []byte, eventID string, model string) (AnthropicResponse, error) {
 	var openaiResp struct {
 		Choices []struct {
 			Message struct {
-				Content string `json:"content"`
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
@@ -332,76 +781,107 @@ func translateOpenAIResponseToAnthropic(w http.ResponseWriter, body []byte, even
 		} `json:"usage"`
 	}
 
-	if err := json.Unmarshal(body, &openaiResp); err != nil || len(openaiResp.Choices) == 0 {
-		sendError(w, "api_error", "Failed to parse provider response", http.StatusBadGateway)
-		return
+	if err := json.Unmarshal(body, &openaiResp); err != nil {
+		return AnthropicResponse{}, fmt.Errorf("failed to parse provider response: %w", err)
+	}
+	if len(openaiResp.Choices) == 0 {
+		return AnthropicResponse{}, errors.New("failed to parse provider response: no choices")
 	}
 
-	anthropicResp := AnthropicResponse{
-		ID:   "msg_" + eventID[:8],
-		Type: "message",
-		Role: "assistant",
-		Content: []ContentBlock{
-			{Type: "text", Text: openaiResp.Choices[0].Message.Content},
-		},
+	// Text comes first, then one tool_use block per tool call. A response
+	// made only of tool calls has no text block.
+	choice := openaiResp.Choices[0]
+	var content []ContentBlock
+	if choice.Message.Content != "" || len(choice.Message.ToolCalls) == 0 {
+		content = append(content, ContentBlock{Type: "text", Text: choice.Message.Content})
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		// Arguments arrive as a JSON-encoded string; Anthropic wants the
+		// object itself.
+		input := toolInput(tc.Function.Name, tc.Function.Arguments)
+		content = append(content, ContentBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+	}
+
+	return AnthropicResponse{
+		ID:         messageID(eventID),
+		Type:       "message",
+		Role:       "assistant",
+		Content:    content,
 		Model:      model,
-		StopReason: "end_turn",
+		StopReason: openAIStopReason(choice.FinishReason),
 		Usage: Usage{
 			InputTokens:  openaiResp.Usage.PromptTokens,
 			OutputTokens: openaiResp.Usage.CompletionTokens,
 		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(anthropicResp) //nolint:errcheck
+	}, nil
 }
 
 // translateOllamaResponseToAnthropic converts a non-streaming Ollama /api/chat
 // response into the Anthropic Messages API response format.
 func translateOllamaResponseToAnthropic(w http.ResponseWriter, body []byte, eventID string, model string) {
+	anthropicResp, err := ollamaResponseToAnthropic(body, eventID, model)
+	if err != nil {
+		sendError(w, "api_error", err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anthropicResp) //nolint:errcheck
+}
+
+// ollamaResponseToAnthropic decodes a non-streaming Ollama /api/chat response
+// into an AnthropicResponse.
+func ollamaResponseToAnthropic(body []byte, eventID string, model string) (AnthropicResponse, error) {
 	var ollamaResp struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
-		PromptEvalCount int `json:"prompt_eval_count"`
-		EvalCount       int `json:"eval_count"`
+		DoneReason      string `json:"done_reason"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
+		Error           string `json:"error"`
 	}
 
 	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		sendError(w, "api_error", "Failed to parse provider response", http.StatusBadGateway)
-		return
+		return AnthropicResponse{}, fmt.Errorf("failed to parse provider response: %w", err)
+	}
+
+	// Ollama reports some failures with a 200 status and an error field.
+	if ollamaResp.Error != "" {
+		return AnthropicResponse{}, errors.New("ollama: " + ollamaResp.Error)
 	}
 
-	anthropicResp := AnthropicResponse{
-		ID:   "msg_" + eventID[:8],
+	return AnthropicResponse{
+		ID:   messageID(eventID),
 		Type: "message",
 		Role: "assistant",
 		Content: []ContentBlock{
 			{Type: "text", Text: ollamaResp.Message.Content},
 		},
 		Model:      model,
-		StopReason: "end_turn",
+		StopReason: ollamaStopReason(ollamaResp.DoneReason),
 		Usage: Usage{
 			InputTokens:  ollamaResp.PromptEvalCount,
 			OutputTokens: ollamaResp.EvalCount,
 		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(anthropicResp) //nolint:errcheck
+	}, nil
 }
 
 // handleHealth returns a simple JSON status payload for liveness probes.
+// telemetry reports whether routing events can still be recorded: "ok",
+// "degraded" when the database cannot be written, or "disabled".
 func (p *ProxyServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	cfg, _, _ := p.current()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
-		"status":  "ok",
-		"service": "sr-router",
-		"models":  len(p.cfg.Models),
+		"status":    "ok",
+		"service":   "sr-router",
+		"models":    len(cfg.Models),
+		"telemetry": p.telemetryHealth(),
 	})
 }
 
-// handleDashboard returns aggregate routing statistics from telemetry.
+// handleDashboard returns aggregate routing statistics from telemetry,
+// including estimated savings versus always using the fallback model.
 func (p *ProxyServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	if p.telemetry == nil {
 		sendError(w, "api_error", "Telemetry not available", http.StatusServiceUnavailable)
@@ -412,10 +892,95 @@ func (p *ProxyServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		sendError(w, "api_error", "Failed to get stats: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	cfg, _, _ := p.current()
+	if baseline, ok := cfg.Models[cfg.Defaults.FallbackModel]; ok {
+		stats.ApplyBaseline(cfg.Defaults.FallbackModel, baseline.CostPer1kTok)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats) //nolint:errcheck
 }
 
+// setRoutingHeaders exposes the routing outcome to clients and debugging
+// proxies via X-SR-* response headers.
+func setRoutingHeaders(w http.ResponseWriter, model, tier, routeClass string) {
+	w.Header().Set("X-SR-Model", model)
+	w.Header().Set("X-SR-Tier", tier)
+	w.Header().Set("X-SR-Route-Class", routeClass)
+}
+
+// requestIDRe restricts client-supplied request IDs to a safe character set
+// and length, since they are stored in telemetry and echoed in headers.
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// resolveRequestID returns the incoming X-Request-Id header when it is valid,
+// otherwise a freshly generated UUID.
+func resolveRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); requestIDRe.MatchString(id) {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// messageID derives an Anthropic message ID from the first eight characters
+// of the event ID (or all of it, when shorter).
+func messageID(eventID string) string {
+	if len(eventID) > 8 {
+		eventID = eventID[:8]
+	}
+	return "msg_" + eventID
+}
+
+// telemetryHealth returns the telemetry status reported by handleHealth.
+func (p *ProxyServer) telemetryHealth() string {
+	if p.telemetry == nil {
+		return "disabled"
+	}
+	if err := p.telemetry.CheckWritable(); err != nil {
+		log.Printf("Health: telemetry not writable: %v", err)
+		return "degraded"
+	}
+	return "ok"
+}
+
+// estimateInputTokens approximates the prompt tokens of req from the text of
+// its system prompt and messages, for translated streams whose provider does
+// not report them up front.
+func estimateInputTokens(req AnthropicRequest) int {
+	tokens := router.EstimateTokens(ExtractSystemPrompt(req.System))
+	for _, msg := range req.Messages {
+		tokens += router.EstimateTokens(ExtractText(msg.Content))
+	}
+	return tokens
+}
+
+// samplePreviewChars bounds the prompt preview included in sampled logs.
+const samplePreviewChars = 200
+
+// shouldSample reports whether the request identified by eventID falls within
+// the sampled fraction rate. The decision is a deterministic hash of the ID,
+// so the same request is always either sampled or not.
+func shouldSample(eventID string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(eventID)) //nolint:errcheck
+	return float64(h.Sum64())/math.MaxUint64 < rate
+}
+
+// previewText returns at most n runes of s, with "..." appended when it was
+// truncated.
+func previewText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
 // sendError writes an Anthropic-format error response with the given HTTP status.
 func sendError(w http.ResponseWriter, errorType string, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
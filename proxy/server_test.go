@@ -0,0 +1,1094 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
+	"github.com/jbctechsolutions/sr-router/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestProxy builds a dry-run ProxyServer from the real YAML config without
+// opening the telemetry database.
+func newTestProxy(t *testing.T) *ProxyServer {
+	t.Helper()
+	cfg, err := config.Load("../config")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	rtr := router.NewRouter(cfg)
+	return &ProxyServer{
+		classifier: router.NewClassifier(cfg),
+		router:     rtr,
+		failover:   router.NewFailoverEngine(cfg, rtr, nil),
+		cfg:        cfg,
+		dryRun:     true,
+	}
+}
+
+// postMessages sends body to handleMessages with the given extra headers and
+// returns the recorded response.
+func postMessages(t *testing.T, p *ProxyServer, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	p.handleMessages(w, req)
+	return w
+}
+
+const simpleRequestBody = `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"Write a Go function for sorting"}]}`
+
+func TestHandleMessages_SuppliedRequestID(t *testing.T) {
+	p := newTestProxy(t)
+
+	w := postMessages(t, p, simpleRequestBody, map[string]string{"X-Request-Id": "client-retry-42"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Request-Id"); got != "client-retry-42" {
+		t.Errorf("X-Request-Id = %q, want the supplied ID", got)
+	}
+
+	var resp AnthropicResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.ID != "msg_client-r" {
+		t.Errorf("message ID = %q, want it derived from the request ID", resp.ID)
+	}
+}
+
+func TestHandleMessages_GeneratedRequestID(t *testing.T) {
+	p := newTestProxy(t)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"no header", nil},
+		{"invalid header", map[string]string{"X-Request-Id": "bad id\twith spaces"}},
+		{"oversized header", map[string]string{"X-Request-Id": strings.Repeat("a", 200)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postMessages(t, p, simpleRequestBody, tt.headers)
+			got := w.Header().Get("X-Request-Id")
+			if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("X-Request-Id = %q, want a generated UUID", got)
+			}
+		})
+	}
+}
+
+func TestHandleMessages_ShortRequestID(t *testing.T) {
+	p := newTestProxy(t)
+
+	w := postMessages(t, p, simpleRequestBody, map[string]string{"X-Request-Id": "r1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Request-Id"); got != "r1" {
+		t.Errorf("X-Request-Id = %q, want %q", got, "r1")
+	}
+}
+
+// newStubProviderProxy builds a live (non-dry-run) ProxyServer whose only
+// model is an openai_compat provider served by handler.
+func newStubProviderProxy(t *testing.T, handler http.HandlerFunc) *ProxyServer {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		Defaults: config.Defaults{FallbackModel: "stub", CostWeight: 0.4, QualityWeight: 0.6},
+		Tiers:    map[string]config.Tier{"budget": {Models: []string{"stub"}}},
+		Models: map[string]config.Model{
+			"stub": {Provider: "openai_compat", APIModel: "stub-model", BaseURL: srv.URL, QualityCeiling: 0.9},
+		},
+		RouteClasses: map[string]config.RouteClass{
+			"interactive": {DefaultTier: "budget"},
+		},
+	}
+	rtr := router.NewRouter(cfg)
+	return &ProxyServer{
+		classifier: router.NewClassifier(cfg),
+		router:     rtr,
+		failover:   router.NewFailoverEngine(cfg, rtr, nil),
+		cfg:        cfg,
+	}
+}
+
+func assertRoutingHeaders(t *testing.T, h http.Header, model, tier, routeClass string) {
+	t.Helper()
+	if got := h.Get("X-SR-Model"); got != model {
+		t.Errorf("X-SR-Model = %q, want %q", got, model)
+	}
+	if got := h.Get("X-SR-Tier"); got != tier {
+		t.Errorf("X-SR-Tier = %q, want %q", got, tier)
+	}
+	if got := h.Get("X-SR-Route-Class"); got != routeClass {
+		t.Errorf("X-SR-Route-Class = %q, want %q", got, routeClass)
+	}
+}
+
+func TestHandleMessages_RoutingHeadersDryRun(t *testing.T) {
+	p := newTestProxy(t)
+
+	w := postMessages(t, p, simpleRequestBody, map[string]string{"x-request-type": "background"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	classification := p.classifier.Classify("Write a Go function for sorting", map[string]string{"x-request-type": "background"})
+	decision := p.router.Route(classification)
+	assertRoutingHeaders(t, w.Header(), decision.Model, decision.Tier, "background")
+}
+
+func TestHandleMessages_HaikuRequestRoutesToBudget(t *testing.T) {
+	p := newTestProxy(t)
+
+	haiku := `{"model":"claude-3-5-haiku-20241022","max_tokens":100,"messages":[{"role":"user","content":"Write a Go function for sorting"}]}`
+	w := postMessages(t, p, haiku, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if tier := w.Header().Get("X-SR-Tier"); tier != "budget" {
+		t.Errorf("X-SR-Tier = %q, want budget for a haiku request", tier)
+	}
+	if rc := w.Header().Get("X-SR-Route-Class"); rc != "background" {
+		t.Errorf("X-SR-Route-Class = %q, want background", rc)
+	}
+
+	// The same prompt for a non-haiku model is routed on its content.
+	w = postMessages(t, p, simpleRequestBody, nil)
+	if tier := w.Header().Get("X-SR-Tier"); tier != "premium" {
+		t.Errorf("X-SR-Tier = %q, want premium for a code prompt", tier)
+	}
+
+	// An explicit request type wins over the model name.
+	w = postMessages(t, p, haiku, map[string]string{"x-request-type": "chat"})
+	if rc := w.Header().Get("X-SR-Route-Class"); rc != "interactive" {
+		t.Errorf("X-SR-Route-Class = %q, want interactive with an explicit header", rc)
+	}
+}
+
+func TestHandleMessages_ToolRequestRequiresToolUseModel(t *testing.T) {
+	p := newTestProxy(t)
+
+	plain := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"Summarize this document"}]}`
+	w := postMessages(t, p, plain, nil)
+	cheapest := w.Header().Get("X-SR-Model")
+
+	// Take tool support away from the model a plain request gets.
+	m := p.cfg.Models[cheapest]
+	m.Strengths = []string{"summarization"}
+	p.cfg.Models[cheapest] = m
+	if w := postMessages(t, p, plain, nil); w.Header().Get("X-SR-Model") != cheapest {
+		t.Fatalf("without tools: got %s, want %s", w.Header().Get("X-SR-Model"), cheapest)
+	}
+
+	withTools := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"Summarize this document"}],` +
+		`"tools":[{"name":"read_file","input_schema":{"type":"object"}}]}`
+	withToolResult := `{"model":"claude-sonnet","max_tokens":100,"messages":[` +
+		`{"role":"user","content":"Summarize this document"},` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"read_file","input":{}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"..."}]}]}`
+	for name, body := range map[string]string{"tools": withTools, "tool_result": withToolResult} {
+		w := postMessages(t, p, body, nil)
+		got := w.Header().Get("X-SR-Model")
+		if got == cheapest {
+			t.Errorf("%s: routed to %s, which lacks tool_use", name, got)
+		}
+		if !slices.Contains(p.cfg.Models[got].Strengths, router.ToolUseStrength) {
+			t.Errorf("%s: routed to %s with strengths %v, want a tool_use model", name, got, p.cfg.Models[got].Strengths)
+		}
+	}
+}
+
+func TestHandleMessages_RoutingHeadersNonStreaming(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	w := postMessages(t, p, simpleRequestBody, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	assertRoutingHeaders(t, w.Header(), "stub", "budget", "interactive")
+}
+
+func TestHandleMessages_ForwardsResponseFormat(t *testing.T) {
+	var got struct {
+		ResponseFormat json.RawMessage `json:"response_format"`
+	}
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"{}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"list three colours"}],` +
+		`"response_format":{"type":"json_object"}}`
+	w := postMessages(t, p, body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if want := `{"type":"json_object"}`; string(got.ResponseFormat) != want {
+		t.Errorf("response_format = %s, want %s", got.ResponseFormat, want)
+	}
+}
+
+func TestHandleMessages_ForwardsTools(t *testing.T) {
+	var got struct {
+		Tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name       string          `json:"name"`
+				Parameters json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		} `json:"tools"`
+		ToolChoice json.RawMessage `json:"tool_choice"`
+	}
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"weather in Paris?"}],` +
+		`"tools":[{"name":"get_weather","description":"Look up the weather","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}}],` +
+		`"tool_choice":{"type":"tool","name":"get_weather"}}`
+	w := postMessages(t, p, body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	if len(got.Tools) != 1 || got.Tools[0].Type != "function" || got.Tools[0].Function.Name != "get_weather" {
+		t.Fatalf("provider received tools %+v", got.Tools)
+	}
+	if !strings.Contains(string(got.Tools[0].Function.Parameters), `"city"`) {
+		t.Errorf("parameters = %s, want the input schema", got.Tools[0].Function.Parameters)
+	}
+	if want := `{"function":{"name":"get_weather"},"type":"function"}`; string(got.ToolChoice) != want {
+		t.Errorf("tool_choice = %s, want %s", got.ToolChoice, want)
+	}
+}
+
+func TestHandleMessages_RoutingHeadersStreaming(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"index\":0}]}\n\ndata: [DONE]\n\n")) //nolint:errcheck
+	})
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hello"}]}`
+	w := postMessages(t, p, body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !w.Flushed {
+		t.Fatal("expected a streamed (flushed) response")
+	}
+	// The recorder snapshots headers at the first flush, so these were
+	// written before any SSE data.
+	assertRoutingHeaders(t, w.Result().Header, "stub", "budget", "interactive")
+}
+
+// TestHandleMessages_StreamFallbackToJSON verifies that when a provider
+// ignores stream: true and returns a JSON document, the client still
+// receives a well-formed SSE sequence.
+func TestHandleMessages_StreamFallbackToJSON(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"choices":[{"message":{"content":"not streamed"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`)) //nolint:errcheck
+	})
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hello"}]}`
+	w := postMessages(t, p, body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	assertSSEEvents(t, w.Body.String(), "message_start", "content_block_start",
+		"content_block_delta", "content_block_stop", "message_delta", "message_stop")
+	if !strings.Contains(w.Body.String(), `"text":"not streamed"`) {
+		t.Errorf("stream missing the response text:\n%s", w.Body.String())
+	}
+}
+
+// redirectTransport sends every request to target's host, letting tests
+// stand in for providers whose endpoints are fixed (api.anthropic.com).
+type redirectTransport struct{ target *url.URL }
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+	r.Host = ""
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// TestAnthropicNormalizedStreaming exercises the normalised (non-raw)
+// Anthropic path end to end: the failover engine builds a streaming request
+// body for the Anthropic endpoint, and the SSE it returns is passed through
+// to the client unchanged.
+func TestAnthropicNormalizedStreaming(t *testing.T) {
+	const sse = "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[]}}` + "\n\n" +
+		"event: content_block_start\n" +
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+		"event: content_block_stop\n" +
+		`data: {"type":"content_block_stop","index":0}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+
+	var gotPath string
+	var gotBody map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody) //nolint:errcheck
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(sse)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	target, _ := url.Parse(srv.URL)
+	orig := http.DefaultClient.Transport
+	http.DefaultClient.Transport = redirectTransport{target}
+	t.Cleanup(func() { http.DefaultClient.Transport = orig })
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+
+	cfg := &config.Config{
+		Defaults: config.Defaults{FallbackModel: "claude-stub"},
+		Models: map[string]config.Model{
+			"claude-stub": {Provider: "anthropic", APIModel: "claude-test", QualityCeiling: 0.9},
+		},
+	}
+	engine := router.NewFailoverEngine(cfg, router.NewRouter(cfg), nil)
+
+	resp, usedModel, err := engine.ExecuteWithFailover(context.Background(),
+		router.RoutingDecision{Model: "claude-stub", Tier: "premium"},
+		router.ProviderRequest{
+			SystemPrompt: "be brief",
+			Messages:     []router.ProviderMessage{{Role: "user", Content: "hi"}},
+			MaxTokens:    64,
+			Stream:       true,
+		})
+	if err != nil {
+		t.Fatalf("ExecuteWithFailover: %v", err)
+	}
+	if usedModel != "claude-stub" {
+		t.Errorf("served by %s, want claude-stub", usedModel)
+	}
+
+	if gotPath != "/v1/messages" {
+		t.Errorf("request path = %q, want /v1/messages", gotPath)
+	}
+	for field, want := range map[string]string{
+		"model":      `"claude-test"`,
+		"stream":     "true",
+		"system":     `"be brief"`,
+		"max_tokens": "64",
+		"messages":   `[{"content":"hi","role":"user"}]`,
+	} {
+		if got := string(gotBody[field]); got != want {
+			t.Errorf("request %s = %s, want %s", field, got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	StreamAnthropicPassthrough(w, resp, "evt-1")
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	// Only the connection comment is added ahead of the provider's events.
+	if want := ": connected\n\n" + sse; w.Body.String() != want {
+		t.Errorf("stream was not passed through verbatim:\ngot:\n%s\nwant:\n%s", w.Body.String(), want)
+	}
+}
+
+// TestHandleMessages_ConcurrencyLimit holds the provider open while more
+// requests than proxy.max_concurrent_requests arrive, and checks that only
+// the allowed number reach the provider and the rest get a 429.
+func TestHandleMessages_ConcurrencyLimit(t *testing.T) {
+	const limit, total = 2, 5
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	arrived := make(chan struct{}, total)
+	unblock := make(chan struct{})
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		arrived <- struct{}{}
+		<-unblock
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+	})
+	p.limiter = newConcurrencyLimiter(limit, 0)
+
+	codes := make(chan int, total)
+	var wg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- postMessages(t, p, simpleRequestBody, nil).Code
+		}()
+	}
+
+	// Once the admitted requests are at the provider, everything else has
+	// been turned away; then let the admitted ones finish.
+	for i := 0; i < limit; i++ {
+		<-arrived
+	}
+	rejected := 0
+	for rejected < total-limit {
+		if code := <-codes; code != http.StatusTooManyRequests {
+			t.Fatalf("got status %d while saturated, want 429", code)
+		}
+		rejected++
+	}
+	close(unblock)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("admitted request got status %d, want 200", code)
+		}
+	}
+	if maxInFlight > limit {
+		t.Errorf("provider saw %d concurrent requests, limit is %d", maxInFlight, limit)
+	}
+}
+
+// TestHandleMessages_ConcurrencyQueue checks that with a queue timeout, a
+// request arriving while saturated waits for a slot instead of failing.
+func TestHandleMessages_ConcurrencyQueue(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+	})
+	p.limiter = newConcurrencyLimiter(1, 5*time.Second)
+
+	first := make(chan int, 1)
+	go func() { first <- postMessages(t, p, simpleRequestBody, nil).Code }()
+	<-arrived
+
+	second := make(chan int, 1)
+	go func() { second <- postMessages(t, p, simpleRequestBody, nil).Code }()
+	time.Sleep(20 * time.Millisecond) // let the second request start queueing
+	close(unblock)
+
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first request got %d, want 200", code)
+	}
+	if code := <-second; code != http.StatusOK {
+		t.Errorf("queued request got %d, want 200", code)
+	}
+}
+
+func TestHandleMessages_BodyTooLarge(t *testing.T) {
+	p := newTestProxy(t)
+	p.cfg.Proxy.MaxBodyBytes = 1024
+
+	oversized := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"` +
+		strings.Repeat("x", 2048) + `"}]}`
+	w := postMessages(t, p, oversized, nil)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d, want 413: %s", w.Code, w.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("invalid JSON error response: %v", err)
+	}
+	if errResp.Type != "error" || errResp.Error.Type != "request_too_large" {
+		t.Errorf("got error %+v, want Anthropic request_too_large error", errResp)
+	}
+
+	// A body under the limit is still accepted.
+	if w := postMessages(t, p, simpleRequestBody, nil); w.Code != http.StatusOK {
+		t.Errorf("small body: got status %d, want 200", w.Code)
+	}
+}
+
+func TestHandleMessages_RejectsMultipleCompletions(t *testing.T) {
+	p := newTestProxy(t)
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"n":3,"messages":[{"role":"user","content":"hi"}]}`
+	w := postMessages(t, p, body, nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400: %s", w.Code, w.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("invalid JSON error response: %v", err)
+	}
+	if errResp.Error.Type != "invalid_request_error" || !strings.Contains(errResp.Error.Message, "n=3 is not supported") {
+		t.Errorf("got error %+v, want an invalid_request_error explaining n is unsupported", errResp)
+	}
+
+	// n: 1 asks for the single completion the proxy returns anyway.
+	body = `{"model":"claude-sonnet","max_tokens":100,"n":1,"messages":[{"role":"user","content":"hi"}]}`
+	if w := postMessages(t, p, body, nil); w.Code != http.StatusOK {
+		t.Errorf("n=1: got status %d, want 200", w.Code)
+	}
+}
+
+func TestHandleHealth_TelemetryStatus(t *testing.T) {
+	health := func(p *ProxyServer) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		p.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var payload map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("invalid health JSON: %v", err)
+		}
+		if payload["status"] != "ok" {
+			t.Errorf("status = %v, want ok", payload["status"])
+		}
+		s, _ := payload["telemetry"].(string)
+		return s
+	}
+
+	p := newTestProxy(t)
+	if got := health(p); got != "disabled" {
+		t.Errorf("without telemetry: got %q, want disabled", got)
+	}
+
+	tel, err := telemetry.NewCollector(filepath.Join(t.TempDir(), "health.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	p.telemetry = tel
+	if got := health(p); got != "ok" {
+		t.Errorf("open collector: got %q, want ok", got)
+	}
+
+	tel.Close()
+	if got := health(p); got != "degraded" {
+		t.Errorf("closed collector: got %q, want degraded", got)
+	}
+}
+
+func TestHandleMessages_RecordsCacheUsage(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],` + //nolint:errcheck
+			`"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":1,` +
+			`"cache_creation_input_tokens":40,"cache_read_input_tokens":2000}}`))
+	})
+	stub := p.cfg.Models["stub"]
+	stub.Provider = "anthropic"
+	p.cfg.Models["stub"] = stub
+
+	tel, err := telemetry.NewCollector(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer tel.Close()
+	p.telemetry = tel
+
+	w := postMessages(t, p, simpleRequestBody, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"cache_read_input_tokens":2000`) {
+		t.Errorf("cache usage missing from response: %s", w.Body.String())
+	}
+
+	var buf bytes.Buffer
+	if err := tel.ExportEvents(&buf, "json", time.Time{}); err != nil {
+		t.Fatalf("ExportEvents: %v", err)
+	}
+	var events []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil || len(events) != 1 {
+		t.Fatalf("expected one recorded event, got %s (%v)", buf.String(), err)
+	}
+	if got := events[0]["cache_creation_input_tokens"]; got != float64(40) {
+		t.Errorf("cache_creation_input_tokens = %v, want 40", got)
+	}
+	if got := events[0]["cache_read_input_tokens"]; got != float64(2000) {
+		t.Errorf("cache_read_input_tokens = %v, want 2000", got)
+	}
+}
+
+func TestProviderResponseParseErrorsWrapCause(t *testing.T) {
+	for name, decode := range map[string]func([]byte, string, string) (AnthropicResponse, error){
+		"openai": openAIResponseToAnthropic,
+		"ollama": ollamaResponseToAnthropic,
+	} {
+		_, err := decode([]byte(`{"choices":`), "evt", "m")
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) || !strings.HasPrefix(err.Error(), "failed to parse provider response: ") {
+			t.Errorf("%s: err = %v, want a wrapped *json.SyntaxError", name, err)
+		}
+	}
+}
+
+func TestHandleMessages_RecordsTokensAndCost(t *testing.T) {
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1500,"completion_tokens":500}}`)) //nolint:errcheck
+	})
+	stub := p.cfg.Models["stub"]
+	stub.CostPer1kTok = 0.002
+	p.cfg.Models["stub"] = stub
+
+	tel, err := telemetry.NewCollector(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer tel.Close()
+	p.telemetry = tel
+
+	if w := postMessages(t, p, simpleRequestBody, nil); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	stats, err := tel.GetStats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.InputTokens != 1500 || stats.OutputTokens != 500 {
+		t.Errorf("tokens = %d in, %d out; want 1500, 500", stats.InputTokens, stats.OutputTokens)
+	}
+	if math.Abs(stats.TotalCost-0.004) > 1e-9 {
+		t.Errorf("TotalCost = %f, want 0.004 for 2k tokens at 0.002 per 1k", stats.TotalCost)
+	}
+}
+
+func TestHandleMessages_ForwardsImagesToOllama(t *testing.T) {
+	var got struct {
+		Messages []struct {
+			Content string   `json:"content"`
+			Images  []string `json:"images"`
+		} `json:"messages"`
+	}
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":{"role":"assistant","content":"a cat"},"done":true,"eval_count":2}`)) //nolint:errcheck
+	})
+	stub := p.cfg.Models["stub"]
+	stub.Provider = "ollama"
+	p.cfg.Models["stub"] = stub
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":[` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},` +
+		`{"type":"text","text":"What is in this picture?"}]}]}`
+	if w := postMessages(t, p, body, nil); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	if len(got.Messages) != 1 {
+		t.Fatalf("provider got %d messages, want 1", len(got.Messages))
+	}
+	msg := got.Messages[0]
+	if msg.Content != "What is in this picture?" || len(msg.Images) != 1 || msg.Images[0] != "iVBORw0KGgo=" {
+		t.Errorf("provider got content %q images %q, want the text and the base64 image", msg.Content, msg.Images)
+	}
+}
+
+func TestHandleMessages_ForwardsSamplingParamsToOllama(t *testing.T) {
+	var got struct {
+		Options map[string]any `json:"options"`
+	}
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":{"role":"assistant","content":"ok"},"done":true,"eval_count":1}`)) //nolint:errcheck
+	})
+	stub := p.cfg.Models["stub"]
+	stub.Provider = "ollama"
+	p.cfg.Models["stub"] = stub
+
+	body := `{"model":"claude-sonnet","max_tokens":100,"temperature":0.5,"top_p":0.8,"top_k":20,` +
+		`"stop_sequences":["###"],"messages":[{"role":"user","content":"hi"}]}`
+	if w := postMessages(t, p, body, nil); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	want := map[string]any{"temperature": 0.5, "top_p": 0.8, "top_k": float64(20), "stop": []any{"###"}}
+	for key, v := range want {
+		if !reflect.DeepEqual(got.Options[key], v) {
+			t.Errorf("options.%s = %#v, want %#v", key, got.Options[key], v)
+		}
+	}
+}
+
+func TestHandleMessages_ServiceTierRouteClassDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		want    any
+	}{
+		{"route class default", map[string]string{"x-request-type": "background"}, simpleRequestBody, "standard_only"},
+		{"client value wins", map[string]string{"x-request-type": "background"},
+			`{"model":"claude-sonnet","max_tokens":100,"service_tier":"auto","messages":[{"role":"user","content":"hello"}]}`, "auto"},
+		{"no default", nil, simpleRequestBody, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]any
+			p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`)) //nolint:errcheck
+			})
+			stub := p.cfg.Models["stub"]
+			stub.Provider = "anthropic"
+			p.cfg.Models["stub"] = stub
+			p.cfg.RouteClasses["background"] = config.RouteClass{DefaultTier: "budget", ServiceTier: "standard_only"}
+
+			if w := postMessages(t, p, tt.body, tt.headers); w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+			}
+			if got["service_tier"] != tt.want {
+				t.Errorf("provider got service_tier %v, want %v", got["service_tier"], tt.want)
+			}
+		})
+	}
+}
+
+// TestHandleMessages_RequestDefaultsPrecedence verifies the order in which
+// max_tokens and temperature are chosen: route class, then task, then the
+// client's own values.
+func TestHandleMessages_RequestDefaultsPrecedence(t *testing.T) {
+	classTemp, taskTemp := 0.5, 0.1
+	tests := []struct {
+		name            string
+		task            config.TaskSpec
+		body            string
+		wantMaxTokens   float64
+		wantTemperature float64
+	}{
+		{"route class", config.TaskSpec{},
+			`{"model":"claude-sonnet","messages":[{"role":"user","content":"hello"}]}`, 300, 0.5},
+		{"task overrides route class", config.TaskSpec{MaxTokens: 200, Temperature: &taskTemp},
+			`{"model":"claude-sonnet","messages":[{"role":"user","content":"hello"}]}`, 200, 0.1},
+		{"request overrides task", config.TaskSpec{MaxTokens: 200, Temperature: &taskTemp},
+			`{"model":"claude-sonnet","max_tokens":50,"temperature":0.9,"messages":[{"role":"user","content":"hello"}]}`, 50, 0.9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]any
+			p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+			})
+			p.cfg.RouteClasses["interactive"] = config.RouteClass{DefaultTier: "budget", MaxTokens: 300, Temperature: &classTemp}
+			p.cfg.Tasks = map[string]config.TaskSpec{"chat": tt.task}
+
+			if w := postMessages(t, p, tt.body, nil); w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+			}
+			if got["max_tokens"] != tt.wantMaxTokens || got["temperature"] != tt.wantTemperature {
+				t.Errorf("provider got max_tokens=%v temperature=%v, want %v and %v",
+					got["max_tokens"], got["temperature"], tt.wantMaxTokens, tt.wantTemperature)
+			}
+		})
+	}
+}
+
+func TestShouldSampleApproximatesRate(t *testing.T) {
+	const n = 20000
+	for _, rate := range []float64{0.01, 0.1, 0.5} {
+		hits := 0
+		for i := 0; i < n; i++ {
+			if shouldSample(uuid.New().String(), rate) {
+				hits++
+			}
+		}
+		got := float64(hits) / n
+		if math.Abs(got-rate) > 0.02 {
+			t.Errorf("rate %.2f: sampled fraction %.4f, want within 0.02", rate, got)
+		}
+	}
+}
+
+func TestShouldSampleBoundsAndDeterminism(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id := uuid.New().String()
+		if shouldSample(id, 0) {
+			t.Fatalf("rate 0 sampled %s", id)
+		}
+		if !shouldSample(id, 1) {
+			t.Fatalf("rate 1 did not sample %s", id)
+		}
+		if shouldSample(id, 0.3) != shouldSample(id, 0.3) {
+			t.Fatalf("sampling decision for %s is not reproducible", id)
+		}
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	if got := previewText("short", 10); got != "short" {
+		t.Errorf("previewText(short) = %q", got)
+	}
+	if got := previewText("héllo wörld", 5); got != "héllo..." {
+		t.Errorf("previewText truncation = %q, want %q", got, "héllo...")
+	}
+}
+
+func TestHandleMessages_VerboseLogsScoring(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := newTestProxy(t)
+	p.SetVerbose(true)
+	postMessages(t, p, simpleRequestBody, nil)
+
+	out := buf.String()
+	for _, want := range []string{
+		"Classification: route_class=interactive (default) task=code confidence=",
+		"min_quality=",
+		"task code matched",
+		"score=",
+		"excluded: quality",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("verbose log missing %q:\n%s", want, out)
+		}
+	}
+	for name := range p.cfg.Models {
+		if !strings.Contains(out, "candidate "+name+" ") {
+			t.Errorf("verbose log has no scoring line for %s", name)
+		}
+	}
+
+	// Without --verbose only the single routing line is logged.
+	buf.Reset()
+	p.SetVerbose(false)
+	postMessages(t, p, simpleRequestBody, nil)
+	if strings.Contains(buf.String(), "candidate ") {
+		t.Error("candidate scores logged without verbose")
+	}
+}
+
+func TestTranslateOllamaResponse_DoneReason(t *testing.T) {
+	body := `{"message":{"content":"truncated"},"done":true,"done_reason":"length","prompt_eval_count":3,"eval_count":5}`
+	w := httptest.NewRecorder()
+	translateOllamaResponseToAnthropic(w, []byte(body), "evt-1", "llama3.2")
+
+	var resp AnthropicResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.StopReason != "max_tokens" {
+		t.Errorf("stop_reason = %q, want max_tokens", resp.StopReason)
+	}
+	if resp.Usage.InputTokens != 3 || resp.Usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v, want 3 in / 5 out", resp.Usage)
+	}
+}
+
+func TestTranslateOpenAIResponse_ToolCalls(t *testing.T) {
+	body := `{"choices":[{"message":{"content":"Let me check.","tool_calls":[` +
+		`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+		`"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":7}}`
+	w := httptest.NewRecorder()
+	translateOpenAIResponseToAnthropic(w, []byte(body), "evt-1", "gpt-4o")
+
+	var raw struct {
+		Content    []map[string]json.RawMessage `json:"content"`
+		StopReason string                       `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("invalid JSON response: %v\n%s", err, w.Body.String())
+	}
+	if len(raw.Content) != 2 {
+		t.Fatalf("content = %s, want a text block and a tool_use block", w.Body.String())
+	}
+	if string(raw.Content[0]["type"]) != `"text"` || string(raw.Content[0]["text"]) != `"Let me check."` {
+		t.Errorf("first block = %v, want the text", raw.Content[0])
+	}
+	tool := raw.Content[1]
+	if string(tool["type"]) != `"tool_use"` || string(tool["id"]) != `"call_1"` || string(tool["name"]) != `"get_weather"` {
+		t.Errorf("second block = %v, want tool_use call_1 get_weather", tool)
+	}
+	if string(tool["input"]) != `{"city":"Paris"}` {
+		t.Errorf("input = %s, want the decoded arguments object", tool["input"])
+	}
+	if _, ok := tool["text"]; ok {
+		t.Error("tool_use block should not carry a text field")
+	}
+	if raw.StopReason != "tool_use" {
+		t.Errorf("stop_reason = %q, want tool_use", raw.StopReason)
+	}
+}
+
+func TestTranslateOpenAIResponse_ToolCallsOnly(t *testing.T) {
+	body := `{"choices":[{"message":{"content":null,"tool_calls":[` +
+		`{"id":"call_1","type":"function","function":{"name":"list_files","arguments":"not json"}}]},` +
+		`"finish_reason":"tool_calls"}]}`
+	resp, err := openAIResponseToAnthropic([]byte(body), "evt-1", "gpt-4o")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Type != "tool_use" {
+		t.Fatalf("content = %+v, want only the tool_use block", resp.Content)
+	}
+	if string(resp.Content[0].Input) != `{}` {
+		t.Errorf("input = %s, want {} for unparseable arguments", resp.Content[0].Input)
+	}
+}
+
+func TestReadProviderBody_GzipOpenAIResponse(t *testing.T) {
+	resp := gzipResponse(t, `{"choices":[{"message":{"content":"decompressed"},"finish_reason":"stop"}],"usage":{"prompt_tokens":2,"completion_tokens":4}}`)
+
+	body, err := readProviderBody(resp)
+	if err != nil {
+		t.Fatalf("readProviderBody: %v", err)
+	}
+	w := httptest.NewRecorder()
+	translateOpenAIResponseToAnthropic(w, body, "evt-gz", "gpt-4o")
+
+	var out AnthropicResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON response: %v\n%s", err, w.Body.String())
+	}
+	if len(out.Content) != 1 || out.Content[0].Text != "decompressed" {
+		t.Errorf("content = %+v, want the decompressed text", out.Content)
+	}
+	if out.Usage.InputTokens != 2 || out.Usage.OutputTokens != 4 {
+		t.Errorf("usage = %+v, want 2 in / 4 out", out.Usage)
+	}
+}
+
+func TestReadProviderBody_Plain(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("plain"))}
+	body, err := readProviderBody(resp)
+	if err != nil || string(body) != "plain" {
+		t.Errorf("readProviderBody = %q, %v; want plain", body, err)
+	}
+}
+
+func TestTranslateOllamaResponse_Error(t *testing.T) {
+	w := httptest.NewRecorder()
+	translateOllamaResponseToAnthropic(w, []byte(`{"error":"model 'nope' not found"}`), "evt-1", "nope")
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("got status %d, want 502", w.Code)
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("invalid JSON error response: %v", err)
+	}
+	if errResp.Error.Type != "api_error" || errResp.Error.Message != "ollama: model 'nope' not found" {
+		t.Errorf("got %+v, want api_error with the Ollama message", errResp.Error)
+	}
+}
+
+// TestHandleMessages_TracingSpans installs an in-memory span recorder and
+// checks that a request produces a server span with a child span per
+// provider attempt, and that the trace context reaches the provider.
+func TestHandleMessages_TracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	var gotTraceparent string
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	w := postMessages(t, p, simpleRequestBody, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+	reqSpan, ok := byName["sr-router.request"]
+	if !ok {
+		t.Fatalf("no sr-router.request span among %d spans", len(spans))
+	}
+	callSpan, ok := byName["provider.call"]
+	if !ok {
+		t.Fatalf("no provider.call span among %d spans", len(spans))
+	}
+	if callSpan.Parent().SpanID() != reqSpan.SpanContext().SpanID() {
+		t.Error("provider.call span is not a child of the request span")
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range callSpan.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["sr.model"].AsString(); got != "stub" {
+		t.Errorf("sr.model = %q, want %q", got, "stub")
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("http.response.status_code = %d, want 200", got)
+	}
+
+	if want := callSpan.SpanContext().TraceID().String(); !strings.Contains(gotTraceparent, want) {
+		t.Errorf("provider traceparent %q does not carry trace ID %s", gotTraceparent, want)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
+	"github.com/jbctechsolutions/sr-router/telemetry"
+)
+
+// shadowTimeout bounds a shadow model call, including reading its response.
+const shadowTimeout = 2 * time.Minute
+
+// shadowEventSuffix is appended to a request's event ID to form the ID of
+// its shadow event.
+const shadowEventSuffix = ":shadow"
+
+// startShadow sends req to defaults.shadow_model in the background when the
+// request identified by eventID is sampled for shadowing, and records the
+// outcome as a telemetry event whose shadow_of is eventID. Nothing is sent
+// when no shadow model is configured or it is the model that served the
+// request.
+//
+// The call is detached from the client's context and never writes to the
+// client: a slow or failing shadow model only shows up in telemetry and the
+// log. Shutdown waits for shadow calls in flight before closing telemetry.
+func (p *ProxyServer) startShadow(ctx context.Context, cfg *config.Config, failover *router.FailoverEngine, eventID string, c router.Classification, d router.RoutingDecision, usedModel string, req router.ProviderRequest) {
+	shadowModel := cfg.Defaults.ShadowModel
+	if shadowModel == "" || shadowModel == usedModel {
+		return
+	}
+	rate := cfg.Defaults.ShadowSampleRate
+	if rate == 0 {
+		rate = 1
+	}
+	if !shouldSample(eventID+shadowEventSuffix, rate) {
+		return
+	}
+	model, ok := cfg.Models[shadowModel]
+	if !ok {
+		log.Printf("Warning: shadow model %q not found in config, skipping", shadowModel)
+		return
+	}
+
+	// Read the whole answer in one piece; nobody is waiting on a stream.
+	// Anthropic models are sent the client's raw body, so it must not ask
+	// for a stream either; failing that, use the normalised request.
+	req.Stream = false
+	if len(req.RawAnthropicBody) > 0 {
+		body, err := setBodyFields(req.RawAnthropicBody, map[string]any{"stream": false})
+		if err != nil {
+			body = nil
+		}
+		req.RawAnthropicBody = body
+	}
+
+	p.shadows.Add(1)
+	go func() {
+		defer p.shadows.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowTimeout)
+		defer cancel()
+
+		start := time.Now()
+		status := 0
+		var usage Usage
+		resp, err := failover.ExecuteModel(ctx, shadowModel, req)
+		if err == nil {
+			status = resp.StatusCode
+			var body []byte
+			body, err = readProviderBody(resp)
+			resp.Body.Close()
+			usage = providerUsage(model.Provider, body)
+		}
+		if err != nil {
+			log.Printf("Shadow %s: %s failed: %v", eventID, shadowModel, err)
+		}
+
+		event := telemetry.RoutingEvent{
+			ID:            eventID + shadowEventSuffix,
+			RouteClass:    c.RouteClass,
+			TaskType:      c.TaskType,
+			Tier:          d.Tier,
+			SelectedModel: shadowModel,
+			LatencyMs:     int(time.Since(start).Milliseconds()),
+			ShadowOf:      eventID,
+			ShadowStatus:  status,
+		}
+		setEventTokens(&event, model, usage.InputTokens, usage.OutputTokens)
+		p.recordRouting(event)
+	}()
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/telemetry"
+)
+
+// shadowStubProxy returns a proxy with telemetry whose provider answers
+// "primary" for the routed model and hands requests for the shadow model to
+// shadow. defaults.shadow_model is set to a model costing $0.002 per 1k
+// tokens, which scores too low to be routed to.
+func shadowStubProxy(t *testing.T, shadow http.HandlerFunc) (*ProxyServer, *telemetry.Collector) {
+	t.Helper()
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		if body.Model == "shadow-model" {
+			shadow(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"primary"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	stub := p.cfg.Models["stub"]
+	p.cfg.Models["shadow"] = config.Model{Provider: stub.Provider, APIModel: "shadow-model",
+		BaseURL: stub.BaseURL, QualityCeiling: 0.1, CostPer1kTok: 0.002}
+	p.cfg.Defaults.ShadowModel = "shadow"
+
+	tel, err := telemetry.NewCollector(filepath.Join(t.TempDir(), "shadow.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tel.Close() })
+	p.telemetry = tel
+	return p, tel
+}
+
+// exportedEvents returns every recorded routing event, keyed by ID.
+func exportedEvents(t *testing.T, tel *telemetry.Collector) map[string]map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tel.ExportEvents(&buf, "json", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	events := make(map[string]map[string]any)
+	for _, row := range rows {
+		events[row["id"].(string)] = row
+	}
+	return events
+}
+
+func TestHandleMessages_ShadowModelRunsInBackground(t *testing.T) {
+	var shadowCalls int32
+	release := make(chan struct{})
+	p, tel := shadowStubProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&shadowCalls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"shadow"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)) //nolint:errcheck
+	})
+
+	// The shadow model is held until release, so the client getting its
+	// answer shows the shadow call does not hold it up.
+	w := postMessages(t, p, simpleRequestBody, map[string]string{"X-Request-Id": "req-shadow"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"text":"primary"`) {
+		t.Fatalf("got %d %s, want the primary model's answer", w.Code, w.Body.String())
+	}
+	assertRoutingHeaders(t, w.Header(), "stub", "budget", "interactive")
+	if _, ok := exportedEvents(t, tel)["req-shadow"+shadowEventSuffix]; ok {
+		t.Error("shadow event recorded before the shadow model answered")
+	}
+
+	close(release)
+	p.shadows.Wait()
+
+	if n := atomic.LoadInt32(&shadowCalls); n != 1 {
+		t.Errorf("shadow model calls = %d, want 1", n)
+	}
+	events := exportedEvents(t, tel)
+	if got := events["req-shadow"]["shadow_of"]; got != nil {
+		t.Errorf("primary event shadow_of = %v, want null", got)
+	}
+	shadow, ok := events["req-shadow"+shadowEventSuffix]
+	if !ok {
+		t.Fatalf("no shadow event recorded; events: %v", events)
+	}
+	if shadow["shadow_of"] != "req-shadow" || shadow["selected_model"] != "shadow" ||
+		shadow["shadow_status"] != float64(http.StatusOK) || shadow["input_tokens"] != 1.0 ||
+		shadow["output_tokens"] != 1.0 || shadow["estimated_cost"] != 2.0/1000*0.002 {
+		t.Errorf("shadow event = %v, want shadow_of req-shadow, model shadow, status 200, 1+1 tokens at 0.002 per 1k", shadow)
+	}
+
+	stats, err := tel.GetStats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 1 || stats.ByModel["shadow"] != 0 {
+		t.Errorf("stats = %d requests by %v, want only the primary request counted", stats.TotalRequests, stats.ByModel)
+	}
+}
+
+func TestHandleMessages_ShadowFailureDoesNotAffectClient(t *testing.T) {
+	p, tel := shadowStubProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"shadow down"}`, http.StatusInternalServerError)
+	})
+
+	for _, stream := range []bool{false, true} {
+		id := "req-nonstream"
+		body := simpleRequestBody
+		if stream {
+			id = "req-stream"
+			body = strings.Replace(body, `"max_tokens"`, `"stream":true,"max_tokens"`, 1)
+		}
+		w := postMessages(t, p, body, map[string]string{"X-Request-Id": id})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "primary") {
+			t.Errorf("stream=%v: got %d %s, want the primary model's answer", stream, w.Code, w.Body.String())
+		}
+	}
+	p.shadows.Wait()
+
+	events := exportedEvents(t, tel)
+	for _, id := range []string{"req-nonstream", "req-stream"} {
+		shadow, ok := events[id+shadowEventSuffix]
+		if !ok {
+			t.Errorf("no shadow event recorded for %s", id)
+			continue
+		}
+		if shadow["shadow_status"] != float64(0) {
+			t.Errorf("%s shadow_status = %v, want 0 for a failed call", id, shadow["shadow_status"])
+		}
+	}
+}
+
+// TestHandleMessages_AnthropicShadowIsNotStreamed verifies that an anthropic
+// shadow model, which is sent the client's raw body, is asked for a single
+// JSON response even when the client streams, so its usage is recorded.
+func TestHandleMessages_AnthropicShadowIsNotStreamed(t *testing.T) {
+	var gotStream atomic.Value
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		gotStream.Store(body.Stream)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":[{"type":"text","text":"shadow"}],"usage":{"input_tokens":3,"output_tokens":2}}`)) //nolint:errcheck
+	}))
+	defer anthropic.Close()
+
+	p, tel := shadowStubProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the openai_compat shadow model should not be called")
+	})
+	p.cfg.Models["shadow"] = config.Model{Provider: "anthropic", APIModel: "claude-shadow",
+		BaseURL: anthropic.URL, QualityCeiling: 0.1, CostPer1kTok: 0.002}
+
+	body := strings.Replace(simpleRequestBody, `"max_tokens"`, `"stream":true,"max_tokens"`, 1)
+	if w := postMessages(t, p, body, map[string]string{"X-Request-Id": "req-anthropic"}); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body.String())
+	}
+	p.shadows.Wait()
+
+	if stream, _ := gotStream.Load().(bool); stream {
+		t.Error("anthropic shadow model was asked to stream")
+	}
+	shadow, ok := exportedEvents(t, tel)["req-anthropic"+shadowEventSuffix]
+	if !ok {
+		t.Fatal("no shadow event recorded")
+	}
+	if shadow["input_tokens"] != 3.0 || shadow["output_tokens"] != 2.0 || shadow["estimated_cost"] != 5.0/1000*0.002 {
+		t.Errorf("shadow event = %v, want 3+2 tokens at 0.002 per 1k", shadow)
+	}
+}
@@ -7,10 +7,57 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+	"github.com/jbctechsolutions/sr-router/router"
 )
 
+// streamOptions are a server's settings for the streaming translators. The
+// zero value gives the defaults; NewProxyServer fills them in from the
+// proxy: config, and each ProxyServer keeps its own.
+type streamOptions struct {
+	// maxLineBytes is the longest line accepted from a provider, zero
+	// meaning config.DefaultMaxStreamLineBytes. bufio.Scanner stops at 64KB
+	// by default, which a single large delta (a long tool call's arguments,
+	// say) can exceed. Set from proxy.max_stream_line_bytes.
+	maxLineBytes int
+
+	// flushInterval is how long a text or thinking delta is held for
+	// deltas close behind it (see deltaBatcher). Zero sends every delta as
+	// it arrives. Set from proxy.stream_flush_ms.
+	flushInterval time.Duration
+}
+
+// lineLimit returns the longest line o accepts.
+func (o streamOptions) lineLimit() int {
+	if o.maxLineBytes > 0 {
+		return o.maxLineBytes
+	}
+	return config.DefaultMaxStreamLineBytes
+}
+
+// newStreamScanner returns a line scanner over r that accepts lines up to
+// o's line limit. The buffer starts small and grows only for long lines.
+func newStreamScanner(r io.Reader, o streamOptions) *bufio.Scanner {
+	limit := o.lineLimit()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64*1024, limit)), limit)
+	return scanner
+}
+
+// streamReadError reports a failure reading a provider stream, such as a
+// line longer than the line limit, as an SSE error event so the client
+// does not mistake a truncated stream for a complete one.
+func streamReadError(w http.ResponseWriter, f http.Flusher, err error) {
+	log.Printf("Warning: reading provider stream: %v", err)
+	emitStreamError(w, f, "api_error", "reading provider stream: "+err.Error())
+}
+
 // --- Anthropic SSE event types -----------------------------------------------
 
 // messageStartEvent is the first event emitted in every streaming response.
@@ -26,8 +73,10 @@ type messageStartPayload struct {
 	Model   string        `json:"model"`
 	Content []interface{} `json:"content"`
 	Usage   struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 	} `json:"usage"`
 }
 
@@ -51,19 +100,64 @@ type contentBlockDelta struct {
 	} `json:"delta"`
 }
 
+// thinkingBlockStart signals the opening of a thinking (reasoning) block.
+type thinkingBlockStart struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type     string `json:"type"`
+		Thinking string `json:"thinking"`
+	} `json:"content_block"`
+}
+
+// thinkingBlockDelta carries an incremental reasoning chunk.
+type thinkingBlockDelta struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	Delta struct {
+		Type     string `json:"type"`
+		Thinking string `json:"thinking"`
+	} `json:"delta"`
+}
+
+// toolUseBlockStart signals the opening of a tool_use block; its input is
+// sent in input_json_delta events.
+type toolUseBlockStart struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type  string   `json:"type"`
+		ID    string   `json:"id"`
+		Name  string   `json:"name"`
+		Input struct{} `json:"input"`
+	} `json:"content_block"`
+}
+
+// inputJSONDelta carries a fragment of a tool_use block's JSON input.
+type inputJSONDelta struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	Delta struct {
+		Type        string `json:"type"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+}
+
 // contentBlockStop signals the end of a content block.
 type contentBlockStop struct {
 	Type  string `json:"type"`
 	Index int    `json:"index"`
 }
 
-// messageDelta carries the stop reason and final token usage.
+// messageDelta carries the stop reason and final token usage. Input tokens
+// are included when known.
 type messageDelta struct {
 	Type  string `json:"type"`
 	Delta struct {
 		StopReason string `json:"stop_reason"`
 	} `json:"delta"`
 	Usage struct {
+		InputTokens  int `json:"input_tokens,omitempty"`
 		OutputTokens int `json:"output_tokens"`
 	} `json:"usage"`
 }
@@ -84,9 +178,15 @@ func sseHeaders(w http.ResponseWriter) {
 }
 
 // checkResponseStatus returns true if the provider response has a non-2xx
-// status. When that happens it reads the body, closes it, and writes an
-// Anthropic-format error to w so the caller can return early.
+// status or an undecodable body. When that happens it reads the body, closes
+// it, and writes an Anthropic-format error to w so the caller can return
+// early. Otherwise a gzip-encoded body is left wrapped for decompression.
 func checkResponseStatus(w http.ResponseWriter, resp *http.Response) bool {
+	if err := router.DecodeResponseBody(resp); err != nil {
+		resp.Body.Close()
+		sendError(w, "api_error", err.Error(), http.StatusBadGateway)
+		return true
+	}
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return false
 	}
@@ -100,6 +200,14 @@ func checkResponseStatus(w http.ResponseWriter, resp *http.Response) bool {
 	return true
 }
 
+// writeSSEConnected writes and flushes a ": connected" SSE comment. Sent
+// right after the headers, it gives clients and intermediaries bytes to see
+// before the model produces its first event; SSE parsers ignore comments.
+func writeSSEConnected(w http.ResponseWriter, flusher http.Flusher) {
+	io.WriteString(w, ": connected\n\n") //nolint:errcheck
+	flusher.Flush()
+}
+
 // writeSSEEvent serialises data as JSON and writes a single SSE event frame,
 // then flushes the connection.
 func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) {
@@ -126,38 +234,62 @@ func buildMessageStart(id, model string) messageStartEvent {
 	return messageStartEvent{Type: "message_start", Message: payload}
 }
 
-// buildContentBlockStart constructs the content block opening event.
-func buildContentBlockStart() contentBlockStart {
+// buildContentBlockStart constructs the text block opening event at index.
+func buildContentBlockStart(index int) contentBlockStart {
 	cbs := contentBlockStart{
 		Type:  "content_block_start",
-		Index: 0,
+		Index: index,
 	}
 	cbs.ContentBlock.Type = "text"
 	cbs.ContentBlock.Text = ""
 	return cbs
 }
 
-// buildContentBlockDelta constructs a delta event for the given text chunk.
-func buildContentBlockDelta(text string) contentBlockDelta {
+// buildContentBlockDelta constructs a delta event for the given text chunk
+// in the block at index.
+func buildContentBlockDelta(index int, text string) contentBlockDelta {
 	cbd := contentBlockDelta{
 		Type:  "content_block_delta",
-		Index: 0,
+		Index: index,
 	}
 	cbd.Delta.Type = "text_delta"
 	cbd.Delta.Text = text
 	return cbd
 }
 
-// buildContentBlockStop constructs the content block closing event.
-func buildContentBlockStop() contentBlockStop {
-	return contentBlockStop{Type: "content_block_stop", Index: 0}
+// buildThinkingBlockStart constructs the thinking block opening event at index.
+func buildThinkingBlockStart(index int) thinkingBlockStart {
+	tbs := thinkingBlockStart{
+		Type:  "content_block_start",
+		Index: index,
+	}
+	tbs.ContentBlock.Type = "thinking"
+	return tbs
+}
+
+// buildThinkingBlockDelta constructs a delta event for a reasoning chunk in
+// the block at index.
+func buildThinkingBlockDelta(index int, thinking string) thinkingBlockDelta {
+	tbd := thinkingBlockDelta{
+		Type:  "content_block_delta",
+		Index: index,
+	}
+	tbd.Delta.Type = "thinking_delta"
+	tbd.Delta.Thinking = thinking
+	return tbd
+}
+
+// buildContentBlockStop constructs the closing event for the block at index.
+func buildContentBlockStop(index int) contentBlockStop {
+	return contentBlockStop{Type: "content_block_stop", Index: index}
 }
 
 // buildMessageDelta constructs the stop-reason event with token counts.
-func buildMessageDelta(stopReason string, outputTokens int) messageDelta {
+func buildMessageDelta(stopReason string, usage Usage) messageDelta {
 	md := messageDelta{Type: "message_delta"}
 	md.Delta.StopReason = stopReason
-	md.Usage.OutputTokens = outputTokens
+	md.Usage.InputTokens = usage.InputTokens
+	md.Usage.OutputTokens = usage.OutputTokens
 	return md
 }
 
@@ -166,52 +298,195 @@ func buildMessageStop() messageStop {
 	return messageStop{Type: "message_stop"}
 }
 
-// emitPreamble writes message_start and content_block_start then flushes.
-func emitPreamble(w http.ResponseWriter, f http.Flusher, requestID, model string) {
-	writeSSEEvent(w, f, "message_start", buildMessageStart(requestID, model))
-	writeSSEEvent(w, f, "content_block_start", buildContentBlockStart())
+// emitPreamble writes message_start, reporting inputTokens, and
+// content_block_start then flushes.
+func emitPreamble(w http.ResponseWriter, f http.Flusher, requestID, model string, inputTokens int) {
+	start := buildMessageStart(requestID, model)
+	start.Message.Usage.InputTokens = inputTokens
+	writeSSEEvent(w, f, "message_start", start)
+	writeSSEEvent(w, f, "content_block_start", buildContentBlockStart(0))
 }
 
 // emitEpilogue writes content_block_stop, message_delta, and message_stop.
-func emitEpilogue(w http.ResponseWriter, f http.Flusher, outputTokens int) {
-	writeSSEEvent(w, f, "content_block_stop", buildContentBlockStop())
-	writeSSEEvent(w, f, "message_delta", buildMessageDelta("end_turn", outputTokens))
+func emitEpilogue(w http.ResponseWriter, f http.Flusher, stopReason string, usage Usage) {
+	writeSSEEvent(w, f, "content_block_stop", buildContentBlockStop(0))
+	emitMessageEnd(w, f, stopReason, usage)
+}
+
+// emitMessageEnd writes message_delta and message_stop.
+func emitMessageEnd(w http.ResponseWriter, f http.Flusher, stopReason string, usage Usage) {
+	writeSSEEvent(w, f, "message_delta", buildMessageDelta(stopReason, usage))
 	writeSSEEvent(w, f, "message_stop", buildMessageStop())
 }
 
+// emitStreamError writes an Anthropic SSE error event for a failure that
+// occurs after the stream has started.
+func emitStreamError(w http.ResponseWriter, f http.Flusher, errorType, message string) {
+	resp := ErrorResponse{Type: "error"}
+	resp.Error.Type = errorType
+	resp.Error.Message = message
+	writeSSEEvent(w, f, "error", resp)
+}
+
+// blockWriter tracks the currently open content block for translators that
+// can interleave block types (thinking then text), assigning each new block
+// the next index and closing the previous one. Text and thinking deltas go
+// through a deltaBatcher, which is flushed before any other event is written.
+type blockWriter struct {
+	w         http.ResponseWriter
+	f         http.Flusher
+	deltas    *deltaBatcher
+	index     int
+	blockType string
+}
+
+func newBlockWriter(w http.ResponseWriter, f http.Flusher, o streamOptions) *blockWriter {
+	return &blockWriter{w: w, f: f, deltas: newDeltaBatcher(w, f, o.flushInterval)}
+}
+
+// open ensures a block of blockType is open, closing any other open block.
+func (b *blockWriter) open(blockType string) {
+	if b.blockType == blockType {
+		return
+	}
+	b.deltas.flush()
+	if b.blockType != "" {
+		writeSSEEvent(b.w, b.f, "content_block_stop", buildContentBlockStop(b.index))
+		b.index++
+	}
+	b.blockType = blockType
+	if blockType == "thinking" {
+		writeSSEEvent(b.w, b.f, "content_block_start", buildThinkingBlockStart(b.index))
+	} else {
+		writeSSEEvent(b.w, b.f, "content_block_start", buildContentBlockStart(b.index))
+	}
+}
+
+// text writes a text delta, opening a text block if needed.
+func (b *blockWriter) text(s string) {
+	b.open("text")
+	b.deltas.text(b.index, s)
+}
+
+// thinking writes a thinking delta, opening a thinking block if needed.
+func (b *blockWriter) thinking(s string) {
+	b.open("thinking")
+	b.deltas.thinking(b.index, s)
+}
+
+// toolUse writes a complete tool_use block, closing any open block first.
+func (b *blockWriter) toolUse(block bufferedBlock) {
+	b.deltas.flush()
+	if b.blockType != "" {
+		writeSSEEvent(b.w, b.f, "content_block_stop", buildContentBlockStop(b.index))
+		b.index++
+		b.blockType = ""
+	}
+	writeToolUseBlock(b.w, b.f, b.index, block)
+	b.index++
+}
+
+// close closes the open block. If no block was ever opened an empty text
+// block is emitted so the response always contains at least one block.
+func (b *blockWriter) close() {
+	b.deltas.flush()
+	if b.blockType == "" {
+		if b.index > 0 {
+			// The last block was a self-contained tool_use block.
+			return
+		}
+		b.open("text")
+	}
+	writeSSEEvent(b.w, b.f, "content_block_stop", buildContentBlockStop(b.index))
+}
+
 // --- OpenAI SSE types --------------------------------------------------------
 
 // openAIChunk is the minimal representation of an OpenAI streaming chunk.
 type openAIChunk struct {
 	Choices []struct {
 		Delta struct {
-			Content string `json:"content"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			// ToolCalls carry a tool call's ID and name in its first
+			// fragment and its arguments spread across any number of
+			// fragments, matched up by Index.
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
 		} `json:"delta"`
-		Index int `json:"index"`
+		Index        int    `json:"index"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	// Usage is sent in a final chunk with no choices when the request set
+	// stream_options.include_usage.
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
 // --- Ollama streaming types --------------------------------------------------
 
 // ollamaChunk is one JSON line from an Ollama /api/chat streaming response.
+// Ollama reports some failures (e.g. an unknown model) as {"error": "..."}
+// with a 200 status, so Error must be checked on every line.
 type ollamaChunk struct {
 	Message struct {
 		Role    string `json:"role"`
 		Content string `json:"content"`
 	} `json:"message"`
-	Done      bool `json:"done"`
-	EvalCount int  `json:"eval_count"`
+	Done       bool   `json:"done"`
+	DoneReason string `json:"done_reason"`
+	EvalCount  int    `json:"eval_count"`
+	// PromptEvalCount is the input token count, reported on the done chunk.
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	Error           string `json:"error"`
+}
+
+// openAIStopReason maps an OpenAI finish_reason to an Anthropic stop_reason:
+// "tool_calls" becomes "tool_use" and "length" becomes "max_tokens";
+// anything else is a normal end of turn.
+func openAIStopReason(finishReason string) string {
+	switch finishReason {
+	case "tool_calls":
+		return "tool_use"
+	case "length":
+		return "max_tokens"
+	}
+	return "end_turn"
+}
+
+// ollamaStopReason maps Ollama's done_reason to an Anthropic stop_reason.
+// Ollama reports "length" when num_predict is exhausted; everything else
+// ("stop", "load", "unload", or absent) is a normal end of turn.
+func ollamaStopReason(doneReason string) string {
+	if doneReason == "length" {
+		return "max_tokens"
+	}
+	return "end_turn"
 }
 
 // --- Public streaming translators --------------------------------------------
 
 // StreamAnthropicPassthrough copies Anthropic SSE from resp.Body directly to
-// w, preserving all event lines verbatim. It only flushes on data lines to
-// keep the output latency low.
+// w, preserving all event lines verbatim after the opening ": connected"
+// comment. It only flushes on data lines to keep the output latency low.
 //
 // This is used when the upstream provider is Anthropic itself — no translation
-// is needed.
+// is needed. That holds whether the request was forwarded raw or rebuilt from
+// the normalised request, since both ask Anthropic for its native stream.
 func StreamAnthropicPassthrough(w http.ResponseWriter, resp *http.Response, _ string) {
+	streamAnthropicPassthrough(w, resp, streamOptions{})
+}
+
+// streamAnthropicPassthrough is StreamAnthropicPassthrough with the stream settings o.
+func streamAnthropicPassthrough(w http.ResponseWriter, resp *http.Response, o streamOptions) {
 	if checkResponseStatus(w, resp) {
 		return
 	}
@@ -224,8 +499,9 @@ func StreamAnthropicPassthrough(w http.ResponseWriter, resp *http.Response, _ st
 	}
 
 	defer resp.Body.Close()
+	writeSSEConnected(w, flusher)
 
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := newStreamScanner(resp.Body, o)
 	for scanner.Scan() {
 		line := scanner.Text()
 		fmt.Fprintf(w, "%s\n", line)
@@ -234,6 +510,10 @@ func StreamAnthropicPassthrough(w http.ResponseWriter, resp *http.Response, _ st
 			flusher.Flush()
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		streamReadError(w, flusher, err)
+		return
+	}
 	// Final flush to ensure any trailing blank lines are sent.
 	flusher.Flush()
 }
@@ -243,10 +523,34 @@ func StreamAnthropicPassthrough(w http.ResponseWriter, resp *http.Response, _ st
 //
 // The translation emits:
 //  1. message_start  — once at the start
-//  2. content_block_start — once at the start
+//  2. content_block_start — whenever the output switches between reasoning
+//     and text
 //  3. content_block_delta — once per OpenAI chunk that contains text
-//  4. content_block_stop, message_delta, message_stop — once at [DONE]
-func StreamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string) {
+//  4. content_block_stop, message_delta, message_stop — once at [DONE], or
+//     when the body ends cleanly without one, as some providers close the
+//     stream without sending [DONE]
+//
+// inputTokens is an estimate of the prompt size, reported in message_start.
+// When the provider sends a final usage chunk (requested with
+// stream_options.include_usage), its prompt and completion token counts are
+// reported in message_delta.
+//
+// Reasoning models that stream delta.reasoning_content have it mapped to
+// Anthropic thinking blocks (thinking_delta), with ordinary content in text
+// blocks; each new block gets the next index.
+//
+// Tool calls are not streamed as they arrive: OpenAI splits their arguments
+// into fragments that are not valid JSON on their own. Each call's
+// arguments are accumulated instead, and once the stream ends every call is
+// written as a complete tool_use block whose single input_json_delta holds
+// the whole input, repaired if the provider cut it short (see repairJSON).
+// The finish_reason, mapped by openAIStopReason, becomes the stop_reason.
+func StreamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string, inputTokens int) {
+	streamOpenAIToAnthropic(w, resp, requestID, model, inputTokens, streamOptions{})
+}
+
+// streamOpenAIToAnthropic is StreamOpenAIToAnthropic with the stream settings o.
+func streamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string, inputTokens int, o streamOptions) {
 	if checkResponseStatus(w, resp) {
 		return
 	}
@@ -259,10 +563,20 @@ func StreamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, request
 	}
 
 	defer resp.Body.Close()
+	writeSSEConnected(w, flusher)
+
+	start := buildMessageStart(requestID, model)
+	start.Message.Usage.InputTokens = inputTokens
+	writeSSEEvent(w, flusher, "message_start", start)
+	blocks := newBlockWriter(w, flusher, o)
+	usage := Usage{InputTokens: inputTokens}
+	stopReason := "end_turn"
 
-	emitPreamble(w, flusher, requestID, model)
+	// Tool calls in the order they started, with their arguments so far.
+	var toolCalls []*openAIToolCall
+	toolCallsByIndex := make(map[int]*openAIToolCall)
 
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := newStreamScanner(resp.Body, o)
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -283,16 +597,57 @@ func StreamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, request
 			continue
 		}
 
+		if chunk.Usage != nil {
+			usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+
 		for _, choice := range chunk.Choices {
-			if choice.Delta.Content == "" {
-				continue
+			if choice.Delta.ReasoningContent != "" {
+				blocks.thinking(choice.Delta.ReasoningContent)
+			}
+			if choice.Delta.Content != "" {
+				blocks.text(choice.Delta.Content)
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				call, ok := toolCallsByIndex[tc.Index]
+				if !ok {
+					call = &openAIToolCall{}
+					toolCallsByIndex[tc.Index] = call
+					toolCalls = append(toolCalls, call)
+				}
+				if tc.ID != "" {
+					call.id = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.arguments.WriteString(tc.Function.Arguments)
+			}
+			if choice.FinishReason != "" {
+				stopReason = openAIStopReason(choice.FinishReason)
 			}
-			writeSSEEvent(w, flusher, "content_block_delta",
-				buildContentBlockDelta(choice.Delta.Content))
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		blocks.close()
+		streamReadError(w, flusher, err)
+		return
+	}
+
+	for _, call := range toolCalls {
+		blocks.toolUse(bufferedBlock{Type: "tool_use", ID: call.id, Name: call.name,
+			Input: toolInput(call.name, call.arguments.String())})
+	}
+	blocks.close()
+	emitMessageEnd(w, flusher, stopReason, usage)
+}
 
-	emitEpilogue(w, flusher, 0)
+// openAIToolCall is a streamed OpenAI tool call being reassembled from its
+// fragments.
+type openAIToolCall struct {
+	id        string
+	name      string
+	arguments strings.Builder
 }
 
 // StreamOllamaToAnthropic reads Ollama streaming JSON lines from resp.Body and
@@ -300,12 +655,23 @@ func StreamOpenAIToAnthropic(w http.ResponseWriter, resp *http.Response, request
 //
 // Ollama streams newline-delimited JSON objects (not SSE). Each line is
 // unmarshalled and translated. The final line (done == true) carries token
-// counts that are forwarded in the message_delta event.
-func StreamOllamaToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string) {
+// counts and done_reason, which are forwarded in the message_delta event.
+// inputTokens is an estimate of the prompt size, reported in message_start.
+//
+// The SSE preamble, including the ": connected" comment the other
+// translators send straight away, is deferred until the first line is read,
+// so an Ollama error reported on the first line becomes an ordinary
+// Anthropic error response; an error later in the stream is sent as an SSE
+// error event.
+func StreamOllamaToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string, inputTokens int) {
+	streamOllamaToAnthropic(w, resp, requestID, model, inputTokens, streamOptions{})
+}
+
+// streamOllamaToAnthropic is StreamOllamaToAnthropic with the stream settings o.
+func streamOllamaToAnthropic(w http.ResponseWriter, resp *http.Response, requestID string, model string, inputTokens int, o streamOptions) {
 	if checkResponseStatus(w, resp) {
 		return
 	}
-	sseHeaders(w)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -315,11 +681,21 @@ func StreamOllamaToAnthropic(w http.ResponseWriter, resp *http.Response, request
 
 	defer resp.Body.Close()
 
-	emitPreamble(w, flusher, requestID, model)
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			sseHeaders(w)
+			writeSSEConnected(w, flusher)
+			emitPreamble(w, flusher, requestID, model, inputTokens)
+		}
+	}
 
-	outputTokens := 0
+	usage := Usage{InputTokens: inputTokens}
+	stopReason := "end_turn"
+	deltas := newDeltaBatcher(w, flusher, o.flushInterval)
 
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := newStreamScanner(resp.Body, o)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == "" {
@@ -331,17 +707,191 @@ func StreamOllamaToAnthropic(w http.ResponseWriter, resp *http.Response, request
 			continue
 		}
 
+		if chunk.Error != "" {
+			msg := "ollama: " + chunk.Error
+			if !started {
+				sendError(w, "api_error", msg, http.StatusBadGateway)
+			} else {
+				deltas.flush()
+				emitStreamError(w, flusher, "api_error", msg)
+			}
+			return
+		}
+
+		start()
+
 		if chunk.Done {
-			// The done chunk carries the final eval_count (output tokens).
-			outputTokens = chunk.EvalCount
+			// The done chunk carries the final eval_count (output tokens)
+			// and prompt_eval_count (input tokens).
+			usage.OutputTokens = chunk.EvalCount
+			if chunk.PromptEvalCount > 0 {
+				usage.InputTokens = chunk.PromptEvalCount
+			}
+			stopReason = ollamaStopReason(chunk.DoneReason)
 			break
 		}
 
 		if chunk.Message.Content != "" {
-			writeSSEEvent(w, flusher, "content_block_delta",
-				buildContentBlockDelta(chunk.Message.Content))
+			deltas.text(0, chunk.Message.Content)
+		}
+	}
+	deltas.flush()
+	if err := scanner.Err(); err != nil {
+		if !started {
+			log.Printf("Warning: reading provider stream: %v", err)
+			sendError(w, "api_error", "reading provider stream: "+err.Error(), http.StatusBadGateway)
+		} else {
+			streamReadError(w, flusher, err)
 		}
+		return
+	}
+
+	start()
+	emitEpilogue(w, flusher, stopReason, usage)
+}
+
+// --- Non-streaming fallback --------------------------------------------------
+
+// isJSONResponse reports whether a successful provider response is a single
+// application/json document rather than a stream (SSE or Ollama's NDJSON).
+func isJSONResponse(resp *http.Response) bool {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// bufferedBlock is a content block of a complete Anthropic message.
+type bufferedBlock struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text"`
+	Thinking string          `json:"thinking"`
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Input    json.RawMessage `json:"input"`
+}
+
+// bufferedMessage is a complete Anthropic message to replay as SSE.
+type bufferedMessage struct {
+	ID         string          `json:"id"`
+	Content    []bufferedBlock `json:"content"`
+	StopReason string          `json:"stop_reason"`
+	Usage      Usage           `json:"usage"`
+}
+
+// StreamJSONToAnthropic handles a provider that answered a streaming request
+// with a complete, non-streaming JSON response. The body is buffered,
+// decoded in provider's format ("anthropic", "openai_compat", or "ollama"),
+// and replayed to w as an Anthropic SSE sequence carrying each content block
+// in a single delta. A body that cannot be decoded becomes an ordinary error
+// response, since nothing has been streamed yet.
+func StreamJSONToAnthropic(w http.ResponseWriter, resp *http.Response, provider, requestID, model string) {
+	streamJSONToAnthropic(w, resp, provider, requestID, model, streamOptions{})
+}
+
+// streamJSONToAnthropic is StreamJSONToAnthropic with the stream settings o.
+func streamJSONToAnthropic(w http.ResponseWriter, resp *http.Response, provider, requestID, model string, o streamOptions) {
+	if checkResponseStatus(w, resp) {
+		return
+	}
+	defer resp.Body.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sendError(w, "api_error", "Failed to read provider response", http.StatusBadGateway)
+		return
+	}
+
+	msg, err := decodeBufferedMessage(body, provider, requestID, model)
+	if err != nil {
+		sendError(w, "api_error", err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	sseHeaders(w)
+	writeSSEConnected(w, flusher)
+	start := buildMessageStart(msg.ID, model)
+	start.Message.Usage.InputTokens = msg.Usage.InputTokens
+	start.Message.Usage.CacheCreationInputTokens = msg.Usage.CacheCreationInputTokens
+	start.Message.Usage.CacheReadInputTokens = msg.Usage.CacheReadInputTokens
+	writeSSEEvent(w, flusher, "message_start", start)
+
+	blocks := newBlockWriter(w, flusher, o)
+	for _, b := range msg.Content {
+		switch b.Type {
+		case "text":
+			blocks.text(b.Text)
+		case "thinking":
+			blocks.thinking(b.Thinking)
+		case "tool_use":
+			blocks.toolUse(b)
+		}
+	}
+	blocks.close()
+
+	stopReason := msg.StopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	emitMessageEnd(w, flusher, stopReason, msg.Usage)
+}
+
+// decodeBufferedMessage decodes a complete provider response body into the
+// message replayed by StreamJSONToAnthropic. Anthropic messages keep their
+// own ID; translated ones use requestID, as the streaming translators do.
+func decodeBufferedMessage(body []byte, provider, requestID, model string) (bufferedMessage, error) {
+	var msg bufferedMessage
+	switch provider {
+	case "openai_compat", "ollama":
+		var ar AnthropicResponse
+		var err error
+		if provider == "openai_compat" {
+			ar, err = openAIResponseToAnthropic(body, requestID, model)
+		} else {
+			ar, err = ollamaResponseToAnthropic(body, requestID, model)
+		}
+		if err != nil {
+			return msg, err
+		}
+		msg = bufferedMessage{ID: requestID, StopReason: ar.StopReason, Usage: ar.Usage}
+		for _, c := range ar.Content {
+			msg.Content = append(msg.Content, bufferedBlock{Type: c.Type, Text: c.Text, ID: c.ID, Name: c.Name, Input: c.Input})
+		}
+	default:
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return msg, fmt.Errorf("failed to parse provider response: %w", err)
+		}
+		if msg.ID == "" {
+			msg.ID = requestID
+		}
+	}
+	return msg, nil
+}
+
+// writeToolUseBlock writes a complete tool_use block at index: its start,
+// its whole input as one input_json_delta, and its stop.
+func writeToolUseBlock(w http.ResponseWriter, f http.Flusher, index int, b bufferedBlock) {
+	start := toolUseBlockStart{Type: "content_block_start", Index: index}
+	start.ContentBlock.Type = "tool_use"
+	start.ContentBlock.ID = b.ID
+	start.ContentBlock.Name = b.Name
+	writeSSEEvent(w, f, "content_block_start", start)
+
+	input := string(b.Input)
+	if input == "" {
+		input = "{}"
 	}
+	delta := inputJSONDelta{Type: "content_block_delta", Index: index}
+	delta.Delta.Type = "input_json_delta"
+	delta.Delta.PartialJSON = input
+	writeSSEEvent(w, f, "content_block_delta", delta)
 
-	emitEpilogue(w, flusher, outputTokens)
+	writeSSEEvent(w, f, "content_block_stop", buildContentBlockStop(index))
 }
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deltaBatcher coalesces consecutive deltas for the same content block into
+// one content_block_delta event, so that deltas arriving close together cost
+// one event and one flush. The first pending delta starts a timer of the
+// batcher's interval; when it fires, everything received since is written
+// and flushed, so a provider that pauses mid-stream never leaves text held
+// back for longer than that.
+//
+// The timer writes from its own goroutine, so callers must call flush before
+// writing any other event to w; the batcher holds nothing once flush returns.
+type deltaBatcher struct {
+	w        http.ResponseWriter
+	f        http.Flusher
+	interval time.Duration
+
+	mu        sync.Mutex
+	index     int
+	blockType string
+	pending   strings.Builder
+	timer     *time.Timer
+}
+
+// newDeltaBatcher returns a batcher holding deltas for interval; zero sends
+// every delta as it arrives.
+func newDeltaBatcher(w http.ResponseWriter, f http.Flusher, interval time.Duration) *deltaBatcher {
+	return &deltaBatcher{w: w, f: f, interval: interval}
+}
+
+// text queues a text delta for the block at index.
+func (b *deltaBatcher) text(index int, s string) { b.add(index, "text", s) }
+
+// thinking queues a thinking delta for the block at index.
+func (b *deltaBatcher) thinking(index int, s string) { b.add(index, "thinking", s) }
+
+func (b *deltaBatcher) add(index int, blockType, s string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Deltas for a different block must not be merged with the pending ones.
+	if b.pending.Len() > 0 && (index != b.index || blockType != b.blockType) {
+		b.flushLocked()
+	}
+	b.index, b.blockType = index, blockType
+	b.pending.WriteString(s)
+
+	if b.interval <= 0 {
+		b.flushLocked()
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flush)
+	}
+}
+
+// flush writes any pending delta and stops the timer.
+func (b *deltaBatcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *deltaBatcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.pending.Len() == 0 {
+		return
+	}
+	if b.blockType == "thinking" {
+		writeSSEEvent(b.w, b.f, "content_block_delta", buildThinkingBlockDelta(b.index, b.pending.String()))
+	} else {
+		writeSSEEvent(b.w, b.f, "content_block_delta", buildContentBlockDelta(b.index, b.pending.String()))
+	}
+	b.pending.Reset()
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushCounter is a ResponseWriter that counts flushes and can be read while
+// a batcher's timer is still writing to it.
+type flushCounter struct {
+	mu      sync.Mutex
+	rec     *httptest.ResponseRecorder
+	flushes int
+}
+
+func newFlushCounter() *flushCounter {
+	return &flushCounter{rec: httptest.NewRecorder()}
+}
+
+func (f *flushCounter) Header() http.Header { return f.rec.Header() }
+
+func (f *flushCounter) WriteHeader(code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rec.WriteHeader(code)
+}
+
+func (f *flushCounter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rec.Write(p)
+}
+
+func (f *flushCounter) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes++
+}
+
+func (f *flushCounter) String() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rec.Body.String()
+}
+
+// rapidOpenAIStream returns an OpenAI stream of n one-word deltas and the
+// text they add up to.
+func rapidOpenAIStream(n int) (string, string) {
+	var stream, text strings.Builder
+	for i := range n {
+		word := fmt.Sprintf("w%d ", i)
+		text.WriteString(word)
+		fmt.Fprintf(&stream, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+	}
+	stream.WriteString("data: [DONE]\n\n")
+	return stream.String(), text.String()
+}
+
+func TestStreamOpenAIToAnthropic_FlushBatching(t *testing.T) {
+	stream, want := rapidOpenAIStream(200)
+
+	translate := func(interval time.Duration) (string, int) {
+		w := newFlushCounter()
+		streamOpenAIToAnthropic(w, &http.Response{StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader(stream))}, "req-1", "gpt-test", 0, streamOptions{flushInterval: interval})
+		return w.String(), w.flushes
+	}
+
+	unbatchedBody, unbatched := translate(0)
+	batchedBody, batched := translate(time.Second)
+
+	for name, body := range map[string]string{"unbatched": unbatchedBody, "batched": batchedBody} {
+		events := parseSSEEvents(t, body)
+		if got := deltaText(events); got != want {
+			t.Errorf("%s: delivered text %q, want %q", name, got, want)
+		}
+		if last := events[len(events)-1].Event; last != "message_stop" {
+			t.Errorf("%s: last event = %q, want message_stop", name, last)
+		}
+	}
+	if batched >= unbatched/10 {
+		t.Errorf("batched stream flushed %d times, want far fewer than the %d unbatched flushes", batched, unbatched)
+	}
+}
+
+// TestStreamOpenAIToAnthropic_FlushBatchingTimer verifies that a pending delta
+// is sent once the interval passes, even while the provider sends nothing.
+func TestStreamOpenAIToAnthropic_FlushBatchingTimer(t *testing.T) {
+	pr, pw := io.Pipe()
+	w := newFlushCounter()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		streamOpenAIToAnthropic(w, &http.Response{StatusCode: http.StatusOK, Body: pr}, "req-1", "gpt-test", 0,
+			streamOptions{flushInterval: 10 * time.Millisecond})
+	}()
+
+	io.WriteString(pw, "data: {\"choices\":[{\"delta\":{\"content\":\"first\"}}]}\n\n") //nolint:errcheck
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(w.String(), `"text":"first"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("pending delta was not flushed while the provider paused:\n%s", w.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	io.WriteString(pw, "data: {\"choices\":[{\"delta\":{\"content\":\" second\"}}]}\n\ndata: [DONE]\n\n") //nolint:errcheck
+	pw.Close()
+	<-done
+
+	if got := deltaText(parseSSEEvents(t, w.String())); got != "first second" {
+		t.Errorf("delivered text %q, want %q", got, "first second")
+	}
+}
@@ -1,9 +1,14 @@
 package proxy
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -24,7 +29,7 @@ data: [DONE]
 	}
 
 	w := httptest.NewRecorder()
-	StreamOpenAIToAnthropic(w, resp, "test-id", "test-model")
+	StreamOpenAIToAnthropic(w, resp, "test-id", "test-model", 0)
 
 	body := w.Body.String()
 
@@ -69,7 +74,7 @@ data: [DONE]
 	}
 
 	w := httptest.NewRecorder()
-	StreamOpenAIToAnthropic(w, resp, "test-id-2", "gpt-4o")
+	StreamOpenAIToAnthropic(w, resp, "test-id-2", "gpt-4o", 0)
 
 	body := w.Body.String()
 
@@ -94,7 +99,7 @@ func TestStreamOpenAIToAnthropic_ContentType(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	StreamOpenAIToAnthropic(w, resp, "hdr-test", "gpt-4o")
+	StreamOpenAIToAnthropic(w, resp, "hdr-test", "gpt-4o", 0)
 
 	ct := w.Header().Get("Content-Type")
 	if ct != "text/event-stream" {
@@ -102,6 +107,177 @@ func TestStreamOpenAIToAnthropic_ContentType(t *testing.T) {
 	}
 }
 
+// sseEvent is one parsed SSE frame from a translated stream.
+type sseEvent struct {
+	Event string
+	Data  map[string]interface{}
+}
+
+// parseSSEEvents splits an SSE body into event name / decoded data pairs.
+func parseSSEEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, frame := range strings.Split(body, "\n\n") {
+		var ev sseEvent
+		for _, line := range strings.Split(frame, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.Data); err != nil {
+					t.Fatalf("invalid event data %q: %v", line, err)
+				}
+			}
+		}
+		if ev.Event != "" {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// TestStreamOpenAIToAnthropic_ReasoningContent verifies that reasoning_content
+// deltas are emitted as a thinking block ahead of the text block, each with
+// its own index.
+func TestStreamOpenAIToAnthropic_ReasoningContent(t *testing.T) {
+	sseData := `data: {"choices":[{"delta":{"reasoning_content":"Let me think"},"index":0}]}
+
+data: {"choices":[{"delta":{"reasoning_content":" carefully."},"index":0}]}
+
+data: {"choices":[{"delta":{"content":"The answer"},"index":0}]}
+
+data: {"choices":[{"delta":{"content":" is 42."},"index":0}]}
+
+data: [DONE]
+
+`
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+	}
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "reason-id", "reasoner", 0)
+
+	events := parseSSEEvents(t, w.Body.String())
+
+	type want struct {
+		event string
+		index float64
+		check func(map[string]interface{}) bool
+	}
+	blockType := func(typ string) func(map[string]interface{}) bool {
+		return func(d map[string]interface{}) bool {
+			cb, _ := d["content_block"].(map[string]interface{})
+			return cb["type"] == typ
+		}
+	}
+	delta := func(typ, field, text string) func(map[string]interface{}) bool {
+		return func(d map[string]interface{}) bool {
+			dl, _ := d["delta"].(map[string]interface{})
+			return dl["type"] == typ && dl[field] == text
+		}
+	}
+	expected := []want{
+		{"message_start", -1, nil},
+		{"content_block_start", 0, blockType("thinking")},
+		{"content_block_delta", 0, delta("thinking_delta", "thinking", "Let me think")},
+		{"content_block_delta", 0, delta("thinking_delta", "thinking", " carefully.")},
+		{"content_block_stop", 0, nil},
+		{"content_block_start", 1, blockType("text")},
+		{"content_block_delta", 1, delta("text_delta", "text", "The answer")},
+		{"content_block_delta", 1, delta("text_delta", "text", " is 42.")},
+		{"content_block_stop", 1, nil},
+		{"message_delta", -1, nil},
+		{"message_stop", -1, nil},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events, want %d:\n%s", len(events), len(expected), w.Body.String())
+	}
+	for i, exp := range expected {
+		ev := events[i]
+		if ev.Event != exp.event {
+			t.Errorf("event %d: got %q, want %q", i, ev.Event, exp.event)
+			continue
+		}
+		if exp.index >= 0 && ev.Data["index"] != exp.index {
+			t.Errorf("event %d (%s): got index %v, want %v", i, ev.Event, ev.Data["index"], exp.index)
+		}
+		if exp.check != nil && !exp.check(ev.Data) {
+			t.Errorf("event %d (%s): unexpected payload %v", i, ev.Event, ev.Data)
+		}
+	}
+}
+
+// eventUsage returns the usage object of the first event named name.
+func eventUsage(t *testing.T, events []sseEvent, name string) map[string]interface{} {
+	t.Helper()
+	for _, ev := range events {
+		if ev.Event != name {
+			continue
+		}
+		if name == "message_start" {
+			msg, _ := ev.Data["message"].(map[string]interface{})
+			usage, _ := msg["usage"].(map[string]interface{})
+			return usage
+		}
+		usage, _ := ev.Data["usage"].(map[string]interface{})
+		return usage
+	}
+	t.Fatalf("no %s event", name)
+	return nil
+}
+
+// TestStreamOpenAIToAnthropic_Usage verifies that the estimated input tokens
+// are reported in message_start and that a final usage chunk is forwarded in
+// message_delta.
+func TestStreamOpenAIToAnthropic_Usage(t *testing.T) {
+	sseData := `data: {"choices":[{"delta":{"content":"Hi"},"index":0}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"stop","index":0}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":21,"completion_tokens":5,"total_tokens":26}}
+
+data: [DONE]
+
+`
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+	}
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "usage-id", "test-model", 18)
+	events := parseSSEEvents(t, w.Body.String())
+
+	if got := eventUsage(t, events, "message_start")["input_tokens"]; got != float64(18) {
+		t.Errorf("message_start input_tokens = %v, want 18", got)
+	}
+	usage := eventUsage(t, events, "message_delta")
+	if usage["input_tokens"] != float64(21) || usage["output_tokens"] != float64(5) {
+		t.Errorf("message_delta usage = %v, want input 21, output 5", usage)
+	}
+}
+
+// TestStreamOpenAIToAnthropic_UsageEstimated verifies that without a usage
+// chunk the estimated input tokens are still reported in message_delta.
+func TestStreamOpenAIToAnthropic_UsageEstimated(t *testing.T) {
+	sseData := "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"index\":0}]}\n\ndata: [DONE]\n\n"
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+	}
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "usage-id", "test-model", 18)
+
+	usage := eventUsage(t, parseSSEEvents(t, w.Body.String()), "message_delta")
+	if usage["input_tokens"] != float64(18) || usage["output_tokens"] != float64(0) {
+		t.Errorf("message_delta usage = %v, want input 18, output 0", usage)
+	}
+}
+
 // TestStreamOllamaToAnthropic verifies that Ollama JSON-line chunks are
 // correctly translated into Anthropic SSE event sequences.
 func TestStreamOllamaToAnthropic(t *testing.T) {
@@ -115,7 +291,7 @@ func TestStreamOllamaToAnthropic(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	StreamOllamaToAnthropic(w, resp, "ollama-req-id", "llama3.2")
+	StreamOllamaToAnthropic(w, resp, "ollama-req-id", "llama3.2", 0)
 
 	body := w.Body.String()
 
@@ -145,6 +321,109 @@ func TestStreamOllamaToAnthropic(t *testing.T) {
 	}
 }
 
+// ollamaStreamResponse wraps newline-delimited Ollama JSON in a 200 response.
+func ollamaStreamResponse(lines string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(lines)),
+	}
+}
+
+// TestStreamOllamaToAnthropic_DoneReason verifies that done_reason is mapped
+// to the Anthropic stop_reason in message_delta.
+func TestStreamOllamaToAnthropic_DoneReason(t *testing.T) {
+	tests := []struct {
+		doneReason string
+		want       string
+	}{
+		{"stop", "end_turn"},
+		{"length", "max_tokens"},
+		{"", "end_turn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doneReason, func(t *testing.T) {
+			lines := `{"message":{"role":"assistant","content":"Hi"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"` + tt.doneReason + `","eval_count":7}
+`
+			w := httptest.NewRecorder()
+			StreamOllamaToAnthropic(w, ollamaStreamResponse(lines), "req", "llama3.2", 0)
+
+			var stopReason any
+			for _, ev := range parseSSEEvents(t, w.Body.String()) {
+				if ev.Event == "message_delta" {
+					stopReason = ev.Data["delta"].(map[string]any)["stop_reason"]
+				}
+			}
+			if stopReason != tt.want {
+				t.Errorf("stop_reason = %v, want %q", stopReason, tt.want)
+			}
+		})
+	}
+}
+
+// TestStreamOllamaToAnthropic_Usage verifies that the done chunk's token
+// counts replace the input estimate in message_delta.
+func TestStreamOllamaToAnthropic_Usage(t *testing.T) {
+	lines := `{"message":{"role":"assistant","content":"Hi"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":30,"eval_count":7}
+`
+	w := httptest.NewRecorder()
+	StreamOllamaToAnthropic(w, ollamaStreamResponse(lines), "req", "llama3.2", 25)
+	events := parseSSEEvents(t, w.Body.String())
+
+	if got := eventUsage(t, events, "message_start")["input_tokens"]; got != float64(25) {
+		t.Errorf("message_start input_tokens = %v, want 25", got)
+	}
+	usage := eventUsage(t, events, "message_delta")
+	if usage["input_tokens"] != float64(30) || usage["output_tokens"] != float64(7) {
+		t.Errorf("message_delta usage = %v, want input 30, output 7", usage)
+	}
+}
+
+// TestStreamOllamaToAnthropic_ErrorBeforeOutput verifies that an Ollama error
+// line (sent with status 200) becomes an Anthropic error response rather
+// than an empty stream.
+func TestStreamOllamaToAnthropic_ErrorBeforeOutput(t *testing.T) {
+	w := httptest.NewRecorder()
+	StreamOllamaToAnthropic(w, ollamaStreamResponse(`{"error":"model 'nope' not found"}`+"\n"), "req", "nope", 0)
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("got status %d, want 502", w.Code)
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("invalid JSON error response: %v\n%s", err, w.Body.String())
+	}
+	if errResp.Type != "error" || !strings.Contains(errResp.Error.Message, "model 'nope' not found") {
+		t.Errorf("got %+v, want an Anthropic error carrying the Ollama message", errResp)
+	}
+}
+
+// TestStreamOllamaToAnthropic_ErrorMidStream verifies that an error after
+// output has started is sent as an SSE error event with no message_stop.
+func TestStreamOllamaToAnthropic_ErrorMidStream(t *testing.T) {
+	lines := `{"message":{"role":"assistant","content":"Hel"},"done":false}
+{"error":"out of memory"}
+`
+	w := httptest.NewRecorder()
+	StreamOllamaToAnthropic(w, ollamaStreamResponse(lines), "req", "llama3.2", 0)
+
+	events := parseSSEEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	if last.Event != "error" {
+		t.Fatalf("last event = %q, want error", last.Event)
+	}
+	if msg := last.Data["error"].(map[string]any)["message"]; msg != "ollama: out of memory" {
+		t.Errorf("error message = %v", msg)
+	}
+	for _, ev := range events {
+		if ev.Event == "message_stop" {
+			t.Error("message_stop emitted after a stream error")
+		}
+	}
+}
+
 // TestStreamOllamaToAnthropic_ContentType verifies the SSE content-type header.
 func TestStreamOllamaToAnthropic_ContentType(t *testing.T) {
 	ollamaData := `{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true}
@@ -155,7 +434,7 @@ func TestStreamOllamaToAnthropic_ContentType(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	StreamOllamaToAnthropic(w, resp, "hdr-ollama", "llama3.2")
+	StreamOllamaToAnthropic(w, resp, "hdr-ollama", "llama3.2", 0)
 
 	ct := w.Header().Get("Content-Type")
 	if ct != "text/event-stream" {
@@ -259,7 +538,7 @@ func TestStreamOpenAIToAnthropic_ErrorStatus(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	StreamOpenAIToAnthropic(w, resp, "err-oai", "gpt-4o")
+	StreamOpenAIToAnthropic(w, resp, "err-oai", "gpt-4o", 0)
 
 	if w.Code != http.StatusUnauthorized {
 		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
@@ -279,7 +558,7 @@ func TestStreamOllamaToAnthropic_ErrorStatus(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	StreamOllamaToAnthropic(w, resp, "err-ollama", "llama3.2")
+	StreamOllamaToAnthropic(w, resp, "err-ollama", "llama3.2", 0)
 
 	if w.Code != http.StatusServiceUnavailable {
 		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
@@ -289,3 +568,398 @@ func TestStreamOllamaToAnthropic_ErrorStatus(t *testing.T) {
 		t.Errorf("error body should describe upstream status, got: %s", body)
 	}
 }
+
+// gzipResponse returns a 200 response whose body is data gzip-compressed,
+// with Content-Encoding: gzip set as a gateway would send it.
+func gzipResponse(t *testing.T, data string) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(&buf),
+	}
+}
+
+// TestStreamOpenAIToAnthropic_Gzip verifies that a gzip-encoded SSE stream
+// is decompressed before translation.
+func TestStreamOpenAIToAnthropic_Gzip(t *testing.T) {
+	resp := gzipResponse(t, `data: {"id":"chatcmpl-gz","choices":[{"delta":{"content":"Hello"},"index":0}]}
+
+data: {"id":"chatcmpl-gz","choices":[{"delta":{"content":" gzip"},"index":0}]}
+
+data: [DONE]
+
+`)
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "gz-id", "gpt-4o", 0)
+
+	body := w.Body.String()
+	for _, want := range []string{"event: message_start", `"text":"Hello"`, `"text":" gzip"`, "event: message_stop"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in body:\n%s", want, body)
+		}
+	}
+}
+
+// TestStreamOpenAIToAnthropic_InvalidGzip verifies that a body claiming gzip
+// encoding that is not gzip becomes a 502 error rather than an empty stream.
+func TestStreamOpenAIToAnthropic_InvalidGzip(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(strings.NewReader("data: [DONE]\n\n")),
+	}
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "gz-bad", "gpt-4o", 0)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+}
+
+// assertSSEEvents checks that body contains exactly the given SSE event
+// names, in order.
+func assertSSEEvents(t *testing.T, body string, want ...string) {
+	t.Helper()
+	var got []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			got = append(got, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v\nbody:\n%s", got, want, body)
+	}
+}
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestIsJSONResponse(t *testing.T) {
+	tests := []struct {
+		contentType string
+		status      int
+		want        bool
+	}{
+		{"application/json", http.StatusOK, true},
+		{"application/json; charset=utf-8", http.StatusOK, true},
+		{"text/event-stream", http.StatusOK, false},
+		{"application/x-ndjson", http.StatusOK, false},
+		{"", http.StatusOK, false},
+		{"application/json", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{"Content-Type": {tt.contentType}}}
+		if got := isJSONResponse(resp); got != tt.want {
+			t.Errorf("isJSONResponse(%q, %d) = %v, want %v", tt.contentType, tt.status, got, tt.want)
+		}
+	}
+}
+
+// TestStreamJSONToAnthropic_Anthropic verifies that a complete Anthropic
+// message is replayed block by block, including thinking and tool_use.
+func TestStreamJSONToAnthropic_Anthropic(t *testing.T) {
+	resp := jsonResponse(`{"id":"msg_upstream","type":"message","role":"assistant","content":[` +
+		`{"type":"thinking","thinking":"let me check"},` +
+		`{"type":"text","text":"Checking the weather."},` +
+		`{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],` +
+		`"stop_reason":"tool_use","usage":{"input_tokens":12,"output_tokens":7,` +
+		`"cache_creation_input_tokens":300,"cache_read_input_tokens":1200}}`)
+
+	w := httptest.NewRecorder()
+	StreamJSONToAnthropic(w, resp, "anthropic", "req-1", "claude-sonnet")
+
+	body := w.Body.String()
+	assertSSEEvents(t, body, "message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop")
+	for _, want := range []string{
+		`"id":"msg_upstream"`, `"input_tokens":12`,
+		`"cache_creation_input_tokens":300`, `"cache_read_input_tokens":1200`,
+		`"thinking":"let me check"`, `"text":"Checking the weather."`,
+		`"type":"tool_use","id":"toolu_1","name":"get_weather"`,
+		`"partial_json":"{\"city\":\"Paris\"}"`,
+		`"stop_reason":"tool_use"`, `"output_tokens":7`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in body:\n%s", want, body)
+		}
+	}
+	if !strings.Contains(body, `"index":2`) {
+		t.Errorf("tool_use block should be at index 2:\n%s", body)
+	}
+}
+
+func TestStreamJSONToAnthropic_Ollama(t *testing.T) {
+	resp := jsonResponse(`{"message":{"content":"local answer"},"done":true,"done_reason":"length","prompt_eval_count":4,"eval_count":9}`)
+
+	w := httptest.NewRecorder()
+	StreamJSONToAnthropic(w, resp, "ollama", "req-2", "llama3.2")
+
+	body := w.Body.String()
+	assertSSEEvents(t, body, "message_start", "content_block_start",
+		"content_block_delta", "content_block_stop", "message_delta", "message_stop")
+	for _, want := range []string{`"text":"local answer"`, `"stop_reason":"max_tokens"`, `"output_tokens":9`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in body:\n%s", want, body)
+		}
+	}
+}
+
+// TestStreamJSONToAnthropic_Unparseable verifies that a JSON body that cannot
+// be decoded becomes an error response rather than a broken stream.
+func TestStreamJSONToAnthropic_Unparseable(t *testing.T) {
+	w := httptest.NewRecorder()
+	StreamJSONToAnthropic(w, jsonResponse(`{"unexpected":true}`), "openai_compat", "req-3", "gpt-4o")
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "event:") {
+		t.Errorf("expected no SSE events, got:\n%s", w.Body.String())
+	}
+}
+
+// TestStreamOpenAIToAnthropic_NoDone verifies that a stream closed without
+// data: [DONE] still ends with a complete Anthropic event sequence.
+func TestStreamOpenAIToAnthropic_NoDone(t *testing.T) {
+	sseData := `data: {"choices":[{"delta":{"content":"Hello"},"index":0}]}
+
+data: {"choices":[{"delta":{"content":" world"},"index":0,"finish_reason":"stop"}]}
+`
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+	}
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, resp, "no-done", "gpt-test", 0)
+
+	assertSSEEvents(t, w.Body.String(), "message_start", "content_block_start",
+		"content_block_delta", "content_block_delta", "content_block_stop", "message_delta", "message_stop")
+	if got := deltaText(parseSSEEvents(t, w.Body.String())); got != "Hello world" {
+		t.Errorf("text = %q, want %q", got, "Hello world")
+	}
+}
+
+// deltaText concatenates the text of every content_block_delta event.
+func deltaText(events []sseEvent) string {
+	var b strings.Builder
+	for _, ev := range events {
+		if ev.Event != "content_block_delta" {
+			continue
+		}
+		delta, _ := ev.Data["delta"].(map[string]interface{})
+		text, _ := delta["text"].(string)
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// TestStreamTranslators_ConnectedComment verifies that every translator
+// opens the stream with a ": connected" comment ahead of the first event.
+func TestStreamTranslators_ConnectedComment(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream func(w http.ResponseWriter)
+	}{
+		{"openai", func(w http.ResponseWriter) {
+			StreamOpenAIToAnthropic(w, &http.Response{StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))},
+				"req-1", "gpt-test", 0)
+		}},
+		{"ollama", func(w http.ResponseWriter) {
+			StreamOllamaToAnthropic(w, ollamaStreamResponse(`{"message":{"content":"hi"},"done":true}`+"\n"), "req-1", "llama3", 0)
+		}},
+		{"anthropic", func(w http.ResponseWriter) {
+			StreamAnthropicPassthrough(w, &http.Response{StatusCode: http.StatusOK,
+				Body: io.NopCloser(strings.NewReader("event: message_start\ndata: {\"type\":\"message_start\"}\n\n"))}, "req-1")
+		}},
+		{"json", func(w http.ResponseWriter) {
+			StreamJSONToAnthropic(w, jsonResponse(`{"choices":[{"message":{"content":"hi"}}]}`), "openai_compat", "req-1", "gpt-test")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.stream(w)
+
+			body := w.Body.String()
+			if !strings.HasPrefix(body, ": connected\n\nevent: message_start\n") {
+				t.Errorf("stream should open with the comment, then message_start:\n%s", body)
+			}
+		})
+	}
+}
+
+// TestStreamTranslators_LongLine verifies that a single stream line longer
+// than bufio.Scanner's default 64KB limit is forwarded in full rather than
+// silently truncating the stream.
+func TestStreamTranslators_LongLine(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+
+	t.Run("openai", func(t *testing.T) {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader(
+				`data: {"choices":[{"delta":{"content":"` + long + `"}}]}` + "\n\ndata: [DONE]\n\n")),
+		}
+		w := httptest.NewRecorder()
+		StreamOpenAIToAnthropic(w, resp, "long-id", "gpt-test", 0)
+
+		events := parseSSEEvents(t, w.Body.String())
+		if got := deltaText(events); got != long {
+			t.Errorf("translated %d bytes of text, want %d", len(got), len(long))
+		}
+		if last := events[len(events)-1].Event; last != "message_stop" {
+			t.Errorf("last event = %q, want message_stop", last)
+		}
+	})
+
+	t.Run("ollama", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		StreamOllamaToAnthropic(w, ollamaStreamResponse(
+			`{"message":{"content":"`+long+`"},"done":false}`+"\n"+`{"done":true,"eval_count":1}`+"\n"),
+			"long-id", "llama3", 0)
+
+		events := parseSSEEvents(t, w.Body.String())
+		if got := deltaText(events); got != long {
+			t.Errorf("translated %d bytes of text, want %d", len(got), len(long))
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		line := `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + long + `"}}`
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("event: content_block_delta\n" + line + "\n\n")),
+		}
+		w := httptest.NewRecorder()
+		StreamAnthropicPassthrough(w, resp, "long-id")
+
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("long data line was not passed through intact (got %d bytes)", w.Body.Len())
+		}
+	})
+}
+
+// TestStreamOpenAIToAnthropic_LineTooLong verifies that a line over the
+// configured limit ends the stream with an error event instead of a normal
+// message_stop.
+func TestStreamOpenAIToAnthropic_LineTooLong(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(
+			`data: {"choices":[{"delta":{"content":"` + strings.Repeat("x", 2048) + `"}}]}` + "\n\ndata: [DONE]\n\n")),
+	}
+	w := httptest.NewRecorder()
+	streamOpenAIToAnthropic(w, resp, "long-id", "gpt-test", 0, streamOptions{maxLineBytes: 1024})
+
+	events := parseSSEEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	if last.Event != "error" {
+		t.Fatalf("last event = %q, want error", last.Event)
+	}
+	errBody, _ := last.Data["error"].(map[string]interface{})
+	if msg, _ := errBody["message"].(string); !strings.Contains(msg, "reading provider stream") {
+		t.Errorf("error message = %q, want it to mention reading the provider stream", msg)
+	}
+}
+
+// TestStreamOpenAIToAnthropic_ToolCallFragments feeds tool call arguments
+// split at awkward points, none valid JSON on its own, and verifies each
+// call arrives as one tool_use block whose input is the complete arguments.
+func TestStreamOpenAIToAnthropic_ToolCallFragments(t *testing.T) {
+	weather := `{"city":"Paris, \"FR\"","days":[1,2,3],"units":{"temp":"c"}}`
+	search := `{"query":"café {brackets]"}`
+
+	var stream strings.Builder
+	stream.WriteString("data: {\"choices\":[{\"delta\":{\"content\":\"Checking.\"}}]}\n\n")
+
+	// The first fragment of each call carries its ID and name.
+	fragment := func(index int, id, name, args string) {
+		call := map[string]any{"index": index, "function": map[string]any{"arguments": args}}
+		if id != "" {
+			call["id"] = id
+			call["function"].(map[string]any)["name"] = name
+		}
+		data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"tool_calls": []any{call}}}}})
+		fmt.Fprintf(&stream, "data: %s\n\n", data)
+	}
+	fragment(0, "call_1", "get_weather", weather[:9])
+	fragment(0, "", "", weather[9:24])
+	fragment(1, "call_2", "search", search[:12])
+	fragment(0, "", "", weather[24:])
+	fragment(1, "", "", search[12:])
+	stream.WriteString("data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\ndata: [DONE]\n\n")
+
+	w := httptest.NewRecorder()
+	StreamOpenAIToAnthropic(w, &http.Response{StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(stream.String()))}, "tool-id", "gpt-test", 0)
+	events := parseSSEEvents(t, w.Body.String())
+
+	type toolBlock struct{ id, name, input string }
+	var tools []toolBlock
+	var stopReason any
+	for _, ev := range events {
+		switch ev.Event {
+		case "content_block_start":
+			if cb, _ := ev.Data["content_block"].(map[string]any); cb["type"] == "tool_use" {
+				tools = append(tools, toolBlock{id: cb["id"].(string), name: cb["name"].(string)})
+			}
+		case "content_block_delta":
+			if delta, _ := ev.Data["delta"].(map[string]any); delta["type"] == "input_json_delta" {
+				partial := delta["partial_json"].(string)
+				if !json.Valid([]byte(partial)) {
+					t.Errorf("input_json_delta is not valid JSON on its own: %s", partial)
+				}
+				tools[len(tools)-1].input += partial
+			}
+		case "message_delta":
+			delta, _ := ev.Data["delta"].(map[string]any)
+			stopReason = delta["stop_reason"]
+		}
+	}
+
+	want := []toolBlock{{"call_1", "get_weather", weather}, {"call_2", "search", search}}
+	if len(tools) != len(want) {
+		t.Fatalf("got %d tool_use blocks, want %d:\n%s", len(tools), len(want), w.Body.String())
+	}
+	for i, tool := range tools {
+		if tool.id != want[i].id || tool.name != want[i].name {
+			t.Errorf("tool %d = %s %s, want %s %s", i, tool.id, tool.name, want[i].id, want[i].name)
+		}
+		var got, orig any
+		if err := json.Unmarshal([]byte(tool.input), &got); err != nil {
+			t.Errorf("tool %d input %q is not valid JSON: %v", i, tool.input, err)
+			continue
+		}
+		json.Unmarshal([]byte(want[i].input), &orig) //nolint:errcheck
+		if !reflect.DeepEqual(got, orig) {
+			t.Errorf("tool %d input = %s, want %s", i, tool.input, want[i].input)
+		}
+	}
+	if got := deltaText(events); got != "Checking." {
+		t.Errorf("text = %q, want %q", got, "Checking.")
+	}
+	if stopReason != "tool_use" {
+		t.Errorf("stop_reason = %v, want tool_use", stopReason)
+	}
+}
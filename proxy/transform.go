@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// requestTransform rewrites a request's system prompt and messages before it
+// is classified and sent to a provider. Transforms are pure: they return a
+// new request and never modify the one they are given, including its
+// Messages slice.
+type requestTransform func(req AnthropicRequest) AnthropicRequest
+
+// newTransforms builds the transforms named in proxy.transforms, in order.
+// An unknown name is an error.
+func newTransforms(cfg *config.Config) ([]requestTransform, error) {
+	var transforms []requestTransform
+	for _, name := range cfg.Proxy.Transforms {
+		switch name {
+		case "strip_system_reminders":
+			transforms = append(transforms, stripSystemRemindersTransform)
+		case "redact_emails":
+			transforms = append(transforms, redactEmailsTransform)
+		case "truncate_to_context":
+			transforms = append(transforms, truncateToContext(largestContext(cfg)))
+		default:
+			return nil, fmt.Errorf("unknown transform %q (want strip_system_reminders, redact_emails, or truncate_to_context)", name)
+		}
+	}
+	return transforms, nil
+}
+
+// composeTransforms returns a transform applying each of transforms in turn,
+// each to the previous one's result.
+func composeTransforms(transforms ...requestTransform) requestTransform {
+	return func(req AnthropicRequest) AnthropicRequest {
+		for _, t := range transforms {
+			req = t(req)
+		}
+		return req
+	}
+}
+
+// applyTransforms runs transforms over req and returns the result, along
+// with body with its system and messages replaced to match, so that
+// Anthropic passthrough sends the transformed request too. If the body
+// cannot be rewritten, the error is returned rather than sending a body that
+// disagrees with the transformed request.
+func applyTransforms(transforms []requestTransform, req AnthropicRequest, body []byte) (AnthropicRequest, []byte, error) {
+	if len(transforms) == 0 {
+		return req, body, nil
+	}
+	out := composeTransforms(transforms...)(req)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return req, body, fmt.Errorf("decoding request body: %w", err)
+	}
+	if len(out.System) > 0 {
+		raw["system"] = out.System
+	} else {
+		delete(raw, "system")
+	}
+	messages, err := json.Marshal(out.Messages)
+	if err != nil {
+		return req, body, fmt.Errorf("encoding transformed messages: %w", err)
+	}
+	raw["messages"] = messages
+	patched, err := json.Marshal(raw)
+	if err != nil {
+		return req, body, fmt.Errorf("encoding transformed request: %w", err)
+	}
+	return out, patched, nil
+}
+
+// stripSystemRemindersTransform removes the <system-reminder> blocks Claude
+// Code hooks and plugins add to the system prompt and messages. A text block
+// left empty is dropped, unless that would leave its message with no
+// content, in which case the message is kept as it was.
+func stripSystemRemindersTransform(req AnthropicRequest) AnthropicRequest {
+	strip := func(s string) string {
+		if !systemReminderRe.MatchString(s) {
+			return s
+		}
+		return strings.TrimSpace(systemReminderRe.ReplaceAllString(s, ""))
+	}
+	return mapRequestText(req, strip)
+}
+
+// emailRe matches email addresses.
+var emailRe = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// redactedEmail replaces each email address redact_emails finds.
+const redactedEmail = "[redacted email]"
+
+// redactEmailsTransform replaces email addresses in the system prompt,
+// message text, and tool results with redactedEmail.
+func redactEmailsTransform(req AnthropicRequest) AnthropicRequest {
+	return mapRequestText(req, func(s string) string {
+		return emailRe.ReplaceAllString(s, redactedEmail)
+	})
+}
+
+// truncateToContext returns a transform that drops the oldest messages
+// until the request's estimated input tokens plus its max_tokens fit in
+// contextTokens. It only cuts where the remaining conversation starts with a
+// user message that is not a tool result, so tool_use and tool_result
+// exchanges are dropped whole and the request stays valid. When nothing
+// short enough starts there, it keeps the shortest such suffix; when no
+// message after the first can start a conversation, the request is left
+// untouched. Zero contextTokens disables the transform.
+func truncateToContext(contextTokens int) requestTransform {
+	return func(req AnthropicRequest) AnthropicRequest {
+		if contextTokens <= 0 {
+			return req
+		}
+		fits := func(messages []Message) bool {
+			r := AnthropicRequest{System: req.System, Messages: messages, MaxTokens: req.MaxTokens}
+			return estimateInputTokens(r)+r.MaxTokens <= contextTokens
+		}
+		if fits(req.Messages) {
+			return req
+		}
+		cut := -1
+		for i := 1; i < len(req.Messages); i++ {
+			if !startsConversation(req.Messages[i]) {
+				continue
+			}
+			cut = i
+			if fits(req.Messages[i:]) {
+				break
+			}
+		}
+		if cut < 0 {
+			return req
+		}
+		req.Messages = req.Messages[cut:]
+		return req
+	}
+}
+
+// startsConversation reports whether msg can open a conversation: a user
+// message that does not answer an earlier tool call.
+func startsConversation(msg Message) bool {
+	if msg.Role != "user" {
+		return false
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(msg.Content, &blocks) == nil {
+		for _, b := range blocks {
+			if b.Type == "tool_result" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// largestContext returns the largest max_context of the enabled models, the
+// most any routed request could use. Transforms run before routing, so
+// truncate_to_context is bounded by this rather than by the selected
+// model's max_context.
+func largestContext(cfg *config.Config) int {
+	largest := 0
+	for _, m := range cfg.Models {
+		if !m.Disabled && m.MaxContext > largest {
+			largest = m.MaxContext
+		}
+	}
+	return largest
+}
+
+// mapRequestText returns req with f applied to the text of its system
+// prompt and messages.
+func mapRequestText(req AnthropicRequest, f func(string) string) AnthropicRequest {
+	if len(req.System) > 0 {
+		req.System = mapContentText(req.System, f)
+	}
+	messages := make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = Message{Role: msg.Role, Content: mapContentText(msg.Content, f)}
+	}
+	req.Messages = messages
+	return req
+}
+
+// mapContentText applies f to the text in an Anthropic content field: a
+// plain string, or the text blocks of an array, including those nested in
+// tool_result blocks. Other blocks are kept byte for byte. Text blocks that
+// f empties are dropped; if that would leave no content at all, or the
+// content cannot be decoded, it is returned unchanged.
+func mapContentText(raw json.RawMessage, f func(string) string) json.RawMessage {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if out := f(s); out != s && out != "" {
+			raw, _ = json.Marshal(out)
+		}
+		return raw
+	}
+
+	var blocks []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return raw
+	}
+	kept := make([]map[string]json.RawMessage, 0, len(blocks))
+	changed := false
+	for _, b := range blocks {
+		var typ string
+		json.Unmarshal(b["type"], &typ) //nolint:errcheck
+		switch {
+		case typ == "text":
+			var text string
+			if json.Unmarshal(b["text"], &text) != nil {
+				break
+			}
+			out := f(text)
+			if out == text {
+				break
+			}
+			changed = true
+			if out == "" {
+				continue
+			}
+			b["text"], _ = json.Marshal(out)
+		case typ == "tool_result" && len(b["content"]) > 0:
+			if content := mapContentText(b["content"], f); !bytes.Equal(content, b["content"]) {
+				changed = true
+				b["content"] = content
+			}
+		}
+		kept = append(kept, b)
+	}
+	if !changed || len(kept) == 0 {
+		return raw
+	}
+	out, err := json.Marshal(kept)
+	if err != nil {
+		return raw
+	}
+	return out
+}
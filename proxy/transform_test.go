@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// transformRequest decodes an Anthropic request body for the transform
+// tests.
+func transformRequest(t *testing.T, body string) AnthropicRequest {
+	t.Helper()
+	var req AnthropicRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// messageContents returns each message's content as JSON text.
+func messageContents(req AnthropicRequest) []string {
+	out := make([]string, len(req.Messages))
+	for i, msg := range req.Messages {
+		out[i] = string(msg.Content)
+	}
+	return out
+}
+
+func TestStripSystemRemindersTransform(t *testing.T) {
+	req := transformRequest(t, `{"system":"Be brief.<system-reminder>today is Monday</system-reminder>","messages":[
+		{"role":"user","content":[{"type":"text","text":"<system-reminder>hook output</system-reminder>"},{"type":"text","text":"Fix the bug"}]},
+		{"role":"assistant","content":"Done."},
+		{"role":"user","content":"<system-reminder>only a reminder</system-reminder>"}]}`)
+	original := messageContents(req)
+
+	got := stripSystemRemindersTransform(req)
+
+	if s := ExtractSystemPrompt(got.System); s != "Be brief." {
+		t.Errorf("system = %q, want %q", s, "Be brief.")
+	}
+	want := []string{
+		`[{"text":"Fix the bug","type":"text"}]`,
+		`"Done."`,
+		// Stripping would leave nothing, so the message is kept as it was.
+		`"<system-reminder>only a reminder</system-reminder>"`,
+	}
+	if c := messageContents(got); strings.Join(c, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages =\n%s\nwant\n%s", strings.Join(c, "\n"), strings.Join(want, "\n"))
+	}
+	if c := messageContents(req); strings.Join(c, "\n") != strings.Join(original, "\n") {
+		t.Errorf("input request was modified:\n%s", strings.Join(c, "\n"))
+	}
+}
+
+func TestRedactEmailsTransform(t *testing.T) {
+	req := transformRequest(t, `{"system":[{"type":"text","text":"Reply to ops@example.com"}],"messages":[
+		{"role":"user","content":"Email jane.doe+work@mail.example.org about it"},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"owner: bob@example.net"},
+			{"type":"image","source":{"type":"base64","media_type":"image/png","data":"a@b.co"}}]}]}`)
+
+	got := redactEmailsTransform(req)
+
+	if s := ExtractSystemPrompt(got.System); s != "Reply to [redacted email]" {
+		t.Errorf("system = %q", s)
+	}
+	if s := ExtractText(got.Messages[0].Content); s != "Email [redacted email] about it" {
+		t.Errorf("message text = %q", s)
+	}
+	blocks := string(got.Messages[1].Content)
+	if !strings.Contains(blocks, `"content":"owner: [redacted email]"`) {
+		t.Errorf("tool result not redacted: %s", blocks)
+	}
+	if !strings.Contains(blocks, `"data":"a@b.co"`) {
+		t.Errorf("image data should be left alone: %s", blocks)
+	}
+}
+
+func TestTruncateToContextTransform(t *testing.T) {
+	long := strings.Repeat("word ", 200) // roughly 250 tokens
+	msg := func(role, content string) string {
+		b, _ := json.Marshal(map[string]string{"role": role, "content": content})
+		return string(b)
+	}
+	req := transformRequest(t, `{"max_tokens":100,"messages":[`+strings.Join([]string{
+		msg("user", long), msg("assistant", long),
+		msg("user", "second question"), msg("assistant", long),
+		msg("user", "latest question"),
+	}, ",")+`]}`)
+
+	if got := truncateToContext(0)(req); len(got.Messages) != 5 {
+		t.Errorf("zero context dropped messages: %d left", len(got.Messages))
+	}
+	if got := truncateToContext(100000)(req); len(got.Messages) != 5 {
+		t.Errorf("request that fits was truncated: %d left", len(got.Messages))
+	}
+
+	// Room for the last three messages; the first must then be a user
+	// message, so the conversation starts at "second question".
+	got := truncateToContext(estimateInputTokens(AnthropicRequest{Messages: req.Messages[2:]}) + 150)(req)
+	if len(got.Messages) != 3 || ExtractText(got.Messages[0].Content) != "second question" {
+		t.Errorf("kept %d messages starting %q, want 3 starting with the second question",
+			len(got.Messages), ExtractText(got.Messages[0].Content))
+	}
+	if len(req.Messages) != 5 {
+		t.Error("input request was modified")
+	}
+
+	// The last user message is kept even when it alone is too big.
+	if got := truncateToContext(10)(req); len(got.Messages) != 1 {
+		t.Errorf("kept %d messages, want only the last", len(got.Messages))
+	}
+}
+
+func TestTruncateToContextKeepsToolExchanges(t *testing.T) {
+	long := strings.Repeat("line of output ", 200)
+	toolUse := func(id string) string {
+		return `{"role":"assistant","content":[{"type":"tool_use","id":"` + id + `","name":"read_file","input":{}}]}`
+	}
+	toolResult := func(id string) string {
+		return `{"role":"user","content":[{"type":"tool_result","tool_use_id":"` + id + `","content":"` + long + `"}]}`
+	}
+
+	// An agent loop: one user prompt, then only tool rounds. No message
+	// after the first can open a conversation, so nothing is dropped.
+	agent := transformRequest(t, `{"max_tokens":100,"messages":[
+		{"role":"user","content":"Fix the failing test"},`+
+		toolUse("t1")+`,`+toolResult("t1")+`,`+toolUse("t2")+`,`+toolResult("t2")+`]}`)
+	if got := truncateToContext(10)(agent); len(got.Messages) != 5 {
+		t.Errorf("agent loop kept %d messages, want all 5 untouched", len(got.Messages))
+	}
+
+	// With a later user prompt, the earlier exchange is dropped whole and
+	// the conversation restarts at that prompt, tool rounds and all.
+	req := transformRequest(t, `{"max_tokens":100,"messages":[
+		{"role":"user","content":"Fix the failing test"},`+
+		toolUse("t1")+`,`+toolResult("t1")+`,
+		{"role":"assistant","content":"Fixed."},
+		{"role":"user","content":"Now update the docs"},`+
+		toolUse("t2")+`,`+toolResult("t2")+`]}`)
+	got := truncateToContext(10)(req)
+	if len(got.Messages) != 3 || ExtractText(got.Messages[0].Content) != "Now update the docs" {
+		t.Errorf("kept %d messages starting %s, want 3 starting with the second prompt",
+			len(got.Messages), got.Messages[0].Content)
+	}
+}
+
+func TestComposeTransformsOrder(t *testing.T) {
+	reminder := "<system-reminder>" + strings.Repeat("context ", 400) + "</system-reminder>"
+	req := transformRequest(t, `{"max_tokens":10,"messages":[
+		{"role":"user","content":"first from a@example.com"},
+		{"role":"assistant","content":"ok"},
+		{"role":"user","content":[{"type":"text","text":"`+reminder+`"},{"type":"text","text":"second"}]}]}`)
+	limit := estimateInputTokens(AnthropicRequest{Messages: req.Messages[:2]}) + 20
+	truncate := truncateToContext(limit)
+
+	// Stripping first makes the request small enough to keep everything.
+	got := composeTransforms(stripSystemRemindersTransform, truncate, redactEmailsTransform)(req)
+	if len(got.Messages) != 3 || ExtractText(got.Messages[0].Content) != "first from [redacted email]" {
+		t.Errorf("strip then truncate kept %d messages: %v", len(got.Messages), messageContents(got))
+	}
+
+	// Truncating first sees the reminder and drops the older messages.
+	got = composeTransforms(truncate, stripSystemRemindersTransform)(req)
+	if len(got.Messages) != 1 || ExtractText(got.Messages[0].Content) != "second" {
+		t.Errorf("truncate then strip kept %d messages: %v", len(got.Messages), messageContents(got))
+	}
+}
+
+func TestNewTransforms(t *testing.T) {
+	cfg := &config.Config{Proxy: config.ProxyConfig{Transforms: []string{"redact_emails", "strip_system_reminders", "truncate_to_context"}}}
+	if transforms, err := newTransforms(cfg); err != nil || len(transforms) != 3 {
+		t.Errorf("newTransforms = %d transforms, %v; want 3, nil", len(transforms), err)
+	}
+
+	cfg.Proxy.Transforms = []string{"redact_emails", "redact_phones"}
+	if _, err := newTransforms(cfg); err == nil || !strings.Contains(err.Error(), "redact_phones") {
+		t.Errorf("newTransforms with an unknown name: err = %v, want one naming redact_phones", err)
+	}
+}
+
+func TestHandleMessages_TransformsReachProvider(t *testing.T) {
+	var sent string
+	p := newStubProviderProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sent = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+	})
+	p.transforms = []requestTransform{redactEmailsTransform}
+
+	w := postMessages(t, p, `{"model":"claude-sonnet","max_tokens":100,"messages":[{"role":"user","content":"Write to sam@example.com"}]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(sent, "sam@example.com") || !strings.Contains(sent, redactedEmail) {
+		t.Errorf("provider received %s, want the email redacted", sent)
+	}
+}
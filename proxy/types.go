@@ -12,8 +12,49 @@ type AnthropicRequest struct {
 	MaxTokens   int             `json:"max_tokens"`
 	Messages    []Message       `json:"messages"`
 	System      json.RawMessage `json:"system,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
+
+	// TopP, TopK, and StopSequences tune sampling and where generation
+	// stops. They are forwarded to every provider that supports them.
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+
+	// ServiceTier is Anthropic's service_tier: "auto" to use priority
+	// capacity when available, or "standard_only".
+	ServiceTier string `json:"service_tier,omitempty"`
+
+	// Metadata carries request metadata such as "user_id", which Anthropic
+	// uses for abuse monitoring.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Tools      []Tool      `json:"tools,omitempty"`
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+
+	// ResponseFormat is an OpenAI-style response_format (e.g.
+	// {"type":"json_object"}) requesting structured JSON output. It is not
+	// part of the Anthropic API; the router passes it on or emulates it per
+	// provider.
+	ResponseFormat json.RawMessage `json:"response_format,omitempty"`
+
+	// N is the OpenAI parameter asking for several completions. Only one
+	// completion per request is supported, so n > 1 is rejected.
+	N int `json:"n,omitempty"`
+}
+
+// Tool is a client-defined tool the model may call.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice constrains tool use: type is "auto", "any", "tool" (with name),
+// or "none".
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // Message is a single turn in an Anthropic conversation.
@@ -22,8 +63,32 @@ type Message struct {
 	Content json.RawMessage `json:"content"`
 }
 
+// UsesTools reports whether req involves tool calling: it defines tools, or
+// a message carries tool_use or tool_result blocks.
+func UsesTools(req AnthropicRequest) bool {
+	if len(req.Tools) > 0 {
+		return true
+	}
+	for _, msg := range req.Messages {
+		var blocks []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(msg.Content, &blocks) != nil {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type == "tool_use" || b.Type == "tool_result" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ExtractText extracts text content from the Anthropic content format.
-// It handles both the plain-string form and the array-of-content-blocks form.
+// It handles both the plain-string form and the array-of-content-blocks form;
+// only "text" blocks contribute. null and any other JSON type (numbers,
+// booleans, objects) yield an empty string.
 func ExtractText(raw json.RawMessage) string {
 	if len(raw) == 0 {
 		return ""
@@ -35,23 +100,54 @@ func ExtractText(raw json.RawMessage) string {
 		return s
 	}
 
-	// Try array of typed content blocks.
-	var blocks []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+	// Try array of typed content blocks. Blocks are decoded one at a time so
+	// a malformed or non-object element is skipped rather than discarding
+	// the text of its neighbours.
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return ""
 	}
-	if err := json.Unmarshal(raw, &blocks); err == nil {
-		var sb strings.Builder
-		for _, b := range blocks {
-			if b.Type == "text" {
-				sb.WriteString(b.Text)
-			}
+	var sb strings.Builder
+	for _, rawBlock := range blocks {
+		var b struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(rawBlock, &b); err != nil {
+			continue
+		}
+		if b.Type == "text" {
+			sb.WriteString(b.Text)
 		}
-		return sb.String()
 	}
+	return sb.String()
+}
 
-	// Fall back to raw bytes as a string (best-effort).
-	return string(raw)
+// ExtractImages returns the base64 data of the image blocks in an Anthropic
+// content field, in order. Only images with a base64 source are returned;
+// URL sources, plain-string content, and malformed blocks yield nothing.
+func ExtractImages(raw json.RawMessage) []string {
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil
+	}
+	var images []string
+	for _, rawBlock := range blocks {
+		var b struct {
+			Type   string `json:"type"`
+			Source struct {
+				Type string `json:"type"`
+				Data string `json:"data"`
+			} `json:"source"`
+		}
+		if err := json.Unmarshal(rawBlock, &b); err != nil {
+			continue
+		}
+		if b.Type == "image" && b.Source.Type == "base64" && b.Source.Data != "" {
+			images = append(images, b.Source.Data)
+		}
+	}
+	return images
 }
 
 // ExtractSystemPrompt returns the system prompt text from the request.
@@ -84,16 +180,46 @@ type AnthropicResponse struct {
 	Usage        Usage          `json:"usage"`
 }
 
-// ContentBlock is a single typed block within an Anthropic response.
+// ContentBlock is a single typed block within an Anthropic response: a
+// "text" block carries Text, a "tool_use" block carries ID, Name, and Input.
 type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// MarshalJSON writes only the fields belonging to b's type, so a text block
+// always has "text" (even when empty) and a tool_use block always has an
+// "input" object.
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	if b.Type == "tool_use" {
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage(`{}`)
+		}
+		return json.Marshal(struct {
+			Type  string          `json:"type"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		}{b.Type, b.ID, b.Name, input})
+	}
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}{b.Type, b.Text})
 }
 
-// Usage carries token-count information in an Anthropic response.
+// Usage carries token-count information in an Anthropic response. The
+// cache fields count prompt-cache writes and reads, which Anthropic reports
+// separately from (and prices differently to) InputTokens.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 // ErrorResponse is the Anthropic-format error envelope.
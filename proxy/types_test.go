@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"string", `"hello"`, "hello"},
+		{"text blocks", `[{"type":"text","text":"a"},{"type":"text","text":"b"}]`, "ab"},
+		{"mixed with image blocks",
+			`[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0"}},{"type":"text","text":"describe this"},{"type":"tool_result","content":"x"}]`,
+			"describe this"},
+		{"non-object elements skipped", `[42,{"type":"text","text":"kept"},null]`, "kept"},
+		{"null", `null`, ""},
+		{"number", `123`, ""},
+		{"boolean", `true`, ""},
+		{"object", `{"type":"text","text":"not an array"}`, ""},
+		{"empty", ``, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractText(json.RawMessage(tt.raw)); got != tt.want {
+				t.Errorf("ExtractText(%s) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractImages(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"base64 images in order",
+			`[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0"}},{"type":"text","text":"compare"},{"type":"image","source":{"type":"base64","media_type":"image/jpeg","data":"/9j/4AA"}}]`,
+			[]string{"iVBORw0", "/9j/4AA"}},
+		{"url source skipped", `[{"type":"image","source":{"type":"url","url":"https://example.com/a.png"}}]`, nil},
+		{"malformed blocks skipped", `[42,{"type":"image","source":"x"},null]`, nil},
+		{"string content", `"hello"`, nil},
+		{"empty", ``, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractImages(json.RawMessage(tt.raw))
+			if len(got) != len(tt.want) {
+				t.Fatalf("ExtractImages(%s) = %q, want %q", tt.raw, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ExtractImages(%s) = %q, want %q", tt.raw, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractSystemPromptNullAndNumber(t *testing.T) {
+	var req AnthropicRequest
+	for _, body := range []string{
+		`{"system":null,"messages":[{"role":"user","content":"hi"}]}`,
+		`{"system":123,"messages":[{"role":"user","content":"hi"}]}`,
+	} {
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		if got := ExtractSystemPrompt(req.System); got != "" {
+			t.Errorf("ExtractSystemPrompt for %s = %q, want empty", body, got)
+		}
+	}
+}
+
+func TestUsesTools(t *testing.T) {
+	tests := []struct {
+		name string
+		req  AnthropicRequest
+		want bool
+	}{
+		{"plain", AnthropicRequest{Messages: []Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}}, false},
+		{"text blocks", AnthropicRequest{Messages: []Message{{Role: "user", Content: json.RawMessage(`[{"type":"text","text":"hi"}]`)}}}, false},
+		{"tool definitions", AnthropicRequest{Tools: []Tool{{Name: "read_file"}}}, true},
+		{"tool_use block", AnthropicRequest{Messages: []Message{{Role: "assistant", Content: json.RawMessage(`[{"type":"tool_use","id":"t1","name":"x","input":{}}]`)}}}, true},
+		{"tool_result block", AnthropicRequest{Messages: []Message{{Role: "user", Content: json.RawMessage(`[{"type":"tool_result","tool_use_id":"t1"}]`)}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UsesTools(tt.req); got != tt.want {
+				t.Errorf("UsesTools = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sort"
+	"sync"
+)
+
+// classificationCache is a fixed-size, mutex-guarded LRU cache of
+// classification results keyed by classificationKey.
+type classificationCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is most recently used
+	entries  map[[sha256.Size]byte]*list.Element
+
+	hits, misses int
+}
+
+type cacheEntry struct {
+	key   [sha256.Size]byte
+	value Classification
+}
+
+// newClassificationCache returns an empty cache holding at most capacity
+// entries.
+func newClassificationCache(capacity int) *classificationCache {
+	return &classificationCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// classificationKey hashes prompt together with headers in sorted order, so
+// the same request always maps to the same key.
+func classificationKey(prompt string, headers map[string]string) [sha256.Size]byte {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	h.Write([]byte(prompt))
+	for _, k := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{'='})
+		h.Write([]byte(headers[k]))
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// get returns the cached classification for key, marking it most recently
+// used.
+func (c *classificationCache) get(key [sha256.Size]byte) (Classification, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return Classification{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).value, true
+}
+
+// put stores value under key, evicting the least recently used entry when
+// the cache is full.
+func (c *classificationCache) put(key [sha256.Size]byte, value Classification) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// len returns the number of cached entries.
+func (c *classificationCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
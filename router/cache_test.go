@@ -0,0 +1,91 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClassifyCachesIdenticalPrompts(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.ClassificationCacheSize = 16
+	c := NewClassifier(cfg)
+
+	first := c.Classify("Write a Go function for rate limiting", nil)
+	for i := 0; i < 3; i++ {
+		if got := c.Classify("Write a Go function for rate limiting", nil); got.TaskType != first.TaskType || got.RouteClass != first.RouteClass {
+			t.Fatalf("cached classification %+v differs from %+v", got, first)
+		}
+	}
+	if c.cache.hits != 3 || c.cache.misses != 1 {
+		t.Errorf("got %d hits / %d misses, want 3 / 1", c.cache.hits, c.cache.misses)
+	}
+}
+
+func TestClassifyCacheKeysIncludeHeaders(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.ClassificationCacheSize = 16
+	c := NewClassifier(cfg)
+
+	const prompt = "Summarize this document"
+	plain := c.Classify(prompt, nil)
+	background := c.Classify(prompt, map[string]string{"x-request-type": "background"})
+
+	if c.cache.len() != 2 {
+		t.Errorf("expected 2 cache entries, got %d", c.cache.len())
+	}
+	if plain.RouteClass == background.RouteClass {
+		t.Errorf("header did not change the cached route class (%s)", plain.RouteClass)
+	}
+
+	// Header order must not matter.
+	a := classificationKey(prompt, map[string]string{"a": "1", "b": "2"})
+	b := classificationKey(prompt, map[string]string{"b": "2", "a": "1"})
+	if a != b {
+		t.Error("keys differ for the same headers")
+	}
+	if classificationKey(prompt, map[string]string{"a": "1"}) == classificationKey(prompt+"a=1", nil) {
+		t.Error("header and prompt text should not collide")
+	}
+}
+
+func TestClassificationCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newClassificationCache(2)
+	k1, k2, k3 := classificationKey("1", nil), classificationKey("2", nil), classificationKey("3", nil)
+
+	cache.put(k1, Classification{TaskType: "one"})
+	cache.put(k2, Classification{TaskType: "two"})
+	cache.get(k1) // k2 is now least recently used
+	cache.put(k3, Classification{TaskType: "three"})
+
+	if _, ok := cache.get(k2); ok {
+		t.Error("expected k2 to be evicted")
+	}
+	for _, k := range [][32]byte{k1, k3} {
+		if _, ok := cache.get(k); !ok {
+			t.Error("expected recently used entries to remain")
+		}
+	}
+}
+
+func TestClassifyWithoutCache(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.ClassificationCacheSize = 0
+	if c := NewClassifier(cfg); c.cache != nil {
+		t.Error("expected no cache when classification_cache_size is 0")
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+	for _, size := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			cfg := loadTestConfig(b)
+			cfg.Defaults.ClassificationCacheSize = size
+			c := NewClassifier(cfg)
+			headers := map[string]string{"x-request-type": "chat"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Classify("Refactor this Go function and explain the architecture trade-offs", headers)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// ContextWindow compares a model's configured max_context with the context
+// window its provider reports.
+type ContextWindow struct {
+	Model      string
+	Configured int
+
+	// Probed is the reported context window in tokens, or 0 when the
+	// provider does not report one for the model.
+	Probed int
+
+	// Err explains why the provider could not be asked; it is "" when the
+	// request succeeded, even if no context window was reported.
+	Err string
+}
+
+// contextLengthFields are the model-listing fields OpenAI-compatible
+// providers report the context window in: context_length (OpenRouter,
+// Together), context_window (Groq), and max_model_len (vLLM).
+var contextLengthFields = []string{"context_length", "context_window", "max_model_len"}
+
+// ProbeContextWindows asks each configured model's provider for the model's
+// context window, returning one result per model sorted by name:
+//
+//   - anthropic: GET {base_url}/v1/models/{api_model}, reading max_input_tokens
+//   - openai_compat: GET {base_url}/models (once per base URL), reading the
+//     matching entry's context_length, context_window, or max_model_len
+//   - ollama: POST {base_url}/api/show, reading model_info's
+//     <architecture>.context_length
+//
+// Providers that do not report a context window leave Probed at 0. Azure
+// deployments and unknown providers are skipped without a request.
+func ProbeContextWindows(ctx context.Context, cfg *config.Config) []ContextWindow {
+	names := make([]string, 0, len(cfg.Models))
+	for name := range cfg.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listings := make(map[string]map[string]int)
+	listingErrs := make(map[string]string)
+
+	results := make([]ContextWindow, 0, len(names))
+	for _, name := range names {
+		m := cfg.Models[name]
+		res := ContextWindow{Model: name, Configured: m.MaxContext}
+		var err error
+		switch {
+		case m.Provider == "anthropic":
+			res.Probed, err = probeAnthropicContext(ctx, m)
+		case m.Provider == "openai_compat" && m.AuthStyle != "azure":
+			base := strings.TrimRight(m.BaseURL, "/")
+			if _, ok := listings[base]; !ok && listingErrs[base] == "" {
+				listing, err := listOpenAICompatContexts(ctx, base, m.AuthStyle)
+				if err != nil {
+					listingErrs[base] = err.Error()
+				} else {
+					listings[base] = listing
+				}
+			}
+			res.Probed = listings[base][m.APIModel]
+			res.Err = listingErrs[base]
+		case m.Provider == "ollama":
+			res.Probed, err = probeOllamaContext(ctx, m)
+		}
+		if err != nil {
+			res.Err = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// probeAnthropicContext reads max_input_tokens from the model's entry in
+// Anthropic's models API.
+func probeAnthropicContext(ctx context.Context, m config.Model) (int, error) {
+	endpoint := anthropicBaseURL(m.BaseURL) + "/v1/models/" + url.PathEscape(m.APIModel)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	setAnthropicAuth(httpReq, nil)
+
+	var info struct {
+		MaxInputTokens int `json:"max_input_tokens"`
+	}
+	if err := fetchJSON(httpReq, &info); err != nil {
+		return 0, err
+	}
+	return info.MaxInputTokens, nil
+}
+
+// listOpenAICompatContexts fetches base's model listing and returns the
+// context window of every model that reports one, by model ID.
+func listOpenAICompatContexts(ctx context.Context, base, authStyle string) (map[string]int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	setOpenAICompatAuth(httpReq, base, authStyle)
+
+	var listing struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := fetchJSON(httpReq, &listing); err != nil {
+		return nil, err
+	}
+	contexts := make(map[string]int)
+	for _, entry := range listing.Data {
+		id, _ := entry["id"].(string)
+		for _, field := range contextLengthFields {
+			if n, ok := entry[field].(float64); ok && n > 0 {
+				contexts[id] = int(n)
+				break
+			}
+		}
+	}
+	return contexts, nil
+}
+
+// probeOllamaContext reads the context length Ollama reports for the model
+// under its architecture's key, such as llama.context_length.
+func probeOllamaContext(ctx context.Context, m config.Model) (int, error) {
+	data, err := json.Marshal(map[string]string{"model": m.APIModel})
+	if err != nil {
+		return 0, err
+	}
+	endpoint := strings.TrimRight(m.BaseURL, "/") + "/api/show"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var show struct {
+		ModelInfo map[string]any `json:"model_info"`
+	}
+	if err := fetchJSON(httpReq, &show); err != nil {
+		return 0, err
+	}
+	for key, v := range show.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n), nil
+		}
+	}
+	return 0, nil
+}
+
+// fetchJSON sends httpReq and decodes a 2xx JSON response into v.
+func fetchJSON(httpReq *http.Request, v any) error {
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("returned %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
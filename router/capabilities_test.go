@@ -0,0 +1,83 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+func TestProbeContextWindows(t *testing.T) {
+	var listings int32
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&listings, 1)
+		w.Write([]byte(`{"data":[` + //nolint:errcheck
+			`{"id":"big-model","context_length":200000},` +
+			`{"id":"groq-model","context_window":131072},` +
+			`{"id":"bare-model"}]}`))
+	}))
+	defer openai.Close()
+
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/show" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"model_info":{"general.architecture":"llama","llama.context_length":131072}}`)) //nolint:errcheck
+	}))
+	defer ollama.Close()
+
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models/claude-test" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id":"claude-test","max_input_tokens":200000}`)) //nolint:errcheck
+	}))
+	defer anthropic.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	cfg := &config.Config{Models: map[string]config.Model{
+		"big":     {Provider: "openai_compat", APIModel: "big-model", BaseURL: openai.URL + "/v1", MaxContext: 128000},
+		"groq":    {Provider: "openai_compat", APIModel: "groq-model", BaseURL: openai.URL + "/v1/"},
+		"bare":    {Provider: "openai_compat", APIModel: "bare-model", BaseURL: openai.URL + "/v1"},
+		"local":   {Provider: "ollama", APIModel: "llama3.2", BaseURL: ollama.URL},
+		"claude":  {Provider: "anthropic", APIModel: "claude-test", BaseURL: anthropic.URL},
+		"down":    {Provider: "openai_compat", APIModel: "x", BaseURL: down.URL},
+		"azure":   {Provider: "openai_compat", AuthStyle: "azure", APIModel: "gpt", BaseURL: down.URL},
+		"mystery": {Provider: "carrier_pigeon"},
+	}}
+
+	got := make(map[string]ContextWindow)
+	for _, r := range ProbeContextWindows(context.Background(), cfg) {
+		got[r.Model] = r
+	}
+
+	want := map[string]int{"big": 200000, "groq": 131072, "bare": 0, "local": 131072, "claude": 200000, "azure": 0, "mystery": 0}
+	for model, probed := range want {
+		if r := got[model]; r.Probed != probed || r.Err != "" {
+			t.Errorf("%s: got %+v, want probed %d and no error", model, r, probed)
+		}
+	}
+	if got["big"].Configured != 128000 {
+		t.Errorf("big: configured = %d, want 128000", got["big"].Configured)
+	}
+	if r := got["down"]; r.Probed != 0 || !strings.Contains(r.Err, "503") {
+		t.Errorf("down: got %+v, want a 503 error", r)
+	}
+	if listings != 1 {
+		t.Errorf("model listing fetched %d times, want once per base URL", listings)
+	}
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// defaultPrimaryTimeout bounds how long ChainedClassifier waits on the
+// primary backend before falling back.
+const defaultPrimaryTimeout = 2 * time.Second
+
+// ChainedClassifier is a TaskBackend that tries a primary backend (e.g.
+// embeddings) under a short timeout and falls back to a secondary backend —
+// normally the regex patterns — when the primary errors or times out, so an
+// unavailable classification service never fails the request.
+type ChainedClassifier struct {
+	primary  TaskBackend
+	fallback TaskBackend
+	timeout  time.Duration
+}
+
+// NewChainedClassifier returns a ChainedClassifier. A non-positive timeout
+// uses defaultPrimaryTimeout.
+func NewChainedClassifier(primary, fallback TaskBackend, timeout time.Duration) *ChainedClassifier {
+	if timeout <= 0 {
+		timeout = defaultPrimaryTimeout
+	}
+	return &ChainedClassifier{primary: primary, fallback: fallback, timeout: timeout}
+}
+
+// DetectTask returns the primary backend's result, or the fallback's when the
+// primary fails within the timeout. Each fallback is logged.
+func (c *ChainedClassifier) DetectTask(ctx context.Context, prompt string) (string, float64, error) {
+	primaryCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	taskType, confidence, err := c.primary.DetectTask(primaryCtx, prompt)
+	if err == nil {
+		return taskType, confidence, nil
+	}
+
+	log.Printf("classifier: primary backend failed, falling back to regex: %v", err)
+	return c.fallback.DetectTask(ctx, prompt)
+}
+
+// regexBackend adapts a Classifier's compiled task patterns to TaskBackend so
+// they can serve as the fallback in a ChainedClassifier.
+type regexBackend struct {
+	c *Classifier
+}
+
+// DetectTask runs the regex task-pattern scan. It never fails.
+func (r regexBackend) DetectTask(_ context.Context, prompt string) (string, float64, error) {
+	r.c.mu.RLock()
+	defer r.c.mu.RUnlock()
+	taskType, _, confidence := r.c.detectTaskType(prompt)
+	return taskType, confidence, nil
+}
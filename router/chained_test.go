@@ -0,0 +1,96 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubBackend is a TaskBackend returning a fixed result, or blocking until
+// the context is done when block is set.
+type stubBackend struct {
+	task       string
+	confidence float64
+	err        error
+	block      bool
+	calls      int
+}
+
+func (s *stubBackend) DetectTask(ctx context.Context, _ string) (string, float64, error) {
+	s.calls++
+	if s.block {
+		<-ctx.Done()
+		return "", 0, ctx.Err()
+	}
+	return s.task, s.confidence, s.err
+}
+
+func TestChainedClassifierUsesPrimary(t *testing.T) {
+	primary := &stubBackend{task: "architecture", confidence: 0.9}
+	fallback := &stubBackend{task: "chat", confidence: 0.5}
+	cc := NewChainedClassifier(primary, fallback, time.Second)
+
+	task, conf, err := cc.DetectTask(context.Background(), "anything")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if task != "architecture" || conf != 0.9 {
+		t.Errorf("got (%q, %.2f), want (architecture, 0.90)", task, conf)
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback should not be called, got %d calls", fallback.calls)
+	}
+}
+
+func TestChainedClassifierFallsBackOnError(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+	c.backend = NewChainedClassifier(
+		&stubBackend{err: errors.New("connection refused")},
+		regexBackend{c: c},
+		time.Second,
+	)
+
+	result := c.Classify("Write a Go function for rate limiting", nil)
+	if result.TaskType != "code" {
+		t.Errorf("got task type %q, want regex result %q", result.TaskType, "code")
+	}
+	if len(result.RequiredStrengths) == 0 || result.RequiredStrengths[0] != "code" {
+		t.Errorf("expected code strengths from regex fallback, got %v", result.RequiredStrengths)
+	}
+}
+
+func TestChainedClassifierFallsBackOnTimeout(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+	c.backend = NewChainedClassifier(
+		&stubBackend{block: true},
+		regexBackend{c: c},
+		20*time.Millisecond,
+	)
+
+	start := time.Now()
+	result := c.Classify("Summarize this document", nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("classification took %v, expected the primary to be cut off by the timeout", elapsed)
+	}
+	if result.TaskType != "summarization" {
+		t.Errorf("got task type %q, want regex result %q", result.TaskType, "summarization")
+	}
+}
+
+func TestNewClassifierFromConfigEmbeddingUnavailable(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.Classifier = "embedding"
+	// Nothing listens on port 1, so embedding the task examples fails.
+	cfg.Defaults.Embedding.BaseURL = "http://127.0.0.1:1"
+
+	c, err := NewClassifierFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("expected degraded regex classifier, got error: %v", err)
+	}
+	if got := c.Classify("Translate this to Spanish", nil).TaskType; got != "translation" {
+		t.Errorf("got task type %q, want %q", got, "translation")
+	}
+}
@@ -1,8 +1,15 @@
 package router
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jbctechsolutions/sr-router/config"
 )
@@ -15,15 +22,55 @@ type Classification struct {
 	MinQuality        float64
 	LatencyBudgetMs   int
 	RequiredStrengths []string
-	Confidence        float64
+	// StrengthMatch is the task's strength_match mode: "any" or, when
+	// empty, "all".
+	StrengthMatch string
+	Confidence    float64
+	// LongConversation is set by ClassifyConversation when the conversation
+	// crossed the configured long_conversation threshold.
+	LongConversation bool
+	// TierPinned confines routing to Tier (escalating through
+	// defaults.tier_escalation when configured) even when tier escalation
+	// is off. See AsRouteClass.
+	TierPinned bool
+	// MaxTokens and Temperature are the defaults for a request that omits
+	// them, from the task or else the route class (see
+	// config.GetRequestDefaults). Zero and nil mean no default.
+	MaxTokens   int
+	Temperature *float64
+	// ServiceTier is the route class's default Anthropic service_tier, or
+	// "" for none.
+	ServiceTier string
 }
 
 // Classifier performs two-layer classification: route class then task type.
 // It compiles all patterns once at construction time so Classify is cheap.
 type Classifier struct {
+	// mu guards cfg, the compiled patterns, and cache, which Reload
+	// replaces while classifications may be in flight.
+	mu            sync.RWMutex
 	cfg           *config.Config
 	taskPatterns  map[string][]*regexp.Regexp
 	routePatterns map[string]*compiledRoutePatterns
+
+	// backend, when non-nil, replaces the regex task patterns for layer 2.
+	backend TaskBackend
+
+	// cache, when non-nil, memoises Classify results by prompt and headers.
+	cache *classificationCache
+
+	// lookupEnv, when non-nil, reads the environment for route-class env
+	// detection. It is unset by default because the proxy's own environment
+	// says nothing about the requests it serves.
+	lookupEnv func(string) (string, bool)
+
+	// stdinPiped records that the CLI's stdin is a pipe or file rather than
+	// a terminal, selecting route classes configured with stdin: false.
+	stdinPiped bool
+
+	// flags holds the CLI flags passed for this invocation, without leading
+	// dashes, matched against each route class's configured flags.
+	flags map[string]bool
 }
 
 type compiledRoutePatterns struct {
@@ -34,60 +81,259 @@ type compiledRoutePatterns struct {
 // NewClassifier constructs a Classifier and pre-compiles all regex patterns
 // from the provided config. Invalid patterns are silently skipped.
 func NewClassifier(cfg *config.Config) *Classifier {
-	c := &Classifier{
-		cfg:           cfg,
-		taskPatterns:  make(map[string][]*regexp.Regexp),
-		routePatterns: make(map[string]*compiledRoutePatterns),
+	c := &Classifier{cfg: cfg}
+	if n := cfg.Defaults.ClassificationCacheSize; n > 0 {
+		c.cache = newClassificationCache(n)
+	}
+	c.taskPatterns, c.routePatterns, _ = compilePatterns(cfg, false)
+	return c
+}
+
+// compilePatterns compiles the task and route-class patterns in cfg. With
+// strict set, the first invalid pattern is returned as an error; otherwise
+// invalid patterns are skipped.
+func compilePatterns(cfg *config.Config, strict bool) (map[string][]*regexp.Regexp, map[string]*compiledRoutePatterns, error) {
+	var firstErr error
+	compile := func(where, p string) *regexp.Regexp {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: invalid pattern %q: %w", where, p, err)
+		}
+		return re
 	}
 
+	taskPatterns := make(map[string][]*regexp.Regexp)
 	for name, task := range cfg.Tasks {
 		for _, p := range task.Patterns {
-			re, err := regexp.Compile("(?i)" + p)
-			if err == nil {
-				c.taskPatterns[name] = append(c.taskPatterns[name], re)
+			if re := compile("task "+name, p); re != nil {
+				taskPatterns[name] = append(taskPatterns[name], re)
 			}
 		}
 	}
 
+	routePatterns := make(map[string]*compiledRoutePatterns)
 	for name, rc := range cfg.RouteClasses {
 		crp := &compiledRoutePatterns{}
 		for _, p := range rc.Detection.ContentPatterns {
-			re, err := regexp.Compile("(?i)" + p)
-			if err == nil {
+			if re := compile("route class "+name, p); re != nil {
 				crp.contentPatterns = append(crp.contentPatterns, re)
 			}
 		}
 		for _, p := range rc.Detection.SystemPromptPatterns {
-			re, err := regexp.Compile("(?i)" + p)
-			if err == nil {
+			if re := compile("route class "+name, p); re != nil {
 				crp.systemPromptPatterns = append(crp.systemPromptPatterns, re)
 			}
 		}
-		c.routePatterns[name] = crp
+		routePatterns[name] = crp
 	}
 
+	if strict && firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return taskPatterns, routePatterns, nil
+}
+
+// Reload switches the classifier to cfg's route classes, tasks, and
+// patterns in one step, for config hot-reload without rebuilding the
+// classifier's dependents. Unlike NewClassifier it rejects invalid
+// patterns: on error the current config stays in use. Cached
+// classifications are dropped. A task backend such as the embedding
+// classifier is kept as is.
+func (c *Classifier) Reload(cfg *config.Config) error {
+	taskPatterns, routePatterns, err := compilePatterns(cfg, true)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	c.taskPatterns = taskPatterns
+	c.routePatterns = routePatterns
+	c.cache = nil
+	if n := cfg.Defaults.ClassificationCacheSize; n > 0 {
+		c.cache = newClassificationCache(n)
+	}
+	return nil
+}
+
+// NewClassifierWithBackend constructs a Classifier that delegates task-type
+// detection to backend. Route-class detection still uses the configured
+// patterns and headers.
+func NewClassifierWithBackend(cfg *config.Config, backend TaskBackend) *Classifier {
+	c := NewClassifier(cfg)
+	c.backend = backend
 	return c
 }
 
+// NewClassifierFromConfig constructs a Classifier using the task backend
+// selected by defaults.classifier. An empty value or "regex" yields the
+// pattern-based classifier. "embedding" builds an EmbeddingBackend, which
+// embeds all task examples before returning, and chains it in front of the
+// regex patterns so classification degrades rather than fails when the
+// embedding service is unavailable — including at startup, where embedding
+// the examples is given embeddingStartupTimeout.
+func NewClassifierFromConfig(cfg *config.Config) (*Classifier, error) {
+	switch cfg.Defaults.Classifier {
+	case "", "regex":
+		return NewClassifier(cfg), nil
+	case "embedding":
+		c := NewClassifier(cfg)
+		timeout := time.Duration(cfg.Defaults.Embedding.TimeoutMs) * time.Millisecond
+		ctx, cancel := context.WithTimeout(context.Background(), embeddingStartupTimeout)
+		backend, err := NewEmbeddingBackend(ctx, cfg)
+		cancel()
+		if err != nil {
+			log.Printf("classifier: embedding backend unavailable, using regex: %v", err)
+			return c, nil
+		}
+		c.backend = NewChainedClassifier(backend, regexBackend{c: c}, timeout)
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown classifier %q", cfg.Defaults.Classifier)
+	}
+}
+
+// SetEnv enables env-based route-class detection, reading variables through
+// lookup (os.LookupEnv for the process environment). Cached classifications
+// are dropped since they were made without it.
+func (c *Classifier) SetEnv(lookup func(string) (string, bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookupEnv = lookup
+	if c.cache != nil {
+		c.cache = newClassificationCache(c.cache.capacity)
+	}
+}
+
+// SetFlags records the CLI flags passed for this invocation (e.g. "--bg").
+// A route class listing any of them under detection flags is selected ahead
+// of env, stdin, and content rules. Cached classifications are dropped.
+func (c *Classifier) SetFlags(flags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags = make(map[string]bool, len(flags))
+	for _, f := range flags {
+		c.flags[strings.TrimLeft(f, "-")] = true
+	}
+	if c.cache != nil {
+		c.cache = newClassificationCache(c.cache.capacity)
+	}
+}
+
+// SetStdinPiped tells the classifier whether the CLI's stdin is piped or
+// redirected, as when it is run from cron or a shell pipeline. When piped,
+// route classes configured with stdin: false are selected. Cached
+// classifications are dropped.
+func (c *Classifier) SetStdinPiped(piped bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stdinPiped = piped
+	if c.cache != nil {
+		c.cache = newClassificationCache(c.cache.capacity)
+	}
+}
+
 // Classify runs the two-layer classification against the prompt and optional
 // HTTP headers. Layer 1 determines the route class (interactive, background,
 // compaction). Layer 2 determines the task type (code, architecture, etc.).
-// The resulting quality floor is the maximum of the route-class floor and the
-// task-specific minimum quality.
+// The quality floor is the task's minimum quality, raised to the route-class
+// floor only when an x-request-type header chose the route class. When
+// defaults.classification_cache_size is positive, results for identical
+// prompts and headers are served from an LRU cache.
 func (c *Classifier) Classify(prompt string, headers map[string]string) Classification {
-	routeClass := c.detectRouteClass(prompt, headers)
+	return c.ClassifyContext(context.Background(), prompt, headers)
+}
+
+// ClassifyContext is Classify with a context for the task backend call, so a
+// cancelled request also cancels a pending embedding lookup. The backend is
+// called without holding the classifier's lock, so a slow backend never
+// blocks Reload or the configuration setters.
+func (c *Classifier) ClassifyContext(ctx context.Context, prompt string, headers map[string]string) Classification {
+	c.mu.RLock()
+	cache, backend := c.cache, c.backend
+	var key [sha256.Size]byte
+	if cache != nil {
+		key = classificationKey(prompt, headers)
+		if cl, ok := cache.get(key); ok {
+			c.mu.RUnlock()
+			return cl
+		}
+	}
+	if backend != nil {
+		c.mu.RUnlock()
+		taskType, confidence, err := backend.DetectTask(ctx, prompt)
+		if err != nil {
+			log.Printf("classifier: task backend failed: %v", err)
+		}
+		c.mu.RLock()
+		cl := c.classifyBackendTask(prompt, headers, taskType, confidence, err)
+		// A cache replaced by Reload meanwhile must not receive a result
+		// computed partly under the previous config.
+		if cache != nil && c.cache == cache {
+			cache.put(key, cl)
+		}
+		c.mu.RUnlock()
+		return cl
+	}
+	defer c.mu.RUnlock()
+	cl := c.classify(prompt, headers)
+	if cache != nil {
+		cache.put(key, cl)
+	}
+	return cl
+}
+
+// classify performs an uncached Classify using the regex task patterns.
+func (c *Classifier) classify(prompt string, headers map[string]string) Classification {
+	routeClass, fromHeader := c.detectRouteClassFromHeader(prompt, headers)
 	taskType, strengths, confidence := c.detectTaskType(prompt)
+	return c.classification(routeClass, taskType, strengths, confidence, fromHeader)
+}
+
+// classifyBackendTask completes a classification whose task type the task
+// backend returned (or failed to return, when err is non-nil).
+func (c *Classifier) classifyBackendTask(prompt string, headers map[string]string, taskType string, confidence float64, err error) Classification {
+	routeClass, fromHeader := c.detectRouteClassFromHeader(prompt, headers)
+	taskType, strengths, confidence := c.backendTask(taskType, confidence, err)
+	return c.classification(routeClass, taskType, strengths, confidence, fromHeader)
+}
+
+// ClassifyTask returns the classification a prompt of taskType would get,
+// without a prompt to classify: the task's required strengths and quality
+// floor, with full confidence. An empty routeClass uses interactive, the
+// class a prompt matching no detection rule falls into; a non-empty one is
+// treated as chosen by an x-request-type header, so its quality floor
+// applies.
+func (c *Classifier) ClassifyTask(taskType, routeClass string) Classification {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fromHeader := routeClass != ""
+	if !fromHeader {
+		routeClass = "interactive"
+	}
+	return c.classification(routeClass, taskType, c.cfg.Tasks[taskType].RequiredStrengths, 1.0, fromHeader)
+}
 
+// classification builds the Classification for a detected route class and
+// task type. fromHeader reports whether an x-request-type header chose the
+// route class.
+func (c *Classifier) classification(routeClass, taskType string, strengths []string, confidence float64, fromHeader bool) Classification {
 	rc := c.cfg.RouteClasses[routeClass]
 
 	// Task min_quality drives the quality floor — this determines which
 	// models are eligible. The route class floor no longer forces everything
 	// to premium; it only applies as a boost for explicit header overrides.
 	minQuality := rc.QualityFloor
+	var strengthMatch string
 	if task, ok := c.cfg.Tasks[taskType]; ok {
 		minQuality = task.MinQuality
+		if fromHeader && rc.QualityFloor > minQuality {
+			minQuality = rc.QualityFloor
+		}
+		strengthMatch = task.StrengthMatch
 	}
 
+	maxTokens, temperature := c.cfg.GetRequestDefaults(routeClass, taskType)
 	return Classification{
 		RouteClass:        routeClass,
 		TaskType:          taskType,
@@ -95,61 +341,262 @@ func (c *Classifier) Classify(prompt string, headers map[string]string) Classifi
 		MinQuality:        minQuality,
 		LatencyBudgetMs:   rc.LatencyBudgetMs,
 		RequiredStrengths: strengths,
+		StrengthMatch:     strengthMatch,
 		Confidence:        confidence,
+		MaxTokens:         maxTokens,
+		Temperature:       temperature,
+		ServiceTier:       rc.ServiceTier,
+	}
+}
+
+// ClassifyConversation is ClassifyContext for a multi-turn conversation:
+// prompt is the latest user message, turns the number of messages, and chars
+// their combined text length. When the conversation reaches the configured
+// long_conversation threshold the quality floor is raised, and the tier
+// replaced, so it is routed to a context-preserving model.
+func (c *Classifier) ClassifyConversation(ctx context.Context, prompt string, headers map[string]string, turns, chars int) Classification {
+	cl := c.ClassifyContext(ctx, prompt, headers)
+
+	c.mu.RLock()
+	lc := c.cfg.Defaults.LongConversation
+	c.mu.RUnlock()
+	long := (lc.Turns > 0 && turns >= lc.Turns) || (lc.Chars > 0 && chars >= lc.Chars)
+	if !long {
+		return cl
+	}
+	cl.LongConversation = true
+	if lc.MinQuality > cl.MinQuality {
+		cl.MinQuality = lc.MinQuality
 	}
+	if lc.Tier != "" {
+		cl.Tier = lc.Tier
+	}
+	return cl
+}
+
+// AsRouteClass returns cl moved into the named route class with the task's
+// requirements set aside: the tier, latency budget, and quality floor come
+// from the route class, required strengths are dropped, and routing is
+// pinned to the class's tier. The max_tokens, temperature, and
+// service_tier defaults are resolved again for the new class. It is for
+// requests whose class is known from the request itself regardless of
+// content. cl is returned unchanged when routeClass is not configured.
+func (c *Classifier) AsRouteClass(cl Classification, routeClass string) Classification {
+	c.mu.RLock()
+	rc, ok := c.cfg.RouteClasses[routeClass]
+	maxTokens, temperature := c.cfg.GetRequestDefaults(routeClass, cl.TaskType)
+	c.mu.RUnlock()
+	if !ok {
+		return cl
+	}
+	cl.RouteClass = routeClass
+	cl.Tier = rc.DefaultTier
+	cl.LatencyBudgetMs = rc.LatencyBudgetMs
+	cl.MinQuality = rc.QualityFloor
+	cl.RequiredStrengths = nil
+	cl.StrengthMatch = ""
+	cl.TierPinned = rc.DefaultTier != ""
+	cl.MaxTokens = maxTokens
+	cl.Temperature = temperature
+	cl.ServiceTier = rc.ServiceTier
+	return cl
+}
+
+// ToolUseStrength is the model strength required by requests that use tools.
+const ToolUseStrength = "tool_use"
+
+// RequireToolUse returns cl restricted to models with the tool_use strength,
+// for requests that define tools or carry tool_use/tool_result blocks. Tool
+// support is mandatory rather than one option among several, so a
+// strength_match: any requirement is replaced by tool_use alone.
+func RequireToolUse(cl Classification) Classification {
+	if cl.StrengthMatch == "any" {
+		cl.RequiredStrengths = nil
+		cl.StrengthMatch = ""
+	}
+	for _, s := range cl.RequiredStrengths {
+		if s == ToolUseStrength {
+			return cl
+		}
+	}
+	// Copy so the task's configured strengths slice is never appended to.
+	strengths := make([]string, 0, len(cl.RequiredStrengths)+1)
+	cl.RequiredStrengths = append(append(strengths, cl.RequiredStrengths...), ToolUseStrength)
+	return cl
 }
 
-// detectRouteClass applies a three-priority decision:
+// detectRouteClass applies a six-priority decision:
 //  1. Explicit x-request-type header value matched against configured headers.
-//  2. Content patterns matched against the prompt text.
-//  3. Default to "interactive".
+//  2. CLI flags (see SetFlags) matched against configured flags.
+//  3. Environment variables matched against configured env entries, when
+//     enabled with SetEnv.
+//  4. Piped stdin (see SetStdinPiped) matched against stdin: false.
+//  5. Content patterns matched against the prompt text.
+//  6. Default to "interactive".
 func (c *Classifier) detectRouteClass(prompt string, headers map[string]string) string {
+	name, _ := c.detectRouteClassWithReason(prompt, headers)
+	return name
+}
+
+// detectRouteClassFromHeader is detectRouteClass, additionally reporting
+// whether the route class was chosen by an explicit x-request-type header.
+func (c *Classifier) detectRouteClassFromHeader(prompt string, headers map[string]string) (string, bool) {
+	if name, ok := c.headerRouteClass(headers); ok {
+		return name, true
+	}
+	return c.detectRouteClass(prompt, headers), false
+}
+
+// headerRouteClass returns the route class selected by the x-request-type
+// header, if any. The value must equal, ignoring case, one of a class's
+// detection headers or, failing that, a route class name.
+func (c *Classifier) headerRouteClass(headers map[string]string) (string, bool) {
+	rt := strings.TrimSpace(headers["x-request-type"])
+	if rt == "" {
+		return "", false
+	}
+	names := c.sortedRouteClasses()
+	for _, name := range names {
+		for _, h := range c.cfg.RouteClasses[name].Detection.Headers {
+			if value, ok := requestTypeValue(h); ok && strings.EqualFold(value, rt) {
+				return name, true
+			}
+		}
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, rt) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// requestTypeValue parses a detection headers entry, either
+// "x-request-type: value" or a bare "value", returning the x-request-type
+// value it matches. Entries naming any other header report false.
+func requestTypeValue(entry string) (string, bool) {
+	header, value, found := strings.Cut(entry, ":")
+	if !found {
+		return strings.TrimSpace(entry), true
+	}
+	if !strings.EqualFold(strings.TrimSpace(header), "x-request-type") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+// detectRouteClassWithReason is detectRouteClass, additionally describing
+// which rule selected the route class.
+func (c *Classifier) detectRouteClassWithReason(prompt string, headers map[string]string) (string, string) {
 	// Priority 1: explicit header wins.
-	if rt, ok := headers["x-request-type"]; ok {
-		for name := range c.cfg.RouteClasses {
-			for _, h := range c.cfg.RouteClasses[name].Detection.Headers {
-				if strings.Contains(h, rt) {
-					return name
+	if name, ok := c.headerRouteClass(headers); ok {
+		return name, fmt.Sprintf("header x-request-type=%s", headers["x-request-type"])
+	}
+
+	// Priority 2: CLI flag match.
+	if len(c.flags) > 0 {
+		for _, name := range c.sortedRouteClasses() {
+			for _, flag := range c.cfg.RouteClasses[name].Detection.Flags {
+				if c.flags[strings.TrimLeft(flag, "-")] {
+					return name, "flag " + flag
+				}
+			}
+		}
+	}
+
+	// Priority 3: environment match.
+	if c.lookupEnv != nil {
+		for _, name := range c.sortedRouteClasses() {
+			for _, entry := range c.cfg.RouteClasses[name].Detection.Env {
+				if c.envMatches(entry) {
+					return name, "env " + entry
 				}
 			}
 		}
 	}
 
-	// Priority 2: content pattern match.
+	// Priority 4: piped stdin. A terminal selects nothing here, since
+	// interactive is already the default.
+	if c.stdinPiped {
+		for _, name := range c.sortedRouteClasses() {
+			if st := c.cfg.RouteClasses[name].Detection.Stdin; st != nil && !*st {
+				return name, "stdin piped"
+			}
+		}
+	}
+
+	// Priority 5: content pattern match.
 	for name, crp := range c.routePatterns {
 		for _, re := range crp.contentPatterns {
 			if re.MatchString(prompt) {
-				return name
+				return name, fmt.Sprintf("content pattern %q", patternSource(re))
 			}
 		}
 	}
 
-	// Priority 3: fall back to interactive.
-	return "interactive"
+	// Priority 6: fall back to interactive.
+	return "interactive", "default"
+}
+
+// sortedRouteClasses returns the configured route class names in order, so
+// detection rules that several classes could satisfy pick deterministically.
+func (c *Classifier) sortedRouteClasses() []string {
+	names := make([]string, 0, len(c.cfg.RouteClasses))
+	for name := range c.cfg.RouteClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envMatches reports whether a detection env entry holds: "NAME=value"
+// requires NAME to equal value, while a bare "NAME" requires it to be set to
+// a non-empty value.
+func (c *Classifier) envMatches(entry string) bool {
+	name, want, hasValue := strings.Cut(entry, "=")
+	got, ok := c.lookupEnv(strings.TrimSpace(name))
+	if !ok {
+		return false
+	}
+	if hasValue {
+		return got == strings.TrimSpace(want)
+	}
+	return got != ""
 }
 
 // detectTaskType scans all task patterns and returns the task name with the
-// most pattern hits, the required strengths for that task, and a confidence
-// score derived from the hit count. Defaults to "chat" with confidence 0.5
-// when no patterns match.
+// highest weighted pattern hit count, the required strengths for that task,
+// and a confidence score derived from the hit count. Each hit counts the
+// task's weight (1 when unset); ties go to the task whose name sorts first.
+// Defaults to "chat" with confidence 0.5 when no patterns match.
 func (c *Classifier) detectTaskType(prompt string) (string, []string, float64) {
 	bestType := "chat"
 	bestCount := 0
+	bestScore := 0.0
 	var bestStrengths []string
 
-	for name, patterns := range c.taskPatterns {
+	names := make([]string, 0, len(c.taskPatterns))
+	for name := range c.taskPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
 		count := 0
-		for _, re := range patterns {
+		for _, re := range c.taskPatterns[name] {
 			if re.MatchString(prompt) {
 				count++
 			}
 		}
-		if count > bestCount {
+		weight := 1.0
+		if task, ok := c.cfg.Tasks[name]; ok && task.Weight > 0 {
+			weight = task.Weight
+		}
+		if score := float64(count) * weight; score > bestScore {
+			bestScore = score
 			bestCount = count
 			bestType = name
-			if task, ok := c.cfg.Tasks[name]; ok {
-				bestStrengths = task.RequiredStrengths
-			}
+			bestStrengths = c.cfg.Tasks[name].RequiredStrengths
 		}
 	}
 
@@ -162,3 +609,17 @@ func (c *Classifier) detectTaskType(prompt string) (string, []string, float64) {
 
 	return bestType, bestStrengths, confidence
 }
+
+// backendTask looks up the required strengths of the task type a
+// TaskBackend returned. A backend error or an unknown task name yields the
+// same "chat" default the regex path uses when nothing matches.
+func (c *Classifier) backendTask(taskType string, confidence float64, err error) (string, []string, float64) {
+	if err != nil {
+		return "chat", nil, 0.5
+	}
+	task, ok := c.cfg.Tasks[taskType]
+	if !ok {
+		return "chat", nil, 0.5
+	}
+	return taskType, task.RequiredStrengths, confidence
+}
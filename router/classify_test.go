@@ -1,12 +1,15 @@
 package router
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jbctechsolutions/sr-router/config"
 )
 
-func loadTestConfig(t *testing.T) *config.Config {
+func loadTestConfig(t testing.TB) *config.Config {
 	t.Helper()
 	cfg, err := config.Load("../config")
 	if err != nil {
@@ -41,6 +44,77 @@ func TestClassifyTaskType(t *testing.T) {
 	}
 }
 
+func TestClassifyCodeReviewOverCode(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	tests := []struct {
+		prompt   string
+		wantType string
+	}{
+		{"Review this PR before I merge it", "code_review"},
+		{"Do a code review of the auth package", "code_review"},
+		// Matches code ("refactor") and code_review ("review.*code") once
+		// each; code_review's weight breaks the tie.
+		{"Review the code in this refactor", "code_review"},
+		{"Write a function that validates tokens", "code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			result := c.Classify(tt.prompt, nil)
+			if result.TaskType != tt.wantType {
+				t.Errorf("got task type %q, want %q", result.TaskType, tt.wantType)
+			}
+			if tt.wantType == "code_review" && result.MinQuality < cfg.Tasks["code_review"].MinQuality {
+				t.Errorf("min quality %v, want at least code_review's %v", result.MinQuality, cfg.Tasks["code_review"].MinQuality)
+			}
+		})
+	}
+}
+
+func TestDetectTaskTypeWeight(t *testing.T) {
+	cfg := &config.Config{Tasks: map[string]config.TaskSpec{
+		"code":        {Patterns: []string{"refactor", "fix.*bug"}, RequiredStrengths: []string{"code"}},
+		"code_review": {Patterns: []string{"review"}, RequiredStrengths: []string{"code_review"}},
+	}}
+	prompt := "Review this refactor"
+
+	// Equal hits and no weights: the tie goes to the first name.
+	if got, _, _ := NewClassifier(cfg).detectTaskType(prompt); got != "code" {
+		t.Errorf("unweighted tie = %q, want code", got)
+	}
+
+	review := cfg.Tasks["code_review"]
+	review.Weight = 1.5
+	cfg.Tasks["code_review"] = review
+	c := NewClassifier(cfg)
+	if got, strengths, _ := c.detectTaskType(prompt); got != "code_review" || strings.Join(strengths, ",") != "code_review" {
+		t.Errorf("weighted = %q %v, want code_review [code_review]", got, strengths)
+	}
+	// Two code hits outweigh one weighted review hit.
+	if got, _, _ := c.detectTaskType("Review this refactor and fix the bug"); got != "code" {
+		t.Errorf("more code hits = %q, want code", got)
+	}
+}
+
+func TestClassifyTaskMatchesPromptClassification(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	fromPrompt := c.Classify("Write a Go function for rate limiting", nil)
+	fromTask := c.ClassifyTask("code", "")
+	if fromTask.RouteClass != fromPrompt.RouteClass || fromTask.Tier != fromPrompt.Tier ||
+		fromTask.MinQuality != fromPrompt.MinQuality ||
+		strings.Join(fromTask.RequiredStrengths, ",") != strings.Join(fromPrompt.RequiredStrengths, ",") {
+		t.Errorf("ClassifyTask(code) = %+v, want the requirements of a code prompt %+v", fromTask, fromPrompt)
+	}
+
+	bg := c.ClassifyTask("code", "background")
+	if bg.RouteClass != "background" || bg.Tier != cfg.RouteClasses["background"].DefaultTier {
+		t.Errorf("ClassifyTask(code, background) = %+v, want the background class", bg)
+	}
+}
+
 func TestClassifyRouteClass(t *testing.T) {
 	cfg := loadTestConfig(t)
 	c := NewClassifier(cfg)
@@ -62,6 +136,160 @@ func TestClassifyRouteClassFromHeaders(t *testing.T) {
 	}
 }
 
+func TestClassifyRouteClassHeaderExactMatch(t *testing.T) {
+	cfg := loadTestConfig(t)
+	bg := cfg.RouteClasses["background"]
+	bg.Detection.Headers = append(bg.Detection.Headers, "batch")
+	cfg.RouteClasses["background"] = bg
+	c := NewClassifier(cfg)
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"chat", "interactive"},
+		{"Background", "background"},
+		{" compaction ", "compaction"},
+		{"batch", "background"},        // bare value entry
+		{"interactive", "interactive"}, // route class name
+		// Substrings of a configured entry used to match; they no longer do.
+		{"back", "interactive"},
+		{"x-request-type", "interactive"},
+		{"c", "interactive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			// "Write a Go function" would otherwise be interactive, so
+			// a non-matching header falls through to the default.
+			got := c.Classify("Write a Go function", map[string]string{"x-request-type": tt.value})
+			if got.RouteClass != tt.want {
+				t.Errorf("x-request-type %q: got %s, want %s", tt.value, got.RouteClass, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireToolUse(t *testing.T) {
+	task := []string{"code"}
+	cl := RequireToolUse(Classification{RequiredStrengths: task})
+	if strings.Join(cl.RequiredStrengths, ",") != "code,tool_use" {
+		t.Errorf("strengths = %v, want [code tool_use]", cl.RequiredStrengths)
+	}
+	if len(task) != 1 {
+		t.Errorf("the task's strengths were modified: %v", task)
+	}
+	if again := RequireToolUse(cl); len(again.RequiredStrengths) != 2 {
+		t.Errorf("tool_use added twice: %v", again.RequiredStrengths)
+	}
+
+	// tool_use cannot be one of several alternatives.
+	cl = RequireToolUse(Classification{RequiredStrengths: []string{"code", "simple_code"}, StrengthMatch: "any"})
+	if strings.Join(cl.RequiredStrengths, ",") != "tool_use" || cl.StrengthMatch != "" {
+		t.Errorf("got strengths %v match %q, want only tool_use", cl.RequiredStrengths, cl.StrengthMatch)
+	}
+}
+
+// mapEnv returns a lookup function over env, standing in for os.LookupEnv.
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestClassifyRouteClassFromEnv(t *testing.T) {
+	cfg := loadTestConfig(t)
+	bg := cfg.RouteClasses["background"]
+	bg.Detection.Env = append(bg.Detection.Env, "BATCH_JOB")
+	cfg.RouteClasses["background"] = bg
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"name=value matches", map[string]string{"SKILLRUNNER_MODE": "background"}, "background"},
+		{"name=value needs the value", map[string]string{"SKILLRUNNER_MODE": "interactive"}, "interactive"},
+		{"bare name set", map[string]string{"BATCH_JOB": "1"}, "background"},
+		{"bare name empty", map[string]string{"BATCH_JOB": ""}, "interactive"},
+		{"unset", nil, "interactive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClassifier(cfg)
+			c.SetEnv(mapEnv(tt.env))
+			if got := c.Classify("Write a Go function", nil); got.RouteClass != tt.want {
+				t.Errorf("route class = %s, want %s", got.RouteClass, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyEnvPriority(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+	c.SetEnv(mapEnv(map[string]string{"SKILLRUNNER_MODE": "background"}))
+
+	// An explicit header still wins over the environment.
+	if got := c.Classify("Write a Go function", map[string]string{"x-request-type": "compaction"}); got.RouteClass != "compaction" {
+		t.Errorf("header: route class = %s, want compaction", got.RouteClass)
+	}
+	// The environment wins over content patterns.
+	if got := c.Classify("Please summarize this conversation history", nil); got.RouteClass != "background" {
+		t.Errorf("content: route class = %s, want background", got.RouteClass)
+	}
+	if reason := c.Explain("Write a Go function", nil).RouteClassReason; reason != "env SKILLRUNNER_MODE=background" {
+		t.Errorf("reason = %q, want the matching env entry", reason)
+	}
+}
+
+func TestClassifyIgnoresEnvByDefault(t *testing.T) {
+	t.Setenv("SKILLRUNNER_MODE", "background")
+	c := NewClassifier(loadTestConfig(t))
+	if got := c.Classify("Write a Go function", nil); got.RouteClass != "interactive" {
+		t.Errorf("route class = %s, want interactive without SetEnv", got.RouteClass)
+	}
+}
+
+func TestClassifyRouteClassFromFlag(t *testing.T) {
+	c := NewClassifier(loadTestConfig(t))
+	c.SetFlags([]string{"--bg"})
+
+	if got := c.Classify("Write a Go function", nil); got.RouteClass != "background" {
+		t.Errorf("route class = %s, want background for --bg", got.RouteClass)
+	}
+	if reason := c.Explain("Write a Go function", nil).RouteClassReason; reason != "flag --bg" {
+		t.Errorf("reason = %q, want flag --bg", reason)
+	}
+
+	c.SetFlags([]string{"--json"})
+	if got := c.Classify("Write a Go function", nil); got.RouteClass != "interactive" {
+		t.Errorf("unrelated flag: route class = %s, want interactive", got.RouteClass)
+	}
+}
+
+func TestClassifyStdinPiped(t *testing.T) {
+	c := NewClassifier(loadTestConfig(t))
+	c.SetStdinPiped(true)
+
+	got := c.Classify("Write a Go function", nil)
+	if got.RouteClass != "background" {
+		t.Errorf("route class = %s, want background for piped stdin", got.RouteClass)
+	}
+	if reason := c.Explain("Write a Go function", nil).RouteClassReason; reason != "stdin piped" {
+		t.Errorf("reason = %q, want stdin piped", reason)
+	}
+	// An explicit header still wins over stdin.
+	if got := c.Classify("Write a Go function", map[string]string{"x-request-type": "chat"}); got.RouteClass != "interactive" {
+		t.Errorf("header: route class = %s, want interactive", got.RouteClass)
+	}
+
+	c.SetStdinPiped(false)
+	if got := c.Classify("Write a Go function", nil); got.RouteClass != "interactive" {
+		t.Errorf("terminal: route class = %s, want interactive", got.RouteClass)
+	}
+}
+
 func TestClassifySetsTierFromRouteClass(t *testing.T) {
 	cfg := loadTestConfig(t)
 	c := NewClassifier(cfg)
@@ -96,3 +324,187 @@ func TestClassifyMinQualityFromTask(t *testing.T) {
 		t.Errorf("expected min_quality 0.90 for architecture, got %.2f", result.MinQuality)
 	}
 }
+
+func TestClassifyHeaderRouteClassBoostsQualityFloor(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	// Forcing interactive by header raises summarization's 0.50 minimum to
+	// interactive's 0.85 floor.
+	result := c.Classify("Summarize this document", map[string]string{"x-request-type": "chat"})
+	if result.RouteClass != "interactive" || result.MinQuality != 0.85 {
+		t.Errorf("got class %s min_quality %.2f, want interactive 0.85", result.RouteClass, result.MinQuality)
+	}
+
+	// A task minimum above the class floor is kept.
+	result = c.Classify("Design a microservice architecture", map[string]string{"x-request-type": "chat"})
+	if result.MinQuality != 0.90 {
+		t.Errorf("expected min_quality 0.90 for architecture, got %.2f", result.MinQuality)
+	}
+}
+
+func TestClassifyDetectedRouteClassDoesNotBoostQualityFloor(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+	c.SetEnv(mapEnv(map[string]string{"SKILLRUNNER_MODE": "background"}))
+
+	// Background chosen from the environment keeps summarization's 0.50
+	// minimum rather than background's 0.60 floor.
+	result := c.Classify("Summarize this document", nil)
+	if result.RouteClass != "background" || result.MinQuality != 0.50 {
+		t.Errorf("got class %s min_quality %.2f, want background 0.50", result.RouteClass, result.MinQuality)
+	}
+
+	// The same class forced by header applies its floor.
+	result = c.Classify("Summarize this document", map[string]string{"x-request-type": "background"})
+	if result.MinQuality != 0.60 {
+		t.Errorf("expected min_quality 0.60 with a header, got %.2f", result.MinQuality)
+	}
+}
+
+func TestClassifierReload(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.ClassificationCacheSize = 16
+	c := NewClassifier(cfg)
+
+	const prompt = "Write a limerick about goroutines"
+	if got := c.Classify(prompt, nil); got.TaskType == "poetry" {
+		t.Fatalf("unexpected poetry task before reload")
+	}
+
+	reloaded := loadTestConfig(t)
+	reloaded.Defaults.ClassificationCacheSize = 16
+	reloaded.Tasks["poetry"] = config.TaskSpec{
+		Patterns:          []string{"limerick", "haiku"},
+		RequiredStrengths: []string{"creative"},
+		MinQuality:        0.65,
+	}
+	if err := c.Reload(reloaded); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	// The earlier result was cached; Reload must drop it.
+	got := c.Classify(prompt, nil)
+	if got.TaskType != "poetry" || got.MinQuality != 0.65 {
+		t.Errorf("after reload: got task %s min_quality %.2f, want poetry 0.65", got.TaskType, got.MinQuality)
+	}
+}
+
+func TestClassifierReloadRejectsInvalidPattern(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	bad := loadTestConfig(t)
+	bad.Tasks["broken"] = config.TaskSpec{Patterns: []string{"unclosed("}}
+	bad.Tasks["poetry"] = config.TaskSpec{Patterns: []string{"limerick"}}
+	if err := c.Reload(bad); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+
+	// The previous patterns stay in use.
+	if got := c.Classify("Write a limerick", nil); got.TaskType == "poetry" {
+		t.Error("a failed reload must not apply any of the new patterns")
+	}
+}
+
+func TestClassifyConversationLongBiasesRouting(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.LongConversation = config.LongConversationConfig{Turns: 10, MinQuality: 0.9}
+	c := NewClassifier(cfg)
+	r := NewRouter(cfg)
+
+	const prompt = "Summarize the key points of this thread"
+	short := c.ClassifyConversation(context.Background(), prompt, nil, 3, 200)
+	long := c.ClassifyConversation(context.Background(), prompt, nil, 12, 200)
+
+	if short.LongConversation {
+		t.Error("3-message conversation should not count as long")
+	}
+	if !long.LongConversation {
+		t.Fatal("12-message conversation should count as long")
+	}
+	if long.MinQuality != 0.9 {
+		t.Errorf("long conversation min quality = %.2f, want 0.90", long.MinQuality)
+	}
+
+	shortModel := r.Route(short).Model
+	longModel := r.Route(long).Model
+	if shortModel == longModel {
+		t.Errorf("short and long conversations both routed to %q", shortModel)
+	}
+	if q := cfg.Models[longModel].QualityCeiling; q < 0.9 {
+		t.Errorf("long conversation routed to %q with quality %.2f, want >= 0.90", longModel, q)
+	}
+}
+
+func TestClassifyConversationCharsThresholdAndTier(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.LongConversation = config.LongConversationConfig{Chars: 1000, Tier: "premium"}
+	c := NewClassifier(cfg)
+
+	if got := c.ClassifyConversation(context.Background(), "hi", nil, 2, 999); got.LongConversation {
+		t.Error("999 chars should not count as long")
+	}
+	got := c.ClassifyConversation(context.Background(), "hi", nil, 2, 1000)
+	if !got.LongConversation || got.Tier != "premium" {
+		t.Errorf("got long=%v tier=%q, want long conversation in premium", got.LongConversation, got.Tier)
+	}
+}
+
+func TestClassifyConversationDisabledByDefault(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	got := c.ClassifyConversation(context.Background(), "hi", nil, 500, 1_000_000)
+	want := c.Classify("hi", nil)
+	if got.LongConversation || got.MinQuality != want.MinQuality || got.Tier != want.Tier {
+		t.Errorf("got %+v, want unchanged %+v", got, want)
+	}
+}
+
+// startedBackend is a TaskBackend that signals each call on started and then
+// blocks until the call's context is done.
+type startedBackend struct {
+	started chan struct{}
+}
+
+func (b *startedBackend) DetectTask(ctx context.Context, _ string) (string, float64, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return "", 0, ctx.Err()
+}
+
+// TestClassifyContextReleasesLockDuringBackendCall verifies that a pending
+// task backend call neither blocks Reload nor outlives its request context.
+func TestClassifyContextReleasesLockDuringBackendCall(t *testing.T) {
+	cfg := loadTestConfig(t)
+	backend := &startedBackend{started: make(chan struct{})}
+	c := NewClassifierWithBackend(cfg, backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan Classification)
+	go func() { done <- c.ClassifyContext(ctx, "hello", nil) }()
+	<-backend.started
+
+	reloaded := make(chan error)
+	go func() { reloaded <- c.Reload(cfg) }()
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Reload blocked behind a pending backend call")
+	}
+
+	cancel()
+	select {
+	case cl := <-done:
+		if cl.TaskType != "chat" {
+			t.Errorf("TaskType = %q, want chat after the backend call was cancelled", cl.TaskType)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelling the context did not cancel the backend call")
+	}
+}
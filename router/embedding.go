@@ -0,0 +1,156 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// TaskBackend is a pluggable task-type detector. The regex patterns compiled
+// by Classifier are the built-in default; a TaskBackend replaces that layer-2
+// step while route-class detection stays pattern based.
+type TaskBackend interface {
+	// DetectTask returns the name of the best-matching task and a confidence
+	// in the range [0, 1].
+	DetectTask(ctx context.Context, prompt string) (string, float64, error)
+}
+
+// embeddingStartupTimeout bounds embedding every task example when
+// NewClassifierFromConfig builds the embedding backend, so a hung endpoint
+// delays startup by at most this long before classification falls back to
+// regex.
+const embeddingStartupTimeout = 30 * time.Second
+
+// EmbeddingBackend detects the task type by embedding the prompt and picking
+// the task whose example prompts are most similar (cosine similarity). Task
+// example embeddings are computed once at construction and cached.
+type EmbeddingBackend struct {
+	baseURL  string
+	model    string
+	examples map[string][][]float64
+	tasks    []string
+}
+
+// NewEmbeddingBackend builds an EmbeddingBackend from defaults.embedding and
+// embeds every task's examples up front. Tasks without examples are never
+// selected. An error is returned if the endpoint is unreachable, ctx ends
+// before every example is embedded, or no task defines any examples.
+func NewEmbeddingBackend(ctx context.Context, cfg *config.Config) (*EmbeddingBackend, error) {
+	ec := cfg.Defaults.Embedding
+	if ec.BaseURL == "" || ec.Model == "" {
+		return nil, fmt.Errorf("embedding classifier requires defaults.embedding.base_url and model")
+	}
+
+	b := &EmbeddingBackend{
+		baseURL:  strings.TrimRight(ec.BaseURL, "/"),
+		model:    ec.Model,
+		examples: make(map[string][][]float64),
+	}
+
+	for name, task := range cfg.Tasks {
+		for _, ex := range task.Examples {
+			vec, err := b.embed(ctx, ex)
+			if err != nil {
+				return nil, fmt.Errorf("embedding example for task %q: %w", name, err)
+			}
+			b.examples[name] = append(b.examples[name], vec)
+		}
+		if len(b.examples[name]) > 0 {
+			b.tasks = append(b.tasks, name)
+		}
+	}
+	if len(b.tasks) == 0 {
+		return nil, fmt.Errorf("embedding classifier requires at least one task with examples")
+	}
+
+	// Sorted task order makes ties resolve deterministically.
+	sort.Strings(b.tasks)
+	return b, nil
+}
+
+// DetectTask embeds prompt and returns the task with the highest cosine
+// similarity to any of its examples. The similarity, clamped to [0, 1], is
+// used as the confidence.
+func (b *EmbeddingBackend) DetectTask(ctx context.Context, prompt string) (string, float64, error) {
+	vec, err := b.embed(ctx, prompt)
+	if err != nil {
+		return "", 0, err
+	}
+
+	bestTask := ""
+	bestSim := math.Inf(-1)
+	for _, name := range b.tasks {
+		for _, ex := range b.examples[name] {
+			if sim := cosineSimilarity(vec, ex); sim > bestSim {
+				bestSim = sim
+				bestTask = name
+			}
+		}
+	}
+
+	return bestTask, math.Max(0, math.Min(1, bestSim)), nil
+}
+
+// embed calls the /api/embeddings endpoint and returns the vector for text.
+func (b *EmbeddingBackend) embed(ctx context.Context, text string) ([]float64, error) {
+	data, err := json.Marshal(map[string]string{
+		"model":  b.model,
+		"prompt": text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling embeddings request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/api/embeddings", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("creating embeddings request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("embeddings endpoint returned %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Embedding []float64 `json:"embedding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding embeddings response: %w", err)
+	}
+	if len(out.Embedding) == 0 {
+		return nil, fmt.Errorf("embeddings endpoint returned an empty vector")
+	}
+	return out.Embedding, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b. Vectors
+// of different length or zero magnitude have similarity 0.
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,200 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// stubEmbeddingServer returns an httptest.Server that mimics Ollama's
+// /api/embeddings endpoint with deterministic vectors: code-flavoured text
+// points along the first axis, summary-flavoured text along the second, and
+// everything else along the third. calls counts embedding requests.
+func stubEmbeddingServer(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(calls, 1)
+
+		var req struct {
+			Model  string `json:"model"`
+			Prompt string `json:"prompt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lower := strings.ToLower(req.Prompt)
+		vec := []float64{0, 0, 1}
+		switch {
+		case strings.Contains(lower, "function") || strings.Contains(lower, "bug"):
+			vec = []float64{1, 0.1, 0}
+		case strings.Contains(lower, "summar") || strings.Contains(lower, "key points"):
+			vec = []float64{0.1, 1, 0}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embedding": vec}) //nolint:errcheck
+	}))
+}
+
+// embeddingTestConfig builds a config with three tasks that each carry
+// example prompts, pointed at baseURL for embeddings.
+func embeddingTestConfig(baseURL string) *config.Config {
+	return &config.Config{
+		Defaults: config.Defaults{
+			Classifier: "embedding",
+			Embedding:  config.EmbeddingConfig{BaseURL: baseURL, Model: "stub-embed"},
+		},
+		Tasks: map[string]config.TaskSpec{
+			"code": {
+				Examples:          []string{"Write a function", "Fix this bug"},
+				RequiredStrengths: []string{"code"},
+				MinQuality:        0.8,
+			},
+			"summarization": {
+				Examples:          []string{"Summarize this", "List the key points"},
+				RequiredStrengths: []string{"summarization"},
+				MinQuality:        0.5,
+			},
+			"chat": {
+				Examples:   []string{"Hello there"},
+				MinQuality: 0.7,
+			},
+		},
+		RouteClasses: map[string]config.RouteClass{
+			"interactive": {DefaultTier: "premium", QualityFloor: 0.85},
+		},
+	}
+}
+
+func TestEmbeddingBackendCachesExamples(t *testing.T) {
+	var calls int32
+	srv := stubEmbeddingServer(t, &calls)
+	defer srv.Close()
+
+	cfg := embeddingTestConfig(srv.URL)
+	c, err := NewClassifierFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewClassifierFromConfig: %v", err)
+	}
+
+	// Five examples are embedded once at startup.
+	if got := atomic.LoadInt32(&calls); got != 5 {
+		t.Fatalf("expected 5 example embeddings at startup, got %d", got)
+	}
+
+	c.Classify("please summarize this report", nil)
+	c.Classify("write a function to sort a list", nil)
+
+	// Each Classify embeds only the prompt.
+	if got := atomic.LoadInt32(&calls); got != 7 {
+		t.Errorf("expected 7 embedding calls after two classifications, got %d", got)
+	}
+}
+
+func TestEmbeddingBackendSelectsNearestTask(t *testing.T) {
+	var calls int32
+	srv := stubEmbeddingServer(t, &calls)
+	defer srv.Close()
+
+	c, err := NewClassifierFromConfig(embeddingTestConfig(srv.URL))
+	if err != nil {
+		t.Fatalf("NewClassifierFromConfig: %v", err)
+	}
+
+	tests := []struct {
+		prompt        string
+		wantType      string
+		wantStrengths []string
+	}{
+		// None of these would match the regex patterns in tasks.yaml.
+		{"There is a bug when the list is empty", "code", []string{"code"}},
+		{"Can you summarise the meeting notes?", "summarization", []string{"summarization"}},
+		{"Good morning!", "chat", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			result := c.Classify(tt.prompt, nil)
+			if result.TaskType != tt.wantType {
+				t.Errorf("got task type %q, want %q", result.TaskType, tt.wantType)
+			}
+			if strings.Join(result.RequiredStrengths, ",") != strings.Join(tt.wantStrengths, ",") {
+				t.Errorf("got strengths %v, want %v", result.RequiredStrengths, tt.wantStrengths)
+			}
+			if result.Confidence <= 0 || result.Confidence > 1 {
+				t.Errorf("confidence %f out of range (0, 1]", result.Confidence)
+			}
+		})
+	}
+}
+
+func TestNewClassifierFromConfigDefaultsToRegex(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.Classifier = ""
+
+	c, err := NewClassifierFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewClassifierFromConfig: %v", err)
+	}
+	if c.backend != nil {
+		t.Error("expected regex classifier with no backend")
+	}
+	if got := c.Classify("Write a Go function for rate limiting", nil).TaskType; got != "code" {
+		t.Errorf("got task type %q, want %q", got, "code")
+	}
+}
+
+func TestNewClassifierFromConfigUnknownBackend(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Defaults.Classifier = "telepathy"
+
+	if _, err := NewClassifierFromConfig(cfg); err == nil {
+		t.Error("expected error for unknown classifier backend")
+	}
+}
+
+func TestNewEmbeddingBackendGivesUpOnHungEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewEmbeddingBackend(ctx, embeddingTestConfig(srv.URL)); err == nil {
+		t.Fatal("expected an error from a hung embeddings endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("NewEmbeddingBackend took %v to give up, want about the context timeout", elapsed)
+	}
+}
+
+func TestNewEmbeddingBackendRequiresExamples(t *testing.T) {
+	var calls int32
+	srv := stubEmbeddingServer(t, &calls)
+	defer srv.Close()
+
+	cfg := embeddingTestConfig(srv.URL)
+	cfg.Tasks = map[string]config.TaskSpec{"code": {Patterns: []string{"function"}}}
+
+	if _, err := NewEmbeddingBackend(context.Background(), cfg); err == nil {
+		t.Error("expected error when no task defines examples")
+	}
+}
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Explanation describes how a prompt was classified, for debugging output.
+type Explanation struct {
+	// RouteClassReason names the rule that selected the route class: the
+	// x-request-type header, an env entry, a content pattern, or the default.
+	RouteClassReason string
+
+	// TaskMatches maps each task with at least one matching pattern to the
+	// patterns that matched. It is empty when a non-regex backend is in use.
+	TaskMatches map[string][]string
+}
+
+// Explain reports why Classify would classify prompt the way it does. It
+// does not call the task backend, so it is cheap to run alongside Classify.
+func (c *Classifier) Explain(prompt string, headers map[string]string) Explanation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, reason := c.detectRouteClassWithReason(prompt, headers)
+	e := Explanation{
+		RouteClassReason: reason,
+		TaskMatches:      make(map[string][]string),
+	}
+	if c.backend != nil {
+		return e
+	}
+	for name, patterns := range c.taskPatterns {
+		for _, re := range patterns {
+			if re.MatchString(prompt) {
+				e.TaskMatches[name] = append(e.TaskMatches[name], patternSource(re))
+			}
+		}
+	}
+	return e
+}
+
+// patternSource returns the configured pattern text, without the
+// case-insensitivity flag added at compile time.
+func patternSource(re *regexp.Regexp) string {
+	return strings.TrimPrefix(re.String(), "(?i)")
+}
+
+// CandidateScore is one model's standing in a routing decision.
+type CandidateScore struct {
+	Model        string
+	Score        float64
+	CostScore    float64
+	QualityScore float64
+
+	// Excluded explains why the model was filtered out before scoring, or
+	// is "" for qualifying models.
+	Excluded string
+}
+
+// ScoreCandidates scores every configured model against class as Route
+// does, including the models Route would exclude. Qualifying models come
+// first by descending score, followed by excluded models by name.
+func (r *Router) ScoreCandidates(class Classification) []CandidateScore {
+	maxCost := r.maxCost()
+	scores := make([]CandidateScore, 0, len(r.cfg.Models))
+	for name, m := range r.cfg.Models {
+		total, costScore, qualityScore := r.score(m, maxCost)
+		scores = append(scores, CandidateScore{
+			Model:        name,
+			Score:        total,
+			CostScore:    costScore,
+			QualityScore: qualityScore,
+			Excluded:     exclusionReason(m, class),
+		})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		a, b := scores[i], scores[j]
+		if (a.Excluded == "") != (b.Excluded == "") {
+			return a.Excluded == ""
+		}
+		if a.Excluded == "" && a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Model < b.Model
+	})
+	return scores
+}
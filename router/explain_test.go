@@ -0,0 +1,47 @@
+package router
+
+import "testing"
+
+func TestClassifierExplain(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+
+	e := c.Explain("Write a Go function for rate limiting", nil)
+	if e.RouteClassReason != "default" {
+		t.Errorf("route class reason = %q, want default", e.RouteClassReason)
+	}
+	if len(e.TaskMatches["code"]) == 0 {
+		t.Errorf("expected code patterns to match, got %v", e.TaskMatches)
+	}
+
+	e = c.Explain("anything", map[string]string{"x-request-type": "background"})
+	if e.RouteClassReason != "header x-request-type=background" {
+		t.Errorf("route class reason = %q, want the header", e.RouteClassReason)
+	}
+}
+
+func TestRouterScoreCandidatesMatchesRoute(t *testing.T) {
+	cfg := loadTestConfig(t)
+	r := NewRouter(cfg)
+	class := Classification{TaskType: "code", MinQuality: 0.8, RequiredStrengths: []string{"code"}}
+
+	scores := r.ScoreCandidates(class)
+	if len(scores) != len(cfg.Models) {
+		t.Fatalf("expected a score for all %d models, got %d", len(cfg.Models), len(scores))
+	}
+	if scores[0].Model != r.Route(class).Model || scores[0].Excluded != "" {
+		t.Errorf("top candidate %+v does not match Route's choice", scores[0])
+	}
+
+	seenExcluded := false
+	for _, s := range scores {
+		if s.Excluded != "" {
+			seenExcluded = true
+		} else if seenExcluded {
+			t.Errorf("qualifying model %s listed after an excluded model", s.Model)
+		}
+	}
+	if !seenExcluded {
+		t.Error("expected some models to be excluded by the 0.8 quality floor")
+	}
+}
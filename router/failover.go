@@ -1,15 +1,31 @@
 package router
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"time"
 
 	"github.com/jbctechsolutions/sr-router/config"
 	"github.com/jbctechsolutions/sr-router/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerName identifies spans created by this package.
+const tracerName = "github.com/jbctechsolutions/sr-router/router"
+
+// CallFunc sends req to model and returns the provider's response. It is
+// the engine's only point of contact with the network.
+type CallFunc func(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error)
+
 // FailoverEngine executes provider calls with cascading failover across the
 // model chain defined for a tier. It records failover events in telemetry when
 // a model other than the first in the chain ultimately handles the request.
@@ -17,13 +33,59 @@ type FailoverEngine struct {
 	cfg       *config.Config
 	router    *Router
 	telemetry *telemetry.Collector
+	limiter   *providerLimiter
+	callFunc  CallFunc
+
+	// bodyPatterns holds each tier's compiled retry_on_body_patterns.
+	bodyPatterns map[string][]*regexp.Regexp
 }
 
 // NewFailoverEngine returns a FailoverEngine wired to the given config,
-// router (for prompt suffix injection), and optional telemetry collector.
-// Pass nil for tel to disable telemetry recording.
+// router (for prompt prefix and suffix injection), and optional telemetry
+// collector. Pass nil for tel to disable telemetry recording. Per-provider
+// rate limits from cfg.Providers are shared by every request through the
+// engine.
 func NewFailoverEngine(cfg *config.Config, router *Router, tel *telemetry.Collector) *FailoverEngine {
-	return &FailoverEngine{cfg: cfg, router: router, telemetry: tel}
+	f := &FailoverEngine{
+		cfg:          cfg,
+		router:       router,
+		telemetry:    tel,
+		limiter:      newProviderLimiter(cfg),
+		callFunc:     callProvider,
+		bodyPatterns: make(map[string][]*regexp.Regexp),
+	}
+	for tier, spec := range cfg.Failover {
+		for _, p := range spec.RetryOnBodyPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("failover: ignoring invalid retry_on_body_patterns entry %q for %s: %v", p, tier, err)
+				continue
+			}
+			f.bodyPatterns[tier] = append(f.bodyPatterns[tier], re)
+		}
+	}
+	return f
+}
+
+// KeepRateLimits makes f share prev's rate-limit budgets for every provider
+// endpoint whose limits are the same in both configs. Call it on the
+// engine built for a reloaded config, before it handles any request, so the
+// reload does not reset or double the limits.
+func (f *FailoverEngine) KeepRateLimits(prev *FailoverEngine) {
+	if prev == nil {
+		return
+	}
+	f.limiter.keep(prev.limiter)
+}
+
+// SetCallFunc replaces the function used to reach providers, so a failover
+// chain can be exercised against canned responses without real HTTP calls.
+// Passing nil restores the real provider calls.
+func (f *FailoverEngine) SetCallFunc(fn CallFunc) {
+	if fn == nil {
+		fn = callProvider
+	}
+	f.callFunc = fn
 }
 
 // ExecuteWithFailover builds a failover chain from the routing decision — the
@@ -39,35 +101,120 @@ func NewFailoverEngine(cfg *config.Config, router *Router, tel *telemetry.Collec
 // returned immediately so the caller can surface the original provider error.
 //
 // When a network-level error occurs the engine logs it and continues to the
-// next model in the chain.
+// next model in the chain. A model whose provider is unknown (a typo in
+// models.yaml, say) is skipped the same way, without counting as an attempt.
+//
+// For non-streaming requests, a 2xx response whose body matches one of the
+// tier's failover.retry_on_body_patterns is also treated as retryable. Up to
+// retryBodyPeekBytes of the body are inspected; the body handed back to the
+// caller is unchanged.
+//
+// Before each call the provider's rate limit (if any) is consulted. If a
+// request slot is not available within the decision's remaining latency
+// budget, that model is skipped so a model from another provider can serve
+// the request; otherwise the engine waits for the slot.
+//
+// The context is checked before every attempt; once it is cancelled the
+// engine returns ctx.Err() without trying further models.
+//
+// When defaults.max_failover_attempts is positive, at most that many provider
+// calls are made; models skipped for rate limiting or an unknown provider do
+// not count.
 //
 // If all models in the chain are exhausted without a successful response,
 // ExecuteWithFailover returns a non-nil error describing the tier.
 func (f *FailoverEngine) ExecuteWithFailover(ctx context.Context, decision RoutingDecision, req ProviderRequest) (*http.Response, string, error) {
-	chain := f.buildChainFromDecision(decision)
+	return f.execute(ctx, decision, f.buildChainFromDecision(decision), req)
+}
+
+// ExecuteModel sends req to modelName alone, decorated and patched for that
+// model as ExecuteWithFailover would, but with nothing to fail over to. A
+// response with a non-retryable error status is returned as is. With no
+// latency budget, a rate-limited provider is not waited for: the call fails
+// unless a request slot is free right away.
+func (f *FailoverEngine) ExecuteModel(ctx context.Context, modelName string, req ProviderRequest) (*http.Response, error) {
+	resp, _, err := f.execute(ctx, RoutingDecision{Model: modelName}, []string{modelName}, req)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("%s returned no usable response: %w", modelName, err)
+	}
+	return resp, err
+}
+
+// execute tries each model in chain in turn; see ExecuteWithFailover.
+func (f *FailoverEngine) execute(ctx context.Context, decision RoutingDecision, chain []string, req ProviderRequest) (*http.Response, string, error) {
+	start := time.Now()
+	budget := time.Duration(decision.LatencyBudgetMs) * time.Millisecond
 
 	// Preserve the original raw body so each iteration patches from a clean
 	// copy, avoiding accumulated model-name or suffix mutations.
 	originalRawBody := req.RawAnthropicBody
+	originalSystem := req.SystemPrompt
+
+	if req.MaxTokensCap == 0 {
+		req.MaxTokensCap = f.cfg.Defaults.MaxTokensCap
+	}
+
+	maxAttempts := f.cfg.Defaults.MaxFailoverAttempts
+	attempts := 0
+	// lastErr records why the most recent model was passed over, so an
+	// exhausted chain reports its cause.
+	var lastErr error
 
 	for i, modelName := range chain {
+		// Stop immediately if the caller has gone away rather than trying
+		// further models on its behalf.
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		default:
+		}
+
+		if maxAttempts > 0 && attempts >= maxAttempts {
+			log.Printf("failover: attempt cap of %d reached, not trying %s", maxAttempts, modelName)
+			return nil, "", chainExhausted(decision.Tier, "attempt cap reached", lastErr)
+		}
+
 		model, ok := f.cfg.Models[modelName]
 		if !ok {
 			log.Printf("failover: model %q not found in config, skipping", modelName)
 			continue
 		}
 
-		// Inject the model-specific prompt suffix before each attempt so that
-		// each provider in the chain receives an appropriately decorated prompt.
-		req.SystemPrompt = f.router.InjectSuffix(modelName, req.SystemPrompt)
+		remaining := budget - time.Since(start)
+		wait, ok := f.limiter.reserve(rateLimitKey(model), remaining)
+		if !ok {
+			log.Printf("failover: %s rate limit reached for %s (wait %v exceeds budget), trying next in chain", model.Provider, modelName, wait)
+			lastErr = fmt.Errorf("%s: %s rate limit reached", modelName, model.Provider)
+			continue
+		}
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, "", ctx.Err()
+			}
+		}
+
+		// Inject the model-specific prompt prefix and suffix before each
+		// attempt, starting from the undecorated prompt, so that each provider
+		// in the chain receives only its own decoration.
+		req.SystemPrompt = f.router.InjectAffixes(modelName, originalSystem)
 
 		// For Anthropic providers with raw body available, patch the original
-		// body with this model's API name and suffix for direct passthrough
-		// (preserving tool_use, tool_result, images, etc.). Non-Anthropic
+		// body with this model's API name, prefix, and suffix for direct passthrough
+		// (preserving tool_use, tool_result, images, etc.). A JSON mode
+		// instruction rides along with the suffix. Non-Anthropic
 		// providers always use the normalised text path.
 		if len(originalRawBody) > 0 && model.Provider == "anthropic" {
-			suffix := getModelSuffix(f.cfg, modelName)
-			patched, patchErr := PatchAnthropicRawBody(originalRawBody, model.APIModel, suffix)
+			prefix := getModelPrefix(f.cfg, modelName)
+			suffix := joinPromptParts(getModelSuffix(f.cfg, modelName), jsonModeInstruction(req.ResponseFormat))
+			// The tighter of the model's output limit and the global cap
+			// bounds (and, when absent, supplies) the raw max_tokens.
+			limit := req.MaxTokensCap
+			if model.MaxOutputTokens > 0 && (limit <= 0 || model.MaxOutputTokens < limit) {
+				limit = model.MaxOutputTokens
+			}
+			patched, patchErr := PatchAnthropicRawBodyAffixes(originalRawBody, model.APIModel, prefix, suffix, limit)
 			if patchErr != nil {
 				log.Printf("failover: raw body patch failed for %s: %v, falling back to normalised", modelName, patchErr)
 				req.RawAnthropicBody = nil
@@ -78,15 +225,41 @@ func (f *FailoverEngine) ExecuteWithFailover(ctx context.Context, decision Routi
 			req.RawAnthropicBody = nil
 		}
 
-		resp, err := callProvider(ctx, model, req)
+		attempts++
+		resp, err := f.callWithSpan(ctx, modelName, model, req, attempts)
+		if errors.Is(err, ErrUnknownProvider) {
+			// Nothing was sent, so this does not use up an attempt.
+			attempts--
+			log.Printf("failover: %s has %v, skipping", modelName, err)
+			lastErr = fmt.Errorf("%s: %w", modelName, err)
+			continue
+		}
 		if err != nil {
 			log.Printf("failover: provider call failed for %s: %v", modelName, err)
+			lastErr = fmt.Errorf("%s: %w", modelName, err)
 			if i < len(chain)-1 {
 				log.Printf("failover: failing over from %s to %s", modelName, chain[i+1])
 			}
 			continue
 		}
 
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 && !req.Stream {
+			if pattern, err := matchBodyPatterns(resp, f.bodyPatterns[decision.Tier]); err != nil || pattern != "" {
+				resp.Body.Close()
+				if err != nil {
+					log.Printf("failover: reading %s response failed: %v, trying next in chain", modelName, err)
+					lastErr = fmt.Errorf("%s: %w", modelName, err)
+				} else {
+					log.Printf("failover: %s response matched retry pattern %q, trying next in chain", modelName, pattern)
+					lastErr = fmt.Errorf("%s: response matched retry pattern %q", modelName, pattern)
+				}
+				if i < len(chain)-1 {
+					log.Printf("failover: failing over from %s to %s", modelName, chain[i+1])
+				}
+				continue
+			}
+		}
+
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 			// Success — record a failover event in telemetry when we did not
 			// use the primary model.
@@ -101,6 +274,7 @@ func (f *FailoverEngine) ExecuteWithFailover(ctx context.Context, decision Routi
 		if isRetryableStatus(resp.StatusCode) {
 			resp.Body.Close()
 			log.Printf("failover: %s returned %d, trying next in chain", modelName, resp.StatusCode)
+			lastErr = fmt.Errorf("%s: status %d", modelName, resp.StatusCode)
 			if i < len(chain)-1 {
 				log.Printf("failover: failing over from %s to %s", modelName, chain[i+1])
 			}
@@ -112,17 +286,93 @@ func (f *FailoverEngine) ExecuteWithFailover(ctx context.Context, decision Routi
 		return resp, modelName, nil
 	}
 
-	return nil, "", fmt.Errorf("all models in %s chain exhausted", decision.Tier)
+	return nil, "", chainExhausted(decision.Tier, "", lastErr)
+}
+
+// chainExhausted returns the error for a failover chain in tier that ran out
+// of models, with an optional reason and wrapping cause, the error that
+// passed over the last model tried.
+func chainExhausted(tier, reason string, cause error) error {
+	msg := fmt.Sprintf("all models in %s chain exhausted", tier)
+	if reason != "" {
+		msg += " (" + reason + ")"
+	}
+	if cause == nil {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s: %w", msg, cause)
+}
+
+// callWithSpan calls the provider inside a "provider.call" trace span that
+// records the model, provider, attempt number, and response status code.
+func (f *FailoverEngine) callWithSpan(ctx context.Context, modelName string, model config.Model, req ProviderRequest, attempt int) (*http.Response, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "provider.call", trace.WithAttributes(
+		attribute.String("sr.model", modelName),
+		attribute.String("sr.provider", model.Provider),
+		attribute.Int("sr.attempt", attempt),
+	))
+	defer span.End()
+
+	resp, err := f.callFunc(ctx, model, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// retryBodyPeekBytes bounds how much of a response body is inspected for
+// retry_on_body_patterns.
+const retryBodyPeekBytes = 64 << 10
+
+// peekedBody replays the inspected prefix of a response body before the rest
+// of it, while closing the original body.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// matchBodyPatterns returns the source of the first pattern matching the
+// start of resp's body, or "" when none match. A gzip-encoded body is
+// decoded first, so patterns see the text the provider sent; the body is
+// then restored, decoded, so the caller can still read it in full.
+func matchBodyPatterns(resp *http.Response, patterns []*regexp.Regexp) (string, error) {
+	if len(patterns) == 0 {
+		return "", nil
+	}
+	if err := DecodeResponseBody(resp); err != nil {
+		return "", err
+	}
+	peeked, err := io.ReadAll(io.LimitReader(resp.Body, retryBodyPeekBytes))
+	resp.Body = peekedBody{io.MultiReader(bytes.NewReader(peeked), resp.Body), resp.Body}
+	if err != nil {
+		return "", err
+	}
+	for _, re := range patterns {
+		if re.Match(peeked) {
+			return re.String(), nil
+		}
+	}
+	return "", nil
 }
 
 // buildChainFromDecision constructs the failover chain: selected model first,
 // then alternatives sorted by score, then remaining models from the tier's
-// static chain, and finally the global fallback. Duplicates are removed.
+// static chain, and finally the global fallback. Duplicates and disabled
+// models are removed.
 func (f *FailoverEngine) buildChainFromDecision(d RoutingDecision) []string {
 	seen := make(map[string]bool)
 	var chain []string
 
 	add := func(name string) {
+		if f.cfg.Models[name].Disabled {
+			return
+		}
 		if name != "" && !seen[name] {
 			seen[name] = true
 			chain = append(chain, name)
@@ -142,7 +392,10 @@ func (f *FailoverEngine) buildChainFromDecision(d RoutingDecision) []string {
 		add(m)
 	}
 
-	// 4. Global fallback.
+	// 4. Global fallback chain, then the fallback model.
+	for _, m := range f.cfg.Defaults.FallbackChain {
+		add(m)
+	}
 	add(f.cfg.Defaults.FallbackModel)
 
 	return chain
@@ -1,11 +1,16 @@
 package router
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/jbctechsolutions/sr-router/config"
@@ -150,6 +155,136 @@ func TestExecuteWithFailover_FailoverOn429(t *testing.T) {
 	}
 }
 
+// TestExecuteWithFailover_SkipsUnknownProvider verifies that a model with a
+// misspelled provider in the middle of the chain is skipped, without using up
+// one of the max_failover_attempts, and the chain carries on.
+func TestExecuteWithFailover_SkipsUnknownProvider(t *testing.T) {
+	var called []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		called = append(called, body.Model)
+		if body.Model == "gpt-a" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"ok": "true"})
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptSuffix: &suffix},
+		"model-b": {Provider: "opanai_compat", APIModel: "gpt-b", BaseURL: srv.URL, PromptSuffix: &suffix},
+		"model-c": {Provider: "openai_compat", APIModel: "gpt-c", BaseURL: srv.URL, PromptSuffix: &suffix},
+	}, []string{"model-a", "model-b", "model-c"})
+	cfg.Defaults.MaxFailoverAttempts = 2
+
+	router := NewRouter(cfg)
+	engine := NewFailoverEngine(cfg, router, nil)
+
+	resp, modelName, err := engine.ExecuteWithFailover(
+		context.Background(),
+		testDecision("model-a", "model-b", "model-c"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if modelName != "model-c" {
+		t.Errorf("got model %q, want model-c after skipping model-b", modelName)
+	}
+	if strings.Join(called, ",") != "gpt-a,gpt-c" {
+		t.Errorf("provider calls = %v, want gpt-a then gpt-c", called)
+	}
+}
+
+// cannedCalls returns a CallFunc that answers each model's calls with its
+// listed statuses in turn (the last one repeating), or a network error for
+// a status of 0, and records the API models called.
+func cannedCalls(statuses map[string][]int, called *[]string) CallFunc {
+	return func(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error) {
+		*called = append(*called, model.APIModel)
+		codes := statuses[model.APIModel]
+		code := codes[0]
+		if len(codes) > 1 {
+			statuses[model.APIModel] = codes[1:]
+		}
+		if code == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	}
+}
+
+// TestExecuteWithFailover_InjectedCallFunc verifies that a chain can be
+// simulated with canned responses: a 429 and a network error fail over, and
+// the first 2xx response is returned without any HTTP traffic.
+func TestExecuteWithFailover_InjectedCallFunc(t *testing.T) {
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", PromptSuffix: &suffix},
+		"model-b": {Provider: "openai_compat", APIModel: "gpt-b", PromptSuffix: &suffix},
+		"model-c": {Provider: "openai_compat", APIModel: "gpt-c", PromptSuffix: &suffix},
+	}, []string{"model-a", "model-b", "model-c"})
+
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	var called []string
+	engine.SetCallFunc(cannedCalls(map[string][]int{
+		"gpt-a": {http.StatusTooManyRequests},
+		"gpt-b": {0},
+		"gpt-c": {http.StatusOK},
+	}, &called))
+
+	resp, modelName, err := engine.ExecuteWithFailover(
+		context.Background(),
+		testDecision("model-a", "model-b", "model-c"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if modelName != "model-c" {
+		t.Errorf("got model %q, want model-c", modelName)
+	}
+	if got := strings.Join(called, ","); got != "gpt-a,gpt-b,gpt-c" {
+		t.Errorf("called %s, want gpt-a,gpt-b,gpt-c", got)
+	}
+}
+
+// TestExecuteModelWrapsCause verifies that ExecuteModel's error keeps the
+// transport error or status that made the model's response unusable.
+func TestExecuteModelWrapsCause(t *testing.T) {
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", PromptSuffix: &suffix},
+	}, []string{"model-a"})
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	req := ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}}
+
+	errRefused := errors.New("connection refused")
+	engine.SetCallFunc(func(context.Context, config.Model, ProviderRequest) (*http.Response, error) {
+		return nil, errRefused
+	})
+	if _, err := engine.ExecuteModel(context.Background(), "model-a", req); !errors.Is(err, errRefused) {
+		t.Errorf("transport failure: got %v, want it to wrap %v", err, errRefused)
+	}
+
+	var called []string
+	engine.SetCallFunc(cannedCalls(map[string][]int{"gpt-a": {http.StatusServiceUnavailable}}, &called))
+	_, err := engine.ExecuteModel(context.Background(), "model-a", req)
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("retryable status: got %v, want it to report status 503", err)
+	}
+}
+
 // TestExecuteWithFailover_AllModelsExhausted verifies that when every model in
 // the chain fails, ExecuteWithFailover returns a descriptive error.
 func TestExecuteWithFailover_AllModelsExhausted(t *testing.T) {
@@ -180,6 +315,148 @@ func TestExecuteWithFailover_AllModelsExhausted(t *testing.T) {
 	}
 }
 
+// TestExecuteWithFailover_AttemptCap verifies that max_failover_attempts stops
+// a long failing chain after the configured number of provider calls.
+func TestExecuteWithFailover_AttemptCap(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	models := map[string]config.Model{}
+	names := []string{"model-a", "model-b", "model-c", "model-d", "model-e", "fallback"}
+	for _, name := range names {
+		models[name] = config.Model{Provider: "openai_compat", APIModel: name, BaseURL: srv.URL, PromptSuffix: &suffix}
+	}
+	cfg := minimalConfig(models, names)
+	cfg.Defaults.MaxFailoverAttempts = 2
+
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	_, _, err := engine.ExecuteWithFailover(
+		context.Background(),
+		testDecision("model-a", "model-b", "model-c"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}},
+	)
+	if err == nil {
+		t.Fatal("expected error when the attempt cap is reached")
+	}
+	if !strings.Contains(err.Error(), "attempt cap reached") {
+		t.Errorf("error message %q should mention the attempt cap", err.Error())
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 provider attempts, got %d", got)
+	}
+}
+
+// TestExecuteWithFailover_StopsOnCancel verifies that cancelling the context
+// after a failed attempt stops the chain before the next model is tried.
+func TestExecuteWithFailover_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptSuffix: &suffix},
+		"model-b": {Provider: "openai_compat", APIModel: "gpt-b", BaseURL: srv.URL, PromptSuffix: &suffix},
+	}, []string{"model-a", "model-b"})
+
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	_, _, err := engine.ExecuteWithFailover(ctx, testDecision("model-a", "model-b"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected 1 provider attempt before cancellation, got %d", got)
+	}
+}
+
+// TestExecuteWithFailover_AffixesPerModel verifies that each model in the
+// chain receives only its own prompt prefix and suffix, not those of models
+// tried earlier.
+func TestExecuteWithFailover_AffixesPerModel(t *testing.T) {
+	var systems []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		if len(body.Messages) > 0 && body.Messages[0].Role == "system" {
+			systems = append(systems, body.Messages[0].Content)
+		}
+		if len(systems) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	prefixA, suffixB := "A first", "B last"
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptPrefix: &prefixA},
+		"model-b": {Provider: "openai_compat", APIModel: "gpt-b", BaseURL: srv.URL, PromptSuffix: &suffixB},
+	}, []string{"model-a", "model-b"})
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, _, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a", "model-b"),
+		ProviderRequest{SystemPrompt: "base", Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	want := []string{"A first\n\nbase", "base\n\nB last"}
+	if strings.Join(systems, "|") != strings.Join(want, "|") {
+		t.Errorf("system prompts = %q, want %q", systems, want)
+	}
+}
+
+// TestPatchAnthropicRawBodyAffixes verifies prefix and suffix injection for
+// string and content-block system prompts.
+func TestPatchAnthropicRawBodyAffixes(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"string system", `{"system":"base"}`, `"P\n\nbase\n\nS"`},
+		{"no system", `{}`, `"P\n\nS"`},
+		{"block system", `{"system":[{"type":"text","text":"base"}]}`,
+			`[{"text":"P\n\n","type":"text"},{"type":"text","text":"base"},{"text":"\n\nS","type":"text"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := PatchAnthropicRawBodyAffixes([]byte(tt.raw), "m", "P", "S", 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(patched, &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if got := string(body["system"]); got != tt.want {
+				t.Errorf("system = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestExecuteWithFailover_SkipsUnknownModels verifies that model names in the
 // chain that are not present in cfg.Models are skipped without panic.
 func TestExecuteWithFailover_SkipsUnknownModels(t *testing.T) {
@@ -384,6 +661,65 @@ func TestBuildChainFromDecision(t *testing.T) {
 	}
 }
 
+// TestBuildChainFromDecisionFallbackChain verifies defaults.fallback_chain
+// is appended in order after the tier chain, skipping models already tried,
+// with fallback_model last.
+func TestBuildChainFromDecisionFallbackChain(t *testing.T) {
+	models := map[string]config.Model{}
+	for _, name := range []string{"selected", "chain-only", "reliable-1", "reliable-2", "fallback"} {
+		models[name] = config.Model{Provider: "openai_compat"}
+	}
+	cfg := minimalConfig(models, []string{"selected", "chain-only"})
+	cfg.Defaults.FallbackChain = []string{"reliable-1", "chain-only", "reliable-2", "reliable-1"}
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	chain := engine.buildChainFromDecision(testDecision("selected"))
+
+	want := []string{"selected", "chain-only", "reliable-1", "reliable-2", "fallback"}
+	if strings.Join(chain, ",") != strings.Join(want, ",") {
+		t.Errorf("chain = %v, want %v", chain, want)
+	}
+}
+
+// TestExecuteWithFailover_SkipsDisabledModels verifies that a disabled model
+// is left out of the chain and never called, even as the selected model.
+func TestExecuteWithFailover_SkipsDisabledModels(t *testing.T) {
+	var disabledCalls int
+	disabled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		disabledCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer disabled.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"flaky":  {Provider: "openai_compat", BaseURL: disabled.URL, PromptSuffix: &suffix, Disabled: true},
+		"steady": {Provider: "openai_compat", BaseURL: healthy.URL, PromptSuffix: &suffix},
+	}, []string{"flaky", "steady"})
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	decision := testDecision("flaky", "steady")
+	for _, name := range engine.buildChainFromDecision(decision) {
+		if name == "flaky" {
+			t.Errorf("disabled model in chain %v", engine.buildChainFromDecision(decision))
+		}
+	}
+
+	resp, modelName, err := engine.ExecuteWithFailover(context.Background(), decision,
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if modelName != "steady" || disabledCalls != 0 {
+		t.Errorf("served by %s with %d calls to the disabled model, want steady and none", modelName, disabledCalls)
+	}
+}
+
 // TestProviderRequestAnthropicFormat verifies the JSON body sent to an
 // Anthropic-style endpoint contains the expected fields.
 func TestProviderRequestAnthropicFormat(t *testing.T) {
@@ -404,11 +740,12 @@ func TestProviderRequestAnthropicFormat(t *testing.T) {
 	// Override the Anthropic endpoint via the model's base URL trick is not
 	// possible directly; instead we exercise callOpenAICompat which is the
 	// general mechanism and separately verify the Anthropic body builder.
+	temperature := 0.7
 	req := ProviderRequest{
 		SystemPrompt: "be helpful",
 		Messages:     []ProviderMessage{{Role: "user", Content: "hello"}},
 		MaxTokens:    512,
-		Temperature:  0.7,
+		Temperature:  &temperature,
 		Stream:       false,
 	}
 
@@ -428,6 +765,80 @@ func TestProviderRequestAnthropicFormat(t *testing.T) {
 	}
 }
 
+// TestAnthropicMetadataSurvivesBothPaths verifies that metadata.user_id is
+// sent on the normalised path and preserved by raw-body patching.
+func TestAnthropicMetadataSurvivesBothPaths(t *testing.T) {
+	req := ProviderRequest{
+		Messages: []ProviderMessage{{Role: "user", Content: "hello"}},
+		Metadata: map[string]string{"user_id": "user-42"},
+	}
+	encoded, err := json.Marshal(buildAnthropicBody(req, "claude-test"))
+	if err != nil {
+		t.Fatalf("marshal normalised body: %v", err)
+	}
+
+	raw := []byte(`{"model":"client-model","max_tokens":10,"metadata":{"user_id":"user-42"},"messages":[{"role":"user","content":"hello"}]}`)
+	patched, err := PatchAnthropicRawBody(raw, "claude-test", "be concise")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, body := range map[string][]byte{"normalised": encoded, "raw": patched} {
+		var decoded struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", name, err)
+		}
+		if decoded.Metadata["user_id"] != "user-42" {
+			t.Errorf("%s: metadata = %v, want user_id user-42", name, decoded.Metadata)
+		}
+	}
+
+	// Without metadata the field is omitted entirely.
+	if _, ok := buildAnthropicBody(ProviderRequest{}, "claude-test")["metadata"]; ok {
+		t.Error("expected no metadata field when none was supplied")
+	}
+}
+
+// TestAnthropicServiceTierSurvivesBothPaths verifies that service_tier is
+// sent on the normalised path and preserved by raw-body patching.
+func TestAnthropicServiceTierSurvivesBothPaths(t *testing.T) {
+	req := ProviderRequest{
+		Messages:    []ProviderMessage{{Role: "user", Content: "hello"}},
+		ServiceTier: "standard_only",
+	}
+	encoded, err := json.Marshal(buildAnthropicBody(req, "claude-test"))
+	if err != nil {
+		t.Fatalf("marshal normalised body: %v", err)
+	}
+
+	raw := []byte(`{"model":"client-model","max_tokens":10,"service_tier":"standard_only","messages":[{"role":"user","content":"hello"}]}`)
+	patched, err := PatchAnthropicRawBody(raw, "claude-test", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, body := range map[string][]byte{"normalised": encoded, "raw": patched} {
+		var decoded struct {
+			ServiceTier string `json:"service_tier"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", name, err)
+		}
+		if decoded.ServiceTier != "standard_only" {
+			t.Errorf("%s: service_tier = %q, want standard_only", name, decoded.ServiceTier)
+		}
+	}
+
+	if _, ok := buildAnthropicBody(ProviderRequest{}, "claude-test")["service_tier"]; ok {
+		t.Error("expected no service_tier field when none was supplied")
+	}
+	if _, ok := buildOpenAICompatBody(req, "gpt-test")["service_tier"]; ok {
+		t.Error("service_tier must not be sent to OpenAI-compatible providers")
+	}
+}
+
 // TestProviderRequestOpenAICompatFormat verifies the JSON body sent to an
 // OpenAI-compatible endpoint contains a system message prepended to messages.
 func TestProviderRequestOpenAICompatFormat(t *testing.T) {
@@ -470,15 +881,115 @@ func TestProviderRequestOllamaFormat(t *testing.T) {
 	if body["model"] != "llama3" {
 		t.Errorf("model = %v, want llama3", body["model"])
 	}
-	opts, ok := body["options"].(map[string]int)
+	opts, ok := body["options"].(map[string]interface{})
 	if !ok {
-		t.Fatalf("options not map[string]int")
+		t.Fatalf("options not a map")
 	}
 	if opts["num_predict"] != 1024 {
 		t.Errorf("num_predict = %d, want 1024", opts["num_predict"])
 	}
 }
 
+// TestProviderRequestOllamaImages verifies that message images are sent in
+// Ollama's images field, and that messages without images omit it.
+func TestProviderRequestOllamaImages(t *testing.T) {
+	req := ProviderRequest{Messages: []ProviderMessage{
+		{Role: "user", Content: "what is this?", Images: []string{"iVBORw0KGgo="}},
+		{Role: "assistant", Content: "a cat"},
+	}}
+
+	msgs := buildOllamaBody(req, "llava")["messages"].([]map[string]interface{})
+	if images, ok := msgs[0]["images"].([]string); !ok || len(images) != 1 || images[0] != "iVBORw0KGgo=" {
+		t.Errorf("images = %v, want the base64 image", msgs[0]["images"])
+	}
+	if _, ok := msgs[1]["images"]; ok {
+		t.Error("expected no images field on a message without images")
+	}
+}
+
+// TestProviderRequestSamplingParams verifies that temperature, top_p, top_k,
+// and stop sequences land in Ollama's options with their types intact, and
+// reach the other providers under their own names, only when set.
+func TestProviderRequestSamplingParams(t *testing.T) {
+	temperature, topP, topK := 0.3, 0.9, 40
+	req := ProviderRequest{
+		Messages:    []ProviderMessage{{Role: "user", Content: "hi"}},
+		Temperature: &temperature,
+		TopP:        &topP,
+		TopK:        &topK,
+		Stop:        []string{"\n\n", "END"},
+	}
+
+	opts := buildOllamaBody(req, "llama3")["options"].(map[string]interface{})
+	if got, ok := opts["temperature"].(float64); !ok || got != 0.3 {
+		t.Errorf("options.temperature = %#v, want float64 0.3", opts["temperature"])
+	}
+	if got, ok := opts["top_p"].(float64); !ok || got != 0.9 {
+		t.Errorf("options.top_p = %#v, want float64 0.9", opts["top_p"])
+	}
+	if got, ok := opts["top_k"].(int); !ok || got != 40 {
+		t.Errorf("options.top_k = %#v, want int 40", opts["top_k"])
+	}
+	if got, ok := opts["stop"].([]string); !ok || strings.Join(got, "|") != "\n\n|END" {
+		t.Errorf("options.stop = %#v, want %q", opts["stop"], req.Stop)
+	}
+
+	anthropic := buildAnthropicBody(req, "claude-test")
+	if anthropic["top_p"] != 0.9 || anthropic["top_k"] != 40 || len(anthropic["stop_sequences"].([]string)) != 2 {
+		t.Errorf("anthropic body top_p=%v top_k=%v stop_sequences=%v", anthropic["top_p"], anthropic["top_k"], anthropic["stop_sequences"])
+	}
+	openai := buildOpenAICompatBody(req, "gpt-test")
+	if openai["top_p"] != 0.9 || len(openai["stop"].([]string)) != 2 {
+		t.Errorf("openai_compat body top_p=%v stop=%v", openai["top_p"], openai["stop"])
+	}
+	if _, ok := openai["top_k"]; ok {
+		t.Error("openai_compat body has top_k, which the API does not accept")
+	}
+
+	unset := buildOllamaBody(ProviderRequest{}, "llama3")["options"].(map[string]interface{})
+	for _, key := range []string{"temperature", "top_p", "top_k", "stop"} {
+		if _, ok := unset[key]; ok {
+			t.Errorf("options.%s set although the request left it out", key)
+		}
+	}
+}
+
+// TestSetAnthropicAuth checks that client-supplied credentials take
+// precedence over ANTHROPIC_API_KEY, which is used only when the client sent
+// none.
+func TestSetAnthropicAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		envKey     string
+		clientAuth http.Header
+		wantAuth   string
+		wantAPIKey string
+	}{
+		{"client x-api-key over env", "env-key", http.Header{"X-Api-Key": {"client-key"}}, "", "client-key"},
+		{"client x-api-key without env", "", http.Header{"X-Api-Key": {"client-key"}}, "", "client-key"},
+		{"client bearer token", "env-key", http.Header{"Authorization": {"Bearer oauth-token"}}, "Bearer oauth-token", ""},
+		{"env key only", "env-key", nil, "", "env-key"},
+		{"env key with empty client header", "env-key", http.Header{}, "", "env-key"},
+		{"no credentials", "", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ANTHROPIC_API_KEY", tt.envKey)
+			httpReq := httptest.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", nil)
+
+			setAnthropicAuth(httpReq, tt.clientAuth)
+
+			if got := httpReq.Header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+			if got := httpReq.Header.Get("X-Api-Key"); got != tt.wantAPIKey {
+				t.Errorf("x-api-key = %q, want %q", got, tt.wantAPIKey)
+			}
+		})
+	}
+}
+
 // TestResolveAPIKey_Anthropic checks that the anthropic provider always reads
 // the ANTHROPIC_API_KEY environment variable.
 func TestResolveAPIKey_Anthropic(t *testing.T) {
@@ -529,6 +1040,83 @@ func TestResolveAPIKey_OpenAICompatCerebras(t *testing.T) {
 	}
 }
 
+// TestResolveAPIKey_OpenAICompatAzure checks that an Azure OpenAI base URL
+// reads AZURE_OPENAI_API_KEY.
+func TestResolveAPIKey_OpenAICompatAzure(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_API_KEY", "az-secret")
+	key := resolveAPIKey("openai_compat", "https://my-resource.openai.azure.com")
+	if key != "az-secret" {
+		t.Errorf("got key %q, want %q", key, "az-secret")
+	}
+}
+
+// TestOpenAICompatEndpoint checks the chat completions URL for the default
+// and Azure auth styles.
+func TestOpenAICompatEndpoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		model config.Model
+		want  string
+	}{
+		{"bearer", config.Model{BaseURL: "https://api.openai.com/v1/", APIModel: "gpt-4o"},
+			"https://api.openai.com/v1/chat/completions"},
+		{"azure", config.Model{BaseURL: "https://res.openai.azure.com/", APIModel: "gpt4o-prod", AuthStyle: "azure", APIVersion: "2024-06-01"},
+			"https://res.openai.azure.com/openai/deployments/gpt4o-prod/chat/completions?api-version=2024-06-01"},
+		{"azure default version", config.Model{BaseURL: "https://res.openai.azure.com", APIModel: "gpt4o-prod", AuthStyle: "azure"},
+			"https://res.openai.azure.com/openai/deployments/gpt4o-prod/chat/completions?api-version=" + defaultAzureAPIVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := openAICompatEndpoint(tt.model); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecuteWithFailover_AzureAuthStyle verifies that an azure-style model
+// is called at its deployment URL with an api-key header and no bearer token.
+func TestExecuteWithFailover_AzureAuthStyle(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_API_KEY", "az-secret")
+	t.Setenv("OPENAI_API_KEY", "oai-secret")
+
+	var gotPath, gotVersion, gotKey, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := minimalConfig(map[string]config.Model{
+		"azure-gpt": {
+			Provider:   "openai_compat",
+			APIModel:   "gpt4o-prod",
+			BaseURL:    srv.URL,
+			AuthStyle:  "azure",
+			APIVersion: "2024-06-01",
+		},
+	}, []string{"azure-gpt"})
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, _, err := engine.ExecuteWithFailover(context.Background(), testDecision("azure-gpt"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if gotPath != "/openai/deployments/gpt4o-prod/chat/completions" || gotVersion != "2024-06-01" {
+		t.Errorf("called %s?api-version=%s, want the gpt4o-prod deployment at 2024-06-01", gotPath, gotVersion)
+	}
+	if gotKey != "az-secret" || gotAuth != "" {
+		t.Errorf("api-key = %q, Authorization = %q; want api-key az-secret and no bearer token", gotKey, gotAuth)
+	}
+}
+
 // --- PatchAnthropicRawBody tests -------------------------------------------
 
 // TestPatchAnthropicRawBody_PatchesModel verifies that the model field is
@@ -674,6 +1262,65 @@ func TestPatchAnthropicRawBody_PreservesToolUseBlocks(t *testing.T) {
 	}
 }
 
+func TestPatchAnthropicRawBody_RejectsMalformedBodies(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"array", `[{"model":"old"}]`, "unmarshalling raw body"},
+		{"number", `42`, "unmarshalling raw body"},
+		{"string", `"hello"`, "unmarshalling raw body"},
+		{"null", `null`, "not a JSON object"},
+		{"truncated", `{"model":"old",`, "unmarshalling raw body"},
+		{"object system", `{"model":"old","system":{"text":"hi"}}`, "system must be a string or an array"},
+		{"numeric system", `{"model":"old","system":7}`, "system must be a string or an array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := PatchAnthropicRawBody([]byte(tt.raw), "new-model", "be concise")
+			if err == nil {
+				t.Fatalf("expected an error, got %s", patched)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// FuzzPatchAnthropicRawBody checks that no body, however malformed, makes
+// the patcher panic, and that whatever it returns without an error is a JSON
+// object carrying the new model.
+func FuzzPatchAnthropicRawBody(f *testing.F) {
+	for _, seed := range []string{
+		`{"model":"old","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`,
+		`{"model":"old","system":"be brief","messages":[]}`,
+		`{"model":"old","system":[{"type":"text","text":"be brief"}]}`,
+		`{"model":"old","system":{"nested":{"deeper":[1,2,{"x":null}]}}}`,
+		`{"system":null,"max_tokens":"many","response_format":{"type":"json_object"}}`,
+		`[1,2,3]`, `null`, `"text"`, `0`, `{`, ``,
+	} {
+		f.Add([]byte(seed), "prefix", "suffix", 100)
+		f.Add([]byte(seed), "", "", 0)
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte, prefix, suffix string, maxTokensCap int) {
+		patched, err := PatchAnthropicRawBodyAffixes(raw, "new-model", prefix, suffix, maxTokensCap)
+		if err != nil {
+			return
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(patched, &body); err != nil || body == nil {
+			t.Fatalf("patched body is not a JSON object (%v): %s", err, patched)
+		}
+		if string(body["model"]) != `"new-model"` {
+			t.Errorf("model = %s, want \"new-model\"", body["model"])
+		}
+	})
+}
+
 // TestGetModelSuffix verifies the getModelSuffix helper.
 func TestGetModelSuffix(t *testing.T) {
 	suffix := "  format nicely  "
@@ -755,3 +1402,364 @@ func TestExecuteWithFailover_RawPassthroughForAnthropic(t *testing.T) {
 		}
 	}
 }
+
+// TestExecuteWithFailover_PropagatesTraceHeaders verifies that allowlisted
+// tracing headers reach every provider type while other incoming headers do
+// not.
+func TestExecuteWithFailover_PropagatesTraceHeaders(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	for _, provider := range []string{"openai_compat", "ollama"} {
+		t.Run(provider, func(t *testing.T) {
+			var got http.Header
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			suffix := ""
+			cfg := minimalConfig(map[string]config.Model{
+				"model-a": {Provider: provider, APIModel: "m", BaseURL: srv.URL, PromptSuffix: &suffix},
+			}, []string{"model-a"})
+			engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+			incoming := http.Header{}
+			incoming.Set("traceparent", traceparent)
+			incoming.Set("tracestate", "vendor=value")
+			incoming.Set("X-Request-Id", "req-123")
+			incoming.Set("Cookie", "session=secret")
+
+			resp, _, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a"),
+				ProviderRequest{
+					Messages:     []ProviderMessage{{Role: "user", Content: "hi"}},
+					TraceHeaders: incoming,
+				})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if got.Get("traceparent") != traceparent {
+				t.Errorf("traceparent = %q, want %q", got.Get("traceparent"), traceparent)
+			}
+			if got.Get("tracestate") != "vendor=value" {
+				t.Errorf("tracestate = %q, want %q", got.Get("tracestate"), "vendor=value")
+			}
+			if got.Get("X-Request-Id") != "req-123" {
+				t.Errorf("X-Request-Id = %q, want %q", got.Get("X-Request-Id"), "req-123")
+			}
+			if got.Get("Cookie") != "" {
+				t.Error("non-allowlisted Cookie header was forwarded to the provider")
+			}
+		})
+	}
+}
+
+// bodyPatternConfig returns a config whose test-tier chain is model-a
+// (served by filtered) then model-b (served by ok), failing over on
+// content-filter bodies.
+func bodyPatternConfig(filtered, ok string) *config.Config {
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: filtered, PromptSuffix: &suffix},
+		"model-b": {Provider: "openai_compat", APIModel: "gpt-b", BaseURL: ok, PromptSuffix: &suffix},
+	}, []string{"model-a", "model-b"})
+	spec := cfg.Failover["test-tier"]
+	spec.RetryOnBodyPatterns = []string{`"finish_reason":\s*"content_filter"`}
+	cfg.Failover["test-tier"] = spec
+	return cfg
+}
+
+// TestExecuteWithFailover_RetryOnBodyPattern verifies that a 200 response
+// whose body matches a retry pattern fails over to the next model, and that
+// the successful response body reaches the caller intact.
+func TestExecuteWithFailover_RetryOnBodyPattern(t *testing.T) {
+	filtered := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"content":""},"finish_reason": "content_filter"}]}`)) //nolint:errcheck
+	}))
+	defer filtered.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)) //nolint:errcheck
+	}))
+	defer ok.Close()
+
+	cfg := bodyPatternConfig(filtered.URL, ok.URL)
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, modelName, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a", "model-b"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if modelName != "model-b" {
+		t.Errorf("got model %q, want model-b", modelName)
+	}
+
+	var body struct {
+		Choices []struct {
+			Message struct{ Content string } `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if len(body.Choices) != 1 || body.Choices[0].Message.Content != "hi" {
+		t.Errorf("unexpected body: %+v", body)
+	}
+}
+
+// TestExecuteWithFailover_RetryOnBodyPatternNoMatch verifies that a
+// non-matching 200 body is returned in full after being inspected.
+func TestExecuteWithFailover_RetryOnBodyPatternNoMatch(t *testing.T) {
+	large := `{"choices":[{"message":{"content":"` + strings.Repeat("x", 2*retryBodyPeekBytes) + `"},"finish_reason":"stop"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := bodyPatternConfig(srv.URL, srv.URL)
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, modelName, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a", "model-b"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if modelName != "model-a" {
+		t.Errorf("got model %q, want model-a", modelName)
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if string(got) != large {
+		t.Errorf("body was altered: got %d bytes, want %d", len(got), len(large))
+	}
+}
+
+// TestMatchBodyPatternsGzip verifies that a gzip-encoded body is decoded
+// before matching, and handed back decoded with the encoding header removed.
+func TestMatchBodyPatternsGzip(t *testing.T) {
+	const body = `{"choices":[{"message":{"content":""},"finish_reason": "content_filter"}]}`
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(body)) //nolint:errcheck
+	zw.Close()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(&buf),
+	}
+
+	cfg := bodyPatternConfig("", "")
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	pattern, err := matchBodyPatterns(resp, engine.bodyPatterns["test-tier"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pattern == "" {
+		t.Error("gzip-encoded content_filter body did not match")
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || string(got) != body {
+		t.Errorf("body after matching = %q, %v; want the decoded body", got, err)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Content-Encoding was left on the decoded body")
+	}
+}
+
+// TestExecuteWithFailover_RetryOnBodyPatternSkipsStreaming verifies that
+// streaming responses are not inspected, so the stream is never delayed.
+func TestExecuteWithFailover_RetryOnBodyPatternSkipsStreaming(t *testing.T) {
+	filtered := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`data: {"choices":[{"delta":{},"finish_reason":"content_filter"}]}` + "\n\n")) //nolint:errcheck
+	}))
+	defer filtered.Close()
+
+	cfg := bodyPatternConfig(filtered.URL, filtered.URL)
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, modelName, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a", "model-b"),
+		ProviderRequest{Stream: true, Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if modelName != "model-a" {
+		t.Errorf("got model %q, want model-a", modelName)
+	}
+}
+
+// TestMaxTokensCap verifies that the cap clamps high and missing max_tokens
+// values in every body builder while leaving lower requests unchanged.
+func TestMaxTokensCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		cap       int
+		want      int
+	}{
+		{"high value clamped", 100000, 8192, 8192},
+		{"low value unchanged", 1000, 8192, 1000},
+		{"unset uses default under cap", 0, 8192, defaultMaxTokens},
+		{"unset default clamped", 0, 1024, 1024},
+		{"no cap", 100000, 0, 100000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ProviderRequest{MaxTokens: tt.maxTokens, MaxTokensCap: tt.cap}
+
+			if got := buildAnthropicBody(req, "claude-test")["max_tokens"]; got != tt.want {
+				t.Errorf("anthropic max_tokens = %v, want %d", got, tt.want)
+			}
+			if got := buildOpenAICompatBody(req, "gpt-test")["max_tokens"]; got != tt.want {
+				t.Errorf("openai_compat max_tokens = %v, want %d", got, tt.want)
+			}
+			opts := buildOllamaBody(req, "llama3")["options"].(map[string]interface{})
+			if got := opts["num_predict"]; got != tt.want {
+				t.Errorf("ollama num_predict = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPatchAnthropicRawBodyMaxTokensCap verifies the raw passthrough path
+// clamps max_tokens the same way.
+func TestPatchAnthropicRawBodyMaxTokensCap(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		cap  int
+		want string
+	}{
+		{"high value clamped", `{"max_tokens":100000}`, 8192, "8192"},
+		{"low value unchanged", `{"max_tokens":1000}`, 8192, "1000"},
+		{"missing set to cap", `{}`, 8192, "8192"},
+		{"no cap", `{"max_tokens":100000}`, 0, "100000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := PatchAnthropicRawBodyAffixes([]byte(tt.raw), "m", "", "", tt.cap)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(patched, &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if got := string(body["max_tokens"]); got != tt.want {
+				t.Errorf("max_tokens = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecuteWithFailover_AppliesMaxTokensCap verifies the engine applies
+// defaults.max_tokens_cap to outgoing requests.
+func TestExecuteWithFailover_AppliesMaxTokensCap(t *testing.T) {
+	var got int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		got = body.MaxTokens
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptSuffix: &suffix},
+	}, []string{"model-a"})
+	cfg.Defaults.MaxTokensCap = 2048
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, _, err := engine.ExecuteWithFailover(context.Background(), testDecision("model-a"),
+		ProviderRequest{MaxTokens: 64000, Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got != 2048 {
+		t.Errorf("provider received max_tokens %d, want 2048", got)
+	}
+}
+
+// TestModelMaxOutputTokens verifies a model's max_output_tokens replaces the
+// default for requests without max_tokens and clamps larger requests, with
+// defaults.max_tokens_cap still applying on top.
+func TestModelMaxOutputTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		limit     int
+		cap       int
+		want      int
+	}{
+		{"unset uses model default", 0, 32000, 0, 32000},
+		{"unset small model default", 0, 2048, 0, 2048},
+		{"high value clamped to model", 50000, 2048, 0, 2048},
+		{"low value unchanged", 1000, 2048, 0, 1000},
+		{"global cap tighter than model", 0, 32000, 8192, 8192},
+		{"no model limit", 0, 0, 0, defaultMaxTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ProviderRequest{MaxTokens: tt.maxTokens, MaxOutputTokens: tt.limit, MaxTokensCap: tt.cap}
+
+			if got := buildAnthropicBody(req, "claude-test")["max_tokens"]; got != tt.want {
+				t.Errorf("anthropic max_tokens = %v, want %d", got, tt.want)
+			}
+			if got := buildOpenAICompatBody(req, "gpt-test")["max_tokens"]; got != tt.want {
+				t.Errorf("openai_compat max_tokens = %v, want %d", got, tt.want)
+			}
+			opts := buildOllamaBody(req, "llama3")["options"].(map[string]interface{})
+			if got := opts["num_predict"]; got != tt.want {
+				t.Errorf("ollama num_predict = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecuteWithFailover_AppliesModelMaxOutputTokens verifies each model in
+// the chain gets its own max_output_tokens default.
+func TestExecuteWithFailover_AppliesModelMaxOutputTokens(t *testing.T) {
+	var got []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body) //nolint:errcheck
+		got = append(got, body.MaxTokens)
+		if len(got) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"small": {Provider: "openai_compat", APIModel: "s", BaseURL: srv.URL, PromptSuffix: &suffix, MaxOutputTokens: 2048},
+		"large": {Provider: "openai_compat", APIModel: "l", BaseURL: srv.URL, PromptSuffix: &suffix, MaxOutputTokens: 32000},
+	}, []string{"small", "large"})
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	resp, _, err := engine.ExecuteWithFailover(context.Background(), testDecision("small", "large"),
+		ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if len(got) != 2 || got[0] != 2048 || got[1] != 32000 {
+		t.Errorf("provider received max_tokens %v, want [2048 32000]", got)
+	}
+}
@@ -0,0 +1,52 @@
+package router
+
+import "encoding/json"
+
+// responseFormat is the subset of an OpenAI response_format object the
+// router understands: type is "text", "json_object", or "json_schema", the
+// last carrying the schema under json_schema.schema.
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema"`
+}
+
+// parseResponseFormat decodes raw, reporting false when it is absent,
+// malformed, or asks for plain text.
+func parseResponseFormat(raw json.RawMessage) (responseFormat, bool) {
+	var f responseFormat
+	if len(raw) == 0 || json.Unmarshal(raw, &f) != nil {
+		return f, false
+	}
+	return f, f.Type == "json_object" || f.Type == "json_schema"
+}
+
+// jsonModeInstruction returns the system-prompt instruction that emulates
+// JSON mode for providers without a response_format parameter, or "" when
+// raw does not request JSON output.
+func jsonModeInstruction(raw json.RawMessage) string {
+	f, ok := parseResponseFormat(raw)
+	if !ok {
+		return ""
+	}
+	instruction := "Respond with a single valid JSON object and nothing else: no prose before or after it and no markdown code fences."
+	if f.Type == "json_schema" && len(f.JSONSchema.Schema) > 0 {
+		instruction += " The JSON must conform to this JSON Schema:\n" + string(f.JSONSchema.Schema)
+	}
+	return instruction
+}
+
+// ollamaFormat converts raw to Ollama's format parameter: "json" for
+// json_object, or the schema itself for json_schema. It returns nil when raw
+// does not request JSON output.
+func ollamaFormat(raw json.RawMessage) interface{} {
+	f, ok := parseResponseFormat(raw)
+	if !ok {
+		return nil
+	}
+	if f.Type == "json_schema" && len(f.JSONSchema.Schema) > 0 {
+		return f.JSONSchema.Schema
+	}
+	return "json"
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func formatRequest(format string) ProviderRequest {
+	return ProviderRequest{
+		SystemPrompt:   "be helpful",
+		Messages:       []ProviderMessage{{Role: "user", Content: "list three colours"}},
+		ResponseFormat: json.RawMessage(format),
+	}
+}
+
+func TestBuildOpenAICompatBodyResponseFormat(t *testing.T) {
+	body := encodeBody(t, buildOpenAICompatBody(formatRequest(`{"type":"json_object"}`), "gpt-test"))
+
+	format, _ := body["response_format"].(map[string]any)
+	if format["type"] != "json_object" {
+		t.Errorf("response_format = %v, want json_object", body["response_format"])
+	}
+
+	body = encodeBody(t, buildOpenAICompatBody(ProviderRequest{}, "gpt-test"))
+	if _, ok := body["response_format"]; ok {
+		t.Error("expected no response_format when none was requested")
+	}
+}
+
+func TestBuildAnthropicBodyEmulatesJSONMode(t *testing.T) {
+	body := buildAnthropicBody(formatRequest(`{"type":"json_object"}`), "claude-test")
+	system, _ := body["system"].(string)
+	if !strings.HasPrefix(system, "be helpful\n\n") || !strings.Contains(system, "single valid JSON object") {
+		t.Errorf("system = %q, want the prompt followed by the JSON instruction", system)
+	}
+	if _, ok := body["response_format"]; ok {
+		t.Error("response_format must not be sent to Anthropic")
+	}
+
+	schema := `{"type":"json_schema","json_schema":{"name":"colours","schema":{"type":"array"}}}`
+	system, _ = buildAnthropicBody(formatRequest(schema), "claude-test")["system"].(string)
+	if !strings.Contains(system, `{"type":"array"}`) {
+		t.Errorf("system = %q, want the schema included", system)
+	}
+
+	system, _ = buildAnthropicBody(formatRequest(`{"type":"text"}`), "claude-test")["system"].(string)
+	if system != "be helpful" {
+		t.Errorf("text format: system = %q, want it unchanged", system)
+	}
+}
+
+func TestPatchAnthropicRawBodyDropsResponseFormat(t *testing.T) {
+	raw := []byte(`{"model":"client","max_tokens":10,"response_format":{"type":"json_object"},"messages":[{"role":"user","content":"hi"}]}`)
+	patched, err := PatchAnthropicRawBodyAffixes(raw, "claude-test", "", jsonModeInstruction(json.RawMessage(`{"type":"json_object"}`)), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(patched, &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, ok := body["response_format"]; ok {
+		t.Error("response_format should be removed from the raw body")
+	}
+	if !strings.Contains(string(body["system"]), "single valid JSON object") {
+		t.Errorf("system = %s, want the JSON instruction", body["system"])
+	}
+}
+
+func TestBuildOllamaBodyFormat(t *testing.T) {
+	body := encodeBody(t, buildOllamaBody(formatRequest(`{"type":"json_object"}`), "llama3"))
+	if body["format"] != "json" {
+		t.Errorf("format = %v, want json", body["format"])
+	}
+
+	schema := `{"type":"json_schema","json_schema":{"name":"colours","schema":{"type":"array"}}}`
+	body = encodeBody(t, buildOllamaBody(formatRequest(schema), "llama3"))
+	if format, _ := body["format"].(map[string]any); format["type"] != "array" {
+		t.Errorf("format = %v, want the schema", body["format"])
+	}
+}
@@ -6,19 +6,30 @@ import "strings"
 // separated by a blank line. If the model has no suffix configured, or the
 // suffix is blank after trimming, systemPrompt is returned unchanged.
 func (r *Router) InjectSuffix(modelName string, systemPrompt string) string {
-	m, ok := r.cfg.Models[modelName]
-	if !ok || m.PromptSuffix == nil {
-		return systemPrompt
-	}
+	return joinPromptParts(systemPrompt, getModelSuffix(r.cfg, modelName))
+}
 
-	suffix := strings.TrimSpace(*m.PromptSuffix)
-	if suffix == "" {
-		return systemPrompt
-	}
+// InjectPrefix prepends the model-specific prompt prefix to systemPrompt,
+// separated by a blank line. If the model has no prefix configured, or the
+// prefix is blank after trimming, systemPrompt is returned unchanged.
+func (r *Router) InjectPrefix(modelName string, systemPrompt string) string {
+	return joinPromptParts(getModelPrefix(r.cfg, modelName), systemPrompt)
+}
 
-	if systemPrompt == "" {
-		return suffix
-	}
+// InjectAffixes applies both the model's prompt prefix and suffix, giving
+// "prefix\n\nsystemPrompt\n\nsuffix" with empty parts (and their separators)
+// omitted.
+func (r *Router) InjectAffixes(modelName string, systemPrompt string) string {
+	return joinPromptParts(getModelPrefix(r.cfg, modelName), systemPrompt, getModelSuffix(r.cfg, modelName))
+}
 
-	return systemPrompt + "\n\n" + suffix
+// joinPromptParts joins the non-empty parts with blank-line separators.
+func joinPromptParts(parts ...string) string {
+	nonEmpty := parts[:0:0]
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
 }
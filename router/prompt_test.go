@@ -3,6 +3,8 @@ package router
 import (
 	"strings"
 	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
 )
 
 func TestInjectSuffix(t *testing.T) {
@@ -118,3 +120,43 @@ func TestInjectSuffix_EmptySystemPrompt(t *testing.T) {
 		t.Error("expected non-empty result for minimax-m2 with empty system prompt")
 	}
 }
+
+func TestInjectAffixes(t *testing.T) {
+	prefix, suffix, blank := "Think step by step.", "Answer in English.", "  "
+	cfg := &config.Config{Models: map[string]config.Model{
+		"prefix-only": {PromptPrefix: &prefix},
+		"suffix-only": {PromptSuffix: &suffix},
+		"both":        {PromptPrefix: &prefix, PromptSuffix: &suffix},
+		"neither":     {},
+		"blank":       {PromptPrefix: &blank, PromptSuffix: &blank},
+	}}
+	r := NewRouter(cfg)
+
+	tests := []struct {
+		model  string
+		system string
+		want   string
+	}{
+		{"prefix-only", "Be terse.", "Think step by step.\n\nBe terse."},
+		{"prefix-only", "", "Think step by step."},
+		{"suffix-only", "Be terse.", "Be terse.\n\nAnswer in English."},
+		{"suffix-only", "", "Answer in English."},
+		{"both", "Be terse.", "Think step by step.\n\nBe terse.\n\nAnswer in English."},
+		{"both", "", "Think step by step.\n\nAnswer in English."},
+		{"neither", "Be terse.", "Be terse."},
+		{"blank", "Be terse.", "Be terse."},
+		{"unknown", "Be terse.", "Be terse."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+"/"+tt.system, func(t *testing.T) {
+			if got := r.InjectAffixes(tt.model, tt.system); got != tt.want {
+				t.Errorf("InjectAffixes(%q, %q) = %q, want %q", tt.model, tt.system, got, tt.want)
+			}
+		})
+	}
+
+	if got := r.InjectPrefix("both", "Be terse."); got != "Think step by step.\n\nBe terse." {
+		t.Errorf("InjectPrefix = %q, want prefix only", got)
+	}
+}
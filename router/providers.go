@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 
 	"github.com/jbctechsolutions/sr-router/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // ProviderRequest is a normalized request that can be translated to any
@@ -18,9 +22,51 @@ type ProviderRequest struct {
 	SystemPrompt string
 	Messages     []ProviderMessage
 	MaxTokens    int
-	Temperature  float64
 	Stream       bool
 
+	// Temperature is sent to the provider when non-nil; nil leaves the
+	// provider's default.
+	Temperature *float64
+
+	// TopP, TopK, and Stop are the client's nucleus sampling, top-k
+	// sampling, and stop sequences, each sent only when set.
+	// OpenAI-compatible APIs have no top_k, so those providers receive only
+	// TopP and Stop.
+	TopP *float64
+	TopK *int
+	Stop []string
+
+	// MaxTokensCap, when positive, clamps the effective max_tokens sent to
+	// the provider. The failover engine sets it from defaults.max_tokens_cap.
+	MaxTokensCap int
+
+	// MaxOutputTokens is the target model's max_output_tokens, filled in by
+	// callProvider for each attempt. It is the default when MaxTokens is
+	// unset and an upper bound otherwise.
+	MaxOutputTokens int
+
+	// Tools and ToolChoice are the client's tool definitions, translated to
+	// each provider's tool-calling format on the normalised path. Ollama has
+	// no tool_choice equivalent, so it receives only the tools.
+	Tools      []ProviderTool
+	ToolChoice *ProviderToolChoice
+
+	// ServiceTier is the Anthropic service_tier ("auto" or "standard_only"),
+	// sent on the normalised Anthropic path when set; the raw passthrough
+	// path already carries it in RawAnthropicBody. Other providers ignore it.
+	ServiceTier string
+
+	// Metadata is the Anthropic request metadata (e.g. "user_id" for abuse
+	// monitoring). It is sent on the normalised Anthropic path; the raw
+	// passthrough path already carries it in RawAnthropicBody.
+	Metadata map[string]string
+
+	// ResponseFormat is the client's OpenAI-style response_format (e.g.
+	// {"type":"json_object"}). It is forwarded to openai_compat providers,
+	// mapped to Ollama's format parameter, and emulated for Anthropic with a
+	// system-prompt instruction.
+	ResponseFormat json.RawMessage
+
 	// RawAnthropicBody, when non-nil, is the original Anthropic API request
 	// body. For Anthropic-provider targets this is forwarded directly —
 	// preserving tool_use, tool_result, images, thinking blocks, etc. — with
@@ -32,12 +78,21 @@ type ProviderRequest struct {
 	// and API key ("x-api-key: …") auth. When set, this is used instead of
 	// the ANTHROPIC_API_KEY environment variable.
 	AnthropicAuthHeader http.Header
+
+	// TraceHeaders carries the incoming request's headers for distributed
+	// tracing. Only names in traceHeaderAllowlist are forwarded to providers.
+	TraceHeaders http.Header
 }
 
 // ProviderMessage is a single turn in the conversation.
 type ProviderMessage struct {
 	Role    string
 	Content string
+
+	// Images holds the base64 data of the message's image blocks. Ollama
+	// receives them in the message's images field; the other normalised
+	// paths send only the text.
+	Images []string
 }
 
 // ProviderResponse holds the result of a fully-consumed, non-streaming call.
@@ -51,16 +106,23 @@ type ProviderResponse struct {
 	StopReason   string
 }
 
+// ErrUnknownProvider is returned by callProvider for a model whose provider
+// is not anthropic, openai_compat, or ollama. The failover engine skips such
+// a model, as it does one missing from the config; a CallFunc may return it
+// for the same effect.
+var ErrUnknownProvider = errors.New("unknown provider")
+
 // callProvider dispatches to the correct provider implementation based on
 // model.Provider. When RawAnthropicBody is set and the target is an Anthropic
 // provider, the raw body is forwarded directly (preserving rich content).
 // The returned *http.Response body is NOT consumed — the caller is responsible
 // for reading and closing it.
 func callProvider(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error) {
+	req.MaxOutputTokens = model.MaxOutputTokens
 	switch model.Provider {
 	case "anthropic":
 		if len(req.RawAnthropicBody) > 0 {
-			return callAnthropicRaw(ctx, model, req.RawAnthropicBody, req.AnthropicAuthHeader)
+			return callAnthropicRaw(ctx, model, req.RawAnthropicBody, req.AnthropicAuthHeader, req.TraceHeaders)
 		}
 		return callAnthropic(ctx, model, req)
 	case "openai_compat":
@@ -68,15 +130,29 @@ func callProvider(ctx context.Context, model config.Model, req ProviderRequest)
 	case "ollama":
 		return callOllama(ctx, model, req)
 	default:
-		return nil, fmt.Errorf("unknown provider %q", model.Provider)
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, model.Provider)
+	}
+}
+
+// defaultAnthropicBaseURL is used for anthropic models that set no base_url.
+const defaultAnthropicBaseURL = "https://api.anthropic.com"
+
+// anthropicBaseURL returns an anthropic model's base_url without a trailing
+// slash, or the official API when it is unset. Setting it sends requests
+// through a gateway or another Anthropic-compatible endpoint.
+func anthropicBaseURL(baseURL string) string {
+	if baseURL == "" {
+		return defaultAnthropicBaseURL
 	}
+	return strings.TrimRight(baseURL, "/")
 }
 
-// callAnthropic sends a request to the Anthropic Messages API.
-// Auth is forwarded from the incoming client request when available,
-// otherwise falls back to the ANTHROPIC_API_KEY environment variable.
+// callAnthropic sends a request to the Anthropic Messages API at
+// {base_url}/v1/messages. Auth is forwarded from the incoming client request
+// when available, otherwise falls back to the ANTHROPIC_API_KEY environment
+// variable.
 func callAnthropic(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error) {
-	endpoint := "https://api.anthropic.com/v1/messages"
+	endpoint := anthropicBaseURL(model.BaseURL) + "/v1/messages"
 
 	body := buildAnthropicBody(req, model.APIModel)
 	data, err := json.Marshal(body)
@@ -92,6 +168,7 @@ func callAnthropic(ctx context.Context, model config.Model, req ProviderRequest)
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	setAnthropicAuth(httpReq, req.AnthropicAuthHeader)
+	setTraceHeaders(httpReq, req.TraceHeaders)
 
 	return http.DefaultClient.Do(httpReq)
 }
@@ -100,7 +177,7 @@ func callAnthropic(ctx context.Context, model config.Model, req ProviderRequest)
 // endpoint. The base URL is taken from model.BaseURL; the API key is resolved
 // from environment variables based on the base URL domain.
 func callOpenAICompat(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error) {
-	endpoint := strings.TrimRight(model.BaseURL, "/") + "/chat/completions"
+	endpoint := openAICompatEndpoint(model)
 
 	body := buildOpenAICompatBody(req, model.APIModel)
 	data, err := json.Marshal(body)
@@ -113,15 +190,55 @@ func callOpenAICompat(ctx context.Context, model config.Model, req ProviderReque
 		return nil, fmt.Errorf("creating openai_compat request: %w", err)
 	}
 
-	apiKey := resolveAPIKey("openai_compat", model.BaseURL)
 	httpReq.Header.Set("Content-Type", "application/json")
-	if apiKey != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
-	}
+	setOpenAICompatAuth(httpReq, model.BaseURL, model.AuthStyle)
+	setTraceHeaders(httpReq, req.TraceHeaders)
 
 	return http.DefaultClient.Do(httpReq)
 }
 
+// azureAPIKeyEnv holds the key for openai_compat models with
+// auth_style: azure, whatever their base URL.
+const azureAPIKeyEnv = "AZURE_OPENAI_API_KEY"
+
+// defaultAzureAPIVersion is sent when an Azure model sets no api_version.
+const defaultAzureAPIVersion = "2024-10-21"
+
+// azureAPIVersion returns model's api_version, or defaultAzureAPIVersion.
+func azureAPIVersion(model config.Model) string {
+	if model.APIVersion != "" {
+		return model.APIVersion
+	}
+	return defaultAzureAPIVersion
+}
+
+// openAICompatEndpoint returns the chat completions URL for model. Azure
+// OpenAI addresses the deployment (api_model) in the path and requires an
+// api-version query parameter; other gateways use {base_url}/chat/completions.
+func openAICompatEndpoint(model config.Model) string {
+	base := strings.TrimRight(model.BaseURL, "/")
+	if model.AuthStyle == "azure" {
+		return base + "/openai/deployments/" + url.PathEscape(model.APIModel) +
+			"/chat/completions?api-version=" + url.QueryEscape(azureAPIVersion(model))
+	}
+	return base + "/chat/completions"
+}
+
+// setOpenAICompatAuth sets the API key on an outgoing openai_compat request:
+// an api-key header read from AZURE_OPENAI_API_KEY for authStyle "azure",
+// otherwise a Bearer token resolved from the base URL.
+func setOpenAICompatAuth(httpReq *http.Request, baseURL, authStyle string) {
+	if authStyle == "azure" {
+		if apiKey := os.Getenv(azureAPIKeyEnv); apiKey != "" {
+			httpReq.Header.Set("api-key", apiKey)
+		}
+		return
+	}
+	if apiKey := resolveAPIKey("openai_compat", baseURL); apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
 // callOllama sends a request to an Ollama /api/chat endpoint.
 // Ollama typically runs locally and requires no API key.
 func callOllama(ctx context.Context, model config.Model, req ProviderRequest) (*http.Response, error) {
@@ -139,6 +256,7 @@ func callOllama(ctx context.Context, model config.Model, req ProviderRequest) (*
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	setTraceHeaders(httpReq, req.TraceHeaders)
 
 	return http.DefaultClient.Do(httpReq)
 }
@@ -164,29 +282,86 @@ func setAnthropicAuth(httpReq *http.Request, clientAuth http.Header) {
 	}
 }
 
+// traceHeaderAllowlist lists the incoming headers propagated to every
+// provider call: W3C Trace Context plus the request ID.
+var traceHeaderAllowlist = []string{"traceparent", "tracestate", "X-Request-Id"}
+
+// setTraceHeaders copies allowlisted tracing headers from src onto httpReq.
+// When OpenTelemetry tracing is enabled, the current span from the request
+// context is then injected so the provider call continues sr-router's trace.
+func setTraceHeaders(httpReq *http.Request, src http.Header) {
+	for _, name := range traceHeaderAllowlist {
+		if v := src.Get(name); v != "" {
+			httpReq.Header.Set(name, v)
+		}
+	}
+	otel.GetTextMapPropagator().Inject(httpReq.Context(), propagation.HeaderCarrier(httpReq.Header))
+}
+
 // resolveAPIKey returns the environment variable value appropriate for the
 // given provider and (for openai_compat) base URL.
 func resolveAPIKey(provider, baseURL string) string {
+	name := apiKeyEnvVar(provider, baseURL)
+	if name == "" {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// apiKeyEnvVar returns the name of the environment variable holding the API
+// key for the given provider and (for openai_compat) base URL, or "" when the
+// provider needs no key.
+func apiKeyEnvVar(provider, baseURL string) string {
 	switch provider {
 	case "anthropic":
-		return os.Getenv("ANTHROPIC_API_KEY")
+		return "ANTHROPIC_API_KEY"
 	case "openai_compat":
 		lower := strings.ToLower(baseURL)
 		switch {
 		case strings.Contains(lower, "minimax"):
-			return os.Getenv("MINIMAX_API_KEY")
+			return "MINIMAX_API_KEY"
 		case strings.Contains(lower, "cerebras"):
-			return os.Getenv("CEREBRAS_API_KEY")
+			return "CEREBRAS_API_KEY"
 		case strings.Contains(lower, "groq"):
-			return os.Getenv("GROQ_API_KEY")
+			return "GROQ_API_KEY"
+		case strings.Contains(lower, "openai.azure.com"):
+			return azureAPIKeyEnv
 		default:
-			return os.Getenv("OPENAI_API_KEY")
+			return "OPENAI_API_KEY"
 		}
 	default:
 		return ""
 	}
 }
 
+// defaultMaxTokens is used when neither the client nor the model's
+// max_output_tokens sets max_tokens.
+const defaultMaxTokens = 4096
+
+// effectiveMaxTokens returns the max_tokens to send for req: the client's
+// value (or the model's MaxOutputTokens, then defaultMaxTokens, when unset),
+// clamped to MaxOutputTokens and MaxTokensCap.
+func effectiveMaxTokens(req ProviderRequest) int {
+	maxTok := req.MaxTokens
+	if maxTok <= 0 {
+		maxTok = req.MaxOutputTokens
+	}
+	if maxTok <= 0 {
+		maxTok = defaultMaxTokens
+	}
+	return clampMaxTokens(maxTok, req.MaxOutputTokens, req.MaxTokensCap)
+}
+
+// clampMaxTokens lowers maxTok to each positive limit it exceeds.
+func clampMaxTokens(maxTok int, limits ...int) int {
+	for _, limit := range limits {
+		if limit > 0 && maxTok > limit {
+			maxTok = limit
+		}
+	}
+	return maxTok
+}
+
 // buildAnthropicBody constructs the JSON-serialisable map for the Anthropic
 // Messages API. It is exported for testing purposes within the package.
 func buildAnthropicBody(req ProviderRequest, apiModel string) map[string]interface{} {
@@ -198,10 +373,7 @@ func buildAnthropicBody(req ProviderRequest, apiModel string) map[string]interfa
 		})
 	}
 
-	maxTok := req.MaxTokens
-	if maxTok <= 0 {
-		maxTok = 4096
-	}
+	maxTok := effectiveMaxTokens(req)
 
 	body := map[string]interface{}{
 		"model":      apiModel,
@@ -210,8 +382,36 @@ func buildAnthropicBody(req ProviderRequest, apiModel string) map[string]interfa
 		"stream":     req.Stream,
 	}
 
-	if req.SystemPrompt != "" {
-		body["system"] = req.SystemPrompt
+	if system := joinPromptParts(req.SystemPrompt, jsonModeInstruction(req.ResponseFormat)); system != "" {
+		body["system"] = system
+	}
+
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		body["top_k"] = *req.TopK
+	}
+	if len(req.Stop) > 0 {
+		body["stop_sequences"] = req.Stop
+	}
+
+	if req.ServiceTier != "" {
+		body["service_tier"] = req.ServiceTier
+	}
+
+	if len(req.Metadata) > 0 {
+		body["metadata"] = req.Metadata
+	}
+
+	if len(req.Tools) > 0 {
+		body["tools"] = anthropicTools(req.Tools)
+		if req.ToolChoice != nil {
+			body["tool_choice"] = anthropicToolChoice(*req.ToolChoice)
+		}
 	}
 
 	return body
@@ -236,24 +436,52 @@ func buildOpenAICompatBody(req ProviderRequest, apiModel string) map[string]inte
 		})
 	}
 
-	maxTok := req.MaxTokens
-	if maxTok <= 0 {
-		maxTok = 4096
-	}
+	maxTok := effectiveMaxTokens(req)
 
-	return map[string]interface{}{
+	body := map[string]interface{}{
 		"model":      apiModel,
 		"max_tokens": maxTok,
 		"messages":   msgs,
 		"stream":     req.Stream,
 	}
+
+	// Ask for a final usage chunk so streamed responses report real token
+	// counts.
+	if req.Stream {
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+	if len(req.Stop) > 0 {
+		body["stop"] = req.Stop
+	}
+
+	if len(req.Tools) > 0 {
+		body["tools"] = openAITools(req.Tools)
+		if req.ToolChoice != nil {
+			if choice, ok := openAIToolChoice(*req.ToolChoice); ok {
+				body["tool_choice"] = choice
+			}
+		}
+	}
+
+	if len(req.ResponseFormat) > 0 {
+		body["response_format"] = req.ResponseFormat
+	}
+
+	return body
 }
 
 // callAnthropicRaw sends a pre-built JSON body to the Anthropic Messages API.
 // The body is forwarded as-is — the caller is responsible for patching the
 // model name and injecting any prompt suffix before calling this function.
-func callAnthropicRaw(ctx context.Context, model config.Model, patchedBody []byte, authHeader http.Header) (*http.Response, error) {
-	endpoint := "https://api.anthropic.com/v1/messages"
+func callAnthropicRaw(ctx context.Context, model config.Model, patchedBody []byte, authHeader, traceHeader http.Header) (*http.Response, error) {
+	endpoint := anthropicBaseURL(model.BaseURL) + "/v1/messages"
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(patchedBody))
 	if err != nil {
@@ -263,6 +491,7 @@ func callAnthropicRaw(ctx context.Context, model config.Model, patchedBody []byt
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	setAnthropicAuth(httpReq, authHeader)
+	setTraceHeaders(httpReq, traceHeader)
 
 	return http.DefaultClient.Do(httpReq)
 }
@@ -273,10 +502,29 @@ func callAnthropicRaw(ctx context.Context, model config.Model, patchedBody []byt
 // tool_use, tool_result, images, thinking blocks, etc.) are preserved
 // byte-for-byte.
 func PatchAnthropicRawBody(rawBody []byte, apiModel string, suffix string) ([]byte, error) {
+	return PatchAnthropicRawBodyAffixes(rawBody, apiModel, "", suffix, 0)
+}
+
+// PatchAnthropicRawBodyAffixes is PatchAnthropicRawBody that also prepends
+// prefix to the "system" field. A string system prompt becomes
+// "prefix\n\nsystem\n\nsuffix"; a content-block system prompt gains a
+// leading and/or trailing text block. When maxTokensCap is positive, a
+// larger (or missing) "max_tokens" is clamped to it. A "response_format"
+// field, which Anthropic rejects, is dropped; callers emulate it through the
+// suffix instead.
+//
+// A body that is not a JSON object, or whose "system" field is neither a
+// string nor an array when there is a prefix or suffix to add, is rejected
+// with an error rather than forwarded half-patched.
+func PatchAnthropicRawBodyAffixes(rawBody []byte, apiModel, prefix, suffix string, maxTokensCap int) ([]byte, error) {
 	var body map[string]json.RawMessage
 	if err := json.Unmarshal(rawBody, &body); err != nil {
 		return nil, fmt.Errorf("unmarshalling raw body: %w", err)
 	}
+	// A JSON null unmarshals into a nil map without error.
+	if body == nil {
+		return nil, fmt.Errorf("unmarshalling raw body: not a JSON object")
+	}
 
 	// Patch the model field.
 	modelJSON, err := json.Marshal(apiModel)
@@ -284,43 +532,78 @@ func PatchAnthropicRawBody(rawBody []byte, apiModel string, suffix string) ([]by
 		return nil, fmt.Errorf("marshalling api_model: %w", err)
 	}
 	body["model"] = modelJSON
+	delete(body, "response_format")
 
-	// Inject suffix into system if needed.
-	if suffix != "" {
-		if existing, ok := body["system"]; ok {
-			// Try as plain string.
-			var s string
-			if err := json.Unmarshal(existing, &s); err == nil {
-				if s == "" {
-					s = suffix
-				} else {
-					s += "\n\n" + suffix
-				}
-				patched, _ := json.Marshal(s)
-				body["system"] = patched
-			} else {
-				// Try as array of content blocks.
-				var blocks []json.RawMessage
-				if err := json.Unmarshal(existing, &blocks); err == nil {
-					newBlock, _ := json.Marshal(map[string]string{
-						"type": "text",
-						"text": "\n\n" + suffix,
-					})
-					blocks = append(blocks, newBlock)
-					patched, _ := json.Marshal(blocks)
-					body["system"] = patched
-				}
+	if maxTokensCap > 0 {
+		var maxTok int
+		if existing, ok := body["max_tokens"]; ok {
+			json.Unmarshal(existing, &maxTok) //nolint:errcheck
+		}
+		if maxTok <= 0 || maxTok > maxTokensCap {
+			if body["max_tokens"], err = json.Marshal(maxTokensCap); err != nil {
+				return nil, fmt.Errorf("marshalling max_tokens: %w", err)
 			}
-		} else {
-			// No system field — add it as a plain string.
-			patched, _ := json.Marshal(suffix)
-			body["system"] = patched
 		}
 	}
 
+	// Inject prefix and suffix into system if needed.
+	if prefix != "" || suffix != "" {
+		system, err := patchSystem(body["system"], prefix, suffix)
+		if err != nil {
+			return nil, err
+		}
+		body["system"] = system
+	}
+
 	return json.Marshal(body)
 }
 
+// patchSystem returns the raw "system" field with prefix and suffix added.
+// A missing or null field becomes a plain string.
+func patchSystem(existing json.RawMessage, prefix, suffix string) (json.RawMessage, error) {
+	var s string
+	if existing == nil || json.Unmarshal(existing, &s) == nil {
+		patched, err := json.Marshal(joinPromptParts(prefix, s, suffix))
+		if err != nil {
+			return nil, fmt.Errorf("marshalling system: %w", err)
+		}
+		return patched, nil
+	}
+
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(existing, &blocks); err != nil {
+		return nil, fmt.Errorf("system must be a string or an array of content blocks: %w", err)
+	}
+	if prefix != "" {
+		newBlock, err := json.Marshal(map[string]string{"type": "text", "text": prefix + "\n\n"})
+		if err != nil {
+			return nil, fmt.Errorf("marshalling system prefix: %w", err)
+		}
+		blocks = append([]json.RawMessage{newBlock}, blocks...)
+	}
+	if suffix != "" {
+		newBlock, err := json.Marshal(map[string]string{"type": "text", "text": "\n\n" + suffix})
+		if err != nil {
+			return nil, fmt.Errorf("marshalling system suffix: %w", err)
+		}
+		blocks = append(blocks, newBlock)
+	}
+	patched, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling system: %w", err)
+	}
+	return patched, nil
+}
+
+// getModelPrefix returns the trimmed prompt prefix for a model, or "" if none.
+func getModelPrefix(cfg *config.Config, modelName string) string {
+	m, ok := cfg.Models[modelName]
+	if !ok || m.PromptPrefix == nil {
+		return ""
+	}
+	return strings.TrimSpace(*m.PromptPrefix)
+}
+
 // getModelSuffix returns the trimmed prompt suffix for a model, or "" if none.
 func getModelSuffix(cfg *config.Config, modelName string) string {
 	m, ok := cfg.Models[modelName]
@@ -331,35 +614,59 @@ func getModelSuffix(cfg *config.Config, modelName string) string {
 }
 
 // buildOllamaBody constructs the JSON-serialisable map for the Ollama
-// /api/chat endpoint. Token limit is conveyed via options.num_predict.
+// /api/chat endpoint. Token limit is conveyed via options.num_predict, and
+// each message's images are sent base64-encoded in its images field.
 func buildOllamaBody(req ProviderRequest, apiModel string) map[string]interface{} {
-	msgs := make([]map[string]string, 0, len(req.Messages)+1)
+	msgs := make([]map[string]interface{}, 0, len(req.Messages)+1)
 
 	if req.SystemPrompt != "" {
-		msgs = append(msgs, map[string]string{
+		msgs = append(msgs, map[string]interface{}{
 			"role":    "system",
 			"content": req.SystemPrompt,
 		})
 	}
 
 	for _, m := range req.Messages {
-		msgs = append(msgs, map[string]string{
+		msg := map[string]interface{}{
 			"role":    m.Role,
 			"content": m.Content,
-		})
+		}
+		if len(m.Images) > 0 {
+			msg["images"] = m.Images
+		}
+		msgs = append(msgs, msg)
 	}
 
-	maxTok := req.MaxTokens
-	if maxTok <= 0 {
-		maxTok = 4096
+	options := map[string]interface{}{
+		"num_predict": effectiveMaxTokens(req),
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		options["top_k"] = *req.TopK
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
 	}
 
-	return map[string]interface{}{
+	body := map[string]interface{}{
 		"model":    apiModel,
 		"messages": msgs,
 		"stream":   req.Stream,
-		"options": map[string]int{
-			"num_predict": maxTok,
-		},
+		"options":  options,
+	}
+
+	if len(req.Tools) > 0 {
+		body["tools"] = openAITools(req.Tools)
 	}
+
+	if format := ollamaFormat(req.ResponseFormat); format != nil {
+		body["format"] = format
+	}
+
+	return body
 }
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+func TestBuildOpenAICompatBodyRequestsStreamUsage(t *testing.T) {
+	req := ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}, Stream: true}
+	body := encodeBody(t, buildOpenAICompatBody(req, "gpt-test"))
+	opts, _ := body["stream_options"].(map[string]any)
+	if opts["include_usage"] != true {
+		t.Errorf("stream_options = %v, want include_usage true", body["stream_options"])
+	}
+
+	req.Stream = false
+	body = encodeBody(t, buildOpenAICompatBody(req, "gpt-test"))
+	if _, ok := body["stream_options"]; ok {
+		t.Error("expected no stream_options for a non-streaming request")
+	}
+}
+
+func TestCallAnthropicHonoursBaseURL(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	model := config.Model{Provider: "anthropic", APIModel: "claude-test", BaseURL: srv.URL + "/"}
+	req := ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}, MaxTokens: 10}
+
+	resp, err := callProvider(context.Background(), model, req)
+	if err != nil {
+		t.Fatalf("normalised request: %v", err)
+	}
+	resp.Body.Close()
+
+	req.RawAnthropicBody = []byte(`{"model":"claude-test","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`)
+	resp, err = callProvider(context.Background(), model, req)
+	if err != nil {
+		t.Fatalf("raw request: %v", err)
+	}
+	resp.Body.Close()
+
+	if want := []string{"/v1/messages", "/v1/messages"}; !slices.Equal(paths, want) {
+		t.Errorf("gateway received paths %v, want %v", paths, want)
+	}
+}
+
+func TestAnthropicBaseURLDefault(t *testing.T) {
+	if got := anthropicBaseURL(""); got != "https://api.anthropic.com" {
+		t.Errorf("anthropicBaseURL(\"\") = %q, want the official API", got)
+	}
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedSource makes a rand.Source64 safe for concurrent use, since routing
+// runs on many proxy goroutines at once.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// rngSource backs rng. It is seeded from the clock at startup; Seed makes
+// subsequent draws reproducible.
+var rngSource = &lockedSource{src: rand.NewSource(time.Now().UnixNano()).(rand.Source64)}
+
+// rng is the single source of randomness for routing (sampling, jitter,
+// weighted selection). Code in this package draws from rng rather than the
+// global math/rand functions so a seeded run is fully reproducible.
+var rng = rand.New(rngSource)
+
+// Seed reseeds the routing RNG. Two runs with the same seed and inputs make
+// identical random choices.
+func Seed(seed int64) {
+	rngSource.Seed(seed)
+}
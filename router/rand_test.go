@@ -0,0 +1,64 @@
+package router
+
+import "testing"
+
+func TestSeedReproducible(t *testing.T) {
+	draw := func() []float64 {
+		out := make([]float64, 10)
+		for i := range out {
+			out[i] = rng.Float64()
+		}
+		return out
+	}
+
+	Seed(42)
+	first := draw()
+	Seed(42)
+	second := draw()
+	Seed(43)
+	other := draw()
+
+	same, differs := true, false
+	for i := range first {
+		if first[i] != second[i] {
+			same = false
+		}
+		if first[i] != other[i] {
+			differs = true
+		}
+	}
+	if !same {
+		t.Errorf("same seed produced different sequences: %v vs %v", first, second)
+	}
+	if !differs {
+		t.Error("different seeds produced identical sequences")
+	}
+}
+
+func TestSeedIdenticalDecisions(t *testing.T) {
+	cfg := loadTestConfig(t)
+	c := NewClassifier(cfg)
+	r := NewRouter(cfg)
+	prompts := []string{
+		"Write a Go function for rate limiting",
+		"Summarize this document",
+		"What is a goroutine?",
+		"Design a microservice architecture",
+	}
+
+	run := func() []RoutingDecision {
+		Seed(7)
+		var out []RoutingDecision
+		for _, p := range prompts {
+			out = append(out, r.Route(c.Classify(p, nil)))
+		}
+		return out
+	}
+
+	first, second := run(), run()
+	for i := range first {
+		if first[i].Model != second[i].Model || first[i].Score != second[i].Score {
+			t.Errorf("prompt %q: decisions differ across seeded runs: %+v vs %+v", prompts[i], first[i], second[i])
+		}
+	}
+}
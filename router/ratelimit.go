@@ -0,0 +1,131 @@
+package router
+
+import (
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// tokenBucket is a mutex-guarded token bucket. Tokens refill continuously at
+// rate per second up to capacity; the balance may go negative to represent
+// requests that have reserved a future slot.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+
+	// requestsPerMinute and burst are the configured limits, so a reload
+	// can tell whether the bucket still applies.
+	requestsPerMinute int
+	burst             int
+}
+
+// newTokenBucket returns a full bucket allowing requestsPerMinute on average
+// with up to burst requests back-to-back.
+func newTokenBucket(requestsPerMinute, burst int) *tokenBucket {
+	b := &tokenBucket{requestsPerMinute: requestsPerMinute, burst: burst}
+	if burst < 1 {
+		burst = 1
+	}
+	b.rate = float64(requestsPerMinute) / 60
+	b.capacity = float64(burst)
+	b.tokens = float64(burst)
+	b.last = time.Now()
+	return b
+}
+
+// reserve takes one token and returns how long the caller must wait before
+// using it. If that wait would exceed maxWait, no token is taken and ok is
+// false.
+func (b *tokenBucket) reserve(maxWait time.Duration) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// providerLimiter holds one token bucket per rate-limited provider
+// endpoint, keyed by rateLimitKey.
+type providerLimiter struct {
+	buckets map[string]*tokenBucket
+}
+
+// rateLimitKey identifies the provider endpoint whose budget a model's
+// requests spend: its provider kind together with its base_url host, so
+// openai_compat models served by different hosts are limited separately.
+func rateLimitKey(m config.Model) string {
+	return m.Provider + "@" + baseURLHost(m.BaseURL)
+}
+
+// baseURLHost returns the host of baseURL, or "" when it has none.
+func baseURLHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// newProviderLimiter builds a bucket for every provider endpoint used by
+// cfg's models that has a positive requests_per_minute. The limit is taken
+// from the cfg.Providers entry named after the endpoint's base_url host, or
+// else from the one named after its provider kind, and applies to each
+// endpoint separately. Endpoints without a limit are not tracked.
+func newProviderLimiter(cfg *config.Config) *providerLimiter {
+	l := &providerLimiter{buckets: make(map[string]*tokenBucket)}
+	for _, m := range cfg.Models {
+		key := rateLimitKey(m)
+		if _, ok := l.buckets[key]; ok {
+			continue
+		}
+		spec, ok := cfg.Providers[baseURLHost(m.BaseURL)]
+		if !ok {
+			spec = cfg.Providers[m.Provider]
+		}
+		if spec.RequestsPerMinute > 0 {
+			l.buckets[key] = newTokenBucket(spec.RequestsPerMinute, spec.Burst)
+		}
+	}
+	return l
+}
+
+// keep replaces l's buckets with prev's for every endpoint whose
+// requests_per_minute and burst are unchanged, so a config reload neither
+// refills their budgets nor lets requests on the old and new engines each
+// spend a full one.
+func (l *providerLimiter) keep(prev *providerLimiter) {
+	for name, b := range l.buckets {
+		if old, ok := prev.buckets[name]; ok && old.requestsPerMinute == b.requestsPerMinute && old.burst == b.burst {
+			l.buckets[name] = old
+		}
+	}
+}
+
+// reserve reserves a request slot on the endpoint identified by key.
+// Unlimited endpoints always succeed immediately.
+func (l *providerLimiter) reserve(key string, maxWait time.Duration) (time.Duration, bool) {
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0, true
+	}
+	return b.reserve(maxWait)
+}
@@ -0,0 +1,192 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(60, 2) // 1 request/second, burst of 2
+
+	for i := 0; i < 2; i++ {
+		if wait, ok := b.reserve(0); !ok || wait != 0 {
+			t.Fatalf("burst request %d: got (%v, %v), want immediate", i, wait, ok)
+		}
+	}
+
+	// Bucket is empty: a zero budget is refused, a generous one waits ~1s.
+	if _, ok := b.reserve(0); ok {
+		t.Error("expected reservation to be refused with zero max wait")
+	}
+	wait, ok := b.reserve(5 * time.Second)
+	if !ok {
+		t.Fatal("expected reservation within a 5s budget")
+	}
+	if wait < 900*time.Millisecond || wait > time.Second {
+		t.Errorf("got wait %v, want ~1s", wait)
+	}
+}
+
+// TestExecuteWithFailover_RateLimitCapsThroughput fires concurrent requests
+// at a provider limited to 20 requests per second (burst 1) and
+// asserts the engine spaces them out instead of sending them all at once.
+func TestExecuteWithFailover_RateLimitCapsThroughput(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptSuffix: &suffix},
+	}, []string{"model-a"})
+	cfg.Providers = map[string]config.ProviderSpec{
+		"openai_compat": {RequestsPerMinute: 1200}, // 20/s
+	}
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	decision := testDecision("model-a")
+	decision.LatencyBudgetMs = 10000
+
+	const n = 6
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _, err := engine.ExecuteWithFailover(context.Background(), decision,
+				ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if got := atomic.LoadInt32(&calls); got != n {
+		t.Errorf("expected %d provider calls, got %d", n, got)
+	}
+	// One immediate request, then five spaced 50ms apart.
+	if min := 5 * 50 * time.Millisecond; elapsed < min-10*time.Millisecond {
+		t.Errorf("requests completed in %v, expected at least ~%v under the rate limit", elapsed, min)
+	}
+}
+
+// TestExecuteWithFailover_RateLimitFailsOverToOtherProvider verifies that
+// when a provider's slot can't be obtained within the latency budget, the
+// engine moves on to a model from a different provider.
+func TestExecuteWithFailover_RateLimitFailsOverToOtherProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	suffix := ""
+	cfg := minimalConfig(map[string]config.Model{
+		"model-a": {Provider: "openai_compat", APIModel: "gpt-a", BaseURL: srv.URL, PromptSuffix: &suffix},
+		"model-b": {Provider: "ollama", APIModel: "llama", BaseURL: srv.URL, PromptSuffix: &suffix},
+	}, []string{"model-a", "model-b"})
+	cfg.Providers = map[string]config.ProviderSpec{
+		"openai_compat": {RequestsPerMinute: 1}, // one request, then a 60s wait
+	}
+	engine := NewFailoverEngine(cfg, NewRouter(cfg), nil)
+
+	decision := testDecision("model-a", "model-b")
+	decision.LatencyBudgetMs = 100
+	req := ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}}
+
+	wantModels := []string{"model-a", "model-b"}
+	for i, want := range wantModels {
+		resp, modelName, err := engine.ExecuteWithFailover(context.Background(), decision, req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		resp.Body.Close()
+		if modelName != want {
+			t.Errorf("request %d: got model %q, want %q", i, modelName, want)
+		}
+	}
+}
+
+func TestProviderLimiterKeysByEndpoint(t *testing.T) {
+	cfg := minimalConfig(map[string]config.Model{
+		"minimax":        {Provider: "openai_compat", BaseURL: "https://api.minimax.io/v1"},
+		"cerebras":       {Provider: "openai_compat", BaseURL: "https://api.cerebras.ai/v1"},
+		"cerebras-small": {Provider: "openai_compat", BaseURL: "https://api.cerebras.ai/v1"},
+		"groq":           {Provider: "openai_compat", BaseURL: "https://api.groq.com/openai/v1"},
+	}, nil)
+	cfg.Providers = map[string]config.ProviderSpec{
+		"openai_compat": {RequestsPerMinute: 1},
+		"api.groq.com":  {RequestsPerMinute: 2, Burst: 2},
+	}
+	l := newProviderLimiter(cfg)
+	reserve := func(model string) bool {
+		_, ok := l.reserve(rateLimitKey(cfg.Models[model]), 0)
+		return ok
+	}
+
+	// Each host gets its own budget of the openai_compat limit.
+	if !reserve("minimax") {
+		t.Error("minimax: first request refused")
+	}
+	if !reserve("cerebras") {
+		t.Error("cerebras: first request refused after minimax spent its budget")
+	}
+	// Models on the same host share one.
+	if reserve("cerebras-small") {
+		t.Error("cerebras-small: request allowed although cerebras spent the host's budget")
+	}
+	// A host entry overrides the provider kind's limit.
+	if !reserve("groq") || !reserve("groq") {
+		t.Error("groq: host limit with burst 2 refused a second request")
+	}
+}
+
+func TestKeepRateLimits(t *testing.T) {
+	models := map[string]config.Model{
+		"model-a": {Provider: "ollama"},
+		"model-b": {Provider: "openai_compat", BaseURL: "https://api.example.com/v1"},
+	}
+	newEngine := func(providers map[string]config.ProviderSpec) *FailoverEngine {
+		cfg := minimalConfig(models, nil)
+		cfg.Providers = providers
+		return NewFailoverEngine(cfg, NewRouter(cfg), nil)
+	}
+	old := newEngine(map[string]config.ProviderSpec{
+		"ollama":        {RequestsPerMinute: 1},
+		"openai_compat": {RequestsPerMinute: 1},
+	})
+	for name, m := range models {
+		if _, ok := old.limiter.reserve(rateLimitKey(m), 0); !ok {
+			t.Fatalf("%s: first request refused", name)
+		}
+	}
+
+	reloaded := newEngine(map[string]config.ProviderSpec{
+		"ollama":        {RequestsPerMinute: 1},
+		"openai_compat": {RequestsPerMinute: 2},
+	})
+	reloaded.KeepRateLimits(old)
+
+	// The unchanged limit keeps its spent budget; the changed one starts
+	// afresh.
+	if _, ok := reloaded.limiter.reserve(rateLimitKey(models["model-a"]), 0); ok {
+		t.Error("ollama: reload refilled an unchanged rate limit")
+	}
+	if _, ok := reloaded.limiter.reserve(rateLimitKey(models["model-b"]), 0); !ok {
+		t.Error("openai_compat: changed rate limit should start with a full budget")
+	}
+}
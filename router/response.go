@@ -0,0 +1,129 @@
+package router
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecodeProviderResponse reads a non-streaming response body in provider's
+// wire format ("anthropic", "openai_compat", or "ollama") into a
+// ProviderResponse. Stop reasons are reported as the provider sent them.
+func DecodeProviderResponse(provider string, body io.Reader) (ProviderResponse, error) {
+	var out ProviderResponse
+	switch provider {
+	case "anthropic":
+		var r struct {
+			Model   string `json:"model"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			StopReason string `json:"stop_reason"`
+			Usage      struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.NewDecoder(body).Decode(&r); err != nil {
+			return out, fmt.Errorf("decoding anthropic response: %w", err)
+		}
+		var sb strings.Builder
+		for _, c := range r.Content {
+			if c.Type == "text" {
+				sb.WriteString(c.Text)
+			}
+		}
+		out = ProviderResponse{
+			Content:      sb.String(),
+			Model:        r.Model,
+			InputTokens:  r.Usage.InputTokens,
+			OutputTokens: r.Usage.OutputTokens,
+			StopReason:   r.StopReason,
+		}
+	case "openai_compat":
+		var r struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.NewDecoder(body).Decode(&r); err != nil {
+			return out, fmt.Errorf("decoding openai_compat response: %w", err)
+		}
+		out = ProviderResponse{
+			Model:        r.Model,
+			InputTokens:  r.Usage.PromptTokens,
+			OutputTokens: r.Usage.CompletionTokens,
+		}
+		if len(r.Choices) > 0 {
+			out.Content = r.Choices[0].Message.Content
+			out.StopReason = r.Choices[0].FinishReason
+		}
+	case "ollama":
+		var r struct {
+			Model   string `json:"model"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			DoneReason      string `json:"done_reason"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+		}
+		if err := json.NewDecoder(body).Decode(&r); err != nil {
+			return out, fmt.Errorf("decoding ollama response: %w", err)
+		}
+		out = ProviderResponse{
+			Content:      r.Message.Content,
+			Model:        r.Model,
+			InputTokens:  r.PromptEvalCount,
+			OutputTokens: r.EvalCount,
+			StopReason:   r.DoneReason,
+		}
+	default:
+		return out, fmt.Errorf("unknown provider %q", provider)
+	}
+	return out, nil
+}
+
+// gzipBody decompresses a gzip-encoded response body, closing both the gzip
+// reader and the underlying body on Close.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// DecodeResponseBody wraps resp.Body in a gzip reader when the provider sent
+// Content-Encoding: gzip, which some OpenAI-compatible gateways do
+// regardless of what the client asked for. The header is removed so the body
+// is not decoded twice.
+func DecodeResponseBody(resp *http.Response) error {
+	if !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "gzip") {
+		return nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("decompressing gzip response: %w", err)
+	}
+	resp.Body = gzipBody{zr, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
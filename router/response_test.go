@@ -0,0 +1,45 @@
+package router
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeProviderResponse(t *testing.T) {
+	tests := []struct {
+		provider string
+		body     string
+		want     ProviderResponse
+	}{
+		{"anthropic",
+			`{"model":"claude-test","content":[{"type":"text","text":"hel"},{"type":"tool_use","id":"t"},{"type":"text","text":"lo"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`,
+			ProviderResponse{Content: "hello", Model: "claude-test", InputTokens: 12, OutputTokens: 3, StopReason: "end_turn"}},
+		{"openai_compat",
+			`{"model":"gpt-test","choices":[{"message":{"content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+			ProviderResponse{Content: "hello", Model: "gpt-test", InputTokens: 12, OutputTokens: 3, StopReason: "stop"}},
+		{"ollama",
+			`{"model":"llama3","message":{"role":"assistant","content":"hello"},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":3}`,
+			ProviderResponse{Content: "hello", Model: "llama3", InputTokens: 12, OutputTokens: 3, StopReason: "stop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			got, err := DecodeProviderResponse(tt.provider, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProviderResponseErrors(t *testing.T) {
+	if _, err := DecodeProviderResponse("openai_compat", strings.NewReader("not json")); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if _, err := DecodeProviderResponse("carrier-pigeon", strings.NewReader("{}")); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
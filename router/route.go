@@ -1,7 +1,10 @@
 package router
 
 import (
+	"fmt"
+	"math"
 	"sort"
+	"strings"
 
 	"github.com/jbctechsolutions/sr-router/config"
 )
@@ -15,12 +18,62 @@ type RoutingDecision struct {
 	Reasoning    string
 	EstCost      float64
 	Alternatives []Alternative
+
+	// Detail is the structured form of Reasoning.
+	Detail ReasoningDetail
+
+	// LatencyBudgetMs is carried over from the classification so the
+	// failover engine knows how long it may wait on a rate-limited provider.
+	LatencyBudgetMs int
 }
 
-// Alternative is a model that was considered but not selected.
+// Alternative is a model that was considered but not selected. EstCost is
+// its cost_per_1k_tokens, for comparison with the decision's EstCost.
 type Alternative struct {
-	Model string
-	Score float64
+	Model   string
+	Score   float64
+	EstCost float64
+}
+
+// ReasoningDetail breaks a routing decision down for display: the filters
+// candidates had to pass, the components of the winning score, and why each
+// alternative lost.
+type ReasoningDetail struct {
+	// MinQuality, RequiredStrengths, and StrengthMatch are the filters every
+	// candidate had to pass before scoring.
+	MinQuality        float64
+	RequiredStrengths []string
+	StrengthMatch     string
+
+	// Tiers lists the tiers searched, in order, when routing was limited to
+	// tiers. It is nil when every configured model was considered.
+	Tiers []string
+
+	// Excluded maps each considered model that failed a filter to the reason.
+	Excluded map[string]string
+
+	// Selection is "best_score", "weighted_random", or "fallback" when no
+	// model qualified.
+	Selection string
+
+	// The winning score is CostWeight*CostScore + QualityWeight*QualityScore.
+	CostWeight    float64
+	QualityWeight float64
+	CostScore     float64
+	QualityScore  float64
+
+	// Alternatives explains each of the decision's alternatives, in the
+	// same order.
+	Alternatives []AlternativeDetail
+}
+
+// AlternativeDetail gives an alternative's score components and why it was
+// not selected.
+type AlternativeDetail struct {
+	Model        string
+	CostScore    float64
+	QualityScore float64
+	LostBecause  string
 }
 
 // Router selects the best model for a Classification using weighted scoring.
@@ -39,82 +92,427 @@ func NewRouter(cfg *config.Config) *Router {
 // Models that do not meet the task's MinQuality floor or that lack a required
 // strength are excluded before scoring. The tier is derived from the selected
 // model's membership rather than being predetermined by the route class.
+//
+// When defaults.tier_escalation is configured, candidates are instead limited
+// to the classified tier; if none of its models qualify, the tiers after it
+// in the escalation list are tried in order. A tier-pinned classification
+// (see Classifier.AsRouteClass) is routed the same way without escalation
+// configured, using only its own tier.
+//
 // If no model qualifies, the configured fallback model is returned.
 func (r *Router) Route(class Classification) RoutingDecision {
-	type scored struct {
-		name  string
-		score float64
+	if d, ok := r.route(class); ok {
+		return d
 	}
+	return r.fallbackDecision(class)
+}
 
-	// Determine the maximum cost across all models for normalisation.
-	maxCost := 0.0
-	for _, m := range r.cfg.Models {
-		if m.CostPer1kTok > maxCost {
-			maxCost = m.CostPer1kTok
+// RouteStrict is Route without the fallback model: when no model qualifies it
+// returns an error listing why each model was excluded, so the config or the
+// classification's constraints can be fixed.
+func (r *Router) RouteStrict(class Classification) (RoutingDecision, error) {
+	if d, ok := r.route(class); ok {
+		return d, nil
+	}
+	return RoutingDecision{}, r.noQualifiedModelError(class)
+}
+
+// route selects the best qualifying model, reporting false when there is none.
+func (r *Router) route(class Classification) (RoutingDecision, bool) {
+	if r.tierEscalation(class) {
+		return r.routeWithEscalation(class)
+	}
+
+	names := make([]string, 0, len(r.cfg.Models))
+	for name := range r.cfg.Models {
+		names = append(names, name)
+	}
+	candidates := r.scoreCandidates(class, names, r.cfg.Tiers[class.Tier].PreferredModel)
+	if len(candidates) == 0 {
+		return RoutingDecision{}, false
+	}
+
+	how := "cheapest qualified"
+	if r.weightedSelection() {
+		candidates = r.sampleCandidates(candidates)
+		how = "weighted pick of top candidates"
+	}
+	best := candidates[0]
+	return r.decision(class, candidates, r.findModelTier(best.name),
+		class.TaskType+" task → "+best.name+" ("+how+")", nil), true
+}
+
+// tierEscalation reports whether class is routed within its tier, because
+// defaults.tier_escalation is configured or the class is tier-pinned, rather
+// than across every model.
+func (r *Router) tierEscalation(class Classification) bool {
+	return (len(r.cfg.Defaults.TierEscalation) > 0 || class.TierPinned) && class.Tier != ""
+}
+
+// noQualifiedModelError describes why no model could serve class, giving
+// each configured model's exclusion reason in name order.
+func (r *Router) noQualifiedModelError(class Classification) error {
+	var tiers map[string]bool
+	if r.tierEscalation(class) {
+		tiers = make(map[string]bool)
+		for _, tier := range r.escalationOrder(class.Tier) {
+			for _, name := range r.cfg.GetTierModels(tier) {
+				tiers[name] = true
+			}
 		}
 	}
-	if maxCost == 0 {
-		maxCost = 1.0
+
+	names := make([]string, 0, len(r.cfg.Models))
+	for name := range r.cfg.Models {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	var candidates []scored
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reason := exclusionReason(r.cfg.Models[name], class)
+		if reason == "" && tiers != nil && !tiers[name] {
+			reason = "not in tiers " + strings.Join(r.escalationOrder(class.Tier), ", ")
+		}
+		if reason != "" {
+			reasons = append(reasons, name+": "+reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return fmt.Errorf("no model qualifies for %s task: no models configured", class.TaskType)
+	}
+	return fmt.Errorf("no model qualifies for %s task (min quality %.2f): %s",
+		class.TaskType, class.MinQuality, strings.Join(reasons, "; "))
+}
 
-	for name, m := range r.cfg.Models {
-		// Quality floor filter.
-		if m.QualityCeiling < class.MinQuality {
+// routeWithEscalation scores only the models in the classified tier, then
+// each later tier in defaults.tier_escalation, returning the best model from
+// the first tier that has any qualifying candidate.
+func (r *Router) routeWithEscalation(class Classification) (RoutingDecision, bool) {
+	order := r.escalationOrder(class.Tier)
+	for i, tier := range order {
+		candidates := r.scoreCandidates(class, r.cfg.GetTierModels(tier), r.cfg.Tiers[tier].PreferredModel)
+		if len(candidates) == 0 {
 			continue
 		}
 
-		// Required-strengths filter.
-		if !hasStrengths(m.Strengths, class.RequiredStrengths) {
-			continue
+		how := "cheapest qualified"
+		if r.weightedSelection() {
+			candidates = r.sampleCandidates(candidates)
+			how = "weighted pick of top candidates"
 		}
+		best := candidates[0]
+		reasoning := class.TaskType + " task → " + best.name + " (" + how + " in " + tier + ")"
+		if tier != class.Tier {
+			reasoning += ", escalated from " + class.Tier
+		}
+		return r.decision(class, candidates, tier, reasoning, order[:i+1]), true
+	}
+	return RoutingDecision{}, false
+}
 
-		// Weighted score: higher quality and lower cost both improve the score.
-		qualityScore := m.QualityCeiling
-		costScore := 1.0 - (m.CostPer1kTok / maxCost)
+// escalationOrder returns the tiers to try for a request classified into
+// tier: tier itself, then the tiers listed after it in
+// defaults.tier_escalation. A tier absent from the list escalates through
+// the whole list.
+func (r *Router) escalationOrder(tier string) []string {
+	order := []string{tier}
+	rest := r.cfg.Defaults.TierEscalation
+	for i, t := range rest {
+		if t == tier {
+			rest = rest[i+1:]
+			break
+		}
+	}
+	for _, t := range rest {
+		if t != tier {
+			order = append(order, t)
+		}
+	}
+	return order
+}
 
-		cw := r.cfg.Defaults.CostWeight
-		qw := r.cfg.Defaults.QualityWeight
-		total := cw*costScore + qw*qualityScore
+// EligibleModels returns, sorted by name, every configured model that passes
+// the classification's filters (quality floor, required strengths, not
+// disabled), without scoring or ranking them. These are the candidates Route
+// scores when tier escalation is off.
+func (r *Router) EligibleModels(class Classification) []string {
+	var names []string
+	for name, m := range r.cfg.Models {
+		if exclusionReason(m, class) == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
 
-		candidates = append(candidates, scored{name: name, score: total})
+// EligibleTiers maps every configured tier to the models in it that pass the
+// classification's filters, as EligibleModels does, sorted by name. A tier
+// with no eligible model maps to an empty slice; models a tier lists but
+// that are not configured are left out.
+func (r *Router) EligibleTiers(class Classification) map[string][]string {
+	tiers := make(map[string][]string, len(r.cfg.Tiers))
+	for name, tier := range r.cfg.Tiers {
+		eligible := []string{}
+		for _, model := range tier.Models {
+			if m, ok := r.cfg.Models[model]; ok && exclusionReason(m, class) == "" {
+				eligible = append(eligible, model)
+			}
+		}
+		sort.Strings(eligible)
+		tiers[name] = eligible
 	}
+	return tiers
+}
 
-	if len(candidates) == 0 {
-		return RoutingDecision{
-			Model:     r.cfg.Defaults.FallbackModel,
-			Score:     0,
-			Tier:      class.Tier,
-			Reasoning: "no qualified models, using fallback",
+// scoredModel is a candidate model with its weighted routing score and the
+// score's components.
+type scoredModel struct {
+	name         string
+	score        float64
+	costScore    float64
+	qualityScore float64
+}
+
+// scoreCandidates filters names down to models meeting the classification's
+// quality floor and required strengths and returns them sorted by descending
+// score. Ties go to preferred (the tier's preferred_model, if any), then by
+// model name for determinism.
+func (r *Router) scoreCandidates(class Classification, names []string, preferred string) []scoredModel {
+	maxCost := r.maxCost()
+
+	var candidates []scoredModel
+
+	for _, name := range names {
+		m, ok := r.cfg.Models[name]
+		if !ok {
+			continue
+		}
+		if exclusionReason(m, class) != "" {
+			continue
 		}
+		total, costScore, qualityScore := r.score(m, maxCost)
+		candidates = append(candidates, scoredModel{name: name, score: total, costScore: costScore, qualityScore: qualityScore})
 	}
 
-	// Sort descending by score; ties are broken by model name for determinism.
 	sort.Slice(candidates, func(i, j int) bool {
 		if candidates[i].score != candidates[j].score {
 			return candidates[i].score > candidates[j].score
 		}
+		if (candidates[i].name == preferred) != (candidates[j].name == preferred) {
+			return candidates[i].name == preferred
+		}
 		return candidates[i].name < candidates[j].name
 	})
 
+	return candidates
+}
+
+// Defaults for weighted_random selection when selection_top_k and
+// selection_temperature are unset.
+const (
+	defaultSelectionTopK        = 3
+	defaultSelectionTemperature = 0.1
+)
+
+// weightedSelection reports whether defaults.selection asks for sampling
+// among the top candidates rather than always taking the best score.
+func (r *Router) weightedSelection() bool {
+	return r.cfg.Defaults.Selection == "weighted_random"
+}
+
+// sampleCandidates draws one of the top-K sorted candidates with probability
+// proportional to exp(score/temperature) and returns the candidates with the
+// chosen model moved to the front; the others keep their ranked order as
+// alternatives.
+func (r *Router) sampleCandidates(candidates []scoredModel) []scoredModel {
+	k := r.cfg.Defaults.SelectionTopK
+	if k <= 0 {
+		k = defaultSelectionTopK
+	}
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+	if k < 2 {
+		return candidates
+	}
+	temp := r.cfg.Defaults.SelectionTemperature
+	if temp <= 0 {
+		temp = defaultSelectionTemperature
+	}
+
+	// Subtract the top score before exponentiating so weights stay in
+	// (0, 1] however small the temperature.
+	weights := make([]float64, k)
+	total := 0.0
+	for i, c := range candidates[:k] {
+		weights[i] = math.Exp((c.score - candidates[0].score) / temp)
+		total += weights[i]
+	}
+
+	pick := k - 1
+	x := rng.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			pick = i
+			break
+		}
+		x -= w
+	}
+	if pick == 0 {
+		return candidates
+	}
+
+	out := make([]scoredModel, 0, len(candidates))
+	out = append(out, candidates[pick])
+	out = append(out, candidates[:pick]...)
+	return append(out, candidates[pick+1:]...)
+}
+
+// maxCost returns the highest cost_per_1k_tokens across all models, used to
+// normalise cost scores. It is 1.0 when every model is free.
+func (r *Router) maxCost() float64 {
+	maxCost := 0.0
+	for _, m := range r.cfg.Models {
+		if m.CostPer1kTok > maxCost {
+			maxCost = m.CostPer1kTok
+		}
+	}
+	if maxCost == 0 {
+		maxCost = 1.0
+	}
+	return maxCost
+}
+
+// score returns the weighted routing score for m together with its cost and
+// quality components. Higher quality and lower cost both improve the score.
+func (r *Router) score(m config.Model, maxCost float64) (total, costScore, qualityScore float64) {
+	qualityScore = m.QualityCeiling
+	costScore = 1.0 - (m.CostPer1kTok / maxCost)
+	total = r.cfg.Defaults.CostWeight*costScore + r.cfg.Defaults.QualityWeight*qualityScore
+	return total, costScore, qualityScore
+}
+
+// exclusionReason explains why m cannot serve class, or returns "" when it
+// qualifies.
+func exclusionReason(m config.Model, class Classification) string {
+	if m.Disabled {
+		return "disabled"
+	}
+	// Quality floor filter.
+	if m.QualityCeiling < class.MinQuality {
+		return fmt.Sprintf("quality %.2f below floor %.2f", m.QualityCeiling, class.MinQuality)
+	}
+	// Required-strengths filter.
+	if !hasStrengths(m.Strengths, class.RequiredStrengths, class.StrengthMatch) {
+		if class.StrengthMatch == "any" {
+			return fmt.Sprintf("has none of strengths %v", class.RequiredStrengths)
+		}
+		return fmt.Sprintf("missing strengths %v", class.RequiredStrengths)
+	}
+	return ""
+}
+
+// decision builds a RoutingDecision selecting the first of the sorted
+// candidates, with the rest as alternatives. tiers are the tiers searched,
+// or nil when every model was considered.
+func (r *Router) decision(class Classification, candidates []scoredModel, tier, reasoning string, tiers []string) RoutingDecision {
 	best := candidates[0]
+	weighted := r.weightedSelection()
+
+	detail := r.reasoningDetail(class, tiers)
+	detail.Selection = "best_score"
+	if weighted {
+		detail.Selection = "weighted_random"
+	}
+	detail.CostScore = best.costScore
+	detail.QualityScore = best.qualityScore
 
 	var alts []Alternative
 	for _, c := range candidates[1:] {
-		alts = append(alts, Alternative{Model: c.name, Score: c.score})
+		alts = append(alts, Alternative{Model: c.name, Score: c.score, EstCost: r.cfg.Models[c.name].CostPer1kTok})
+		detail.Alternatives = append(detail.Alternatives, AlternativeDetail{
+			Model:        c.name,
+			CostScore:    c.costScore,
+			QualityScore: c.qualityScore,
+			LostBecause:  lostBecause(c, best, weighted),
+		})
+	}
+
+	return RoutingDecision{
+		Model:           best.name,
+		Score:           best.score,
+		Tier:            tier,
+		Reasoning:       reasoning,
+		EstCost:         r.cfg.Models[best.name].CostPer1kTok,
+		Alternatives:    alts,
+		Detail:          detail,
+		LatencyBudgetMs: class.LatencyBudgetMs,
+	}
+}
+
+// reasoningDetail returns the filters and weights that applied to class,
+// with the exclusion reasons of the models considered: those in tiers, or
+// every model when tiers is nil.
+func (r *Router) reasoningDetail(class Classification, tiers []string) ReasoningDetail {
+	d := ReasoningDetail{
+		MinQuality:        class.MinQuality,
+		RequiredStrengths: class.RequiredStrengths,
+		StrengthMatch:     class.StrengthMatch,
+		Tiers:             tiers,
+		Excluded:          make(map[string]string),
+		CostWeight:        r.cfg.Defaults.CostWeight,
+		QualityWeight:     r.cfg.Defaults.QualityWeight,
+	}
+	considered := func(string) bool { return true }
+	if tiers != nil {
+		inTiers := make(map[string]bool)
+		for _, tier := range tiers {
+			for _, name := range r.cfg.GetTierModels(tier) {
+				inTiers[name] = true
+			}
+		}
+		considered = func(name string) bool { return inTiers[name] }
+	}
+	for name, m := range r.cfg.Models {
+		if !considered(name) {
+			continue
+		}
+		if reason := exclusionReason(m, class); reason != "" {
+			d.Excluded[name] = reason
+		}
 	}
+	return d
+}
 
-	m := r.cfg.Models[best.name]
-	tier := r.findModelTier(best.name)
+// lostBecause explains why candidate c was not selected over best.
+func lostBecause(c, best scoredModel, weighted bool) string {
+	switch {
+	case c.score > best.score && weighted:
+		return fmt.Sprintf("not drawn by weighted selection (score %.3f vs %.3f)", c.score, best.score)
+	case c.score < best.score:
+		return fmt.Sprintf("lower score (%.3f vs %.3f)", c.score, best.score)
+	default:
+		return "tied score, ranked after the preferred model or by name"
+	}
+}
 
+// fallbackDecision selects the global fallback model when nothing qualifies.
+func (r *Router) fallbackDecision(class Classification) RoutingDecision {
+	var tiers []string
+	if r.tierEscalation(class) {
+		tiers = r.escalationOrder(class.Tier)
+	}
+	detail := r.reasoningDetail(class, tiers)
+	detail.Selection = "fallback"
 	return RoutingDecision{
-		Model:        best.name,
-		Score:        best.score,
-		Tier:         tier,
-		Reasoning:    class.TaskType + " task → " + best.name + " (cheapest qualified)",
-		EstCost:      m.CostPer1kTok,
-		Alternatives: alts,
+		Model:           r.cfg.Defaults.FallbackModel,
+		Score:           0,
+		Tier:            class.Tier,
+		Reasoning:       "no qualified models, using fallback",
+		Detail:          detail,
+		LatencyBudgetMs: class.LatencyBudgetMs,
 	}
 }
 
@@ -131,9 +529,10 @@ func (r *Router) findModelTier(modelName string) string {
 	return "premium"
 }
 
-// hasStrengths reports whether modelStrengths contains every element of
-// required.  An empty required slice always returns true.
-func hasStrengths(modelStrengths, required []string) bool {
+// hasStrengths reports whether modelStrengths satisfies required: it must
+// contain every element when match is "all" (or empty), or at least one when
+// match is "any". An empty required list is always satisfied.
+func hasStrengths(modelStrengths, required []string, match string) bool {
 	if len(required) == 0 {
 		return true
 	}
@@ -141,6 +540,14 @@ func hasStrengths(modelStrengths, required []string) bool {
 	for _, s := range modelStrengths {
 		set[s] = true
 	}
+	if match == "any" {
+		for _, r := range required {
+			if set[r] {
+				return true
+			}
+		}
+		return false
+	}
 	for _, r := range required {
 		if !set[r] {
 			return false
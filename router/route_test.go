@@ -1,7 +1,11 @@
 package router
 
 import (
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
 )
 
 func TestRouteSummarizationPicksCheapModel(t *testing.T) {
@@ -70,6 +74,57 @@ func TestRouteReturnsAlternatives(t *testing.T) {
 	}
 }
 
+func TestRouteReasoningDetailMatchesScores(t *testing.T) {
+	cfg := loadTestConfig(t)
+	r := NewRouter(cfg)
+	class := Classification{
+		TaskType:          "code",
+		MinQuality:        0.80,
+		RequiredStrengths: []string{"code"},
+	}
+
+	d := r.Route(class)
+	detail := d.Detail
+	scores := make(map[string]CandidateScore)
+	for _, c := range r.ScoreCandidates(class) {
+		scores[c.Model] = c
+	}
+
+	if detail.Selection != "best_score" || detail.MinQuality != 0.80 || detail.Tiers != nil {
+		t.Errorf("unexpected filters: %+v", detail)
+	}
+	if detail.CostWeight != cfg.Defaults.CostWeight || detail.QualityWeight != cfg.Defaults.QualityWeight {
+		t.Errorf("weights = %v/%v, want %v/%v", detail.CostWeight, detail.QualityWeight,
+			cfg.Defaults.CostWeight, cfg.Defaults.QualityWeight)
+	}
+	win := scores[d.Model]
+	if detail.CostScore != win.CostScore || detail.QualityScore != win.QualityScore {
+		t.Errorf("winner components = %v/%v, want %v/%v", detail.CostScore, detail.QualityScore, win.CostScore, win.QualityScore)
+	}
+	if got := detail.CostWeight*detail.CostScore + detail.QualityWeight*detail.QualityScore; got != d.Score {
+		t.Errorf("weighted components = %v, want the decision score %v", got, d.Score)
+	}
+
+	if len(detail.Alternatives) != len(d.Alternatives) {
+		t.Fatalf("got %d alternative details for %d alternatives", len(detail.Alternatives), len(d.Alternatives))
+	}
+	for i, alt := range detail.Alternatives {
+		want := scores[alt.Model]
+		if alt.Model != d.Alternatives[i].Model || alt.CostScore != want.CostScore || alt.QualityScore != want.QualityScore {
+			t.Errorf("alternative %d = %+v, want %s with %v/%v", i, alt, d.Alternatives[i].Model, want.CostScore, want.QualityScore)
+		}
+		if !strings.HasPrefix(alt.LostBecause, "lower score") && !strings.HasPrefix(alt.LostBecause, "tied score") {
+			t.Errorf("%s lost because %q", alt.Model, alt.LostBecause)
+		}
+	}
+
+	for model, c := range scores {
+		if c.Excluded != detail.Excluded[model] {
+			t.Errorf("%s excluded %q, want %q", model, detail.Excluded[model], c.Excluded)
+		}
+	}
+}
+
 func TestRouteDeriverTierFromModel(t *testing.T) {
 	cfg := loadTestConfig(t)
 	r := NewRouter(cfg)
@@ -100,3 +155,420 @@ func TestRouteFallbackWhenNoModelQualifies(t *testing.T) {
 		t.Errorf("expected fallback model %s, got %s", cfg.Defaults.FallbackModel, decision.Model)
 	}
 }
+
+func TestRouteStrictErrorsWhenNoModelQualifies(t *testing.T) {
+	r := NewRouter(loadTestConfig(t))
+
+	d, err := r.RouteStrict(Classification{
+		TaskType:          "impossible",
+		MinQuality:        0.99,
+		RequiredStrengths: []string{"teleportation"},
+	})
+	if err == nil {
+		t.Fatalf("expected an error, got decision for %s", d.Model)
+	}
+	if !strings.Contains(err.Error(), "below floor 0.99") {
+		t.Errorf("error %q does not mention the quality floor", err)
+	}
+
+	_, err = r.RouteStrict(Classification{TaskType: "impossible", RequiredStrengths: []string{"teleportation"}})
+	if err == nil || !strings.Contains(err.Error(), "missing strengths [teleportation]") {
+		t.Errorf("error %v does not mention the missing strength", err)
+	}
+}
+
+func TestRouteStrictMatchesRoute(t *testing.T) {
+	r := NewRouter(loadTestConfig(t))
+	class := Classification{TaskType: "code", MinQuality: 0.8, RequiredStrengths: []string{"code"}}
+
+	d, err := r.RouteStrict(class)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := r.Route(class); d.Model != want.Model {
+		t.Errorf("RouteStrict chose %s, Route chose %s", d.Model, want.Model)
+	}
+}
+
+func TestRouteStrictWithEscalationReportsTiers(t *testing.T) {
+	r := NewRouter(escalationConfig())
+
+	_, err := r.RouteStrict(Classification{Tier: "premium", RequiredStrengths: []string{"speed"}})
+	if err == nil {
+		t.Fatal("expected an error when no tier qualifies")
+	}
+	if !strings.Contains(err.Error(), "mid: not in tiers premium") {
+		t.Errorf("error %q does not explain that mid is outside the escalation tiers", err)
+	}
+}
+
+func TestRouteTierPinned(t *testing.T) {
+	cfg := escalationConfig()
+	cfg.Defaults.TierEscalation = nil
+	r := NewRouter(cfg)
+
+	// Unpinned, every model competes and the strong model's quality wins
+	// the code task.
+	class := Classification{Tier: "budget", MinQuality: 0.9, RequiredStrengths: []string{"code"}}
+	if d := r.Route(class); d.Model != "strong" {
+		t.Fatalf("unpinned: got %s, want strong", d.Model)
+	}
+
+	c := NewClassifier(&config.Config{RouteClasses: map[string]config.RouteClass{
+		"background": {DefaultTier: "budget", QualityFloor: 0.4, LatencyBudgetMs: 120000},
+	}})
+	pinned := c.AsRouteClass(class, "background")
+	if pinned.RouteClass != "background" || pinned.MinQuality != 0.4 || pinned.RequiredStrengths != nil || !pinned.TierPinned {
+		t.Fatalf("AsRouteClass = %+v", pinned)
+	}
+	if d := r.Route(pinned); d.Model != "weak" || d.Tier != "budget" {
+		t.Errorf("pinned: got %s in %s, want weak in budget", d.Model, d.Tier)
+	}
+
+	if got := c.AsRouteClass(class, "missing"); got.RouteClass != class.RouteClass || got.TierPinned {
+		t.Errorf("unknown route class should leave the classification unchanged, got %+v", got)
+	}
+}
+
+// escalationConfig has a budget tier with only a weak model, a speed tier
+// with a mid-quality model, and a premium tier with a strong one.
+func escalationConfig() *config.Config {
+	return &config.Config{
+		Defaults: config.Defaults{
+			CostWeight:     0.4,
+			QualityWeight:  0.6,
+			FallbackModel:  "fallback",
+			TierEscalation: []string{"budget", "speed", "premium"},
+		},
+		Tiers: map[string]config.Tier{
+			"budget":  {Models: []string{"weak"}},
+			"speed":   {Models: []string{"mid"}},
+			"premium": {Models: []string{"strong"}},
+		},
+		Models: map[string]config.Model{
+			"weak":     {CostPer1kTok: 0.0001, QualityCeiling: 0.5},
+			"mid":      {CostPer1kTok: 0.001, QualityCeiling: 0.75, Strengths: []string{"speed"}},
+			"strong":   {CostPer1kTok: 0.015, QualityCeiling: 0.95, Strengths: []string{"code"}},
+			"fallback": {CostPer1kTok: 0.003, QualityCeiling: 0.9},
+		},
+	}
+}
+
+func TestRouteEscalatesToNextTier(t *testing.T) {
+	r := NewRouter(escalationConfig())
+
+	tests := []struct {
+		name      string
+		class     Classification
+		wantModel string
+		wantTier  string
+	}{
+		{"primary tier qualifies", Classification{Tier: "budget", MinQuality: 0.4}, "weak", "budget"},
+		{"escalates one tier", Classification{Tier: "budget", MinQuality: 0.7}, "mid", "speed"},
+		{"escalates two tiers", Classification{Tier: "budget", MinQuality: 0.9}, "strong", "premium"},
+		{"strength only in premium", Classification{Tier: "speed", RequiredStrengths: []string{"code"}}, "strong", "premium"},
+		{"no escalation past last tier", Classification{Tier: "premium", RequiredStrengths: []string{"speed"}}, "fallback", "premium"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := r.Route(tt.class)
+			if d.Model != tt.wantModel || d.Tier != tt.wantTier {
+				t.Errorf("got %s in %s, want %s in %s (%s)", d.Model, d.Tier, tt.wantModel, tt.wantTier, d.Reasoning)
+			}
+		})
+	}
+}
+
+func TestRouteWithoutEscalationConsidersAllTiers(t *testing.T) {
+	cfg := escalationConfig()
+	r := NewRouter(cfg)
+	class := Classification{Tier: "premium", MinQuality: 0.7}
+
+	if d := r.Route(class); d.Model != "strong" {
+		t.Errorf("with escalation: got %s, want strong from the premium tier", d.Model)
+	}
+
+	// Without escalation the classified tier is ignored, so the cheaper
+	// speed-tier model outscores the premium one.
+	cfg.Defaults.TierEscalation = nil
+	delete(cfg.Models, "fallback")
+	if d := r.Route(class); d.Model != "mid" || d.Tier != "speed" {
+		t.Errorf("without escalation: got %s in %s, want mid in speed", d.Model, d.Tier)
+	}
+}
+
+func TestRoutePreferredModelWinsTies(t *testing.T) {
+	cfg := &config.Config{
+		Defaults: config.Defaults{CostWeight: 0.4, QualityWeight: 0.6, FallbackModel: "fallback"},
+		Tiers: map[string]config.Tier{
+			"free": {Models: []string{"alpha", "beta", "gamma"}},
+		},
+		Models: map[string]config.Model{
+			"alpha": {QualityCeiling: 0.7},
+			"beta":  {QualityCeiling: 0.7},
+			"gamma": {QualityCeiling: 0.7},
+		},
+	}
+	r := NewRouter(cfg)
+	class := Classification{Tier: "free", MinQuality: 0.5}
+
+	if d := r.Route(class); d.Model != "alpha" {
+		t.Fatalf("without a preference: got %s, want alpha (first by name)", d.Model)
+	}
+
+	free := cfg.Tiers["free"]
+	free.PreferredModel = "gamma"
+	cfg.Tiers["free"] = free
+	d := r.Route(class)
+	if d.Model != "gamma" {
+		t.Errorf("got %s, want the preferred gamma", d.Model)
+	}
+	if len(d.Alternatives) != 2 || d.Alternatives[0].Model != "alpha" {
+		t.Errorf("alternatives = %v, want the rest by name", d.Alternatives)
+	}
+
+	cfg.Defaults.TierEscalation = []string{"free"}
+	if d := r.Route(class); d.Model != "gamma" {
+		t.Errorf("with tier escalation: got %s, want gamma", d.Model)
+	}
+
+	// A preference never outranks a better score.
+	cfg.Models["beta"] = config.Model{QualityCeiling: 0.8}
+	if d := r.Route(class); d.Model != "beta" {
+		t.Errorf("got %s, want the higher-scoring beta", d.Model)
+	}
+}
+
+func TestHasStrengthsMatchModes(t *testing.T) {
+	model := []string{"code", "summarization"}
+	tests := []struct {
+		required []string
+		match    string
+		want     bool
+	}{
+		{[]string{"code", "architecture"}, "", false},
+		{[]string{"code", "architecture"}, "all", false},
+		{[]string{"code", "architecture"}, "any", true},
+		{[]string{"architecture", "translation"}, "any", false},
+		{[]string{"code", "summarization"}, "all", true},
+		{nil, "any", true},
+	}
+	for _, tt := range tests {
+		if got := hasStrengths(model, tt.required, tt.match); got != tt.want {
+			t.Errorf("hasStrengths(%v, %v, %q) = %v, want %v", model, tt.required, tt.match, got, tt.want)
+		}
+	}
+}
+
+// TestRouteStrengthMatchAny checks that a model holding only some of the
+// required strengths is excluded under "all" but selected under "any".
+func TestRouteStrengthMatchAny(t *testing.T) {
+	cfg := &config.Config{
+		Defaults: config.Defaults{CostWeight: 0.4, QualityWeight: 0.6, FallbackModel: "fallback"},
+		Models: map[string]config.Model{
+			"partial":  {CostPer1kTok: 0.001, QualityCeiling: 0.8, Strengths: []string{"code"}},
+			"fallback": {CostPer1kTok: 0.01, QualityCeiling: 0.8},
+		},
+		Tasks: map[string]config.TaskSpec{
+			"strict":  {Patterns: []string{"strict"}, RequiredStrengths: []string{"code", "architecture"}},
+			"lenient": {Patterns: []string{"lenient"}, RequiredStrengths: []string{"code", "architecture"}, StrengthMatch: "any"},
+		},
+		RouteClasses: map[string]config.RouteClass{"interactive": {}},
+	}
+	c := NewClassifier(cfg)
+	r := NewRouter(cfg)
+
+	strict := c.Classify("a strict request", nil)
+	if d := r.Route(strict); d.Model != "fallback" {
+		t.Errorf("strength_match all: got %s, want fallback", d.Model)
+	}
+
+	lenient := c.Classify("a lenient request", nil)
+	if lenient.StrengthMatch != "any" {
+		t.Fatalf("classification strength match = %q, want any", lenient.StrengthMatch)
+	}
+	if d := r.Route(lenient); d.Model != "partial" {
+		t.Errorf("strength_match any: got %s, want partial", d.Model)
+	}
+}
+
+// TestRouteWeightedRandomSelection routes the same classification many times
+// and checks that selection frequency follows the candidates' scores: the
+// best model wins most often, but lower-scored models in the top K are still
+// picked and models outside it never are.
+func TestRouteWeightedRandomSelection(t *testing.T) {
+	cfg := &config.Config{
+		Defaults: config.Defaults{
+			CostWeight: 0, QualityWeight: 1, FallbackModel: "a",
+			Selection: "weighted_random", SelectionTopK: 3, SelectionTemperature: 0.1,
+		},
+		Models: map[string]config.Model{
+			"a": {QualityCeiling: 0.9},
+			"b": {QualityCeiling: 0.8},
+			"c": {QualityCeiling: 0.7},
+			"d": {QualityCeiling: 0.6},
+		},
+	}
+	r := NewRouter(cfg)
+	Seed(1)
+
+	const runs = 5000
+	counts := make(map[string]int)
+	for i := 0; i < runs; i++ {
+		d := r.Route(Classification{TaskType: "general"})
+		counts[d.Model]++
+		if len(d.Alternatives) != 3 {
+			t.Fatalf("expected 3 alternatives, got %v", d.Alternatives)
+		}
+	}
+
+	if !(counts["a"] > counts["b"] && counts["b"] > counts["c"]) {
+		t.Errorf("selection counts not ordered by score: %v", counts)
+	}
+	if counts["c"] == 0 {
+		t.Errorf("lowest top-K model never selected: %v", counts)
+	}
+	if counts["d"] != 0 {
+		t.Errorf("model outside top K selected %d times", counts["d"])
+	}
+	// Softmax at temperature 0.1 over scores 0.9, 0.8, 0.7 gives the best
+	// model probability 1/(1+e^-1+e^-2) ≈ 0.665.
+	if share := float64(counts["a"]) / runs; share < 0.62 || share > 0.71 {
+		t.Errorf("best model share = %.3f, want about 0.665", share)
+	}
+}
+
+func TestRouteArgmaxIsDefault(t *testing.T) {
+	cfg := &config.Config{
+		Defaults: config.Defaults{CostWeight: 0, QualityWeight: 1, FallbackModel: "a"},
+		Models: map[string]config.Model{
+			"a": {QualityCeiling: 0.9},
+			"b": {QualityCeiling: 0.89},
+		},
+	}
+	r := NewRouter(cfg)
+	for i := 0; i < 100; i++ {
+		if d := r.Route(Classification{TaskType: "general"}); d.Model != "a" {
+			t.Fatalf("run %d: got %s, want the highest-scored model a", i, d.Model)
+		}
+	}
+}
+
+func TestRouteNeverSelectsDisabledModel(t *testing.T) {
+	cfg := loadTestConfig(t)
+	r := NewRouter(cfg)
+	class := Classification{
+		RouteClass:        "interactive",
+		TaskType:          "architecture",
+		MinQuality:        0.90,
+		RequiredStrengths: []string{"architecture", "complex_reasoning"},
+	}
+	if d := r.Route(class); d.Model != "claude-opus" {
+		t.Fatalf("expected claude-opus before disabling, got %s", d.Model)
+	}
+
+	m := cfg.Models["claude-opus"]
+	m.Disabled = true
+	cfg.Models["claude-opus"] = m
+
+	d := r.Route(class)
+	if d.Model == "claude-opus" {
+		t.Error("disabled model was selected")
+	}
+	for _, alt := range d.Alternatives {
+		if alt.Model == "claude-opus" {
+			t.Error("disabled model listed as an alternative")
+		}
+	}
+}
+
+// TestEligibleTiersRealConfig checks EligibleTiers against the shipped
+// config: every tier is listed, with only the models that pass the filters.
+func TestEligibleTiersRealConfig(t *testing.T) {
+	r := NewRouter(loadTestConfig(t))
+
+	tests := []struct {
+		name  string
+		class Classification
+		want  map[string]string
+	}{
+		{
+			"code at a high floor",
+			Classification{MinQuality: 0.85, RequiredStrengths: []string{"code"}},
+			map[string]string{"premium": "claude-sonnet", "budget": "", "speed": "", "free": ""},
+		},
+		{
+			"summarization at a low floor",
+			Classification{MinQuality: 0.6, RequiredStrengths: []string{"summarization"}},
+			map[string]string{"premium": "", "budget": "minimax-m2,ollama/llama3.2",
+				"speed": "cerebras-glm,ollama/llama3.2", "free": "ollama/llama3.2"},
+		},
+		{
+			"no filters",
+			Classification{},
+			map[string]string{"premium": "claude-opus,claude-sonnet", "budget": "minimax-m2,ollama/llama3.2",
+				"speed": "cerebras-glm,ollama/llama3.2", "free": "ollama/codellama,ollama/llama3.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.EligibleTiers(tt.class)
+			if len(got) != len(tt.want) {
+				t.Errorf("EligibleTiers returned %d tiers, want %d: %v", len(got), len(tt.want), got)
+			}
+			for tier, want := range tt.want {
+				models, ok := got[tier]
+				if !ok {
+					t.Errorf("tier %s missing from %v", tier, got)
+					continue
+				}
+				if strings.Join(models, ",") != want {
+					t.Errorf("tier %s eligible models = %v, want [%s]", tier, models, want)
+				}
+			}
+		})
+	}
+}
+
+// TestEligibleModelsMatchesFilters checks that EligibleModels returns exactly
+// the models passing the quality, strength, and disabled filters, and that
+// they are the candidates Route goes on to score.
+func TestEligibleModelsMatchesFilters(t *testing.T) {
+	cfg := escalationConfig()
+	cfg.Defaults.TierEscalation = nil
+	m := cfg.Models["fallback"]
+	m.Disabled = true
+	cfg.Models["fallback"] = m
+	r := NewRouter(cfg)
+
+	tests := []struct {
+		name  string
+		class Classification
+		want  []string
+	}{
+		{"no filters", Classification{}, []string{"mid", "strong", "weak"}},
+		{"quality floor", Classification{MinQuality: 0.7}, []string{"mid", "strong"}},
+		{"required strength", Classification{RequiredStrengths: []string{"code"}}, []string{"strong"}},
+		{"any strength", Classification{RequiredStrengths: []string{"code", "speed"}, StrengthMatch: "any"}, []string{"mid", "strong"}},
+		{"nothing qualifies", Classification{MinQuality: 0.99}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.EligibleModels(tt.class)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("EligibleModels = %v, want %v", got, tt.want)
+			}
+
+			d := r.Route(tt.class)
+			considered := []string{d.Model}
+			for _, alt := range d.Alternatives {
+				considered = append(considered, alt.Model)
+			}
+			sort.Strings(considered)
+			if len(tt.want) > 0 && strings.Join(considered, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Route considered %v, want the eligible set %v", considered, tt.want)
+			}
+		})
+	}
+}
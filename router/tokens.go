@@ -0,0 +1,31 @@
+package router
+
+// charsPerToken is the rough characters-per-token ratio used for estimates.
+// It is close enough for English prose and code across the providers we
+// route to; exact counts come back from the provider in the usage block.
+const charsPerToken = 4
+
+// EstimateTokens returns an approximate token count for text, rounding up so
+// any non-empty text counts as at least one token.
+func EstimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateCost returns the approximate USD cost of processing tokens with
+// modelName, based on its configured cost_per_1k_tokens. Unknown models cost
+// zero.
+func (r *Router) EstimateCost(modelName string, tokens int) float64 {
+	m, ok := r.cfg.Models[modelName]
+	if !ok {
+		return 0
+	}
+	return float64(tokens) / 1000 * m.CostPer1kTok
+}
+
+// EstCostForPrompt returns the approximate USD cost of sending prompt,
+// classified as taskType, to modelName. Besides the prompt's own tokens it
+// reserves the output the task is expected to produce (see
+// config.GetExpectedOutputTokens), since output is usually most of the bill.
+func (r *Router) EstCostForPrompt(modelName, taskType, prompt string) float64 {
+	return r.EstimateCost(modelName, EstimateTokens(prompt)+r.cfg.GetExpectedOutputTokens(taskType))
+}
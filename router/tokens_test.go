@@ -0,0 +1,66 @@
+package router
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"Write a Go function for rate limiting", 10},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	r := NewRouter(&config.Config{
+		Models: map[string]config.Model{"m": {CostPer1kTok: 0.015}},
+	})
+
+	if got := r.EstimateCost("m", 2000); math.Abs(got-0.03) > 1e-9 {
+		t.Errorf("EstimateCost(m, 2000) = %f, want 0.03", got)
+	}
+	if got := r.EstimateCost("missing", 2000); got != 0 {
+		t.Errorf("EstimateCost for unknown model = %f, want 0", got)
+	}
+}
+
+func TestEstCostForPromptReservesOutput(t *testing.T) {
+	cfg := &config.Config{
+		Models: map[string]config.Model{"m": {CostPer1kTok: 1}},
+		Tasks:  map[string]config.TaskSpec{"summarization": {ExpectedOutputTokens: 200}},
+	}
+	r := NewRouter(cfg)
+	prompt := "Write a Go function for rate limiting" // 10 tokens
+
+	tests := []struct {
+		name     string
+		defaults int
+		task     string
+		want     int
+	}{
+		{"built-in default", 0, "chat", 10 + config.DefaultExpectedOutputTokens},
+		{"configured default", 1000, "chat", 10 + 1000},
+		{"task override", 1000, "summarization", 10 + 200},
+	}
+	for _, tt := range tests {
+		cfg.Defaults.ExpectedOutputTokens = tt.defaults
+		got := r.EstCostForPrompt("m", tt.task, prompt)
+		if want := float64(tt.want) / 1000; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: EstCostForPrompt = %f, want %f", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package router
+
+import "encoding/json"
+
+// ProviderTool is a tool definition in Anthropic's shape: a name, an
+// optional description, and a JSON Schema for the tool's input.
+type ProviderTool struct {
+	Name        string
+	Description string
+	InputSchema json.RawMessage
+}
+
+// ProviderToolChoice tells the model how to use the tools. Type is one of
+// Anthropic's "auto", "any", "tool" (use the tool called Name), or "none".
+type ProviderToolChoice struct {
+	Type string
+	Name string
+}
+
+// inputSchema returns t's schema, defaulting to an empty object schema since
+// every provider requires one.
+func (t ProviderTool) inputSchema() json.RawMessage {
+	if len(t.InputSchema) == 0 {
+		return json.RawMessage(`{"type":"object"}`)
+	}
+	return t.InputSchema
+}
+
+// anthropicTools converts tools to the Anthropic Messages API format.
+func anthropicTools(tools []ProviderTool) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(tools))
+	for _, t := range tools {
+		tool := map[string]interface{}{
+			"name":         t.Name,
+			"input_schema": t.inputSchema(),
+		}
+		if t.Description != "" {
+			tool["description"] = t.Description
+		}
+		out = append(out, tool)
+	}
+	return out
+}
+
+// anthropicToolChoice converts c to the Anthropic Messages API format.
+func anthropicToolChoice(c ProviderToolChoice) map[string]string {
+	choice := map[string]string{"type": c.Type}
+	if c.Type == "tool" {
+		choice["name"] = c.Name
+	}
+	return choice
+}
+
+// openAITools converts tools to OpenAI's function-calling format, which
+// Ollama's /api/chat also accepts.
+func openAITools(tools []ProviderTool) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(tools))
+	for _, t := range tools {
+		fn := map[string]interface{}{
+			"name":       t.Name,
+			"parameters": t.inputSchema(),
+		}
+		if t.Description != "" {
+			fn["description"] = t.Description
+		}
+		out = append(out, map[string]interface{}{
+			"type":     "function",
+			"function": fn,
+		})
+	}
+	return out
+}
+
+// openAIToolChoice converts c to OpenAI's tool_choice: "auto", "required"
+// (Anthropic's "any"), "none", or a named function. ok is false for an
+// unrecognised type, in which case tool_choice should be omitted.
+func openAIToolChoice(c ProviderToolChoice) (choice interface{}, ok bool) {
+	switch c.Type {
+	case "auto", "none":
+		return c.Type, true
+	case "any":
+		return "required", true
+	case "tool":
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": c.Name},
+		}, true
+	default:
+		return nil, false
+	}
+}
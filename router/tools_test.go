@@ -0,0 +1,144 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// toolRequest returns a request carrying one weather tool and the given
+// tool_choice.
+func toolRequest(choice *ProviderToolChoice) ProviderRequest {
+	return ProviderRequest{
+		Messages: []ProviderMessage{{Role: "user", Content: "weather in Paris?"}},
+		Tools: []ProviderTool{{
+			Name:        "get_weather",
+			Description: "Look up the weather",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		}},
+		ToolChoice: choice,
+	}
+}
+
+// encodeBody round-trips a provider body through JSON so tests inspect what
+// is actually sent.
+func encodeBody(t *testing.T, body map[string]interface{}) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return decoded
+}
+
+func TestBuildAnthropicBodyTools(t *testing.T) {
+	body := encodeBody(t, buildAnthropicBody(toolRequest(&ProviderToolChoice{Type: "tool", Name: "get_weather"}), "claude-test"))
+
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("expected 1 tool, got %v", body["tools"])
+	}
+	tool := tools[0].(map[string]any)
+	if tool["name"] != "get_weather" || tool["description"] != "Look up the weather" {
+		t.Errorf("unexpected tool: %v", tool)
+	}
+	schema, _ := tool["input_schema"].(map[string]any)
+	if schema["type"] != "object" || schema["properties"] == nil {
+		t.Errorf("input_schema not preserved: %v", tool["input_schema"])
+	}
+
+	choice, _ := body["tool_choice"].(map[string]any)
+	if choice["type"] != "tool" || choice["name"] != "get_weather" {
+		t.Errorf("tool_choice = %v, want tool get_weather", body["tool_choice"])
+	}
+}
+
+func TestBuildOpenAICompatBodyTools(t *testing.T) {
+	body := encodeBody(t, buildOpenAICompatBody(toolRequest(&ProviderToolChoice{Type: "any"}), "gpt-test"))
+
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("expected 1 tool, got %v", body["tools"])
+	}
+	tool := tools[0].(map[string]any)
+	fn, _ := tool["function"].(map[string]any)
+	if tool["type"] != "function" || fn["name"] != "get_weather" || fn["description"] != "Look up the weather" {
+		t.Errorf("unexpected tool: %v", tool)
+	}
+	if params, _ := fn["parameters"].(map[string]any); params["properties"] == nil {
+		t.Errorf("parameters not preserved: %v", fn["parameters"])
+	}
+	if body["tool_choice"] != "required" {
+		t.Errorf("tool_choice = %v, want required", body["tool_choice"])
+	}
+}
+
+func TestOpenAIToolChoice(t *testing.T) {
+	tests := []struct {
+		choice ProviderToolChoice
+		want   string
+	}{
+		{ProviderToolChoice{Type: "auto"}, `"auto"`},
+		{ProviderToolChoice{Type: "any"}, `"required"`},
+		{ProviderToolChoice{Type: "none"}, `"none"`},
+		{ProviderToolChoice{Type: "tool", Name: "f"}, `{"function":{"name":"f"},"type":"function"}`},
+	}
+	for _, tt := range tests {
+		got, ok := openAIToolChoice(tt.choice)
+		if !ok {
+			t.Errorf("%s: unexpectedly unsupported", tt.choice.Type)
+			continue
+		}
+		data, _ := json.Marshal(got)
+		if string(data) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.choice.Type, data, tt.want)
+		}
+	}
+	if _, ok := openAIToolChoice(ProviderToolChoice{Type: "bogus"}); ok {
+		t.Error("expected unknown tool_choice type to be unsupported")
+	}
+}
+
+func TestBuildOllamaBodyTools(t *testing.T) {
+	body := encodeBody(t, buildOllamaBody(toolRequest(&ProviderToolChoice{Type: "auto"}), "llama3"))
+
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("expected 1 tool, got %v", body["tools"])
+	}
+	fn, _ := tools[0].(map[string]any)["function"].(map[string]any)
+	if fn["name"] != "get_weather" {
+		t.Errorf("unexpected tool: %v", tools[0])
+	}
+	if _, ok := body["tool_choice"]; ok {
+		t.Error("ollama body should not carry tool_choice")
+	}
+}
+
+func TestBuildBodiesWithoutTools(t *testing.T) {
+	req := ProviderRequest{Messages: []ProviderMessage{{Role: "user", Content: "hi"}}}
+	for name, body := range map[string]map[string]interface{}{
+		"anthropic":     buildAnthropicBody(req, "m"),
+		"openai_compat": buildOpenAICompatBody(req, "m"),
+		"ollama":        buildOllamaBody(req, "m"),
+	} {
+		if _, ok := body["tools"]; ok {
+			t.Errorf("%s: tools present without any tools", name)
+		}
+		if _, ok := body["tool_choice"]; ok {
+			t.Errorf("%s: tool_choice present without any tools", name)
+		}
+	}
+}
+
+func TestToolWithoutSchemaGetsEmptyObject(t *testing.T) {
+	req := ProviderRequest{Tools: []ProviderTool{{Name: "ping"}}}
+	body := encodeBody(t, buildAnthropicBody(req, "m"))
+	tool := body["tools"].([]any)[0].(map[string]any)
+	if schema, _ := tool["input_schema"].(map[string]any); schema["type"] != "object" {
+		t.Errorf("input_schema = %v, want an object schema", tool["input_schema"])
+	}
+}
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+// ProbeResult reports whether a single provider endpoint is reachable and
+// accepts the configured credentials.
+type ProbeResult struct {
+	Provider string
+	BaseURL  string
+	// EnvVar is the environment variable the API key is read from, or ""
+	// for providers that need no key. The key value is never reported.
+	EnvVar     string
+	KeyPresent bool
+	OK         bool
+	StatusCode int
+	Err        string
+}
+
+// ProbeProviders issues one lightweight model-listing request to every
+// distinct provider/base-URL pair in cfg and returns the results sorted by
+// provider then base URL. No completions are requested, so probing is free.
+func ProbeProviders(ctx context.Context, cfg *config.Config) []ProbeResult {
+	type target struct{ provider, baseURL, authStyle, apiVersion string }
+	seen := make(map[target]bool)
+	var targets []target
+	for _, m := range cfg.Models {
+		t := target{m.Provider, strings.TrimRight(m.BaseURL, "/"), m.AuthStyle, ""}
+		if m.AuthStyle == "azure" {
+			t.apiVersion = azureAPIVersion(m)
+		}
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].provider != targets[j].provider {
+			return targets[i].provider < targets[j].provider
+		}
+		return targets[i].baseURL < targets[j].baseURL
+	})
+
+	results := make([]ProbeResult, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, probeProvider(ctx, t.provider, t.baseURL, t.authStyle, t.apiVersion))
+	}
+	return results
+}
+
+// probeProvider sends the provider's model-listing request: GET
+// {base_url}/v1/models for Anthropic (the official API when base_url is
+// unset), GET {base_url}/models for openai_compat (GET
+// {base_url}/openai/models?api-version=... with auth style "azure"), and GET
+// /api/tags for Ollama. A 2xx response counts as success.
+func probeProvider(ctx context.Context, provider, baseURL, authStyle, apiVersion string) ProbeResult {
+	res := ProbeResult{
+		Provider: provider,
+		BaseURL:  baseURL,
+		EnvVar:   apiKeyEnvVar(provider, baseURL),
+	}
+	if authStyle == "azure" {
+		res.EnvVar = azureAPIKeyEnv
+	}
+	if res.EnvVar != "" {
+		res.KeyPresent = os.Getenv(res.EnvVar) != ""
+	}
+
+	var endpoint string
+	switch provider {
+	case "anthropic":
+		res.BaseURL = anthropicBaseURL(baseURL)
+		endpoint = res.BaseURL + "/v1/models"
+	case "openai_compat":
+		endpoint = baseURL + "/models"
+		if authStyle == "azure" {
+			endpoint = baseURL + "/openai/models?api-version=" + url.QueryEscape(apiVersion)
+		}
+	case "ollama":
+		endpoint = baseURL + "/api/tags"
+	default:
+		res.Err = fmt.Sprintf("unknown provider %q", provider)
+		return res
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	switch provider {
+	case "anthropic":
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+		setAnthropicAuth(httpReq, nil)
+	case "openai_compat":
+		setOpenAICompatAuth(httpReq, baseURL, authStyle)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	res.OK = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !res.OK {
+		res.Err = fmt.Sprintf("returned %d", resp.StatusCode)
+	}
+	return res
+}
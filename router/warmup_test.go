@@ -0,0 +1,103 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jbctechsolutions/sr-router/config"
+)
+
+func TestProbeProviders(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "good-key")
+
+	// authOK accepts the configured key; authFail rejects every key.
+	authOK := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer good-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`)) //nolint:errcheck
+	}))
+	defer authOK.Close()
+
+	authFail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authFail.Close()
+
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models":[]}`)) //nolint:errcheck
+	}))
+	defer ollama.Close()
+
+	cfg := &config.Config{Models: map[string]config.Model{
+		"ok-a":    {Provider: "openai_compat", BaseURL: authOK.URL + "/v1"},
+		"ok-b":    {Provider: "openai_compat", BaseURL: authOK.URL + "/v1/"}, // same endpoint, deduplicated
+		"bad":     {Provider: "openai_compat", BaseURL: authFail.URL + "/v1"},
+		"local":   {Provider: "ollama", BaseURL: ollama.URL},
+		"mystery": {Provider: "carrier_pigeon"},
+	}}
+
+	results := ProbeProviders(context.Background(), cfg)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 distinct provider endpoints, got %d: %+v", len(results), results)
+	}
+
+	byURL := make(map[string]ProbeResult)
+	for _, r := range results {
+		byURL[r.BaseURL] = r
+		if strings.Contains(r.Err, "good-key") {
+			t.Errorf("probe result leaks the API key: %+v", r)
+		}
+	}
+
+	ok := byURL[authOK.URL+"/v1"]
+	if !ok.OK || ok.EnvVar != "OPENAI_API_KEY" || !ok.KeyPresent {
+		t.Errorf("auth-ok provider: got %+v, want OK with OPENAI_API_KEY present", ok)
+	}
+
+	bad := byURL[authFail.URL+"/v1"]
+	if bad.OK || bad.StatusCode != http.StatusUnauthorized {
+		t.Errorf("auth-fail provider: got %+v, want failure with 401", bad)
+	}
+
+	local := byURL[ollama.URL]
+	if !local.OK || local.EnvVar != "" {
+		t.Errorf("ollama provider: got %+v, want OK with no key env var", local)
+	}
+
+	if unknown := byURL[""]; unknown.OK || unknown.Err == "" {
+		t.Errorf("unknown provider: got %+v, want an error", unknown)
+	}
+}
+
+func TestProbeProvidersAzure(t *testing.T) {
+	t.Setenv("AZURE_OPENAI_API_KEY", "az-key")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/models" || r.URL.Query().Get("api-version") != "2024-06-01" || r.Header.Get("api-key") != "az-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Models: map[string]config.Model{
+		"azure": {Provider: "openai_compat", BaseURL: srv.URL, AuthStyle: "azure", APIVersion: "2024-06-01"},
+	}}
+	results := ProbeProviders(context.Background(), cfg)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+	if r := results[0]; !r.OK || r.EnvVar != "AZURE_OPENAI_API_KEY" || !r.KeyPresent {
+		t.Errorf("got %+v, want OK with AZURE_OPENAI_API_KEY present", r)
+	}
+}
@@ -0,0 +1,146 @@
+package telemetry
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Default batching parameters for NewAsyncRecorder.
+const (
+	DefaultBatchSize     = 50
+	DefaultFlushInterval = 200 * time.Millisecond
+
+	// asyncQueueSize is how many events may wait for the writer before
+	// Record falls back to a synchronous insert.
+	asyncQueueSize = 1024
+)
+
+// AsyncRecorder takes routing-event writes off the request path. Events are
+// queued on a channel and a background goroutine inserts them in batches of
+// up to batchSize, or whatever has accumulated every interval, inside a
+// single transaction.
+type AsyncRecorder struct {
+	c         *Collector
+	batchSize int
+	interval  time.Duration
+
+	events   chan RoutingEvent
+	flushReq chan chan struct{}
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncRecorder starts a background writer for c. Non-positive batchSize
+// or interval select DefaultBatchSize and DefaultFlushInterval. Call Close to
+// flush pending events and stop the writer; the Collector itself stays open.
+func NewAsyncRecorder(c *Collector, batchSize int, interval time.Duration) *AsyncRecorder {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	a := &AsyncRecorder{
+		c:         c,
+		batchSize: batchSize,
+		interval:  interval,
+		events:    make(chan RoutingEvent, asyncQueueSize),
+		flushReq:  make(chan chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues e for writing. If the queue is full, or the recorder has been
+// closed, e is written synchronously instead so no event is lost.
+func (a *AsyncRecorder) Record(e RoutingEvent) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.closed {
+		select {
+		case a.events <- e:
+			return nil
+		default:
+		}
+	}
+	return a.c.RecordRouting(e)
+}
+
+// Flush blocks until every event queued before the call has been written.
+func (a *AsyncRecorder) Flush() {
+	ack := make(chan struct{})
+	select {
+	case a.flushReq <- ack:
+		<-ack
+	case <-a.done:
+	}
+}
+
+// Close writes any pending events and stops the background writer. It is
+// safe to call more than once.
+func (a *AsyncRecorder) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
+
+// run is the background writer loop.
+func (a *AsyncRecorder) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	batch := make([]RoutingEvent, 0, a.batchSize)
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.c.RecordRoutingBatch(batch); err != nil {
+			log.Printf("telemetry: failed to write %d routing events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e, ok := <-a.events:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= a.batchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case ack := <-a.flushReq:
+			// Drain everything queued so far, then write it.
+			for drained := false; !drained; {
+				select {
+				case e, ok := <-a.events:
+					if !ok {
+						write()
+						close(ack)
+						return
+					}
+					batch = append(batch, e)
+				default:
+					drained = true
+				}
+			}
+			write()
+			close(ack)
+		}
+	}
+}
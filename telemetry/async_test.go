@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCollector(t *testing.T) *Collector {
+	t.Helper()
+	c, err := NewCollector(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestAsyncRecorderPersistsAllEventsAfterFlush(t *testing.T) {
+	c := newTestCollector(t)
+	// A long interval ensures the batches are written by size and by Flush,
+	// not by the ticker.
+	a := NewAsyncRecorder(c, 25, time.Hour)
+	defer a.Close()
+
+	const n = 500
+	var wg sync.WaitGroup
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n/5; i++ {
+				if err := a.Record(RoutingEvent{
+					ID:            fmt.Sprintf("evt-%d-%d", w, i),
+					RouteClass:    "interactive",
+					Tier:          "premium",
+					SelectedModel: "claude-sonnet",
+					EstimatedCost: 0.001,
+				}); err != nil {
+					t.Errorf("Record: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	a.Flush()
+
+	stats, err := c.GetStats("")
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.TotalRequests != n {
+		t.Errorf("expected %d persisted events after flush, got %d", n, stats.TotalRequests)
+	}
+}
+
+func TestAsyncRecorderCloseFlushesPending(t *testing.T) {
+	c := newTestCollector(t)
+	a := NewAsyncRecorder(c, 1000, time.Hour)
+
+	for i := 0; i < 10; i++ {
+		if err := a.Record(RoutingEvent{ID: fmt.Sprintf("evt-%d", i), SelectedModel: "m"}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Records after Close are written synchronously rather than dropped.
+	if err := a.Record(RoutingEvent{ID: "late", SelectedModel: "m"}); err != nil {
+		t.Fatalf("Record after Close: %v", err)
+	}
+	a.Flush() // must not block once closed
+
+	stats, err := c.GetStats("")
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.TotalRequests != 11 {
+		t.Errorf("expected 11 persisted events, got %d", stats.TotalRequests)
+	}
+}
@@ -3,13 +3,27 @@ package telemetry
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// timestampLayout is the text layout SQLite uses for CURRENT_TIMESTAMP.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// ErrEventNotFound is returned when feedback names an event ID that was
+// never recorded.
+var ErrEventNotFound = errors.New("event not found")
+
 // Collector records routing events and exposes aggregate stats via SQLite.
 type Collector struct {
 	db *sql.DB
+
+	mu       sync.Mutex
+	writeErr error // result of the last recording write
 }
 
 // RoutingEvent captures a single model-selection decision.
@@ -22,18 +36,57 @@ type RoutingEvent struct {
 	Alternatives  []string
 	LatencyMs     int
 	EstimatedCost float64
-	FailoverFrom  string
-	UserRating    int
-	UserOverride  string
+
+	// InputTokens and OutputTokens are the tokens the request used, as the
+	// provider reported them or, when it did not, as estimated.
+	// EstimatedCost is their cost at the model's cost_per_1k_tokens.
+	InputTokens  int
+	OutputTokens int
+
+	// CacheCreationTokens and CacheReadTokens are the prompt-cache writes
+	// and reads the provider reported, when it reported them.
+	CacheCreationTokens int
+	CacheReadTokens     int
+
+	// ShadowOf is the ID of the request a shadow event mirrors, and is
+	// empty for every other event. ShadowStatus is the HTTP status the
+	// shadow model answered with, or 0 when the call failed outright.
+	// Shadow events are left out of GetStats.
+	ShadowOf     string
+	ShadowStatus int
+
+	FailoverFrom string
+	UserRating   int
+	UserOverride string
 }
 
 // Stats holds aggregate routing telemetry.
 type Stats struct {
 	TotalRequests int
 	TotalCost     float64
+	InputTokens   int
+	OutputTokens  int
 	ByModel       map[string]int
 	ByTier        map[string]int
+	ByRouteClass  map[string]int
 	FailoverCount int
+
+	// BaselineModel, BaselineCost, and EstimatedSavings are populated by
+	// ApplyBaseline; they are zero until a baseline has been applied.
+	BaselineModel    string
+	BaselineCost     float64
+	EstimatedSavings float64
+}
+
+// ApplyBaseline computes what the counted requests would have cost had their
+// input and output tokens been sent to baselineModel at baselineCost per 1k
+// tokens, and records the difference from the actual TotalCost as
+// EstimatedSavings. Each event's estimated_cost is the cost of the same
+// tokens on the model that served it, so the two totals are comparable.
+func (s *Stats) ApplyBaseline(baselineModel string, baselineCost float64) {
+	s.BaselineModel = baselineModel
+	s.BaselineCost = float64(s.InputTokens+s.OutputTokens) / 1000 * baselineCost
+	s.EstimatedSavings = s.BaselineCost - s.TotalCost
 }
 
 // NewCollector opens (or creates) the SQLite database at dbPath and ensures
@@ -54,10 +107,19 @@ func NewCollector(dbPath string) (*Collector, error) {
 		alternatives TEXT,
 		latency_ms INTEGER,
 		estimated_cost REAL,
+		input_tokens INTEGER,
+		output_tokens INTEGER,
+		cache_creation_input_tokens INTEGER,
+		cache_read_input_tokens INTEGER,
+		shadow_of TEXT,
+		shadow_status INTEGER,
 		failover_from TEXT,
 		user_rating INTEGER,
 		user_override TEXT
 	)`)
+	if err == nil {
+		err = addMissingColumns(db)
+	}
 	if err != nil {
 		db.Close()
 		return nil, err
@@ -66,22 +128,132 @@ func NewCollector(dbPath string) (*Collector, error) {
 	return &Collector{db: db}, nil
 }
 
+// addedColumns are routing_events columns added after the table was first
+// released, with their types.
+var addedColumns = [][2]string{
+	{"cache_creation_input_tokens", "INTEGER"},
+	{"cache_read_input_tokens", "INTEGER"},
+	{"shadow_of", "TEXT"},
+	{"shadow_status", "INTEGER"},
+	{"input_tokens", "INTEGER"},
+	{"output_tokens", "INTEGER"},
+}
+
+// addMissingColumns brings a database created by an older version up to
+// date by adding any of addedColumns it lacks.
+func addMissingColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('routing_events')`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range addedColumns {
+		if have[col[0]] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE routing_events ADD COLUMN ` + col[0] + ` ` + col[1]); err != nil {
+			return fmt.Errorf("adding column %s: %w", col[0], err)
+		}
+	}
+	return nil
+}
+
 // Close releases the database connection.
 func (c *Collector) Close() error {
 	return c.db.Close()
 }
 
-// RecordRouting inserts a new routing event.
-func (c *Collector) RecordRouting(e RoutingEvent) error {
+// CheckWritable reports whether events can still be recorded. It runs a
+// read-only query, which fails once the connection is closed, and returns the
+// error of the most recent recording write, if that write failed. It never
+// writes itself, so it cannot contend with the recorder for the write lock.
+func (c *Collector) CheckWritable() error {
+	var n int
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM routing_events WHERE 0`).Scan(&n); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeErr
+}
+
+// recordWrite remembers the result of a recording write for CheckWritable
+// and returns err unchanged.
+func (c *Collector) recordWrite(err error) error {
+	c.mu.Lock()
+	c.writeErr = err
+	c.mu.Unlock()
+	return err
+}
+
+// insertRoutingSQL inserts a single routing event. An event whose ID is
+// already recorded, such as a client reusing an X-Request-Id, is skipped
+// rather than failing the insert (and with it the rest of a batch): the
+// first event, and any failover or feedback recorded against it, is kept.
+const insertRoutingSQL = `INSERT INTO routing_events
+	(id, route_class, task_type, tier, selected_model, alternatives, latency_ms, estimated_cost,
+	 input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens, shadow_of, shadow_status)
+ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ ON CONFLICT(id) DO NOTHING`
+
+// routingArgs returns the insertRoutingSQL arguments for e.
+func routingArgs(e RoutingEvent) []interface{} {
 	altsJSON, _ := json.Marshal(e.Alternatives)
-	_, err := c.db.Exec(
-		`INSERT INTO routing_events
-			(id, route_class, task_type, tier, selected_model, alternatives, latency_ms, estimated_cost)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	return []interface{}{
 		e.ID, e.RouteClass, e.TaskType, e.Tier, e.SelectedModel,
 		string(altsJSON), e.LatencyMs, e.EstimatedCost,
-	)
-	return err
+		e.InputTokens, e.OutputTokens,
+		e.CacheCreationTokens, e.CacheReadTokens,
+		sql.NullString{String: e.ShadowOf, Valid: e.ShadowOf != ""},
+		sql.NullInt64{Int64: int64(e.ShadowStatus), Valid: e.ShadowOf != ""},
+	}
+}
+
+// RecordRouting inserts a new routing event. Recording an ID that is
+// already stored is a no-op.
+func (c *Collector) RecordRouting(e RoutingEvent) error {
+	_, err := c.db.Exec(insertRoutingSQL, routingArgs(e)...)
+	return c.recordWrite(err)
+}
+
+// RecordRoutingBatch inserts events in a single transaction. Either all
+// events are stored or, on error, none are.
+func (c *Collector) RecordRoutingBatch(events []RoutingEvent) error {
+	return c.recordWrite(c.recordRoutingBatch(events))
+}
+
+func (c *Collector) recordRoutingBatch(events []RoutingEvent) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(insertRoutingSQL)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		if _, err := stmt.Exec(routingArgs(e)...); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // RecordFailover updates an existing event to reflect the model that was
@@ -91,42 +263,79 @@ func (c *Collector) RecordFailover(eventID, fromModel, toModel string) error {
 		`UPDATE routing_events SET failover_from = ?, selected_model = ? WHERE id = ?`,
 		fromModel, toModel, eventID,
 	)
-	return err
+	return c.recordWrite(err)
 }
 
-// RecordFeedback stores user-provided rating and optional override for an event.
+// RecordFeedback stores user-provided rating and optional override for an
+// event. It returns an error wrapping ErrEventNotFound when no event has
+// that ID.
 func (c *Collector) RecordFeedback(eventID string, rating int, override string) error {
-	_, err := c.db.Exec(
+	res, err := c.db.Exec(
 		`UPDATE routing_events SET user_rating = ?, user_override = ? WHERE id = ?`,
 		rating, override, eventID,
 	)
-	return err
+	if err := c.recordWrite(err); err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrEventNotFound, eventID)
+	}
+	return nil
+}
+
+// Prune deletes events recorded before the cutoff and returns how many were
+// removed. The database is vacuumed afterwards to reclaim the freed space.
+func (c *Collector) Prune(before time.Time) (int, error) {
+	// timestamp holds CURRENT_TIMESTAMP text in UTC, so compare against the
+	// same layout.
+	res, err := c.db.Exec(`DELETE FROM routing_events WHERE timestamp < ?`,
+		before.UTC().Format(timestampLayout))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.db.Exec(`VACUUM`); err != nil {
+		return int(n), err
+	}
+	return int(n), nil
 }
 
-// GetStats returns aggregate stats. When modelFilter is non-empty, TotalRequests
-// and TotalCost are scoped to that model only; ByModel, ByTier, and FailoverCount
-// always cover all events.
+// GetStats returns aggregate stats. When modelFilter is non-empty,
+// TotalRequests, TotalCost, InputTokens, and OutputTokens are scoped to that
+// model only; ByModel, ByTier, ByRouteClass, and FailoverCount always cover
+// all events. Shadow events are not counted, since no client was served by
+// them.
 func (c *Collector) GetStats(modelFilter string) (*Stats, error) {
 	stats := &Stats{
-		ByModel: make(map[string]int),
-		ByTier:  make(map[string]int),
+		ByModel:      make(map[string]int),
+		ByTier:       make(map[string]int),
+		ByRouteClass: make(map[string]int),
 	}
 
 	// Total requests and cost, optionally filtered by model.
-	query := `SELECT COUNT(*), COALESCE(SUM(estimated_cost), 0) FROM routing_events`
+	query := `SELECT COUNT(*), COALESCE(SUM(estimated_cost), 0), COALESCE(SUM(input_tokens), 0),
+		COALESCE(SUM(output_tokens), 0) FROM routing_events WHERE shadow_of IS NULL`
 	args := []interface{}{}
 	if modelFilter != "" {
-		query += ` WHERE selected_model = ?`
+		query += ` AND selected_model = ?`
 		args = append(args, modelFilter)
 	}
 
-	if err := c.db.QueryRow(query, args...).Scan(&stats.TotalRequests, &stats.TotalCost); err != nil {
+	if err := c.db.QueryRow(query, args...).Scan(&stats.TotalRequests, &stats.TotalCost,
+		&stats.InputTokens, &stats.OutputTokens); err != nil {
 		return nil, err
 	}
 
 	// Breakdown by model.
 	rows, err := c.db.Query(
-		`SELECT selected_model, COUNT(*) FROM routing_events GROUP BY selected_model`,
+		`SELECT selected_model, COUNT(*) FROM routing_events WHERE shadow_of IS NULL GROUP BY selected_model`,
 	)
 	if err != nil {
 		return nil, err
@@ -146,7 +355,7 @@ func (c *Collector) GetStats(modelFilter string) (*Stats, error) {
 
 	// Breakdown by tier.
 	rows2, err := c.db.Query(
-		`SELECT tier, COUNT(*) FROM routing_events GROUP BY tier`,
+		`SELECT tier, COUNT(*) FROM routing_events WHERE shadow_of IS NULL GROUP BY tier`,
 	)
 	if err != nil {
 		return nil, err
@@ -164,9 +373,29 @@ func (c *Collector) GetStats(modelFilter string) (*Stats, error) {
 		return nil, err
 	}
 
+	// Breakdown by route class.
+	rows3, err := c.db.Query(
+		`SELECT route_class, COUNT(*) FROM routing_events WHERE shadow_of IS NULL GROUP BY route_class`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows3.Close()
+	for rows3.Next() {
+		var routeClass string
+		var count int
+		if err := rows3.Scan(&routeClass, &count); err != nil {
+			return nil, err
+		}
+		stats.ByRouteClass[routeClass] = count
+	}
+	if err := rows3.Err(); err != nil {
+		return nil, err
+	}
+
 	// Failover count across all events.
 	if err := c.db.QueryRow(
-		`SELECT COUNT(*) FROM routing_events WHERE failover_from IS NOT NULL`,
+		`SELECT COUNT(*) FROM routing_events WHERE failover_from IS NOT NULL AND shadow_of IS NULL`,
 	).Scan(&stats.FailoverCount); err != nil {
 		return nil, err
 	}
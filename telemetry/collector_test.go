@@ -1,8 +1,14 @@
 package telemetry
 
 import (
+	"database/sql"
+	"errors"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRecordAndQueryEvents(t *testing.T) {
@@ -61,3 +67,287 @@ func TestRecordFailover(t *testing.T) {
 		t.Fatalf("failed to record failover: %v", err)
 	}
 }
+
+func TestRecordRoutingDuplicateID(t *testing.T) {
+	c, err := NewCollector(filepath.Join(t.TempDir(), "dup.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer c.Close()
+
+	first := RoutingEvent{ID: "dup-1", RouteClass: "interactive", Tier: "premium", SelectedModel: "claude-sonnet"}
+	if err := c.RecordRouting(first); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+	if err := c.RecordFeedback("dup-1", 5, ""); err != nil {
+		t.Fatalf("failed to record feedback: %v", err)
+	}
+	second := first
+	second.SelectedModel = "claude-opus"
+	if err := c.RecordRouting(second); err != nil {
+		t.Errorf("recording a duplicate ID should not fail: %v", err)
+	}
+	// A duplicate inside a batch must not lose the other events.
+	if err := c.RecordRoutingBatch([]RoutingEvent{second, {ID: "dup-2", SelectedModel: "haiku"}}); err != nil {
+		t.Errorf("batch with a duplicate ID should not fail: %v", err)
+	}
+
+	var rows, rating int
+	var model string
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM routing_events WHERE id = 'dup-1'`).Scan(&rows); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("got %d rows for dup-1, want 1", rows)
+	}
+	if err := c.db.QueryRow(`SELECT selected_model, user_rating FROM routing_events WHERE id = 'dup-1'`).Scan(&model, &rating); err != nil {
+		t.Fatalf("reading event: %v", err)
+	}
+	if model != "claude-sonnet" || rating != 5 {
+		t.Errorf("got model %q rating %d, want the first event (claude-sonnet) with its rating 5", model, rating)
+	}
+	stats, err := c.GetStats("")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.TotalRequests != 2 {
+		t.Errorf("expected 2 requests, got %d", stats.TotalRequests)
+	}
+}
+
+func TestGetStatsByRouteClass(t *testing.T) {
+	c, err := NewCollector(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer c.Close()
+
+	events := []RoutingEvent{
+		{ID: "rc-1", RouteClass: "interactive", Tier: "premium", SelectedModel: "claude-sonnet"},
+		{ID: "rc-2", RouteClass: "interactive", Tier: "premium", SelectedModel: "claude-opus"},
+		{ID: "rc-3", RouteClass: "background", Tier: "budget", SelectedModel: "minimax-m2"},
+		{ID: "rc-4", RouteClass: "compaction", Tier: "speed", SelectedModel: "cerebras-glm"},
+		{ID: "rc-5", RouteClass: "background", Tier: "budget", SelectedModel: "minimax-m2"},
+		{ID: "rc-6", RouteClass: "interactive", Tier: "premium", SelectedModel: "claude-sonnet"},
+	}
+	for _, e := range events {
+		if err := c.RecordRouting(e); err != nil {
+			t.Fatalf("failed to record event %s: %v", e.ID, err)
+		}
+	}
+
+	stats, err := c.GetStats("")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+
+	want := map[string]int{"interactive": 3, "background": 2, "compaction": 1}
+	if len(stats.ByRouteClass) != len(want) {
+		t.Errorf("expected %d route classes, got %d: %v", len(want), len(stats.ByRouteClass), stats.ByRouteClass)
+	}
+	for rc, n := range want {
+		if stats.ByRouteClass[rc] != n {
+			t.Errorf("ByRouteClass[%q] = %d, want %d", rc, stats.ByRouteClass[rc], n)
+		}
+	}
+}
+
+func TestApplyBaselineSavings(t *testing.T) {
+	c, err := NewCollector(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer c.Close()
+
+	events := []RoutingEvent{
+		{ID: "s-1", SelectedModel: "claude-sonnet", InputTokens: 1500, OutputTokens: 500, EstimatedCost: 0.03},
+		{ID: "s-2", SelectedModel: "minimax-m2", InputTokens: 800, OutputTokens: 200, EstimatedCost: 0.0003},
+		{ID: "s-3", SelectedModel: "ollama/llama3.2", InputTokens: 1000, EstimatedCost: 0},
+	}
+	for _, e := range events {
+		if err := c.RecordRouting(e); err != nil {
+			t.Fatalf("failed to record event %s: %v", e.ID, err)
+		}
+	}
+
+	stats, err := c.GetStats("")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	stats.ApplyBaseline("claude-sonnet", 0.015)
+
+	if stats.BaselineModel != "claude-sonnet" {
+		t.Errorf("BaselineModel = %q, want %q", stats.BaselineModel, "claude-sonnet")
+	}
+	// 4k tokens × 0.015 per 1k = 0.06 baseline; actual 0.0303; savings 0.0297.
+	if stats.InputTokens != 3300 || stats.OutputTokens != 700 {
+		t.Errorf("tokens = %d in, %d out; want 3300, 700", stats.InputTokens, stats.OutputTokens)
+	}
+	if math.Abs(stats.BaselineCost-0.06) > 1e-9 {
+		t.Errorf("BaselineCost = %f, want 0.06", stats.BaselineCost)
+	}
+	if math.Abs(stats.EstimatedSavings-0.0297) > 1e-9 {
+		t.Errorf("EstimatedSavings = %f, want 0.0297", stats.EstimatedSavings)
+	}
+}
+
+func TestPruneRemovesOnlyOldEvents(t *testing.T) {
+	c, err := NewCollector(filepath.Join(t.TempDir(), "prune.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer c.Close()
+
+	now := time.Now().UTC()
+	backdated := map[string]time.Time{
+		"old-1":  now.Add(-60 * 24 * time.Hour),
+		"old-2":  now.Add(-31 * 24 * time.Hour),
+		"recent": now.Add(-2 * 24 * time.Hour),
+	}
+	for id, ts := range backdated {
+		if _, err := c.db.Exec(`INSERT INTO routing_events (id, timestamp, selected_model) VALUES (?, ?, ?)`,
+			id, ts.Format(timestampLayout), "claude-sonnet"); err != nil {
+			t.Fatalf("failed to insert %s: %v", id, err)
+		}
+	}
+	if err := c.RecordRouting(RoutingEvent{ID: "now", SelectedModel: "claude-sonnet"}); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+
+	removed, err := c.Prune(now.Add(-30 * 24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 events removed, got %d", removed)
+	}
+
+	rows, err := c.db.Query(`SELECT id FROM routing_events ORDER BY id`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	var remaining []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		remaining = append(remaining, id)
+	}
+	if strings.Join(remaining, ",") != "now,recent" {
+		t.Errorf("remaining events = %v, want [now recent]", remaining)
+	}
+}
+
+func TestRecordFeedbackUnknownEvent(t *testing.T) {
+	c, err := NewCollector(filepath.Join(t.TempDir(), "feedback.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.RecordFeedback("missing", 3, ""); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("got %v, want ErrEventNotFound", err)
+	}
+	// A missing event is the caller's mistake, not a failed write.
+	if err := c.CheckWritable(); err != nil {
+		t.Errorf("CheckWritable after unknown feedback: %v", err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	c, err := NewCollector(filepath.Join(t.TempDir(), "health.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+
+	if err := c.CheckWritable(); err != nil {
+		t.Fatalf("open collector: unexpected error: %v", err)
+	}
+
+	// The check only reads, so a write transaction held elsewhere does not
+	// make it fail.
+	tx, err := c.db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO routing_events (id) VALUES ('pending')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := c.CheckWritable(); err != nil {
+		t.Errorf("during another write: unexpected error: %v", err)
+	}
+	tx.Rollback() //nolint:errcheck
+
+	// A failed recording write is reported until a later write succeeds.
+	if _, err := c.db.Exec(`CREATE TRIGGER reject BEFORE INSERT ON routing_events
+		BEGIN SELECT RAISE(FAIL, 'rejected'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	if err := c.RecordRouting(RoutingEvent{ID: "a"}); err == nil {
+		t.Fatal("expected the insert to fail")
+	}
+	if err := c.CheckWritable(); err == nil {
+		t.Error("after a failed write: expected an error")
+	}
+	if _, err := c.db.Exec(`DROP TRIGGER reject`); err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if err := c.RecordRouting(RoutingEvent{ID: "b"}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := c.CheckWritable(); err != nil {
+		t.Errorf("after a successful write: unexpected error: %v", err)
+	}
+
+	c.Close()
+	if err := c.CheckWritable(); err == nil {
+		t.Error("closed collector: expected an error")
+	}
+}
+
+func TestNewCollectorAddsMissingColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	// The routing_events schema from before cache token columns existed.
+	_, err = db.Exec(`CREATE TABLE routing_events (
+		id TEXT PRIMARY KEY,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		route_class TEXT,
+		task_type TEXT,
+		tier TEXT,
+		selected_model TEXT,
+		alternatives TEXT,
+		latency_ms INTEGER,
+		estimated_cost REAL,
+		failover_from TEXT,
+		user_rating INTEGER,
+		user_override TEXT
+	)`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	c, err := NewCollector(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open old database: %v", err)
+	}
+	defer c.Close()
+
+	err = c.RecordRouting(RoutingEvent{ID: "cached", SelectedModel: "claude-sonnet", CacheReadTokens: 900})
+	if err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+	var read int
+	if err := c.db.QueryRow(`SELECT cache_read_input_tokens FROM routing_events WHERE id = 'cached'`).Scan(&read); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if read != 900 {
+		t.Errorf("cache_read_input_tokens = %d, want 900", read)
+	}
+}
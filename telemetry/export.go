@@ -0,0 +1,224 @@
+package telemetry
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// exportColumns lists every routing_events column in export order.
+var exportColumns = []string{
+	"id", "timestamp", "route_class", "task_type", "tier", "selected_model",
+	"alternatives", "latency_ms", "estimated_cost", "input_tokens", "output_tokens",
+	"cache_creation_input_tokens", "cache_read_input_tokens", "shadow_of",
+	"shadow_status", "failover_from", "user_rating", "user_override",
+}
+
+// exportedEvent is the JSON shape of one exported row. Columns that were
+// never written (shadow_of, shadow_status, failover_from, user_rating,
+// user_override) are null.
+type exportedEvent struct {
+	ID            string    `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	RouteClass    string    `json:"route_class"`
+	TaskType      string    `json:"task_type"`
+	Tier          string    `json:"tier"`
+	SelectedModel string    `json:"selected_model"`
+	Alternatives  []string  `json:"alternatives"`
+	LatencyMs     int       `json:"latency_ms"`
+	EstimatedCost float64   `json:"estimated_cost"`
+	InputTokens   int       `json:"input_tokens"`
+	OutputTokens  int       `json:"output_tokens"`
+
+	CacheCreationTokens int `json:"cache_creation_input_tokens"`
+	CacheReadTokens     int `json:"cache_read_input_tokens"`
+
+	ShadowOf     *string `json:"shadow_of"`
+	ShadowStatus *int    `json:"shadow_status"`
+
+	FailoverFrom *string `json:"failover_from"`
+	UserRating   *int    `json:"user_rating"`
+	UserOverride *string `json:"user_override"`
+}
+
+// ExportEvents writes every routing event recorded at or after since (all
+// events when since is zero) to w, oldest first. format is "csv", which
+// writes a header row followed by one row per event with nulls as empty
+// fields, or "json", which writes a JSON array of objects. Rows are streamed
+// from the database rather than loaded into memory.
+func (c *Collector) ExportEvents(w io.Writer, format string, since time.Time) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format %q (want csv or json)", format)
+	}
+
+	query := `SELECT id, timestamp, route_class, task_type, tier, selected_model,
+		alternatives, latency_ms, estimated_cost, input_tokens, output_tokens, cache_creation_input_tokens,
+		cache_read_input_tokens, shadow_of, shadow_status, failover_from,
+		user_rating, user_override
+		FROM routing_events`
+	var args []interface{}
+	if !since.IsZero() {
+		// timestamp holds CURRENT_TIMESTAMP text in UTC, so compare against
+		// the same layout.
+		query += ` WHERE timestamp >= ?`
+		args = append(args, since.UTC().Format(timestampLayout))
+	}
+	query += ` ORDER BY timestamp, rowid`
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		err = exportCSV(w, rows)
+	} else {
+		err = exportJSON(w, rows)
+	}
+	if err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// scanExported reads the current row into an exportedEvent, also returning
+// the alternatives column as stored.
+func scanExported(rows *sql.Rows) (exportedEvent, string, error) {
+	var (
+		e                           exportedEvent
+		routeClass, taskType, tier  sql.NullString
+		selectedModel, alternatives sql.NullString
+		failoverFrom, userOverride  sql.NullString
+		shadowOf                    sql.NullString
+		latencyMs, userRating       sql.NullInt64
+		shadowStatus                sql.NullInt64
+		inputTokens, outputTokens   sql.NullInt64
+		cacheCreation, cacheRead    sql.NullInt64
+		estimatedCost               sql.NullFloat64
+	)
+	if err := rows.Scan(&e.ID, &e.Timestamp, &routeClass, &taskType, &tier, &selectedModel,
+		&alternatives, &latencyMs, &estimatedCost, &inputTokens, &outputTokens, &cacheCreation, &cacheRead, &shadowOf, &shadowStatus, &failoverFrom, &userRating, &userOverride); err != nil {
+		return e, "", err
+	}
+
+	e.RouteClass = routeClass.String
+	e.TaskType = taskType.String
+	e.Tier = tier.String
+	e.SelectedModel = selectedModel.String
+	e.LatencyMs = int(latencyMs.Int64)
+	e.EstimatedCost = estimatedCost.Float64
+	e.InputTokens = int(inputTokens.Int64)
+	e.OutputTokens = int(outputTokens.Int64)
+	e.CacheCreationTokens = int(cacheCreation.Int64)
+	e.CacheReadTokens = int(cacheRead.Int64)
+	if alternatives.Valid {
+		json.Unmarshal([]byte(alternatives.String), &e.Alternatives) //nolint:errcheck
+	}
+	if shadowOf.Valid {
+		e.ShadowOf = &shadowOf.String
+	}
+	if shadowStatus.Valid {
+		s := int(shadowStatus.Int64)
+		e.ShadowStatus = &s
+	}
+	if failoverFrom.Valid {
+		e.FailoverFrom = &failoverFrom.String
+	}
+	if userRating.Valid {
+		r := int(userRating.Int64)
+		e.UserRating = &r
+	}
+	if userOverride.Valid {
+		e.UserOverride = &userOverride.String
+	}
+	return e, alternatives.String, nil
+}
+
+func exportCSV(w io.Writer, rows *sql.Rows) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return err
+	}
+	for rows.Next() {
+		e, alternatives, err := scanExported(rows)
+		if err != nil {
+			return err
+		}
+		rating := ""
+		if e.UserRating != nil {
+			rating = strconv.Itoa(*e.UserRating)
+		}
+		shadowStatus := ""
+		if e.ShadowStatus != nil {
+			shadowStatus = strconv.Itoa(*e.ShadowStatus)
+		}
+		record := []string{
+			e.ID,
+			e.Timestamp.UTC().Format(time.RFC3339),
+			e.RouteClass,
+			e.TaskType,
+			e.Tier,
+			e.SelectedModel,
+			alternatives,
+			strconv.Itoa(e.LatencyMs),
+			strconv.FormatFloat(e.EstimatedCost, 'f', -1, 64),
+			strconv.Itoa(e.InputTokens),
+			strconv.Itoa(e.OutputTokens),
+			strconv.Itoa(e.CacheCreationTokens),
+			strconv.Itoa(e.CacheReadTokens),
+			derefString(e.ShadowOf),
+			shadowStatus,
+			derefString(e.FailoverFrom),
+			rating,
+			derefString(e.UserOverride),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportJSON(w io.Writer, rows *sql.Rows) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	for rows.Next() {
+		e, _, err := scanExported(rows)
+		if err != nil {
+			return err
+		}
+		e.Timestamp = e.Timestamp.UTC()
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if first {
+			sep = "\n"
+			first = false
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,160 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newExportCollector returns a collector holding two routing events, one of
+// which has failed over and received feedback.
+func newExportCollector(t *testing.T) *Collector {
+	t.Helper()
+	c, err := NewCollector(filepath.Join(t.TempDir(), "export.db"))
+	if err != nil {
+		t.Fatalf("failed to create collector: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	events := []RoutingEvent{
+		{ID: "evt-1", RouteClass: "interactive", TaskType: "code", Tier: "premium",
+			SelectedModel: "claude-sonnet", Alternatives: []string{"claude-opus"}, LatencyMs: 1200, EstimatedCost: 0.015,
+			CacheCreationTokens: 2048, CacheReadTokens: 512},
+		{ID: "evt-2", RouteClass: "background", TaskType: "summarization", Tier: "budget",
+			SelectedModel: "minimax-m2", LatencyMs: 300, EstimatedCost: 0.001},
+	}
+	for _, e := range events {
+		if err := c.RecordRouting(e); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+	if err := c.RecordFailover("evt-2", "minimax-m2", "ollama/llama3.2"); err != nil {
+		t.Fatalf("failed to record failover: %v", err)
+	}
+	if err := c.RecordFeedback("evt-2", 4, "claude-sonnet"); err != nil {
+		t.Fatalf("failed to record feedback: %v", err)
+	}
+	return c
+}
+
+func TestExportEventsCSV(t *testing.T) {
+	c := newExportCollector(t)
+
+	var buf bytes.Buffer
+	if err := c.ExportEvents(&buf, "csv", time.Time{}); err != nil {
+		t.Fatalf("ExportEvents: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d records", len(records))
+	}
+	if got := len(records[0]); got != len(exportColumns) {
+		t.Errorf("header has %d columns, want %d", got, len(exportColumns))
+	}
+
+	row := make(map[string]string)
+	for i, col := range records[0] {
+		row[col] = records[2][i]
+	}
+	want := map[string]string{
+		"id":             "evt-2",
+		"selected_model": "ollama/llama3.2",
+		"failover_from":  "minimax-m2",
+		"user_rating":    "4",
+		"user_override":  "claude-sonnet",
+		"latency_ms":     "300",
+		"estimated_cost": "0.001",
+	}
+	for col, v := range want {
+		if row[col] != v {
+			t.Errorf("column %s = %q, want %q", col, row[col], v)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, row["timestamp"]); err != nil {
+		t.Errorf("timestamp %q is not RFC 3339: %v", row["timestamp"], err)
+	}
+	if records[1][len(exportColumns)-2] != "" {
+		t.Errorf("unrated event has user_rating %q, want empty", records[1][len(exportColumns)-2])
+	}
+}
+
+func TestExportEventsJSON(t *testing.T) {
+	c := newExportCollector(t)
+
+	var buf bytes.Buffer
+	if err := c.ExportEvents(&buf, "json", time.Time{}); err != nil {
+		t.Fatalf("ExportEvents: %v", err)
+	}
+
+	var rows []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(rows))
+	}
+	for _, row := range rows {
+		for _, col := range exportColumns {
+			if _, ok := row[col]; !ok {
+				t.Errorf("event %v missing column %q", row["id"], col)
+			}
+		}
+	}
+
+	first := rows[0]
+	if first["id"] != "evt-1" || first["user_rating"] != nil || first["failover_from"] != nil {
+		t.Errorf("unexpected first event: %v", first)
+	}
+	if alts, _ := first["alternatives"].([]any); len(alts) != 1 || alts[0] != "claude-opus" {
+		t.Errorf("alternatives = %v, want [claude-opus]", first["alternatives"])
+	}
+	if first["cache_creation_input_tokens"] != float64(2048) || first["cache_read_input_tokens"] != float64(512) {
+		t.Errorf("cache tokens = %v/%v, want 2048/512",
+			first["cache_creation_input_tokens"], first["cache_read_input_tokens"])
+	}
+	if rows[1]["user_rating"] != float64(4) {
+		t.Errorf("user_rating = %v, want 4", rows[1]["user_rating"])
+	}
+}
+
+func TestExportEventsSince(t *testing.T) {
+	c := newExportCollector(t)
+
+	var buf bytes.Buffer
+	if err := c.ExportEvents(&buf, "json", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("ExportEvents: %v", err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected no events in the future, got %d", len(rows))
+	}
+
+	buf.Reset()
+	if err := c.ExportEvents(&buf, "csv", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("ExportEvents: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("expected header and 2 rows since an hour ago, got %d records", len(records))
+	}
+}
+
+func TestExportEventsUnknownFormat(t *testing.T) {
+	c := newExportCollector(t)
+	if err := c.ExportEvents(&bytes.Buffer{}, "xml", time.Time{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}